@@ -7,12 +7,17 @@ downstream HSV pipeline (which treats it as BGR, as the original code did).
 IMX219 on RACOON is mounted upside-down; 180° correction is applied in
 software (``frame_post.apply_orientation``), not via libcamera Transform,
 which is unreliable across Pi OS / Picamera2 versions.
+
+Exposure (``cameraExposure``, µs), analogue gain (``cameraGain``), auto
+exposure, white balance (``cameraColorGains`` as "red,blue" colour gains) and
+``fps`` are libcamera controls, applied at start and again when changed
+through the Go API (``apply_controls``).
 """
 
 from picamera2 import Picamera2
 
 from camera import debug
-from camera.frame_post import _flip180_enabled, postprocess_frame
+from camera.frame_post import _bool_setting, _flip180_enabled, postprocess_frame
 from camera.sensor import SENSOR_PROFILES
 
 # Fallback when the sensor model is unknown.
@@ -48,6 +53,36 @@ def _resolve_capture_size(settings, sensor_model):
     return _DEFAULT_CAPTURE_SIZE
 
 
+def _build_controls(settings):
+    """Returns the libcamera controls for the camera settings."""
+    controls = {}
+    exposure = settings.get("cameraExposure")
+    gain = settings.get("cameraGain")
+    auto = _bool_setting(settings, "cameraAutoExposure", "CAMERA_AUTO_EXPOSURE")
+    if auto or (exposure is None and gain is None):
+        controls["AeEnable"] = True
+    else:
+        controls["AeEnable"] = False
+        if exposure is not None:
+            controls["ExposureTime"] = int(exposure)
+        if gain is not None:
+            controls["AnalogueGain"] = float(gain)
+
+    gains = settings.get("cameraColorGains")
+    parts = [p.strip() for p in str(gains).split(",")] if gains is not None else []
+    if len(parts) == 2:
+        controls["AwbEnable"] = False
+        controls["ColourGains"] = (float(parts[0]), float(parts[1]))
+    else:
+        controls["AwbEnable"] = True
+
+    fps = settings.get("fps")
+    if fps:
+        frame_us = int(1_000_000 / float(fps))
+        controls["FrameDurationLimits"] = (frame_us, frame_us)
+    return controls
+
+
 class Pi4Capture:
     def __init__(self, settings=None):
         if settings is None:
@@ -72,6 +107,7 @@ class Pi4Capture:
         )
         self.cap.configure(config)
         self.cap.start()
+        self.apply_controls(settings)
 
         self._width = width
         self._height = height
@@ -81,6 +117,17 @@ class Pi4Capture:
             f"{self._width}x{self._height} flip180={flip}"
         )
 
+    def apply_controls(self, settings):
+        """Applies exposure, gain, white balance and frame rate live."""
+        controls = _build_controls(settings)
+        try:
+            self.cap.set_controls(controls)
+        except Exception as e:
+            debug.log(f"Warning: failed to set camera controls {controls}: {e}")
+            return False
+        debug.log(f"Camera controls set: {controls}")
+        return True
+
     def read(self):
         frame = self.cap.capture_array()
         if frame is None:
@@ -6,6 +6,10 @@ returns BGR frames, matching the downstream HSV pipeline.
 
 The device index can be overridden via the ``cameraDevice`` key in
 threshold.json (useful for USB cameras at /dev/video0, etc.).
+
+Exposure and gain are sensor controls (camera/sensor.py) and can be changed
+while capturing (``apply_controls``); white balance and flip are applied per
+frame in ``frame_post``. Resolution, fps and device need a reopen.
 """
 
 import cv2
@@ -53,6 +57,10 @@ class Rock5aCapture:
             f"target {width}x{height} @ {fps}fps"
         )
 
+    def apply_controls(self, settings):
+        """Re-applies the sensor exposure/gain controls."""
+        return configure_sensor(settings)
+
     def read(self):
         ok, frame = self.cap.read()
         if ok and frame is not None:
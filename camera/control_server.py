@@ -0,0 +1,251 @@
+"""Camera control channel: the request/response server driven by the Go API.
+
+Implements the protocol defined in internal/camctl (camctl.go, methods.go) on
+127.0.0.1:CONTROL_PORT. Every message is a frame of a 4-byte big-endian length
+followed by a UTF-8 JSON object:
+
+    request   {"id": 7, "method": "tuner.set", "params": {...}}
+    progress  {"id": 7, "progress": {"stage": "detect", "fraction": 0.4, "message": ""}}
+    result    {"id": 7, "result": {...}}
+    error     {"id": 7, "error": {"code": "not_found", "message": "...", "details": {...}}}
+
+Each request runs in its own thread and gets any number of progress frames
+followed by exactly one result or error. ``{"method": "cancel", "params":
+{"id": n}}`` marks request n of the same connection as cancelled: its next
+progress report raises ``ControlError("cancelled")``, so long handlers stop at
+their next checkpoint. Handlers are registered per method
+and receive ``(params, progress)``; they return a dict, raise
+:class:`ControlError`, or return the ``{"ok": False, "error": ..., "code": ...}``
+dicts used by the detector modules, which are converted to error frames (the
+remaining keys become ``details``).
+"""
+
+import json
+import os
+import socket
+import struct
+import threading
+
+import numpy as np
+
+from camera import debug
+from camera.settings import CONTROL_PORT
+
+# Keep in sync with camctl.MaxFrameSize and camctl.ProtocolVersion.
+MAX_FRAME_SIZE = 16 << 20
+PROTOCOL_VERSION = 1
+
+# Error codes (camctl.Code*).
+BAD_REQUEST = "bad_request"
+UNKNOWN_METHOD = "unknown_method"
+CAPTURE_FAILED = "capture_failed"
+NOT_FOUND = "not_found"
+UNAVAILABLE = "unavailable"
+FAILED = "failed"
+INTERNAL = "internal"
+CANCELLED = "cancelled"
+
+_HEADER = struct.Struct(">I")
+
+
+class ControlError(Exception):
+    """Error reply with a protocol error code."""
+
+    def __init__(self, code, message, details=None):
+        super().__init__(message)
+        self.code = code
+        self.message = message
+        self.details = details
+
+
+def _json_default(obj):
+    if isinstance(obj, (np.integer,)):
+        return int(obj)
+    if isinstance(obj, (np.floating,)):
+        return float(obj)
+    if isinstance(obj, np.ndarray):
+        return obj.tolist()
+    if isinstance(obj, (np.bool_,)):
+        return bool(obj)
+    raise TypeError(f"Object of type {type(obj).__name__} is not JSON serializable")
+
+
+def _recv_exact(conn, n):
+    buf = bytearray()
+    while len(buf) < n:
+        chunk = conn.recv(n - len(buf))
+        if not chunk:
+            return None
+        buf.extend(chunk)
+    return bytes(buf)
+
+
+def read_frame(conn):
+    """Reads one frame; returns None when the peer closed the connection."""
+    header = _recv_exact(conn, _HEADER.size)
+    if header is None:
+        return None
+    (size,) = _HEADER.unpack(header)
+    if size > MAX_FRAME_SIZE:
+        raise ControlError(BAD_REQUEST, f"frame of {size} bytes exceeds {MAX_FRAME_SIZE}")
+    data = _recv_exact(conn, size)
+    if data is None:
+        return None
+    return json.loads(data.decode("utf-8"))
+
+
+def encode_frame(message):
+    data = json.dumps(message, default=_json_default).encode("utf-8")
+    if len(data) > MAX_FRAME_SIZE:
+        raise ValueError(f"frame of {len(data)} bytes exceeds {MAX_FRAME_SIZE}")
+    return _HEADER.pack(len(data)) + data
+
+
+def _to_reply(result):
+    """Converts a handler return value to a result or raises ControlError."""
+    if result is None:
+        return {}
+    if not isinstance(result, dict) or "ok" not in result:
+        return result
+    result = dict(result)
+    ok = result.pop("ok")
+    if ok:
+        return result
+    message = result.pop("error", "failed")
+    code = result.pop("code", FAILED)
+    raise ControlError(code, message, result or None)
+
+
+class ControlServer(threading.Thread):
+    def __init__(self, handlers, host="127.0.0.1", port=CONTROL_PORT):
+        super().__init__(daemon=True)
+        self._handlers = dict(handlers)
+        self._handlers.setdefault("ping", self._ping)
+        self._host = host
+        self._port = port
+        self._ready = threading.Event()
+
+    def wait_ready(self, timeout=5.0):
+        return self._ready.wait(timeout)
+
+    @staticmethod
+    def _ping(_params, _progress):
+        return {"version": PROTOCOL_VERSION, "board": os.environ.get("RACOON_BOARD", "")}
+
+    def run(self):
+        sock = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+        sock.setsockopt(socket.SOL_SOCKET, socket.SO_REUSEADDR, 1)
+        try:
+            sock.bind((self._host, self._port))
+            sock.listen(4)
+        except OSError as e:
+            debug.log(f"[control] Failed to bind on {self._host}:{self._port}: {e}")
+            return
+
+        self._ready.set()
+        debug.log(f"[control] Control channel listening on {self._host}:{self._port}")
+
+        while True:
+            try:
+                conn, _ = sock.accept()
+            except OSError as e:
+                debug.log(f"[control] accept error: {e}")
+                continue
+            threading.Thread(target=self._serve, args=(conn,), daemon=True).start()
+
+    def _serve(self, conn):
+        write_lock = threading.Lock()
+
+        def send(message):
+            try:
+                frame = encode_frame(message)
+            except (TypeError, ValueError) as e:
+                frame = encode_frame(
+                    {"id": message.get("id"), "error": {"code": INTERNAL, "message": f"encode failed: {e}"}}
+                )
+            with write_lock:
+                conn.sendall(frame)
+
+        # Running requests of this connection: id -> cancel event.
+        active = {}
+        active_lock = threading.Lock()
+
+        with conn:
+            while True:
+                try:
+                    request = read_frame(conn)
+                except (OSError, ValueError, ControlError) as e:
+                    # A malformed frame desynchronizes the stream; drop it.
+                    debug.log(f"[control] read error: {e}")
+                    return
+                if request is None:
+                    return
+                if isinstance(request, dict) and request.get("method") == "cancel":
+                    params = request.get("params") or {}
+                    with active_lock:
+                        event = active.get(params.get("id")) if isinstance(params, dict) else None
+                    if event is not None:
+                        event.set()
+                    send({"id": request.get("id"), "result": {"cancelled": event is not None}})
+                    continue
+                event = threading.Event()
+                request_id = request.get("id") if isinstance(request, dict) else None
+                with active_lock:
+                    active[request_id] = event
+                threading.Thread(
+                    target=self._run, args=(request, send, event, active, active_lock), daemon=True
+                ).start()
+
+    def _run(self, request, send, cancelled, active, active_lock):
+        try:
+            self._handle(request, send, cancelled)
+        finally:
+            with active_lock:
+                active.pop(request.get("id") if isinstance(request, dict) else None, None)
+
+    def _handle(self, request, send, cancelled):
+        request_id = request.get("id") if isinstance(request, dict) else None
+
+        def progress(stage, fraction=0.0, message=""):
+            if cancelled.is_set():
+                raise ControlError(CANCELLED, "cancelled")
+            try:
+                send(
+                    {
+                        "id": request_id,
+                        "progress": {"stage": stage, "fraction": float(fraction), "message": message},
+                    }
+                )
+            except OSError:
+                pass
+
+        try:
+            if not isinstance(request, dict) or not isinstance(request.get("method"), str):
+                raise ControlError(BAD_REQUEST, "request needs an id and a method")
+            method = request["method"]
+            handler = self._handlers.get(method)
+            if handler is None:
+                raise ControlError(UNKNOWN_METHOD, f"unknown method: {method}")
+            params = request.get("params") or {}
+            if not isinstance(params, dict):
+                raise ControlError(BAD_REQUEST, "params must be an object")
+            try:
+                reply = {"id": request_id, "result": _to_reply(handler(params, progress))}
+            except (KeyError, TypeError, ValueError) as e:
+                raise ControlError(BAD_REQUEST, f"bad params: {e}")
+        except ControlError as e:
+            error = {"code": e.code, "message": e.message}
+            if e.details:
+                error["details"] = e.details
+            reply = {"id": request_id, "error": error}
+        except Exception as e:
+            if debug.enabled():
+                import traceback
+
+                traceback.print_exc()
+            reply = {"id": request_id, "error": {"code": INTERNAL, "message": str(e)}}
+
+        try:
+            send(reply)
+        except OSError as e:
+            debug.log(f"[control] send error: {e}")
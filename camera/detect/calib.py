@@ -10,6 +10,7 @@ calibration is actually requested, keeping the normal detection loop light.
 
 import base64
 import os
+import threading
 
 import cv2
 import numpy as np
@@ -30,6 +31,9 @@ S_MARGIN = 35
 V_MARGIN = 35
 
 _model = None
+# The YOLO model is shared with the object detector (camera/detect/objects.py);
+# inference is serialized with this lock.
+model_lock = threading.Lock()
 
 
 def _find_model():
@@ -40,7 +44,7 @@ def _find_model():
     return None
 
 
-def _load_model():
+def load_model():
     """Loads (and caches) the YOLO model. Returns None if unavailable."""
     global _model
     if _model is not None:
@@ -120,50 +124,59 @@ def _encode_preview(frame, bbox, points, quality=80):
     return base64.b64encode(encoded.tobytes()).decode("utf-8")
 
 
-def calibrate(frame, settings=None, conf=0.25):
+def calibrate(frame, settings=None, conf=0.25, progress=None):
     """Runs YOLO calibration on a BGR frame.
 
     Returns a dict: on success ``{"ok": True, "minThreshold", "maxThreshold",
     "ballDetectRadius", "bbox", "samplePoints", "previewFrame"}``; on failure
-    ``{"ok": False, "error": ...}``.
+    ``{"ok": False, "error": ..., "code": ...}`` with a camera control error
+    code. ``progress(stage, fraction)`` is called between the steps.
     """
     if settings is None:
         settings = {}
+    if progress is None:
+        progress = lambda stage, fraction=0.0, message="": None
 
     if frame is None or frame.size == 0:
-        return {"ok": False, "error": "empty frame"}
+        return {"ok": False, "error": "empty frame", "code": "capture_failed"}
 
-    model = _load_model()
+    progress("model", 0.1)
+    model = load_model()
     if model is None:
-        return {"ok": False, "error": "YOLO model unavailable"}
+        return {"ok": False, "error": "YOLO model unavailable", "code": "unavailable"}
 
     frame = np.ascontiguousarray(frame)
 
-    def _run_yolo(infer_conf):
-        return model(frame, conf=infer_conf, imgsz=640, verbose=False)
+    def _run_yolo(infer_conf, image=frame):
+        with model_lock:
+            return model(image, conf=infer_conf, imgsz=640, verbose=False)
 
+    progress("detect", 0.3)
     results = _run_yolo(conf)
     if not results or _best_box(results[0]) is None:
         # Retry with a lower threshold (small ball / wide FOV / colour cast).
+        progress("detect", 0.5, "retrying with a lower confidence")
         results = _run_yolo(max(0.08, conf * 0.5))
     if not results or _best_box(results[0]) is None:
         # Retry on a 180°-rotated copy when camera orientation is wrong.
+        progress("detect", 0.7, "retrying on the rotated frame")
         rotated = cv2.rotate(frame, cv2.ROTATE_180)
-        results = model(rotated, conf=max(0.08, conf * 0.5), imgsz=640, verbose=False)
+        results = _run_yolo(max(0.08, conf * 0.5), rotated)
         if results and _best_box(results[0]) is not None:
             frame = rotated
     if not results:
-        return {"ok": False, "error": "ball not detected"}
+        return {"ok": False, "error": "ball not detected", "code": "not_found"}
 
     box = _best_box(results[0])
     if box is None:
-        return {"ok": False, "error": "ball not detected"}
+        return {"ok": False, "error": "ball not detected", "code": "not_found"}
 
     x1, y1, x2, y2, detection_conf = box
     bbox = (x1, y1, x2, y2)
     if x2 <= x1 or y2 <= y1:
         return {"ok": False, "error": "invalid bounding box"}
 
+    progress("sample", 0.9)
     points = _sample_points(bbox, frame.shape)
 
     # Preprocess identically to the runtime HSV pipeline so calibrated
@@ -114,6 +114,27 @@ class BallDetector:
         self._missCount = 0
         self._fullFrameSearch = False
         self._fullFrameAfterMisses = int(settings.get("fullFrameAfterMisses", 3))
+        self._reset_stats()
+
+    def _reset_stats(self):
+        self._statFrames = 0
+        self._statContours = 0
+        self._statHits = 0
+        self._statCircularitySum = 0.0
+
+    def take_stats(self):
+        """Returns the detection statistics since the previous call and resets
+        them (control method ``detect.stats``, see internal/camctl)."""
+        contours = self._statContours
+        stats = {
+            "frames": self._statFrames,
+            "contours": contours,
+            "hits": self._statHits,
+            "circularity": self._statCircularitySum / contours if contours else 0.0,
+            "circularityThreshold": self._circularityThreshold,
+        }
+        self._reset_stats()
+        return stats
 
     def update_settings(self, settings):
         """Hot-reloads thresholds after a calibration run."""
@@ -142,6 +163,7 @@ class BallDetector:
         self._previousCenter = center
 
     def detect(self, frame):
+        self._statFrames += 1
         search_center = None if self._fullFrameSearch else self._previousCenter
         roi, offset, vertices = self._focus(frame, search_center)
         if roi.size == 0:
@@ -162,8 +184,12 @@ class BallDetector:
             return None, None, vertices, None
 
         bestContour = max(valid_contours, key=cv2.contourArea)
+        circularity = self._circularity(bestContour)
+        self._statContours += 1
+        self._statCircularitySum += circularity
 
-        if self._isCircular(bestContour):
+        if circularity > self._circularityThreshold:
+            self._statHits += 1
             (x, y), radius = cv2.minEnclosingCircle(bestContour)
             center = (int(x + offset[0]), int(y + offset[1]))
             circleContour = self._createCircleContour(
@@ -177,13 +203,13 @@ class BallDetector:
         self._register_miss()
         return None, None, vertices, None
 
-    def _isCircular(self, contour):
+    @staticmethod
+    def _circularity(contour):
         perimeter = cv2.arcLength(contour, True)
         area = cv2.contourArea(contour)
         if perimeter == 0 or area == 0:
-            return False
-        circularity = (4 * np.pi * area) / (perimeter**2)
-        return circularity > self._circularityThreshold
+            return 0.0
+        return float((4 * np.pi * area) / (perimeter**2))
 
     def _focus(self, frame, center):
         height, width = frame.shape[:2]
@@ -279,5 +305,25 @@ class Visualizer:
 
         return frame
 
+    # BGR box colour per object class (camera/transport/protocol.py).
+    _OBJECT_COLORS = {1: (255, 255, 0), 2: (0, 255, 255)}
+
+    def draw_objects(self, frame, objects):
+        """Draws the ObjectDetector results ((class, (x1, y1, x2, y2), conf))."""
+        for cls, (x1, y1, x2, y2), conf in objects:
+            color = self._OBJECT_COLORS.get(cls, (255, 255, 255))
+            p1 = (int(x1), int(y1))
+            cv2.rectangle(frame, p1, (int(x2), int(y2)), color, 2)
+            cv2.putText(
+                frame,
+                f"{conf:.2f}",
+                (p1[0], max(p1[1] - 4, 10)),
+                cv2.FONT_HERSHEY_SIMPLEX,
+                0.4,
+                color,
+                1,
+            )
+        return frame
+
     def destroy(self):
         pass
@@ -0,0 +1,110 @@
+"""Periodic YOLO detection of robots and goals.
+
+The HSV detector only finds the ball. When ``objectDetectIntervalSec`` in
+threshold.json is > 0, this runs the YOLO model from camera/detect/calib.py on
+the latest frame in a background thread and keeps the last result, which the
+main loop appends to every detection message. Balls found by YOLO are dropped;
+the HSV detector reports them every frame.
+
+Model class names are mapped by substring ("robot", "goal"), so both
+"robot"/"goal" and e.g. "blue_robot"/"yellow_goal" work.
+"""
+
+import threading
+import time
+
+import numpy as np
+
+from camera import debug
+from camera.detect.calib import load_model, model_lock
+from camera.transport import protocol
+
+_CLASS_KEYWORDS = (
+    ("robot", protocol.CLASS_ROBOT),
+    ("goal", protocol.CLASS_GOAL),
+)
+
+
+def _class_of(name):
+    name = str(name).lower()
+    for keyword, cls in _CLASS_KEYWORDS:
+        if keyword in name:
+            return cls
+    return None
+
+
+class ObjectDetector:
+    def __init__(self, interval, conf=0.3):
+        self.interval = float(interval)
+        self.conf = float(conf)
+        self._lock = threading.Lock()
+        self._frame = None
+        self._objects = []
+        self._updated = 0.0
+        self._thread = None
+
+    def enabled(self):
+        return self.interval > 0
+
+    def start(self):
+        if not self.enabled():
+            return
+        self._thread = threading.Thread(target=self._run, daemon=True)
+        self._thread.start()
+
+    def submit(self, frame):
+        """Offers the latest frame. Only the newest one is kept."""
+        if not self.enabled():
+            return
+        with self._lock:
+            self._frame = frame
+
+    def objects(self):
+        """Returns the last result as (class, (x1, y1, x2, y2), confidence).
+
+        Results older than three intervals are dropped so a stalled detector
+        does not keep reporting objects that have moved.
+        """
+        with self._lock:
+            if time.time() - self._updated > 3 * self.interval:
+                return []
+            return list(self._objects)
+
+    def _run(self):
+        model = load_model()
+        if model is None:
+            debug.log("[objects] YOLO model unavailable; object detection disabled")
+            return
+        names = getattr(model, "names", {}) or {}
+
+        while True:
+            started = time.time()
+            with self._lock:
+                frame, self._frame = self._frame, None
+            if frame is not None:
+                try:
+                    objects = self._detect(model, names, frame)
+                except Exception as e:
+                    debug.log(f"[objects] detection failed: {e}")
+                else:
+                    with self._lock:
+                        self._objects = objects
+                        self._updated = time.time()
+            time.sleep(max(0.0, self.interval - (time.time() - started)))
+
+    def _detect(self, model, names, frame):
+        with model_lock:
+            results = model(
+                np.ascontiguousarray(frame), conf=self.conf, imgsz=640, verbose=False
+            )
+        objects = []
+        if not results or results[0].boxes is None:
+            return objects
+        for box in results[0].boxes:
+            cls = _class_of(names.get(int(box.cls[0]), ""))
+            if cls is None:
+                continue
+            x1, y1, x2, y2 = (float(v) for v in box.xyxy[0])
+            objects.append((cls, (x1, y1, x2, y2), float(box.conf[0])))
+        objects.sort(key=lambda o: (o[0], -o[2]))
+        return objects
@@ -0,0 +1,188 @@
+"""Checkerboard camera calibration (intrinsics + camera-to-robot transform).
+
+Driven through the calib server by the Go API (/cameracalib). A session
+collects checkerboard views:
+
+1. ``reset(cols, rows, square_mm)`` starts a session for a board with
+   ``cols`` x ``rows`` inner corners.
+2. ``capture(frame)`` adds a view (move/tilt the board between captures).
+3. ``capture(frame, floor_pose)`` adds a view with the board lying flat on
+   the floor at a known pose relative to the robot; this view also fixes the
+   camera-to-robot transform.
+4. ``solve()`` runs ``cv2.calibrateCamera`` and ``cv2.solvePnP`` and writes
+   camera_calibration.json, which the Go side (internal/camgeom) loads.
+
+Robot coordinates: x forward, y left, z up, origin on the floor below the
+robot centre, millimetres. The floor pose is the robot coordinates of the
+board's first inner corner and the direction of the board's column axis
+(``yaw_deg``, 0 = robot forward, counter-clockwise positive), board face up.
+"""
+
+import json
+import math
+import os
+import threading
+import time
+
+import cv2
+import numpy as np
+
+from camera.detect.color import BallDetector
+
+CALIBRATION_FILENAME = "camera_calibration.json"
+
+MIN_FRAMES = 5
+BALL_RADIUS_MM = 21.5
+
+_CRITERIA = (cv2.TERM_CRITERIA_EPS + cv2.TERM_CRITERIA_MAX_ITER, 30, 0.001)
+
+
+def calibration_path():
+    """camera_calibration.json next to threshold.json (the Go working dir)."""
+    return os.path.join(os.getcwd(), CALIBRATION_FILENAME)
+
+
+def _board_to_robot(floor_pose):
+    """Returns (R, t) mapping board coordinates to robot coordinates."""
+    x_mm, y_mm, yaw_deg = floor_pose
+    c = math.cos(math.radians(yaw_deg))
+    s = math.sin(math.radians(yaw_deg))
+    # Board axes in robot coordinates: x along the columns, z into the floor
+    # (OpenCV board frame, face up), y = z cross x.
+    rotation = np.array(
+        [
+            [c, s, 0.0],
+            [s, -c, 0.0],
+            [0.0, 0.0, -1.0],
+        ]
+    )
+    return rotation, np.array([x_mm, y_mm, 0.0])
+
+
+class GeometryCalibrator:
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._reset_locked(9, 6, 25.0)
+
+    def _reset_locked(self, cols, rows, square_mm):
+        self.cols = int(cols)
+        self.rows = int(rows)
+        self.square_mm = float(square_mm)
+        self.image_size = None
+        self.image_points = []
+        self.floor_index = None
+        self.floor_pose = None
+        grid = np.zeros((self.rows * self.cols, 3), np.float32)
+        grid[:, :2] = np.mgrid[0 : self.cols, 0 : self.rows].T.reshape(-1, 2)
+        self.object_points = grid * self.square_mm
+
+    def reset(self, cols, rows, square_mm):
+        if int(cols) < 2 or int(rows) < 2 or float(square_mm) <= 0:
+            return {"ok": False, "error": "invalid board", "code": "bad_request"}
+        with self._lock:
+            self._reset_locked(cols, rows, square_mm)
+            return self._status_locked()
+
+    def status(self):
+        with self._lock:
+            return self._status_locked()
+
+    def _status_locked(self):
+        return {
+            "ok": True,
+            "board": {"cols": self.cols, "rows": self.rows, "squareMm": self.square_mm},
+            "frames": len(self.image_points),
+            "minFrames": MIN_FRAMES,
+            "floorPose": list(self.floor_pose) if self.floor_pose else None,
+        }
+
+    def capture(self, frame, floor_pose=None):
+        """Detects the board in a BGR frame and adds the view to the session."""
+        gray = cv2.cvtColor(frame, cv2.COLOR_BGR2GRAY)
+        pattern = (self.cols, self.rows)
+        found, corners = cv2.findChessboardCorners(
+            gray,
+            pattern,
+            cv2.CALIB_CB_ADAPTIVE_THRESH + cv2.CALIB_CB_NORMALIZE_IMAGE,
+        )
+        preview = frame.copy()
+        if found:
+            corners = cv2.cornerSubPix(gray, corners, (11, 11), (-1, -1), _CRITERIA)
+        cv2.drawChessboardCorners(preview, pattern, corners, found)
+
+        with self._lock:
+            size = (gray.shape[1], gray.shape[0])
+            if found and self.image_size not in (None, size):
+                return {"ok": False, "error": "frame size changed; reset the session"}
+            if found:
+                self.image_size = size
+                self.image_points.append(corners)
+                if floor_pose is not None:
+                    self.floor_index = len(self.image_points) - 1
+                    self.floor_pose = tuple(float(v) for v in floor_pose)
+            result = self._status_locked()
+
+        result["found"] = bool(found)
+        result["previewFrame"] = BallDetector.encode_jpeg_b64(preview)
+        if not found:
+            result["ok"] = False
+            result["error"] = "checkerboard not found"
+            result["code"] = "not_found"
+        return result
+
+    def solve(self, ball_radius_mm=BALL_RADIUS_MM, progress=None):
+        if progress is None:
+            progress = lambda stage, fraction=0.0, message="": None
+        with self._lock:
+            if len(self.image_points) < MIN_FRAMES:
+                return {
+                    "ok": False,
+                    "error": f"need at least {MIN_FRAMES} views ({len(self.image_points)} captured)",
+                }
+            if self.floor_index is None:
+                return {"ok": False, "error": "no floor view captured"}
+            image_points = list(self.image_points)
+            object_points = [self.object_points] * len(image_points)
+            image_size = self.image_size
+            floor_corners = image_points[self.floor_index]
+            floor_pose = self.floor_pose
+
+        progress("intrinsics", 0.1, f"{len(image_points)} views")
+        rms, camera_matrix, dist, _, _ = cv2.calibrateCamera(
+            object_points, image_points, image_size, None, None
+        )
+        progress("floor", 0.8)
+        ok, rvec, tvec = cv2.solvePnP(
+            self.object_points, floor_corners, camera_matrix, dist
+        )
+        if not ok:
+            return {"ok": False, "error": "floor pose could not be solved"}
+
+        # camera <- board from solvePnP, robot <- board from the floor pose.
+        cam_from_board, _ = cv2.Rodrigues(rvec)
+        robot_from_board, board_origin = _board_to_robot(floor_pose)
+        robot_from_cam = robot_from_board @ cam_from_board.T
+        cam_position = board_origin - robot_from_cam @ tvec.reshape(3)
+
+        calibration = {
+            "imageWidth": int(image_size[0]),
+            "imageHeight": int(image_size[1]),
+            "cameraMatrix": [float(v) for v in camera_matrix.reshape(-1)],
+            "distCoeffs": [float(v) for v in dist.reshape(-1)],
+            "rms": float(rms),
+            "frames": len(image_points),
+            "robotFromCamera": {
+                "rotation": [float(v) for v in robot_from_cam.reshape(-1)],
+                "translationMm": [float(v) for v in cam_position],
+            },
+            "ballRadiusMm": float(ball_radius_mm),
+            "createdAt": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()),
+        }
+
+        path = calibration_path()
+        tmp = path + ".tmp"
+        with open(tmp, "w") as f:
+            json.dump(calibration, f, indent=2)
+        os.replace(tmp, path)
+
+        return {"ok": True, "calibration": calibration}
@@ -1,8 +1,9 @@
 """Camera main loop with on-demand YOLO color calibration.
 
 Normal operation runs only the lightweight HSV + contour detector and publishes
-results over UDP. A background calibration server shares the same camera and,
-when triggered, runs YOLO once to recompute HSV thresholds.
+results over UDP. The control channel (camera/control_server.py) shares the
+same camera and serves the Go API: threshold tuning, capture settings and, when
+triggered, a one-shot YOLO run that recomputes the HSV thresholds.
 """
 
 import threading
@@ -11,25 +12,32 @@ import time
 import cv2
 
 from camera import debug
-from camera.calib_server import CalibServer
 from camera.capture.factory import create_capture
+from camera.control_server import CAPTURE_FAILED, UNAVAILABLE, ControlServer
 from camera.detect.calib import calibrate
 from camera.detect.color import BallDetector, Visualizer
+from camera.detect.objects import ObjectDetector
+from camera.geometry import GeometryCalibrator
 from camera.settings import load_settings, save_thresholds, threshold_to_string
 from camera.threshold_utils import arrays_to_strings, relax_arrays, strings_to_arrays
 from camera.transport.encoder import Encoder, NO_BALL_COORD
+from camera.transport.frame_server import FrameServer
 from camera.transport.udp_client import UDPClient
-from camera.tuner_server import TunerServer
+
+# threshold.json keys that need the capture device to be reopened.
+REOPEN_KEYS = ("frameWidth", "frameHeight", "fps", "cameraDevice")
 
 
 class CameraContext:
-    """Shared, lock-guarded state between the main loop and calib server."""
+    """Shared, lock-guarded state between the main loop and control server."""
 
     def __init__(self, capture, detector, settings):
         self.capture = capture
         self.detector = detector
         self.settings = settings
         self.lock = threading.Lock()
+        self.last_capture_time = 0.0
+        self.geometry = GeometryCalibrator()
 
     def read(self):
         with self.lock:
@@ -41,56 +49,86 @@ class CameraContext:
             ret, frame = self.capture.read()
             if not ret or frame is None:
                 return None, None, None, None, None
+            self.last_capture_time = time.time()
             frame = frame.copy()
             center, circle_contour, vertices, distance = self.detector.detect(frame)
             return frame, center, circle_contour, vertices, distance
 
-    def run_calibration(self):
-        """Captures a frame, calibrates, persists, and hot-reloads the detector.
+    def run_calibration(self, progress=None, apply=True):
+        """Captures a frame and calibrates; with ``apply`` the thresholds are
+        persisted and the detector hot-reloaded, otherwise only proposed.
 
-        Returns a JSON-serializable dict for the calib server to send back.
+        Returns a JSON-serializable dict for the control server to send back.
         """
         with self.lock:
             ret, frame = self.capture.read()
 
         if not ret or frame is None:
-            return {"ok": False, "error": "failed to capture frame"}
+            return {"ok": False, "error": "failed to capture frame", "code": CAPTURE_FAILED}
 
-        result = calibrate(frame, self.settings)
+        result = calibrate(frame, self.settings, progress=progress)
         if not result.get("ok"):
-            return {"ok": False, "error": result.get("error", "calibration failed")}
+            return {
+                "ok": False,
+                "error": result.get("error", "calibration failed"),
+                "code": result.get("code", "failed"),
+            }
 
         min_threshold = result["minThreshold"]
         max_threshold = result["maxThreshold"]
         ball_detect_radius = result["ballDetectRadius"]
         circularity_threshold = float(self.settings.get("circularityThreshold", 0.2))
 
-        save_thresholds(
-            min_threshold, max_threshold, ball_detect_radius, circularity_threshold
-        )
+        if apply:
+            save_thresholds(
+                min_threshold, max_threshold, ball_detect_radius, circularity_threshold
+            )
 
-        # Update parsed settings and hot-reload the detector under the lock.
-        self.settings["minThreshold"] = min_threshold
-        self.settings["maxThreshold"] = max_threshold
-        self.settings["ballDetectRadius"] = ball_detect_radius
-        with self.lock:
-            self.detector.update_settings(self.settings)
+            # Update parsed settings and hot-reload the detector under the lock.
+            self.settings["minThreshold"] = min_threshold
+            self.settings["maxThreshold"] = max_threshold
+            self.settings["ballDetectRadius"] = ball_detect_radius
+            with self.lock:
+                self.detector.update_settings(self.settings)
 
         return {
             "ok": True,
+            "applied": bool(apply),
             "minThreshold": threshold_to_string(min_threshold),
             "maxThreshold": threshold_to_string(max_threshold),
             "ballDetectRadius": int(ball_detect_radius),
+            "circularityThreshold": circularity_threshold,
             "bbox": result["bbox"],
             "confidence": result.get("confidence"),
             "samplePoints": result["samplePoints"],
             "previewFrame": result.get("previewFrame"),
         }
 
+    def run_geometry(self, method, params, progress=None):
+        """Handles a checkerboard calibration request (see camera/geometry.py)."""
+        if method == "geom.status":
+            return self.geometry.status()
+        if method == "geom.reset":
+            return self.geometry.reset(
+                int(params["cols"]), int(params["rows"]), float(params["squareMm"])
+            )
+        if method == "geom.solve":
+            return self.geometry.solve(progress=progress)
+        # geom.capture; a floor pose marks the view of the board on the floor.
+        floor_pose = params.get("floorPose")
+        if floor_pose is not None:
+            if len(floor_pose) != 3:
+                raise ValueError("floorPose needs [xMm, yMm, yawDeg]")
+            floor_pose = tuple(float(v) for v in floor_pose)
+        ret, frame = self.read()
+        if not ret or frame is None:
+            return {"ok": False, "error": "failed to capture frame", "code": CAPTURE_FAILED}
+        return self.geometry.capture(frame, floor_pose)
+
     def run_preview(self):
         frame, center, circle_contour, vertices, _distance = self.capture_detect()
         if frame is None:
-            return {"ok": False, "error": "failed to capture frame"}
+            return {"ok": False, "error": "failed to capture frame", "code": CAPTURE_FAILED}
 
         overlay = self.detector.build_mask_overlay(frame)
         annotated = Visualizer().draw(frame, center, circle_contour, vertices)
@@ -151,6 +189,58 @@ class CameraContext:
             "circularityThreshold": float(circularity_threshold),
         }
 
+    def apply_camera(self, values):
+        """Hot-applies capture settings from the Go API.
+
+        ``values`` maps threshold.json camera keys to their new value (None for
+        the default). Exposure, gain, white balance and flip are applied to the
+        running capture; a resolution, fps or device change reopens it. When
+        reopening fails the previous settings are restored.
+        """
+        with self.lock:
+            previous = {key: self.settings.get(key) for key in values}
+            reopen = any(previous[key] != values.get(key) for key in REOPEN_KEYS if key in values)
+            self._update_settings(values)
+            if not reopen:
+                apply_controls = getattr(self.capture, "apply_controls", None)
+                if apply_controls is not None:
+                    apply_controls(self.settings)
+                return {"ok": True, "reopened": False}
+
+            self.capture.release()
+            try:
+                self.capture = create_capture(self.settings)
+            except Exception as e:
+                debug.log(f"[camera] reopen with new settings failed: {e}")
+                self._update_settings(previous)
+                self.capture = create_capture(self.settings)
+                return {"ok": False, "error": f"camera reopen failed: {e}", "code": UNAVAILABLE}
+            return {"ok": True, "reopened": True}
+
+    def _update_settings(self, values):
+        for key, value in values.items():
+            if value is None:
+                self.settings.pop(key, None)
+            else:
+                self.settings[key] = value
+
+    def capture_frame(self):
+        """Raw frame for the possession training samples (internal/possession)."""
+        ret, frame = self.read()
+        if not ret or frame is None:
+            return {"ok": False, "error": "failed to capture frame", "code": CAPTURE_FAILED}
+        frame_h, frame_w = frame.shape[:2]
+        return {
+            "ok": True,
+            "frame": BallDetector.encode_jpeg_b64(frame, quality=90, max_width=frame_w),
+            "width": int(frame_w),
+            "height": int(frame_h),
+        }
+
+    def detect_stats(self):
+        with self.lock:
+            return self.detector.take_stats()
+
     def relax_thresholds(self, save=False):
         min_t, max_t = relax_arrays(
             self.settings["minThreshold"],
@@ -166,10 +256,42 @@ class CameraContext:
         )
 
 
+def control_handlers(context):
+    """Maps the control channel methods (internal/camctl) to the context."""
+
+    def geometry(method):
+        return lambda params, progress: context.run_geometry(method, params, progress)
+
+    return {
+        "tuner.preview": lambda params, progress: context.run_preview(),
+        "tuner.set": lambda params, progress: context.apply_thresholds(
+            str(params["minThreshold"]),
+            str(params["maxThreshold"]),
+            int(params["ballDetectRadius"]),
+            float(params["circularityThreshold"]),
+            bool(params.get("save", False)),
+        ),
+        "tuner.relax": lambda params, progress: context.relax_thresholds(
+            bool(params.get("save", False))
+        ),
+        "camera.apply": lambda params, progress: context.apply_camera(dict(params["values"])),
+        "calib.color": lambda params, progress: context.run_calibration(
+            progress, bool(params.get("apply", True))
+        ),
+        "detect.stats": lambda params, progress: context.detect_stats(),
+        "frame.capture": lambda params, progress: context.capture_frame(),
+        "geom.status": geometry("geom.status"),
+        "geom.reset": geometry("geom.reset"),
+        "geom.capture": geometry("geom.capture"),
+        "geom.solve": geometry("geom.solve"),
+    }
+
+
 def main():
     settings = load_settings()
 
     capture = None
+    context = None
     udpClient = None
     visualizer = None
 
@@ -181,22 +303,25 @@ def main():
 
         context = CameraContext(capture, ballDetector, settings)
 
-        calib_server = CalibServer(context.run_calibration)
-        calib_server.start()
+        control_server = ControlServer(control_handlers(context))
+        control_server.start()
+        if not control_server.wait_ready(5.0):
+            debug.log("[control] server did not become ready in time")
+
+        frame_server = FrameServer()
+        frame_server.start()
 
-        tuner_server = TunerServer(
-            context.run_preview,
-            context.apply_thresholds,
-            context.relax_thresholds,
+        object_detector = ObjectDetector(
+            settings.get("objectDetectIntervalSec", 0),
+            settings.get("objectDetectConfidence", 0.3),
         )
-        tuner_server.start()
-        if not tuner_server.wait_ready(5.0):
-            debug.log("[tuner] server did not become ready in time")
+        object_detector.start()
 
         output_width = int(settings.get("outputFrameWidth", 160))
         output_height = int(settings.get("outputFrameHeight", 96))
         jpeg_quality = int(settings.get("jpegQuality", 90))
 
+        seq = 0
         while True:
             frame, center, circleContour, vertices, distance = context.capture_detect()
             if frame is None:
@@ -204,31 +329,47 @@ def main():
                 time.sleep(0.5)
                 continue
 
+            seq = (seq + 1) & 0xFFFFFFFF
             frame_height, frame_width = frame.shape[:2]
+            balls = []
             if center is not None:
                 graph_x, graph_y = Encoder.pixel_to_graph(
                     center[0], center[1], frame_width, frame_height
                 )
                 debug.log(graph_x, graph_y, distance)
+                _, radius = cv2.minEnclosingCircle(circleContour)
+                balls.append((center, radius))
             else:
                 debug.log(NO_BALL_COORD, NO_BALL_COORD)
 
+            object_detector.submit(frame)
+            udpClient.send(
+                Encoder.encode_detections(
+                    seq,
+                    context.last_capture_time,
+                    frame_width,
+                    frame_height,
+                    balls,
+                    object_detector.objects(),
+                )
+            )
+
+            if not frame_server.wants_frame():
+                continue
+
             frame = visualizer.draw(frame, center, circleContour, vertices)
+            visualizer.draw_objects(frame, object_detector.objects())
 
-            frame_resized = cv2.resize(
-                frame, (output_width, output_height), interpolation=cv2.INTER_AREA
+            width, height, quality = frame_server.frame_params(
+                output_width, output_height, jpeg_quality
             )
-
-            encoded_json_string = Encoder.encodeData(
-                frame_resized,
-                center,
-                frame_width=frame_width,
-                frame_height=frame_height,
-                quality=jpeg_quality,
+            frame_resized = cv2.resize(
+                frame, (width, height), interpolation=cv2.INTER_AREA
             )
 
-            if encoded_json_string:
-                udpClient.send(encoded_json_string)
+            jpeg = Encoder.encode_jpeg(frame_resized, quality=quality)
+            if jpeg:
+                frame_server.send(seq, jpeg)
 
     except IOError as e:
         debug.log(f"Initialization Error: {e}")
@@ -242,6 +383,9 @@ def main():
             traceback.print_exc()
     finally:
         debug.log("Cleaning up resources...")
+        if context is not None:
+            # apply_camera may have reopened the capture.
+            capture = context.capture
         if capture is not None:
             capture.release()
         if udpClient is not None:
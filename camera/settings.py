@@ -1,13 +1,17 @@
 """Settings loading/saving for the camera package.
 
-The threshold configuration is shared with the Go side, which reads and writes
-``threshold.json`` (see internal/mw/mw.go). HSV thresholds are stored as
-comma-separated strings (e.g. "1,115,90") in that file, so they are parsed into
-numpy arrays here.
+The threshold configuration is shared with the Go side, which owns the schema
+of ``threshold.json`` (see internal/thresholds): HSV thresholds are stored as
+comma-separated strings (e.g. "1,115,90", H 0-179 and S/V 0-255) and parsed
+into numpy arrays here, and the file carries a ``version`` key. The Go side
+records every change in threshold_history.json.
 """
 
+import contextlib
+import fcntl
 import json
 import os
+import tempfile
 
 import numpy as np
 
@@ -15,12 +19,19 @@ from camera import debug
 
 # UDP port the camera publishes detection results to (consumed by Go receive).
 UDP_CAMERA_PORT = 31133
-# TCP port the calibration server listens on (driven by Go /calibballcolor).
-CALIB_PORT = 31134
-# TCP port for live threshold preview/tuning (Go /color-tuner UI).
-TUNER_PORT = 31135
+# UDP port for opt-in JPEG frames (see camera/transport/frame_server.py).
+FRAME_PORT = 31136
+# TCP port of the control channel (camera/control_server.py, Go internal/camctl).
+CONTROL_PORT = 31137
 
 CONFIG_FILENAME = "threshold.json"
+# flock'ed around every read-modify-write of threshold.json, here and on the
+# Go side (thresholds.LockFile), so neither loses the other's keys.
+LOCK_SUFFIX = ".lock"
+# Keep in sync with thresholds.SchemaVersion on the Go side.
+SCHEMA_VERSION = 1
+
+HSV_MAX = (179, 255, 255)
 
 _PACKAGE_DIR = os.path.dirname(os.path.abspath(__file__))
 _REPO_ROOT = os.path.dirname(_PACKAGE_DIR)
@@ -49,25 +60,27 @@ def parse_threshold(value, default):
     """Parses an HSV threshold into a uint8 numpy array.
 
     Accepts the Go comma-separated string form ("1,115,90"), a JSON list, or a
-    numpy array. Returns ``default`` when the value is missing or invalid.
+    numpy array. Returns ``default`` when the value is missing or invalid
+    (same rules as thresholds.ParseHSV on the Go side).
     """
     if value is None:
         return default
-    if isinstance(value, np.ndarray):
-        return value.astype(np.uint8)
     if isinstance(value, str):
-        try:
-            parts = [int(x.strip()) for x in value.split(",") if x.strip() != ""]
-        except ValueError:
-            return default
-        if len(parts) != 3:
-            return default
-        return np.array(parts, dtype=np.uint8)
-    if isinstance(value, (list, tuple)):
-        if len(value) != 3:
-            return default
-        return np.array(value, dtype=np.uint8)
-    return default
+        parts = value.split(",")
+    elif isinstance(value, (list, tuple, np.ndarray)):
+        parts = list(value)
+    else:
+        return default
+    if len(parts) != 3:
+        return default
+    try:
+        parts = [int(str(x).strip()) for x in parts]
+    except ValueError:
+        return default
+    if any(v < 0 or v > limit for v, limit in zip(parts, HSV_MAX)):
+        debug.log(f"Invalid HSV threshold {value!r}; using default")
+        return default
+    return np.array(parts, dtype=np.uint8)
 
 
 def load_settings():
@@ -116,6 +129,34 @@ def threshold_to_string(arr):
     return ",".join(str(int(v)) for v in arr)
 
 
+@contextlib.contextmanager
+def _locked(path):
+    with open(path + LOCK_SUFFIX, "a") as lock:
+        fcntl.flock(lock, fcntl.LOCK_EX)
+        try:
+            yield
+        finally:
+            fcntl.flock(lock, fcntl.LOCK_UN)
+
+
+def _write_atomic(path, data):
+    """Replaces path through a unique temporary file in the same directory."""
+    fd, tmp = tempfile.mkstemp(
+        prefix="." + os.path.basename(path) + ".", dir=os.path.dirname(path) or "."
+    )
+    try:
+        with os.fdopen(fd, "w") as f:
+            json.dump(data, f)
+            f.flush()
+            os.fsync(f.fileno())
+        os.chmod(tmp, 0o644)
+        os.replace(tmp, path)
+    except BaseException:
+        with contextlib.suppress(OSError):
+            os.remove(tmp)
+        raise
+
+
 def save_thresholds(min_threshold, max_threshold, ball_detect_radius, circularity_threshold):
     """Writes the threshold config back to threshold.json (Go-compatible form).
 
@@ -124,25 +165,27 @@ def save_thresholds(min_threshold, max_threshold, ball_detect_radius, circularit
     """
     path = config_path()
 
-    data = {}
-    if os.path.exists(path):
-        try:
-            with open(path, "r") as f:
-                data = json.load(f)
-        except Exception:
-            data = {}
-
     if not isinstance(min_threshold, str):
         min_threshold = threshold_to_string(min_threshold)
     if not isinstance(max_threshold, str):
         max_threshold = threshold_to_string(max_threshold)
 
-    data["minThreshold"] = min_threshold
-    data["maxThreshold"] = max_threshold
-    data["ballDetectRadius"] = int(ball_detect_radius)
-    data["circularityThreshold"] = float(circularity_threshold)
-
-    with open(path, "w") as f:
-        json.dump(data, f)
+    with _locked(path):
+        data = {}
+        if os.path.exists(path):
+            try:
+                with open(path, "r") as f:
+                    data = json.load(f)
+            except Exception:
+                data = {}
+
+        data["minThreshold"] = min_threshold
+        data["maxThreshold"] = max_threshold
+        data["ballDetectRadius"] = int(ball_detect_radius)
+        data["circularityThreshold"] = float(circularity_threshold)
+        data["version"] = SCHEMA_VERSION
+
+        # Write atomically so the Go side never reads a partial file.
+        _write_atomic(path, data)
 
     return data
@@ -1,16 +1,14 @@
-"""Encodes detection results into the JSON payload consumed by the Go side.
+"""Encodes detection results into the binary messages consumed by the Go side.
 
-The schema (frame/x/y/isball) matches internal/state/state.go ImageData.
+See camera/transport/protocol.py (and internal/camproto) for the layout.
 Coordinates use a graph-style system: origin at the frame center, x right,
 y up (positive y is above the center).
 """
 
-import base64
-import json
-
 import cv2
 
 from camera import debug
+from camera.transport import protocol
 
 NO_BALL_COORD = 9999
 
@@ -25,13 +23,35 @@ class Encoder:
         )
 
     @staticmethod
-    def encodeData(
-        frame,
-        center=None,
-        frame_width=None,
-        frame_height=None,
-        quality=90,
+    def encode_detections(
+        seq, capture_time, frame_width, frame_height, balls, objects=()
     ):
+        """Packs one frame's detections.
+
+        ``balls`` are HSV ball detections given as (pixel center, radius) pairs,
+        best first. ``objects`` are extra detections given as
+        (class, (x1, y1, x2, y2) pixel box, confidence), e.g. from
+        camera/detect/objects.py.
+        """
+        detections = []
+        for center, radius in balls:
+            x, y = Encoder.pixel_to_graph(
+                center[0], center[1], frame_width, frame_height
+            )
+            detections.append(protocol.Detection(x, y, 2 * radius, 2 * radius))
+        for cls, (x1, y1, x2, y2), confidence in objects:
+            x, y = Encoder.pixel_to_graph(
+                (x1 + x2) / 2.0, (y1 + y2) / 2.0, frame_width, frame_height
+            )
+            detections.append(
+                protocol.Detection(x, y, x2 - x1, y2 - y1, confidence, cls)
+            )
+        return protocol.pack_detections(
+            seq, capture_time, frame_width, frame_height, detections
+        )
+
+    @staticmethod
+    def encode_jpeg(frame, quality=90):
         if frame is None or frame.size == 0:
             debug.log("Error: Cannot encode empty frame.")
             return None
@@ -42,33 +62,4 @@ class Encoder:
         if not result:
             debug.log("Error: Failed to encode image to JPEG.")
             return None
-
-        frame_bytes_b64 = base64.b64encode(encoded_image.tobytes()).decode("utf-8")
-
-        if frame_width is None or frame_height is None:
-            frame_height, frame_width = frame.shape[:2]
-
-        if center is not None:
-            x_coord, y_coord = Encoder.pixel_to_graph(
-                center[0], center[1], frame_width, frame_height
-            )
-            isball = True
-        else:
-            x_coord = NO_BALL_COORD
-            y_coord = NO_BALL_COORD
-            isball = False
-
-        data = {
-            "frame": frame_bytes_b64,
-            "x": x_coord,
-            "y": y_coord,
-            "isball": isball,
-            "frameWidth": int(frame_width),
-            "frameHeight": int(frame_height),
-        }
-
-        try:
-            return json.dumps(data)
-        except TypeError as e:
-            debug.log(f"Error serializing data to JSON: {e}")
-            return None
+        return encoded_image.tobytes()
@@ -0,0 +1,81 @@
+"""Opt-in JPEG frame channel.
+
+The Go side sends ``SUB`` datagrams while a viewer is connected; frames are
+only encoded and sent while that lease is valid, so the detection loop does not
+pay for JPEG encoding when nobody is watching. The subscription may ask for a
+frame size, quality and maximum rate; frames above that rate are not encoded.
+"""
+
+import socket
+import threading
+import time
+
+from camera import debug
+from camera.settings import FRAME_PORT
+from camera.transport import protocol
+
+
+class FrameServer(threading.Thread):
+    def __init__(self, host="127.0.0.1", port=FRAME_PORT):
+        super().__init__(daemon=True)
+        self._host = host
+        self._port = port
+        self._lock = threading.Lock()
+        self._subscriber = None
+        self._expires = 0.0
+        self._request = protocol.FrameRequest()
+        self._last_sent = 0.0
+        self._socket = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+
+    def run(self):
+        try:
+            self._socket.bind((self._host, self._port))
+        except OSError as e:
+            debug.log(f"[frame] Failed to bind on {self._host}:{self._port}: {e}")
+            return
+        debug.log(f"[frame] Frame channel listening on {self._host}:{self._port}")
+
+        while True:
+            try:
+                data, addr = self._socket.recvfrom(64)
+            except OSError as e:
+                debug.log(f"[frame] recv error: {e}")
+                continue
+            request = protocol.parse_subscribe(data)
+            if request is None:
+                continue
+            with self._lock:
+                self._subscriber = addr
+                self._expires = time.monotonic() + protocol.FRAME_LEASE
+                self._request = request
+
+    def wants_frame(self):
+        """True when a subscriber is waiting and its rate allows a frame now."""
+        now = time.monotonic()
+        with self._lock:
+            if self._subscriber is None or now >= self._expires:
+                return False
+            fps = self._request.fps
+            if fps > 0 and now - self._last_sent < 1.0 / fps:
+                return False
+            self._last_sent = now
+            return True
+
+    def frame_params(self, width, height, quality):
+        """Returns the requested (width, height, quality), defaulting to the
+        given values for fields the subscriber left at 0."""
+        with self._lock:
+            r = self._request
+        return (r.width or width, r.height or height, min(r.quality or quality, 100))
+
+    def send(self, seq, jpeg):
+        with self._lock:
+            addr = self._subscriber
+        if addr is None:
+            return
+        for chunk in protocol.pack_frame_chunks(seq, jpeg):
+            try:
+                self._socket.sendto(chunk, addr)
+            except OSError as e:
+                debug.log(f"[frame] send error: {e}")
+                return
@@ -0,0 +1,129 @@
+"""Binary camera protocol shared with the Go side (internal/camproto).
+
+All integers are little endian. Every datagram starts with an 8-byte header::
+
+    magic "RC" | version u8 (2) | kind u8 | seq u32
+
+Detections (kind 1, UDP 31133, every frame)::
+
+    capture_us u64 | width u16 | height u16 | count u8
+    count x (class u8, flags u8, x f32, y f32, width f32, height f32,
+             confidence f32)
+
+x/y is the bounding box centre in graph coordinates (origin at the frame
+centre, y up), width/height the box size in pixels. Detections of each class
+are ordered best first.
+
+Frame chunks (kind 2, UDP 31136, only while subscribed)::
+
+    index u16 | count u16 | total u32 | JPEG bytes
+
+The Go side subscribes by sending ``SUB`` to the frame port; frames are sent
+back to the subscriber for ``FRAME_LEASE`` seconds after the last request.
+``SUB <width> <height> <fps> <quality>`` also asks for a frame size, a maximum
+rate and a JPEG quality; 0 keeps the camera default.
+"""
+
+import struct
+
+VERSION = 2
+KIND_DETECTIONS = 1
+KIND_FRAME_CHUNK = 2
+
+CLASS_BALL = 0
+CLASS_ROBOT = 1
+CLASS_GOAL = 2
+
+CHUNK_SIZE = 32 * 1024
+# Larger frames are rejected by the Go side (camproto.MaxFrameSize).
+MAX_FRAME_SIZE = 8 * 1024 * 1024
+MAX_DETECTIONS = 255
+FRAME_LEASE = 2.0
+SUBSCRIBE = b"SUB"
+
+_HEADER = struct.Struct("<2sBBI")
+_DETECTIONS = struct.Struct("<QHHB")
+_DETECTION = struct.Struct("<BBfffff")
+_CHUNK = struct.Struct("<HHI")
+
+
+class Detection:
+    __slots__ = ("cls", "x", "y", "width", "height", "confidence")
+
+    def __init__(self, x, y, width, height, confidence=1.0, cls=CLASS_BALL):
+        self.cls = cls
+        self.x = x
+        self.y = y
+        self.width = width
+        self.height = height
+        self.confidence = confidence
+
+
+class FrameRequest:
+    __slots__ = ("width", "height", "fps", "quality")
+
+    def __init__(self, width=0, height=0, fps=0, quality=0):
+        self.width = width
+        self.height = height
+        self.fps = fps
+        self.quality = quality
+
+
+def parse_subscribe(data):
+    """Returns the FrameRequest of a subscription datagram, None otherwise."""
+    parts = data.strip().split()
+    if not parts or parts[0] != SUBSCRIBE:
+        return None
+    if len(parts) == 1:
+        return FrameRequest()
+    if len(parts) != 5:
+        return None
+    try:
+        values = [max(0, int(p)) for p in parts[1:]]
+    except ValueError:
+        return None
+    return FrameRequest(*values)
+
+
+def _header(kind, seq):
+    return _HEADER.pack(b"RC", VERSION, kind, seq & 0xFFFFFFFF)
+
+
+def pack_detections(seq, capture_time, width, height, detections):
+    """Serializes one frame's detections. ``capture_time`` is Unix seconds."""
+    detections = list(detections)[:MAX_DETECTIONS]
+    parts = [
+        _header(KIND_DETECTIONS, seq),
+        _DETECTIONS.pack(
+            int(capture_time * 1e6), int(width), int(height), len(detections)
+        ),
+    ]
+    for d in detections:
+        parts.append(
+            _DETECTION.pack(
+                int(d.cls),
+                0,
+                float(d.x),
+                float(d.y),
+                float(d.width),
+                float(d.height),
+                float(d.confidence),
+            )
+        )
+    return b"".join(parts)
+
+
+def pack_frame_chunks(seq, jpeg):
+    """Splits JPEG bytes into frame chunk datagrams. A frame above
+    MAX_FRAME_SIZE yields none."""
+    total = len(jpeg)
+    if total > MAX_FRAME_SIZE:
+        return []
+    count = max(1, (total + CHUNK_SIZE - 1) // CHUNK_SIZE)
+    header = _header(KIND_FRAME_CHUNK, seq)
+    return [
+        header
+        + _CHUNK.pack(i, count, total)
+        + jpeg[i * CHUNK_SIZE : (i + 1) * CHUNK_SIZE]
+        for i in range(count)
+    ]
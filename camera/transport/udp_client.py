@@ -1,4 +1,4 @@
-"""UDP client that publishes detection JSON to the Go receiver."""
+"""UDP client that publishes detection messages to the Go receiver."""
 
 import socket
 
@@ -13,12 +13,14 @@ class UDPClient:
         self.socket = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
         debug.log(f"UDP Client initialized for {self.host}:{self.port}")
 
-    def send(self, data_json_string):
-        if not data_json_string:
+    def send(self, data):
+        if not data:
             debug.log("UDP Send Error: No data to send.")
             return False
+        if isinstance(data, str):
+            data = data.encode("utf-8")
         try:
-            self.socket.sendto(data_json_string.encode("utf-8"), (self.host, self.port))
+            self.socket.sendto(data, (self.host, self.port))
             return True
         except socket.error as e:
             debug.log(f"UDP Send Error: {e}")
@@ -1,9 +1,9 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
@@ -11,23 +11,42 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/autocalib"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/balltrack"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camframe"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camgeom"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camsup"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/connmgr"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/logring"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/mw"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/possession"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
 )
 
-var (
-	pythonCmd   *exec.Cmd
-	robotID     uint32
+const (
+	imageMaxAge     = 500 * time.Millisecond
+	imageWait       = time.Second
+	defaultLogLines = 200
 )
 
+var robotID uint32
+
 func Run(done <-chan struct{}, myID uint32) {
 	robotID = myID
 	if err := restartPythonProcess(); err != nil {
 		log.Printf("Pythonプロセス開始エラー（プログラムは継続します）: %v", err)
 	}
+	go camsup.Default.Run(done)
+	go autocalib.Default.Run(done, autoCalibActions)
+	go possession.DefaultRecorder.Run(done, camctl.Default.CaptureFrame)
 
 	listener, err := net.Listen("tcp", state.Port)
 	if err != nil {
@@ -48,12 +67,18 @@ func Run(done <-chan struct{}, myID uint32) {
 	}
 }
 
+var statusText = map[int]string{
+	200: "OK",
+	202: "Accepted",
+	400: "Bad Request",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	409: "Conflict",
+	500: "Internal Server Error",
+	503: "Service Unavailable",
+}
+
 func sendHTTPResponse(conn net.Conn, statusCode int, contentType string, body string) {
-	statusText := map[int]string{
-		200: "OK",
-		400: "Bad Request",
-		500: "Internal Server Error",
-	}
 	fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n", statusCode, statusText[statusCode])
 	fmt.Fprintf(conn, "Content-Type: %s; charset=utf-8\r\n", contentType)
 	fmt.Fprintf(conn, "Content-Length: %d\r\n", len(body))
@@ -62,10 +87,6 @@ func sendHTTPResponse(conn net.Conn, statusCode int, contentType string, body st
 }
 
 func sendErrorResponse(conn net.Conn, statusCode int) {
-	statusText := map[int]string{
-		400: "Bad Request",
-		500: "Internal Server Error",
-	}
 	body := fmt.Sprintf("%d %s\r\n", statusCode, statusText[statusCode])
 	sendHTTPResponse(conn, statusCode, "text/plain", body)
 }
@@ -89,11 +110,6 @@ func handleRequest(conn net.Conn) {
 	method := parts[0]
 	path := parts[1]
 
-	if method != "GET" {
-		sendErrorResponse(conn, 400)
-		return
-	}
-
 	pathParts := strings.Split(path, "/")
 	if len(pathParts) < 2 {
 		sendErrorResponse(conn, 400)
@@ -102,6 +118,24 @@ func handleRequest(conn net.Conn) {
 
 	endpoint := pathParts[1]
 
+	// Only the job endpoints take other methods; everything else is GET.
+	if endpoint == "calibrations" {
+		handleCalibrations(conn, method, pathParts)
+		return
+	}
+	if endpoint == "motorcalib" {
+		handleMotorCalib(conn, method, pathParts)
+		return
+	}
+	if endpoint == "selftest" {
+		handleSelfTest(conn, method, pathParts)
+		return
+	}
+	if method != "GET" {
+		sendErrorResponse(conn, 405)
+		return
+	}
+
 	switch endpoint {
 	case "buzzer":
 		handleBuzzer(conn, pathParts)
@@ -109,12 +143,20 @@ func handleRequest(conn net.Conn) {
 		handleIgnoreBatteryLow(conn)
 	case "image":
 		handleImage(conn)
+	case "stream.mjpeg":
+		handleStream(conn, pathParts)
 	case "updatepython":
 		handleUpdatePython(conn)
 	case "changeadjustment":
 		handleChangeAdjustment(conn, pathParts)
 	case "calibballcolor":
 		handleCalibBallColor(conn)
+	case "cameracalib":
+		handleCameraCalib(conn, pathParts)
+	case "camerasettings":
+		handleCameraSettings(conn, pathParts)
+	case "thresholds":
+		handleThresholds(conn, pathParts)
 	case "color-tuner":
 		handleColorTunerPage(conn)
 	case "colorpreview":
@@ -125,8 +167,26 @@ func handleRequest(conn net.Conn) {
 		handleSetColor(conn, pathParts)
 	case "relaxcolor":
 		handleRelaxColor(conn, pathParts)
+	case "autocalib":
+		handleAutoCalib(conn, pathParts)
+	case "possession":
+		handlePossession(conn)
 	case "powershutdown":
 		handlePowerShutdown(conn)
+	case "controller":
+		handleController(conn, pathParts)
+	case "logs":
+		handleLogs(conn, pathParts)
+	case "dashboard":
+		handleDashboard(conn, pathParts)
+	case "estop":
+		handleEstop(conn, pathParts)
+	case "dryrun":
+		handleDryRun(conn, pathParts)
+	case "telemetry":
+		handleTelemetry(conn, pathParts)
+	case "flightrec":
+		handleFlightRec(conn, pathParts)
 	default:
 		handleStatus(conn)
 	}
@@ -167,8 +227,64 @@ func handlePowerShutdown(conn net.Conn) {
 	sendHTTPResponse(conn, 200, "text/plain", "POWER SHUTDOWN OK\r\n")
 }
 
+// handleController pins the robot to a PC (/controller/pin/<ip>) or releases
+// the pin (/controller/release).
+func handleController(conn net.Conn, pathParts []string) {
+	if len(pathParts) < 3 {
+		sendErrorResponse(conn, 400)
+		return
+	}
+
+	switch pathParts[2] {
+	case "pin":
+		if len(pathParts) < 4 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		ip := net.ParseIP(pathParts[3])
+		if ip == nil {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		connmgr.Default.Pin(ip)
+		sendHTTPResponse(conn, 200, "text/plain", "CONTROLLER PIN OK\r\n")
+	case "release":
+		connmgr.Default.Release()
+		sendHTTPResponse(conn, 200, "text/plain", "CONTROLLER RELEASE OK\r\n")
+	default:
+		sendErrorResponse(conn, 400)
+	}
+}
+
+// handleLogs returns the most recent log lines (/logs or /logs/<lines>) of the
+// robot and the camera process.
+func handleLogs(conn net.Conn, pathParts []string) {
+	n := defaultLogLines
+	if len(pathParts) >= 3 && pathParts[2] != "" {
+		v, err := strconv.Atoi(pathParts[2])
+		if err != nil || v <= 0 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		n = v
+	}
+
+	var b strings.Builder
+	for _, l := range logring.Default.Tail(n) {
+		fmt.Fprintf(&b, "%s [%s] %s\n", l.Time.Format("15:04:05.000"), l.Source, l.Text)
+	}
+	sendHTTPResponse(conn, 200, "text/plain", b.String())
+}
+
+// handleImage returns the latest annotated camera frame as a base64 JPEG JSON
+// string. Frames are only produced while requested, so the first call after a
+// pause waits briefly for one.
 func handleImage(conn net.Conn) {
-	response, err := json.Marshal(state.ImageResponseData.Frame)
+	var frame string
+	if jpeg, ok := camframe.Fresh(imageMaxAge, imageWait); ok {
+		frame = base64.StdEncoding.EncodeToString(jpeg)
+	}
+	response, err := json.Marshal(frame)
 	if err != nil {
 		sendErrorResponse(conn, 500)
 		return
@@ -211,14 +327,16 @@ func handleChangeAdjustment(conn net.Conn, pathParts []string) {
 		CircularityThreshold: float32(circularityThreshold),
 	}
 
-	if err := mw.SaveAdjustmentConfig(data); err != nil {
+	if _, err := thresholds.FromAdjustment(data); err != nil {
+		sendHTTPResponse(conn, 400, "text/plain", err.Error()+"\r\n")
+		return
+	}
+	if err := mw.SaveAdjustmentConfig(data, thresholds.SourceManual); err != nil {
 		log.Printf("しきい値保存エラー: %v", err)
 		sendErrorResponse(conn, 500)
 		return
 	}
 
-	mw.ReloadAdjustment()
-
 	sendHTTPResponse(conn, 200, "text/plain", "CHANGE ADJUSTMENT OK\r\n")
 
 	if err := restartPythonProcess(); err != nil {
@@ -231,60 +349,108 @@ func handleChangeAdjustment(conn net.Conn, pathParts []string) {
 // threshold.json. On success the MW threshold cache is reloaded so the new
 // values take effect without restarting the camera.
 func handleCalibBallColor(conn net.Conn) {
-	body, ok, err := requestCalibration()
+	result, err := runCalibration(logProgress("キャリブレーション"))
 	if err != nil {
 		log.Printf("キャリブレーション要求エラー: %v", err)
-		sendErrorResponse(conn, 500)
-		return
-	}
-
-	if !ok {
-		sendHTTPResponse(conn, 400, "application/json", string(body))
+		sendCameraError(conn, err)
 		return
 	}
 
-	mw.ReloadAdjustment()
-	sendHTTPResponse(conn, 200, "application/json", string(body))
+	sendCameraResult(conn, result)
 }
 
-// requestCalibration asks the camera process (TCP, localhost) to run a
-// calibration and returns the raw JSON response, whether it reported success,
-// and any transport error.
-func requestCalibration() ([]byte, bool, error) {
-	addr := fmt.Sprintf("127.0.0.1:%d", state.CalibPort)
-	conn, err := net.DialTimeout("tcp", addr, calibDialTimeout)
+// manualCalibrations counts the runCalibration calls in progress (the
+// synchronous /calibballcolor and the controller Calibrate command), so the
+// automatic re-calibration stays out of their way.
+var manualCalibrations atomic.Int32
+
+// runCalibration asks the camera process to run the YOLO colour calibration
+// and, on success, records the new thresholds and reloads the MW threshold
+// cache. progress receives the calibration stages.
+func runCalibration(progress func(camctl.Progress)) (camctl.ColorCalibration, error) {
+	manualCalibrations.Add(1)
+	defer manualCalibrations.Add(-1)
+
+	ctx, cancel := cameraContext(calibTimeout)
+	defer cancel()
+	result, err := camctl.Default.CalibrateColor(ctx, true, progress)
 	if err != nil {
-		return nil, false, fmt.Errorf("カメラプロセスへ接続できませんでした: %w", err)
-	}
-	defer conn.Close()
-
-	if err := conn.SetDeadline(time.Now().Add(calibTimeout)); err != nil {
-		return nil, false, err
+		return result, err
 	}
+	mw.RecordAdjustment(thresholds.SourceCalib)
+	return result, nil
+}
 
-	if _, err := conn.Write([]byte("calib\n")); err != nil {
-		return nil, false, fmt.Errorf("キャリブレーション要求の送信に失敗しました: %w", err)
-	}
+type statusDetection struct {
+	Class      string  `json:"class"`
+	X          float32 `json:"x"`
+	Y          float32 `json:"y"`
+	Width      float32 `json:"width"`
+	Height     float32 `json:"height"`
+	Confidence float32 `json:"confidence"`
+	Selected   bool    `json:"selected"`
+	// Ground is the floor position in mm, null when it cannot be projected.
+	Ground *statusGroundPoint `json:"ground"`
+}
 
-	data, err := io.ReadAll(conn)
-	if err != nil {
-		return nil, false, fmt.Errorf("キャリブレーション結果の受信に失敗しました: %w", err)
-	}
+// statusGroundPoint is a robot-relative floor position in mm (x forward,
+// y left), see internal/camgeom.
+type statusGroundPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
 
-	var parsed struct {
-		OK bool `json:"ok"`
-	}
-	if err := json.Unmarshal(data, &parsed); err != nil {
-		return data, false, fmt.Errorf("キャリブレーション結果の解析に失敗しました: %w", err)
+func groundPoint(gx, gy float64, ok bool) *statusGroundPoint {
+	if !ok {
+		return nil
 	}
-
-	return data, parsed.OK, nil
+	return &statusGroundPoint{X: gx, Y: gy}
 }
 
 type statusBallResponse struct {
 	Detected bool    `json:"detected"`
 	CameraX  float32 `json:"cameraX"`
 	CameraY  float32 `json:"cameraY"`
+	// CameraAgeMs is the age of the last camera packet, -1 if none arrived yet.
+	CameraAgeMs int64 `json:"cameraAgeMs"`
+	// Detections are all camera detections of the last (fresh) frame.
+	Detections []statusDetection `json:"detections"`
+	// Ground is the detected ball on the floor in mm, null when unknown.
+	Ground *statusGroundPoint `json:"ground"`
+	// Track is the ball tracker estimate, null without a track.
+	Track *statusBallTrack `json:"track"`
+	// Possession is the fused possession state (internal/possession).
+	Possession possession.State `json:"possession"`
+}
+
+type statusBallTrack struct {
+	Coasting bool    `json:"coasting"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	VX       float64 `json:"vx"`
+	VY       float64 `json:"vy"`
+	// Ground is the robot-relative floor position in mm (x forward, y left),
+	// null unless camera extrinsics are configured.
+	Ground *statusBallGround `json:"ground"`
+}
+
+type statusBallGround struct {
+	X  float64 `json:"x"`
+	Y  float64 `json:"y"`
+	VX float64 `json:"vx"`
+	VY float64 `json:"vy"`
+}
+
+func ballTrackStatus() *statusBallTrack {
+	s := balltrack.Default.Estimate(time.Now())
+	if !s.Valid {
+		return nil
+	}
+	track := &statusBallTrack{Coasting: s.Coasting, X: s.X, Y: s.Y, VX: s.VX, VY: s.VY}
+	if s.Ground {
+		track.Ground = &statusBallGround{X: s.GroundX, Y: s.GroundY, VX: s.GroundVX, VY: s.GroundVY}
+	}
+	return track
 }
 
 type statusWheelSpeedMS struct {
@@ -304,6 +470,14 @@ type statusWheelSpeedRaw struct {
 type statusResponse struct {
 	RobotID                 uint32              `json:"robotId"`
 	ConnectionState         string              `json:"connectionState"`
+	LinkLost                bool                `json:"linkLost"`
+	Controller              string              `json:"controller"`
+	ControllerPinned        string              `json:"controllerPinned"`
+	RTTMs                   float32             `json:"rttMs"`
+	RemoteEmgStop           bool                `json:"remoteEmgStop"`
+	DryRun                  bool                `json:"dryRun"`
+	Faults                  []fault.Fault       `json:"faults"`
+	Camera                  camsup.Status       `json:"camera"`
 	IsNewRobot              bool                `json:"isNewRobot"`
 	Volt                    float32             `json:"VOLT"`
 	IsDetectPhotoSensor     bool                `json:"ISDETECTPHOTOSENSOR"`
@@ -312,6 +486,7 @@ type statusResponse struct {
 	CapPower                uint8               `json:"capPower"`
 	WheelSpeedMS            statusWheelSpeedMS  `json:"wheelSpeedMS"`
 	WheelSpeedRaw           statusWheelSpeedRaw `json:"wheelSpeedRaw"`
+	WheelTracking           wheeltrack.Status   `json:"wheelTracking"`
 	Ball                    statusBallResponse  `json:"ball"`
 	Thresholds              state.Adjustment    `json:"thresholds"`
 	Error                   bool                `json:"ERROR"`
@@ -319,41 +494,64 @@ type statusResponse struct {
 	ErrorMessage            string              `json:"ERRORMESSAGE"`
 }
 
-func connectionStateName(s int) string {
-	switch s {
-	case state.StateOffered:
-		return "offered"
-	case state.StateConnected:
-		return "connected"
-	default:
-		return "discovering"
-	}
-}
-
 func buildStatusResponse() statusResponse {
 	detectPhotoSensor := state.Recvdata.SensorInformation&state.SensorPhotoMask != 0
 	detectDribblerSensor := state.Recvdata.SensorInformation&state.SensorDribblerMask != 0
 	isNewDribbler := state.Recvdata.SensorInformation&state.SensorNewDribMask != 0
 
 	var isBallDetected bool
+	var ballGround *statusGroundPoint
 	var imageX, imageY float32 = state.BallCoordMissing, state.BallCoordMissing
-	if state.ImageDataPtr != nil {
-		isBallDetected = state.ImageDataPtr.IsBallExit
-		imageX = state.ImageDataPtr.ImageX
-		imageY = state.ImageDataPtr.ImageY
+	detections := []statusDetection{}
+	if data := state.FreshImageData(); data != nil {
+		isBallDetected = data.IsBallExit
+		imageX = data.ImageX
+		imageY = data.ImageY
+		for i, d := range data.Detections {
+			detections = append(detections, statusDetection{
+				Class:      d.Class.String(),
+				X:          d.X,
+				Y:          d.Y,
+				Width:      d.Width,
+				Height:     d.Height,
+				Confidence: d.Confidence,
+				Selected:   i == data.BallIndex,
+				Ground:     groundPoint(camgeom.Default.ProjectDetection(d)),
+			})
+		}
+		if isBallDetected {
+			ballGround = groundPoint(camgeom.Default.Project(float64(imageX), float64(imageY)))
+		}
 		if !isBallDetected {
 			imageX = state.BallCoordMissing
 			imageY = state.BallCoordMissing
 		}
 	}
 
-	state.StateMu.Lock()
-	connState := state.ConnectionState
-	state.StateMu.Unlock()
+	cameraAgeMs := int64(-1)
+	if age, ok := state.CameraAge(); ok {
+		cameraAgeMs = age.Milliseconds()
+	}
+
+	var controller, pinned string
+	if pc := connmgr.Default.Controller(); pc != nil {
+		controller = pc.IP.String()
+	}
+	if ip := connmgr.Default.Pinned(); ip != nil {
+		pinned = ip.String()
+	}
 
 	return statusResponse{
 		RobotID:                robotID,
-		ConnectionState:        connectionStateName(connState),
+		ConnectionState:        connmgr.Default.State().String(),
+		LinkLost:               connmgr.Default.Lost(),
+		Controller:             controller,
+		ControllerPinned:       pinned,
+		RTTMs:                  float32(connmgr.Default.RTT().Seconds() * 1000),
+		RemoteEmgStop:          state.RemoteEmgStop.Load(),
+		DryRun:                 state.DryRun.Load(),
+		Faults:                 fault.Active(),
+		Camera:                 camsup.Default.Status(),
 		IsNewRobot:             state.IsNewRobot,
 		Volt:                   float32(state.Recvdata.Volt) / 10.0,
 		IsDetectPhotoSensor:    detectPhotoSensor,
@@ -372,10 +570,16 @@ func buildStatusResponse() statusResponse {
 			BR: state.Recvdata.BrWheelSpeed,
 			FR: state.Recvdata.FrWheelSpeed,
 		},
+		WheelTracking: wheeltrack.Default.Status(),
 		Ball: statusBallResponse{
-			Detected: isBallDetected,
-			CameraX:  imageX,
-			CameraY:  imageY,
+			Detected:    isBallDetected,
+			CameraX:     imageX,
+			CameraY:     imageY,
+			CameraAgeMs: cameraAgeMs,
+			Detections:  detections,
+			Ground:      ballGround,
+			Track:       ballTrackStatus(),
+			Possession:  possession.Default.Status().State,
 		},
 		Thresholds:   mw.GetAdjustment(),
 		Error:        state.IsRobotError,
@@ -394,7 +598,6 @@ func handleStatus(conn net.Conn) {
 }
 
 const (
-	calibDialTimeout = 5 * time.Second
 	// Generous: the first calibration loads the YOLO model, which can take
 	// several seconds on the robot.
 	calibTimeout = 60 * time.Second
@@ -411,10 +614,8 @@ func cameraWorkDir() string {
 	return filepath.Dir(exe)
 }
 
-func restartPythonProcess() error {
-	stopPythonProcess()
-
-	log.Printf("Pythonプロセスを開始します（board=%s）。", cameraBoard)
+// newPythonCmd builds the camera process command for the supervisor.
+func newPythonCmd() *exec.Cmd {
 	cmd := exec.Command("python3", "-m", "camera")
 	configurePythonCmd(cmd)
 	cmd.Env = append(os.Environ(), "RACOON_BOARD="+cameraBoard)
@@ -425,16 +626,15 @@ func restartPythonProcess() error {
 		cmd.Dir = dir
 		cmd.Env = append(cmd.Env, "PYTHONPATH="+dir)
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	pythonCmd = cmd
-	if err := pythonCmd.Start(); err != nil {
-		return fmt.Errorf("Pythonプロセス開始エラー: %w", err)
-	}
+	return cmd
+}
 
-	log.Println("Pythonプロセスが正常に開始されました。")
-	return nil
+// restartPythonProcess (re)starts the camera process under the supervisor,
+// which keeps it running from then on.
+func restartPythonProcess() error {
+	camsup.Default.SetCommand(newPythonCmd)
+	log.Printf("Pythonプロセスを起動します（board=%s）。", cameraBoard)
+	return camsup.Default.Restart()
 }
 
 // StopPythonProcess terminates the camera Python process and any stale copies
@@ -444,16 +644,5 @@ func StopPythonProcess() {
 }
 
 func stopPythonProcess() {
-	if pythonCmd != nil && pythonCmd.Process != nil {
-		log.Println("既存のPythonプロセスを停止します。")
-		_ = pythonCmd.Process.Kill()
-		_, _ = pythonCmd.Process.Wait()
-		pythonCmd = nil
-	}
-
-	// Orphans survive Ctrl+C of the Go binary; clear them before reopening the camera.
-	_ = exec.Command("pkill", "-TERM", "-f", "python3 -m camera").Run()
-	time.Sleep(300 * time.Millisecond)
-	_ = exec.Command("pkill", "-KILL", "-f", "python3 -m camera").Run()
-	time.Sleep(200 * time.Millisecond)
+	camsup.Default.Stop()
 }
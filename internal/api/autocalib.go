@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/autocalib"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/mw"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
+)
+
+// autoCalibActions are the camera operations of the automatic
+// re-calibration. Changes are saved and recorded in the threshold history
+// with the auto-* sources so that they can be rolled back.
+var autoCalibActions = autocalib.Actions{
+	Stats: camctl.Default.DetectStats,
+	Relax: func(ctx context.Context) (state.Adjustment, error) {
+		if _, err := camctl.Default.RelaxThresholds(ctx, true); err != nil {
+			return state.Adjustment{}, err
+		}
+		return mw.RecordAdjustment(thresholds.SourceAutoRelax), nil
+	},
+	Calibrate: func(ctx context.Context) (state.Adjustment, error) {
+		if _, err := camctl.Default.CalibrateColor(ctx, true, nil); err != nil {
+			return state.Adjustment{}, err
+		}
+		return mw.RecordAdjustment(thresholds.SourceAutoCalib), nil
+	},
+	Current: mw.GetAdjustment,
+	// A manual calibration in any form (job, /calibballcolor, controller
+	// command) holds off the automatic one.
+	Busy: func() bool {
+		_, running := calibJobs.Running()
+		return running || manualCalibrations.Load() > 0 || calibrating.Load()
+	},
+}
+
+// handleAutoCalib serves the automatic re-calibration:
+//
+//	/autocalib             status and the last evaluated window
+//	/autocalib/log         automatic changes, newest first
+//	/autocalib/enable/0|1  switch the monitor off / on (until restart)
+func handleAutoCalib(conn net.Conn, pathParts []string) {
+	action := ""
+	if len(pathParts) >= 3 {
+		action = pathParts[2]
+	}
+
+	switch action {
+	case "":
+		sendThresholdsJSON(conn, autocalib.Default.Status())
+	case "log":
+		entries, err := autocalib.Default.Log()
+		if err != nil {
+			log.Printf("autocalib log error: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendThresholdsJSON(conn, entries)
+	case "enable":
+		if len(pathParts) < 4 || (pathParts[3] != "0" && pathParts[3] != "1") {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		enabled := pathParts[3] == "1"
+		autocalib.Default.SetEnabled(enabled)
+		log.Printf("Automatic re-calibration enabled: %v", enabled)
+		sendThresholdsJSON(conn, autocalib.Default.Status())
+	default:
+		sendErrorResponse(conn, 400)
+	}
+}
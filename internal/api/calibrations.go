@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/calibjob"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
+)
+
+// calibJobs runs ball colour calibrations in the background; the thresholds
+// are only proposed until the job is accepted.
+var calibJobs = calibjob.New(func(ctx context.Context, progress func(camctl.Progress)) (camctl.ColorCalibration, error) {
+	ctx, cancel := context.WithTimeout(ctx, calibTimeout)
+	defer cancel()
+	return camctl.Default.CalibrateColor(ctx, false, progress)
+})
+
+// handleCalibrations exposes the ball colour calibration as jobs:
+//
+//	POST   /calibrations              start a job: 202 with the job (409 while one runs)
+//	GET    /calibrations              jobs, newest first (without preview images)
+//	GET    /calibrations/<id>         progress, error or proposed thresholds and preview
+//	POST   /calibrations/<id>/accept  apply and save the proposed thresholds
+//	DELETE /calibrations/<id>         cancel a running job, or discard a finished one
+func handleCalibrations(conn net.Conn, method string, pathParts []string) {
+	if len(pathParts) < 3 || pathParts[2] == "" {
+		switch method {
+		case "GET":
+			sendThresholdsJSON(conn, calibJobs.List())
+		case "POST":
+			job, err := calibJobs.Start()
+			if errors.Is(err, calibjob.ErrBusy) {
+				sendCalibJobError(conn, 409, err, job.ID)
+				return
+			}
+			log.Printf("Calibration job %d started", job.ID)
+			sendCalibJob(conn, 202, job)
+		default:
+			sendErrorResponse(conn, 405)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(pathParts[2])
+	if err != nil {
+		sendErrorResponse(conn, 400)
+		return
+	}
+	action := ""
+	if len(pathParts) >= 4 {
+		action = pathParts[3]
+	}
+
+	switch {
+	case method == "GET" && action == "":
+		job, ok := calibJobs.Get(id)
+		if !ok {
+			sendCalibJobError(conn, 404, calibjob.ErrNotFound, id)
+			return
+		}
+		sendCalibJob(conn, 200, job)
+
+	case method == "DELETE" && action == "":
+		job, err := calibJobs.Delete(id)
+		if err != nil {
+			sendCalibJobError(conn, 404, err, id)
+			return
+		}
+		log.Printf("Calibration job %d deleted (%s)", id, job.State)
+		sendCalibJob(conn, 200, job)
+
+	case method == "POST" && action == "accept":
+		job, err := calibJobs.Accept(id, acceptCalibration)
+		switch {
+		case errors.Is(err, calibjob.ErrNotFound):
+			sendCalibJobError(conn, 404, err, id)
+		case errors.Is(err, calibjob.ErrState):
+			sendCalibJobError(conn, 409, err, id)
+		case err != nil:
+			log.Printf("calibration accept error: %v", err)
+			sendCameraError(conn, err)
+		default:
+			log.Printf("Calibration job %d accepted", id)
+			sendCalibJob(conn, 200, job)
+		}
+
+	case action == "" || action == "accept":
+		sendErrorResponse(conn, 405)
+
+	default:
+		sendErrorResponse(conn, 400)
+	}
+}
+
+// acceptCalibration hot-applies and saves the proposed thresholds of a job.
+func acceptCalibration(r camctl.ColorCalibration) error {
+	_, err := applyThresholds(state.Adjustment{
+		MinThreshold:         r.MinThreshold,
+		MaxThreshold:         r.MaxThreshold,
+		BallDetectRadius:     r.BallDetectRadius,
+		CircularityThreshold: float32(r.CircularityThreshold),
+	}, true, thresholds.SourceCalib)
+	return err
+}
+
+func sendCalibJob(conn net.Conn, status int, job calibjob.Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, status, "application/json", string(body))
+}
+
+func sendCalibJobError(conn net.Conn, status int, err error, id int) {
+	sendHTTPResponse(conn, status, "application/json", fmt.Sprintf(`{"ok":false,"error":%q,"id":%d}`, err.Error(), id))
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camgeom"
+)
+
+// handleCameraCalib drives the checkerboard camera calibration
+// (camera/geometry.py) and reports the calibration in use:
+//
+//	/cameracalib                                 session and calibration status
+//	/cameracalib/reset/<cols>/<rows>/<squareMm>  start a session (inner corners)
+//	/cameracalib/capture                         add a checkerboard view
+//	/cameracalib/floor/<xMm>/<yMm>/<yawDeg>      add the view of the board lying on the floor
+//	/cameracalib/solve                           compute and save camera_calibration.json
+func handleCameraCalib(conn net.Conn, pathParts []string) {
+	command := ""
+	if len(pathParts) >= 3 {
+		command = pathParts[2]
+	}
+
+	var method string
+	var params any
+	switch command {
+	case "":
+		handleCameraCalibStatus(conn)
+		return
+	case "reset":
+		if len(pathParts) < 6 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		cols, err1 := strconv.Atoi(pathParts[3])
+		rows, err2 := strconv.Atoi(pathParts[4])
+		square, err3 := strconv.ParseFloat(pathParts[5], 64)
+		if err1 != nil || err2 != nil || err3 != nil || cols < 2 || rows < 2 || square <= 0 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		method = camctl.MethodGeomReset
+		params = map[string]any{"cols": cols, "rows": rows, "squareMm": square}
+	case "capture":
+		method = camctl.MethodGeomCapture
+	case "solve":
+		method = camctl.MethodGeomSolve
+	case "floor":
+		if len(pathParts) < 6 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		var pose [3]float64
+		for i := range pose {
+			v, err := strconv.ParseFloat(pathParts[3+i], 64)
+			if err != nil {
+				sendErrorResponse(conn, 400)
+				return
+			}
+			pose[i] = v
+		}
+		method = camctl.MethodGeomCapture
+		params = map[string]any{"floorPose": pose}
+	default:
+		sendErrorResponse(conn, 400)
+		return
+	}
+
+	ctx, cancel := cameraContext(calibTimeout)
+	defer cancel()
+	result, err := camctl.Default.Geometry(ctx, method, params, logProgress("カメラキャリブレーション"))
+	if err != nil {
+		log.Printf("カメラキャリブレーション要求エラー: %v", err)
+		sendCameraError(conn, err)
+		return
+	}
+	if command == "solve" {
+		if err := camgeom.Default.Reload(); err != nil {
+			log.Printf("camera calibration reload error: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+	}
+	sendCameraResult(conn, result)
+}
+
+type cameraCalibStatus struct {
+	// Source is the projection in use: "calibration", "extrinsics" or "".
+	Source      string               `json:"source"`
+	Calibration *camgeom.Calibration `json:"calibration"`
+	// Session is the camera process's checkerboard session, null when the
+	// camera process cannot be reached.
+	Session json.RawMessage `json:"session"`
+}
+
+func handleCameraCalibStatus(conn net.Conn) {
+	status := cameraCalibStatus{
+		Source:      camgeom.Default.Source(),
+		Calibration: camgeom.Default.Calibration(),
+	}
+	ctx, cancel := cameraContext(tunerTimeout)
+	defer cancel()
+	if session, err := camctl.Default.Geometry(ctx, camctl.MethodGeomStatus, nil, nil); err == nil {
+		status.Session = session
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, 200, "application/json", string(data))
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+)
+
+const (
+	tunerTimeout   = 10 * time.Second
+	previewTimeout = 20 * time.Second
+)
+
+// cameraContext bounds one request to the camera process.
+func cameraContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// logProgress returns a progress callback that logs the stages of a long
+// camera request.
+func logProgress(what string) func(camctl.Progress) {
+	return func(p camctl.Progress) {
+		log.Printf("%s: %s %.0f%% %s", what, p.Stage, p.Fraction*100, p.Message)
+	}
+}
+
+// sendCameraResult sends a camera process result as {"ok": true, ...}, the
+// form the tuner and calibration pages expect.
+func sendCameraResult(conn net.Conn, v any) {
+	body, err := withFields(v, map[string]any{"ok": true})
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, 200, "application/json", string(body))
+}
+
+// sendCameraError reports a failed camera request as {"ok": false, "code",
+// "error", ...details}: 400 for a camera error reply, 500 for an internal
+// error of the camera process and 503 when it cannot be reached.
+func sendCameraError(conn net.Conn, err error) {
+	status, code := 503, "unreachable"
+	var details json.RawMessage
+	var e *camctl.Error
+	if errors.As(err, &e) {
+		status, code, details = 400, e.Code, e.Details
+		if e.Code == camctl.CodeInternal {
+			status = 500
+		}
+		err = errors.New(e.Message)
+	}
+	body, merr := withFields(details, map[string]any{"ok": false, "code": code, "error": err.Error()})
+	if merr != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, status, "application/json", string(body))
+}
+
+// withFields encodes v (a JSON object, or nil) with fields added.
+func withFields(v any, fields map[string]any) ([]byte, error) {
+	obj := map[string]json.RawMessage{}
+	if raw, ok := v.(json.RawMessage); !ok || len(raw) > 0 {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if string(data) != "null" {
+			if err := json.Unmarshal(data, &obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for k, f := range fields {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return nil, err
+		}
+		obj[k] = data
+	}
+	return json.Marshal(obj)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
+)
+
+// handleCameraSettings reads and changes the capture settings kept in
+// threshold.json (exposure, gain, white balance, flip, resolution, fps,
+// device):
+//
+//	/camerasettings                                  settings and limits of this board
+//	/camerasettings/set/<name>/<value>[/<name>/<value>...]
+//
+// A value of "default" returns the setting to the camera default. Changes are
+// validated for the board, hot-applied in the camera process (a resolution,
+// fps or device change reopens the capture) and then saved. When the camera
+// process is not running they are only saved and apply on its next start.
+func handleCameraSettings(conn net.Conn, pathParts []string) {
+	current, err := thresholds.Default.Camera()
+	if err != nil {
+		log.Printf("カメラ設定の読み込みエラー: %v", err)
+		sendErrorResponse(conn, 500)
+		return
+	}
+
+	if len(pathParts) < 3 || pathParts[2] == "" {
+		sendThresholdsJSON(conn, cameraSettingsStatus{
+			Board:    cameraBoard,
+			Settings: current,
+			Limits:   thresholds.CameraBoardLimits[cameraBoard],
+		})
+		return
+	}
+	if pathParts[2] != "set" {
+		sendErrorResponse(conn, 400)
+		return
+	}
+
+	args := pathParts[3:]
+	if len(args) == 0 || len(args)%2 != 0 {
+		sendErrorResponse(conn, 400)
+		return
+	}
+	next := current
+	for i := 0; i < len(args); i += 2 {
+		if err := next.Set(args[i], args[i+1]); err != nil {
+			sendCameraSettingsError(conn, err)
+			return
+		}
+	}
+	if err := next.Validate(cameraBoard); err != nil {
+		sendCameraSettingsError(conn, err)
+		return
+	}
+
+	result := cameraSettingsResult{OK: true, Settings: next}
+	ctx, cancel := cameraContext(tunerTimeout)
+	defer cancel()
+	applied, err := camctl.Default.ApplyCamera(ctx, next.FileValues())
+	switch {
+	case camctl.ErrorCode(err) != "":
+		// The camera process rejected or could not open the new settings
+		// and kept the old ones; do not save them.
+		sendCameraError(conn, err)
+		return
+	case err != nil:
+		log.Printf("camera settings not hot-applied (saved for the next camera start): %v", err)
+	default:
+		result.Applied = true
+		result.Reopened = applied.Reopened
+	}
+
+	if err := thresholds.Default.SaveCamera(next, cameraBoard); err != nil {
+		log.Printf("カメラ設定の保存エラー: %v", err)
+		sendErrorResponse(conn, 500)
+		return
+	}
+	log.Printf("Camera settings changed: %v (applied=%v)", args, result.Applied)
+	sendThresholdsJSON(conn, result)
+}
+
+type cameraSettingsStatus struct {
+	Board    string                    `json:"board"`
+	Settings thresholds.CameraSettings `json:"settings"`
+	Limits   thresholds.CameraLimits   `json:"limits"`
+}
+
+type cameraSettingsResult struct {
+	OK bool `json:"ok"`
+	// Applied is false when the camera process could not be reached.
+	Applied bool `json:"applied"`
+	// Reopened reports that the capture device was reopened.
+	Reopened bool                      `json:"reopened"`
+	Settings thresholds.CameraSettings `json:"settings"`
+}
+
+func sendCameraSettingsError(conn net.Conn, err error) {
+	sendHTTPResponse(conn, 400, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()))
+}
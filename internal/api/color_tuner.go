@@ -3,15 +3,15 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"math"
 	"net"
 	"strconv"
-	"strings"
-	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/mw"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
 )
 
 func handleColorTunerPage(conn net.Conn) {
@@ -19,14 +19,14 @@ func handleColorTunerPage(conn net.Conn) {
 }
 
 func handleColorPreview(conn net.Conn) {
-	body, err := requestTuner("preview")
+	ctx, cancel := cameraContext(previewTimeout)
+	defer cancel()
+	preview, err := camctl.Default.Preview(ctx)
 	if err != nil {
-		sendHTTPResponse(conn, 503, "application/json", fmt.Sprintf(
-			`{"ok":false,"error":%q}`, err.Error(),
-		))
+		sendCameraError(conn, err)
 		return
 	}
-	sendHTTPResponse(conn, 200, "application/json", string(body))
+	sendCameraResult(conn, preview)
 }
 
 func handleColorThresholds(conn net.Conn) {
@@ -59,27 +59,56 @@ func handleSetColor(conn net.Conn, pathParts []string) {
 	}
 	save := pathParts[6] == "1"
 
-	cmd := fmt.Sprintf(
-		"set|%s|%s|%d|%.4f|%s",
-		minThreshold,
-		maxThreshold,
-		ballDetectRadius,
-		circularityThreshold,
-		boolTo01(save),
-	)
-
-	body, err := requestTuner(cmd)
+	adj := state.Adjustment{
+		MinThreshold:         minThreshold,
+		MaxThreshold:         maxThreshold,
+		BallDetectRadius:     ballDetectRadius,
+		CircularityThreshold: float32(circularityThreshold),
+	}
+	if _, err := thresholds.FromAdjustment(adj); err != nil {
+		sendHTTPResponse(conn, 400, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()))
+		return
+	}
+	result, err := applyThresholds(adj, save, thresholds.SourceManual)
 	if err != nil {
 		log.Printf("setcolor error: %v", err)
-		sendErrorResponse(conn, 500)
+		sendCameraError(conn, err)
 		return
 	}
 
-	if save {
-		mw.ReloadAdjustment()
+	sendCameraResult(conn, result)
+}
+
+// applyThresholds validates and hot-applies thresholds in the camera process
+// and, when save is set, persists them, records them in the history as source
+// and reloads the MW cache.
+func applyThresholds(adj state.Adjustment, save bool, source string) (camctl.Thresholds, error) {
+	set, err := thresholds.FromAdjustment(adj)
+	if err != nil {
+		return camctl.Thresholds{}, err
+	}
+	adj = set.Adjustment()
+
+	// Drop the float32 noise (0.3 -> 0.30000001).
+	circularity := math.Round(float64(adj.CircularityThreshold)*1e4) / 1e4
+
+	ctx, cancel := cameraContext(tunerTimeout)
+	defer cancel()
+	result, err := camctl.Default.SetThresholds(ctx, camctl.ThresholdParams{
+		MinThreshold:         adj.MinThreshold,
+		MaxThreshold:         adj.MaxThreshold,
+		BallDetectRadius:     adj.BallDetectRadius,
+		CircularityThreshold: circularity,
+		Save:                 save,
+	})
+	if err != nil {
+		return camctl.Thresholds{}, err
 	}
 
-	sendHTTPResponse(conn, 200, "application/json", string(body))
+	if save {
+		mw.RecordAdjustment(source)
+	}
+	return result, nil
 }
 
 func handleRelaxColor(conn net.Conn, pathParts []string) {
@@ -89,88 +118,20 @@ func handleRelaxColor(conn net.Conn, pathParts []string) {
 	}
 	save := pathParts[2] == "1"
 
-	body, err := requestTuner("relax|" + boolTo01(save))
+	ctx, cancel := cameraContext(tunerTimeout)
+	defer cancel()
+	result, err := camctl.Default.RelaxThresholds(ctx, save)
 	if err != nil {
 		log.Printf("relaxcolor error: %v", err)
-		sendErrorResponse(conn, 500)
+		sendCameraError(conn, err)
 		return
 	}
 
 	if save {
-		mw.ReloadAdjustment()
-	}
-
-	sendHTTPResponse(conn, 200, "application/json", string(body))
-}
-
-func boolTo01(v bool) string {
-	if v {
-		return "1"
-	}
-	return "0"
-}
-
-func requestTuner(command string) ([]byte, error) {
-	addr := fmt.Sprintf("127.0.0.1:%d", state.TunerPort)
-	timeout := 10 * time.Second
-	if command == "preview" {
-		timeout = 20 * time.Second
-	}
-
-	var lastErr error
-	for attempt := 0; attempt < 5; attempt++ {
-		if attempt > 0 {
-			time.Sleep(200 * time.Millisecond)
-		}
-
-		body, err := requestTunerOnce(addr, command, timeout)
-		if err == nil {
-			return body, nil
-		}
-		lastErr = err
-	}
-	return nil, lastErr
-}
-
-func requestTunerOnce(addr, command string, timeout time.Duration) ([]byte, error) {
-	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("カメラチューナーへ接続できませんでした: %w", err)
-	}
-	defer conn.Close()
-
-	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-		return nil, err
-	}
-
-	if _, err := conn.Write([]byte(command + "\n")); err != nil {
-		return nil, fmt.Errorf("チューナー要求の送信に失敗しました: %w", err)
-	}
-
-	var buf strings.Builder
-	tmp := make([]byte, 65536)
-	for {
-		n, err := conn.Read(tmp)
-		if n > 0 {
-			buf.Write(tmp[:n])
-			if strings.Contains(buf.String(), "\n") {
-				break
-			}
-		}
-		if err != nil {
-			if err == io.EOF && buf.Len() > 0 {
-				break
-			}
-			return nil, fmt.Errorf("チューナー応答の受信に失敗しました: %w", err)
-		}
-	}
-
-	trimmed := strings.TrimSpace(buf.String())
-	if trimmed == "" {
-		return nil, fmt.Errorf("チューナー応答が空です")
+		mw.RecordAdjustment(thresholds.SourceRelax)
 	}
 
-	return []byte(trimmed), nil
+	sendCameraResult(conn, result)
 }
 
 const colorTunerHTML = `<!DOCTYPE html>
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/control"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
+	"github.com/Rione/ssl-RACOON-Pi2/proto/pb_gen"
+)
+
+// rebootDelay leaves time for the DONE ack to reach the controller before the
+// network goes down.
+const rebootDelay = 500 * time.Millisecond
+
+var calibrating atomic.Bool
+
+// HandleControlCommand executes a MwToPi command received over the UDP
+// controller channel. It mirrors the equivalent HTTP endpoints; slow actions
+// (tuner, calibration, buzzer) run in the background and report completion
+// through the ack stream.
+func HandleControlCommand(msg *pb_gen.MwToPi) {
+	id := msg.GetCommandId()
+	if !control.MarkSeen(id) {
+		return
+	}
+
+	switch cmd := msg.GetCommand().(type) {
+	case *pb_gen.MwToPi_Buzzer:
+		tone := int(cmd.Buzzer.GetTone())
+		duration := int(cmd.Buzzer.GetDurationMs())
+		if tone > 99 || duration < 50 || duration > 3000 {
+			control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, "tone 0-99, duration 50-3000ms")
+			return
+		}
+		link.RingBuzzerAsync(tone, time.Duration(duration)*time.Millisecond, 0)
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_DONE, "")
+
+	case *pb_gen.MwToPi_Estop:
+		active := cmd.Estop.GetActive()
+		if state.RemoteEmgStop.Swap(active) != active {
+			log.Printf("Remote emergency stop %s via controller channel", onOff(active))
+		}
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_DONE, "")
+
+	case *pb_gen.MwToPi_SetThresholds:
+		c := cmd.SetThresholds
+		adj := state.Adjustment{
+			MinThreshold:         c.GetMinThreshold(),
+			MaxThreshold:         c.GetMaxThreshold(),
+			BallDetectRadius:     int(c.GetBallDetectRadius()),
+			CircularityThreshold: c.GetCircularityThreshold(),
+		}
+		if _, err := thresholds.FromAdjustment(adj); err != nil {
+			control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, err.Error())
+			return
+		}
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_ACCEPTED, "")
+		go func() {
+			_, err := applyThresholds(adj, c.GetSave(), thresholds.SourceManual)
+			ackResult(id, err)
+		}()
+
+	case *pb_gen.MwToPi_ThresholdPreset:
+		c := cmd.ThresholdPreset
+		name := c.GetName()
+		if err := thresholds.ValidatePresetName(name); err != nil {
+			control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, err.Error())
+			return
+		}
+		if c.MinThreshold != nil || c.MaxThreshold != nil || c.BallDetectRadius != nil || c.CircularityThreshold != nil {
+			if c.MinThreshold == nil || c.MaxThreshold == nil || c.BallDetectRadius == nil || c.CircularityThreshold == nil {
+				control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, "preset thresholds are incomplete")
+				return
+			}
+			set, err := thresholds.FromAdjustment(state.Adjustment{
+				MinThreshold:         c.GetMinThreshold(),
+				MaxThreshold:         c.GetMaxThreshold(),
+				BallDetectRadius:     int(c.GetBallDetectRadius()),
+				CircularityThreshold: c.GetCircularityThreshold(),
+			})
+			if err != nil {
+				control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, err.Error())
+				return
+			}
+			if _, err := thresholds.Default.SavePreset(name, set); err != nil {
+				control.Ack(id, pb_gen.Command_Ack_Status_ACK_FAILED, err.Error())
+				return
+			}
+			log.Printf("Threshold preset %q received via controller channel", name)
+		} else if _, ok := thresholds.Default.Preset(name); !ok {
+			control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, "preset not found")
+			return
+		}
+		if !c.GetApply() {
+			control.Ack(id, pb_gen.Command_Ack_Status_ACK_DONE, "")
+			return
+		}
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_ACCEPTED, "")
+		go func() {
+			_, err := applyPreset(name, c.GetSave())
+			ackResult(id, err)
+		}()
+
+	case *pb_gen.MwToPi_Calibrate:
+		if !calibrating.CompareAndSwap(false, true) {
+			control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, "calibration already running")
+			return
+		}
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_ACCEPTED, "")
+		go func() {
+			defer calibrating.Store(false)
+			// Progress is reported as ACCEPTED acks carrying the stage.
+			_, err := runCalibration(func(p camctl.Progress) {
+				control.Ack(id, pb_gen.Command_Ack_Status_ACK_ACCEPTED, fmt.Sprintf("%s %.0f%%", p.Stage, p.Fraction*100))
+			})
+			ackResult(id, err)
+		}()
+
+	case *pb_gen.MwToPi_PowerShutdown:
+		if !state.PowerShutdownMode {
+			log.Println("Power shutdown mode requested via controller channel")
+		}
+		state.PowerShutdownMode = true
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_DONE, "")
+
+	case *pb_gen.MwToPi_Reboot:
+		log.Println("Reboot requested via controller channel")
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_DONE, "")
+		go func() {
+			time.Sleep(rebootDelay)
+			stopPythonProcess()
+			if err := exec.Command("reboot").Run(); err != nil {
+				log.Printf("reboot failed: %v", err)
+			}
+		}()
+
+	default:
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_REJECTED, "unknown command")
+	}
+}
+
+// ackResult acks a finished camera request: DONE, or FAILED with the error
+// ("<code>: <message>" for camera error replies).
+func ackResult(id uint32, err error) {
+	if err != nil {
+		control.Ack(id, pb_gen.Command_Ack_Status_ACK_FAILED, err.Error())
+		return
+	}
+	control.Ack(id, pb_gen.Command_Ack_Status_ACK_DONE, "")
+}
+
+func onOff(v bool) string {
+	if v {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+	"net"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/dashboard"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+)
+
+// handleDashboard serves the embedded web dashboard: /dashboard is the page,
+// /dashboard/<file> its scripts and style sheet.
+func handleDashboard(conn net.Conn, pathParts []string) {
+	name := ""
+	if len(pathParts) >= 3 {
+		name = pathParts[2]
+	}
+	data, contentType, ok := dashboard.Asset(name)
+	if !ok {
+		sendErrorResponse(conn, 404)
+		return
+	}
+	sendHTTPResponse(conn, 200, contentType, string(data))
+}
+
+// handleEstop sets (/estop/1) or releases (/estop/0) the remote emergency
+// stop, like the Estop command of the controller channel.
+func handleEstop(conn net.Conn, pathParts []string) {
+	active, ok := parseSwitch(pathParts)
+	if !ok {
+		sendErrorResponse(conn, 400)
+		return
+	}
+	if state.RemoteEmgStop.Swap(active) != active {
+		log.Printf("Remote emergency stop %s via API", onOff(active))
+	}
+	sendHTTPResponse(conn, 200, "text/plain", "ESTOP OK\r\n")
+}
+
+// handleDryRun switches the dry-run mode (-dryrun) on (/dryrun/1) or off
+// (/dryrun/0) until restart.
+func handleDryRun(conn net.Conn, pathParts []string) {
+	on, ok := parseSwitch(pathParts)
+	if !ok {
+		sendErrorResponse(conn, 400)
+		return
+	}
+	if state.DryRun.Swap(on) != on {
+		log.Printf("Dry-run mode %s via API", onOff(on))
+	}
+	sendHTTPResponse(conn, 200, "text/plain", "DRYRUN OK\r\n")
+}
+
+// parseSwitch reads the 0|1 segment of /<endpoint>/0|1.
+func parseSwitch(pathParts []string) (on, ok bool) {
+	if len(pathParts) < 3 || (pathParts[2] != "0" && pathParts[2] != "1") {
+		return false, false
+	}
+	return pathParts[2] == "1", true
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/flightrec"
+)
+
+// handleFlightRec serves the flight recorder:
+//
+//	/flightrec                 ring size and the list of dumps
+//	/flightrec/dump            write a dump of the ring now
+//	/flightrec/dumps/<name>    download a dump
+func handleFlightRec(conn net.Conn, pathParts []string) {
+	action := ""
+	if len(pathParts) >= 3 {
+		action = pathParts[2]
+	}
+	switch action {
+	case "":
+		st, err := flightrec.Default.Status()
+		if err != nil {
+			log.Printf("Flight recorder status error: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendThresholdsJSON(conn, st)
+	case "dump":
+		info, err := flightrec.Default.DumpNow("api")
+		if err != nil {
+			log.Printf("Flight recorder dump error: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendThresholdsJSON(conn, info)
+	case "dumps":
+		if len(pathParts) < 4 {
+			sendErrorResponse(conn, 404)
+			return
+		}
+		data, err := flightrec.Default.Open(pathParts[3])
+		if errors.Is(err, flightrec.ErrNotFound) {
+			sendErrorResponse(conn, 404)
+			return
+		}
+		if err != nil {
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendHTTPResponse(conn, 200, "application/json", string(data))
+	default:
+		sendErrorResponse(conn, 404)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/motorcal"
+)
+
+// motorCalibConfirm must end the start path: the robot spins in place, so the
+// caller confirms that it is safe (wheels lifted or free space around it).
+const motorCalibConfirm = "confirm"
+
+type motorCalibResponse struct {
+	Calibration motorcal.Calibration `json:"calibration"`
+	// Compensated reports whether the compensation is applied.
+	Compensated bool `json:"compensated"`
+	// Mismatch explains why a calibration of another robot is ignored.
+	Mismatch string        `json:"mismatch,omitempty"`
+	Job      *motorcal.Job `json:"job"`
+}
+
+// handleMotorCalib exposes the motor calibration (see internal/motorcal):
+//
+//	GET    /motorcalib                       calibration, compensation and the last job
+//	POST   /motorcalib/run/confirm           spin the robot and fit the wheels: 202 with the job
+//	DELETE /motorcalib/run                   stop a running job
+//	POST   /motorcalib/accept                save the fitted calibration of a done job
+//	POST   /motorcalib/compensate/<0|1>      turn the compensation off / on
+//	POST   /motorcalib/wheeldiameter/<mm>    set the measured wheel diameter (0: nominal)
+//	DELETE /motorcalib                       forget the calibration
+func handleMotorCalib(conn net.Conn, method string, pathParts []string) {
+	action := ""
+	if len(pathParts) >= 3 {
+		action = pathParts[2]
+	}
+	arg := ""
+	if len(pathParts) >= 4 {
+		arg = pathParts[3]
+	}
+
+	switch {
+	case method == "GET" && action == "":
+		sendMotorCalib(conn, 200)
+
+	case method == "DELETE" && action == "":
+		if err := motorcal.Default.Set(motorcal.Uncalibrated); err != nil {
+			log.Printf("motor calibration reset error: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendMotorCalib(conn, 200)
+
+	case method == "POST" && action == "run":
+		if arg != motorCalibConfirm {
+			sendMotorCalibError(conn, 400, "the robot spins in place: POST /motorcalib/run/"+motorCalibConfirm+" once it is safe")
+			return
+		}
+		job, err := motorcal.DefaultRunner.Start()
+		switch {
+		case errors.Is(err, motorcal.ErrNoRig):
+			sendMotorCalibError(conn, 503, err.Error())
+		case err != nil:
+			sendMotorCalibError(conn, 409, err.Error())
+		default:
+			log.Printf("Motor calibration started (%d steps)", job.Steps)
+			sendMotorCalibJob(conn, 202, job)
+		}
+
+	case method == "DELETE" && action == "run":
+		job, err := motorcal.DefaultRunner.Cancel()
+		if err != nil {
+			sendMotorCalibError(conn, 409, err.Error())
+			return
+		}
+		sendMotorCalibJob(conn, 200, job)
+
+	case method == "POST" && action == "accept":
+		job, err := motorcal.DefaultRunner.Accept()
+		switch {
+		case errors.Is(err, motorcal.ErrNotFound), errors.Is(err, motorcal.ErrState):
+			sendMotorCalibError(conn, 409, err.Error())
+		case err != nil:
+			log.Printf("motor calibration accept error: %v", err)
+			sendErrorResponse(conn, 500)
+		default:
+			sendMotorCalibJob(conn, 200, job)
+		}
+
+	case method == "POST" && action == "compensate":
+		if arg != "0" && arg != "1" {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		c := motorcal.Default.Get()
+		c.Compensate = arg == "1"
+		updateMotorCalib(conn, c)
+
+	case method == "POST" && action == "wheeldiameter":
+		mm, err := strconv.ParseFloat(arg, 64)
+		if err != nil || mm < 0 || mm > 200 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		c := motorcal.Default.Get()
+		c.WheelDiameterMm = mm
+		updateMotorCalib(conn, c)
+
+	case action == "" || action == "run" || action == "accept" || action == "compensate" || action == "wheeldiameter":
+		sendErrorResponse(conn, 405)
+
+	default:
+		sendErrorResponse(conn, 404)
+	}
+}
+
+func sendMotorCalibError(conn net.Conn, status int, msg string) {
+	sendHTTPResponse(conn, status, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, msg))
+}
+
+func updateMotorCalib(conn net.Conn, c motorcal.Calibration) {
+	if err := motorcal.Default.Set(c); err != nil {
+		sendMotorCalibError(conn, 400, err.Error())
+		return
+	}
+	sendMotorCalib(conn, 200)
+}
+
+func sendMotorCalib(conn net.Conn, status int) {
+	resp := motorCalibResponse{
+		Calibration: motorcal.Default.Get(),
+		Compensated: motorcal.Default.Compensated(),
+		Mismatch:    motorcal.Default.Mismatch(),
+	}
+	if job, ok := motorcal.DefaultRunner.Job(); ok {
+		resp.Job = &job
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, status, "application/json", string(body))
+}
+
+func sendMotorCalibJob(conn net.Conn, status int, job motorcal.Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, status, "application/json", string(body))
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/possession"
+)
+
+type possessionResponse struct {
+	possession.Status
+	// StateMs is how long the state has lasted.
+	StateMs  int64                    `json:"stateMs"`
+	GateKick bool                     `json:"gateKick"`
+	Samples  possession.SamplesStatus `json:"samples"`
+}
+
+// handlePossession reports the fused ball possession state with its sensor
+// inputs and the training sample recorder.
+func handlePossession(conn net.Conn) {
+	st := possession.Default.Status()
+	resp := possessionResponse{
+		Status:   st,
+		GateKick: possession.Default.Config().GateKick,
+		Samples:  possession.DefaultRecorder.Status(),
+	}
+	if !st.Since.IsZero() {
+		resp.StateMs = time.Since(st.Since).Milliseconds()
+	}
+	sendThresholdsJSON(conn, resp)
+}
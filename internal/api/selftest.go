@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/selftest"
+)
+
+// selfTestConfirm ends the start path to run the motion steps too: the robot
+// spins in place, dribbles and charges the kicker capacitor.
+const selfTestConfirm = "confirm"
+
+// handleSelfTest exposes the self-test (see internal/selftest):
+//
+//	GET    /selftest              the current or last report
+//	POST   /selftest/run          run the checks that do not move the robot: 202 with the report
+//	POST   /selftest/run/confirm  run every check, the motion steps included
+//	DELETE /selftest/run          stop a running self-test
+func handleSelfTest(conn net.Conn, method string, pathParts []string) {
+	action := ""
+	if len(pathParts) >= 3 {
+		action = pathParts[2]
+	}
+	arg := ""
+	if len(pathParts) >= 4 {
+		arg = pathParts[3]
+	}
+
+	switch {
+	case method == "GET" && action == "":
+		report, ok := selftest.Default.Report()
+		if !ok {
+			sendSelfTestError(conn, 404, selftest.ErrNotFound.Error())
+			return
+		}
+		sendSelfTestReport(conn, 200, report)
+
+	case method == "POST" && action == "run":
+		if arg != "" && arg != selfTestConfirm {
+			sendErrorResponse(conn, 404)
+			return
+		}
+		report, err := selftest.Default.Start(arg == selfTestConfirm)
+		switch {
+		case errors.Is(err, selftest.ErrNoRobot):
+			sendSelfTestError(conn, 503, err.Error())
+		case err != nil:
+			sendSelfTestError(conn, 409, err.Error())
+		default:
+			sendSelfTestReport(conn, 202, report)
+		}
+
+	case method == "DELETE" && action == "run":
+		report, err := selftest.Default.Cancel()
+		if err != nil {
+			sendSelfTestError(conn, 409, err.Error())
+			return
+		}
+		sendSelfTestReport(conn, 200, report)
+
+	case action == "" || action == "run":
+		sendErrorResponse(conn, 405)
+
+	default:
+		sendErrorResponse(conn, 404)
+	}
+}
+
+func sendSelfTestError(conn net.Conn, status int, msg string) {
+	sendHTTPResponse(conn, status, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, msg))
+}
+
+func sendSelfTestReport(conn net.Conn, status int, report selftest.Report) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, status, "application/json", string(body))
+}
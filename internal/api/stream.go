@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camframe"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/config"
+)
+
+const (
+	streamBoundary = "racoonframe"
+	// streamWriteTimeout drops a viewer whose connection stopped draining.
+	streamWriteTimeout = 3 * time.Second
+	// streamIdleTimeout ends the stream when the camera sends no frames.
+	streamIdleTimeout = 10 * time.Second
+
+	streamMaxWidth  = 1280
+	streamMaxHeight = 960
+)
+
+var streamClients atomic.Int32
+
+// handleStream serves the annotated camera frames as an MJPEG stream
+// (multipart/x-mixed-replace, viewable directly in a browser <img>):
+//
+//	/stream.mjpeg                          config.json camera.stream defaults
+//	/stream.mjpeg/<fps>                    at most fps frames per second
+//	/stream.mjpeg/<fps>/<width>/<height>   frames resized by the camera process
+//
+// Each viewer only ever sends the newest frame when its connection is ready,
+// so a slow browser loses frames instead of delaying anything else; one that
+// stops reading is disconnected after streamWriteTimeout.
+func handleStream(conn net.Conn, pathParts []string) {
+	sc := config.Get().Camera.Stream
+	req := camproto.FrameRequest{
+		Width:   sc.Width,
+		Height:  sc.Height,
+		FPS:     sc.Fps,
+		Quality: sc.Quality,
+	}
+	if len(pathParts) > 2 && pathParts[2] != "" {
+		fps, err := strconv.Atoi(pathParts[2])
+		if err != nil || fps < 1 {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		req.FPS = min(fps, sc.MaxFps)
+	}
+	if len(pathParts) > 4 {
+		w, err1 := strconv.Atoi(pathParts[3])
+		h, err2 := strconv.Atoi(pathParts[4])
+		if err1 != nil || err2 != nil || w < 16 || h < 16 || w > streamMaxWidth || h > streamMaxHeight {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		req.Width, req.Height = w, h
+	}
+
+	if int(streamClients.Add(1)) > sc.MaxClients {
+		streamClients.Add(-1)
+		sendErrorResponse(conn, 503)
+		return
+	}
+	defer streamClients.Add(-1)
+
+	viewer := camframe.Join(req)
+	defer viewer.Leave()
+
+	conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: multipart/x-mixed-replace; boundary=%s\r\n"+
+		"Cache-Control: no-cache, no-store\r\n"+
+		"Connection: close\r\n\r\n", streamBoundary)
+	if err != nil {
+		return
+	}
+	log.Printf("MJPEG stream started for %s (%dx%d, %d fps)", conn.RemoteAddr(), req.Width, req.Height, req.FPS)
+
+	interval := time.Second / time.Duration(req.FPS)
+	next := time.Now()
+	for {
+		if d := time.Until(next); d > 0 {
+			time.Sleep(d)
+		}
+		frame, ok := camframe.Next(streamIdleTimeout)
+		if !ok {
+			log.Printf("MJPEG stream for %s ended: no camera frames", conn.RemoteAddr())
+			return
+		}
+		next = time.Now().Add(interval)
+
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(conn, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", streamBoundary, len(frame)); err != nil {
+			break
+		}
+		if _, err := conn.Write(frame); err != nil {
+			break
+		}
+		if _, err := conn.Write([]byte("\r\n")); err != nil {
+			break
+		}
+	}
+	log.Printf("MJPEG stream for %s closed", conn.RemoteAddr())
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/telemetry"
+)
+
+const (
+	// telemetryWriteTimeout drops a client whose connection stopped draining.
+	telemetryWriteTimeout = 3 * time.Second
+	// telemetryKeepAlive is the longest silence on the stream, so that
+	// proxies and clients do not time it out.
+	telemetryKeepAlive = 10 * time.Second
+)
+
+// handleTelemetry streams telemetry channels as server-sent events
+// (text/event-stream, usable with a browser EventSource):
+//
+//	/telemetry                          every channel at the default rate
+//	/telemetry/<ch>[:<hz>],...          the given channels, e.g. wheelRaw:100,battery:1
+//	/telemetry/all:<hz>                 every channel at hz
+//
+// The first event ("rates") lists the effective rate of each channel; then
+// each sample is an event named after its channel whose data is
+// {"t": <unix ms>, "v": <value>}.
+func handleTelemetry(conn net.Conn, pathParts []string) {
+	spec := ""
+	if len(pathParts) >= 3 {
+		spec = pathParts[2]
+	}
+	rates, err := parseTelemetrySpec(spec)
+	if err != nil {
+		sendHTTPResponse(conn, 400, "text/plain", err.Error()+"\r\n")
+		return
+	}
+	sub, err := telemetry.Default.Subscribe(rates)
+	if errors.Is(err, telemetry.ErrTooManyClients) {
+		sendErrorResponse(conn, 503)
+		return
+	}
+	if err != nil {
+		sendHTTPResponse(conn, 400, "text/plain", err.Error()+"\r\n")
+		return
+	}
+	defer telemetry.Default.Unsubscribe(sub)
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprint(w, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/event-stream; charset=utf-8\r\n"+
+		"Cache-Control: no-cache, no-store\r\n"+
+		"Access-Control-Allow-Origin: *\r\n"+
+		"Connection: close\r\n\r\n")
+	ratesJSON, _ := json.Marshal(sub.Rates())
+	fmt.Fprintf(w, "event: rates\ndata: %s\n\n", ratesJSON)
+	if flushTelemetry(conn, w) != nil {
+		return
+	}
+	log.Printf("Telemetry stream started for %s (%s)", conn.RemoteAddr(), ratesJSON)
+
+	// The client sends nothing after the request, so a read returns when it
+	// goes away; this frees the subscription without waiting for a write.
+	gone := make(chan struct{})
+	go func() {
+		var buf [256]byte
+		for {
+			if _, err := conn.Read(buf[:]); err != nil {
+				close(gone)
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(telemetryKeepAlive)
+	defer keepAlive.Stop()
+loop:
+	for {
+		select {
+		case <-gone:
+			break loop
+		case s := <-sub.C:
+			writeTelemetrySample(w, s)
+			// Send whatever else is already queued in the same write.
+			for more := true; more; {
+				select {
+				case s := <-sub.C:
+					writeTelemetrySample(w, s)
+				default:
+					more = false
+				}
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err := flushTelemetry(conn, w); err != nil {
+			break loop
+		}
+	}
+	log.Printf("Telemetry stream for %s closed (%d samples dropped)", conn.RemoteAddr(), sub.Dropped())
+}
+
+func writeTelemetrySample(w *bufio.Writer, s telemetry.Sample) {
+	value, err := json.Marshal(s.Value)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: {\"t\":%d,\"v\":%s}\n\n", s.Channel, s.Time.UnixMilli(), value)
+}
+
+func flushTelemetry(conn net.Conn, w *bufio.Writer) error {
+	conn.SetWriteDeadline(time.Now().Add(telemetryWriteTimeout))
+	return w.Flush()
+}
+
+// parseTelemetrySpec parses "<ch>[:<hz>],..." into rates. "all" stands for
+// every channel; an omitted rate is 0 (the configured default).
+func parseTelemetrySpec(spec string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	if spec == "" {
+		return rates, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		name, rate, hasRate := strings.Cut(item, ":")
+		hz := 0.0
+		if hasRate {
+			v, err := strconv.ParseFloat(rate, 64)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("invalid rate %q", item)
+			}
+			hz = v
+		}
+		if name == "all" {
+			for _, ch := range telemetry.Channels {
+				rates[ch] = hz
+			}
+			continue
+		}
+		rates[name] = hz
+	}
+	return rates, nil
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/mw"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
+)
+
+// handleThresholds serves the threshold history (internal/thresholds):
+//
+//	/thresholds/history          recorded sets, newest first
+//	/thresholds/diff/<id>        changes from entry id to the current file
+//	/thresholds/diff/<id>/<id2>  changes from entry id to entry id2
+//	/thresholds/rollback/<id>    restore entry id and hot-apply it
+//	/thresholds/presets/...      named presets, see handleThresholdPresets
+func handleThresholds(conn net.Conn, pathParts []string) {
+	if len(pathParts) < 3 {
+		sendErrorResponse(conn, 400)
+		return
+	}
+
+	switch pathParts[2] {
+	case "history":
+		history, err := thresholds.Default.History()
+		if err != nil {
+			log.Printf("しきい値履歴の読み込みエラー: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendThresholdsJSON(conn, history)
+
+	case "diff":
+		from, ok := thresholdEntryParam(pathParts, 3)
+		if !ok {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		var to thresholds.Set
+		if len(pathParts) > 4 && pathParts[4] != "" {
+			e, ok := thresholdEntryParam(pathParts, 4)
+			if !ok {
+				sendErrorResponse(conn, 400)
+				return
+			}
+			to = e.Set
+		} else {
+			current, err := thresholds.Default.Load()
+			if err != nil {
+				log.Printf("しきい値ファイル読み込みエラー: %v", err)
+				sendErrorResponse(conn, 500)
+				return
+			}
+			to = current
+		}
+		sendThresholdsJSON(conn, thresholds.Diff(from.Set, to))
+
+	case "rollback":
+		e, ok := thresholdEntryParam(pathParts, 3)
+		if !ok {
+			sendErrorResponse(conn, 400)
+			return
+		}
+		set, err := thresholds.Default.Rollback(e.ID)
+		if err != nil {
+			log.Printf("しきい値ロールバックエラー: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		adj := mw.ReloadAdjustment()
+		log.Printf("Thresholds rolled back to history entry %d", e.ID)
+
+		// The file is already saved; only hot-apply in the camera process.
+		if _, err := applyThresholds(set.Adjustment(), false, thresholds.SourceRollback); err != nil {
+			log.Printf("rollback hot-apply error (applied on next camera restart): %v", err)
+		}
+		sendThresholdsJSON(conn, adj)
+
+	case "presets":
+		handleThresholdPresets(conn, pathParts)
+
+	default:
+		sendErrorResponse(conn, 400)
+	}
+}
+
+// handleThresholdPresets manages the named threshold sets of the robot:
+//
+//	/thresholds/presets                     stored presets
+//	/thresholds/presets/save/<name>         store the current threshold.json as name
+//	/thresholds/presets/apply/<name>[/0|1]  hot-apply name; 1 (default) also saves it
+//	/thresholds/presets/delete/<name>       remove name
+func handleThresholdPresets(conn net.Conn, pathParts []string) {
+	if len(pathParts) < 4 || pathParts[3] == "" {
+		presets, err := thresholds.Default.Presets()
+		if err != nil {
+			log.Printf("しきい値プリセットの読み込みエラー: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		sendThresholdsJSON(conn, presets)
+		return
+	}
+	if len(pathParts) < 5 {
+		sendErrorResponse(conn, 400)
+		return
+	}
+	name := pathParts[4]
+
+	switch pathParts[3] {
+	case "save":
+		current, err := thresholds.Default.Load()
+		if err != nil {
+			log.Printf("しきい値ファイル読み込みエラー: %v", err)
+			sendErrorResponse(conn, 500)
+			return
+		}
+		p, err := thresholds.Default.SavePreset(name, current)
+		if err != nil {
+			sendHTTPResponse(conn, 400, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()))
+			return
+		}
+		log.Printf("Threshold preset %q saved", name)
+		sendThresholdsJSON(conn, p)
+
+	case "apply":
+		save := len(pathParts) < 6 || pathParts[5] != "0"
+		result, err := applyPreset(name, save)
+		if errors.Is(err, errPresetNotFound) {
+			sendHTTPResponse(conn, 400, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()))
+			return
+		}
+		if err != nil {
+			log.Printf("preset apply error: %v", err)
+			sendCameraError(conn, err)
+			return
+		}
+		sendCameraResult(conn, result)
+
+	case "delete":
+		if err := thresholds.Default.DeletePreset(name); err != nil {
+			sendHTTPResponse(conn, 400, "application/json", fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()))
+			return
+		}
+		log.Printf("Threshold preset %q deleted", name)
+		sendHTTPResponse(conn, 200, "application/json", `{"ok":true}`)
+
+	default:
+		sendErrorResponse(conn, 400)
+	}
+}
+
+var errPresetNotFound = errors.New("preset not found")
+
+// applyPreset hot-applies the stored preset name in the camera process and,
+// when save is set, persists it to threshold.json.
+func applyPreset(name string, save bool) (camctl.Thresholds, error) {
+	p, ok := thresholds.Default.Preset(name)
+	if !ok {
+		return camctl.Thresholds{}, fmt.Errorf("%w: %q", errPresetNotFound, name)
+	}
+	result, err := applyThresholds(p.Set.Adjustment(), save, thresholds.SourcePreset)
+	if err != nil {
+		return camctl.Thresholds{}, err
+	}
+	log.Printf("Threshold preset %q applied (save=%v)", name, save)
+	return result, nil
+}
+
+// thresholdEntryParam looks up the history entry whose id is pathParts[i].
+func thresholdEntryParam(pathParts []string, i int) (thresholds.Entry, bool) {
+	if len(pathParts) <= i {
+		return thresholds.Entry{}, false
+	}
+	id, err := strconv.Atoi(pathParts[i])
+	if err != nil {
+		return thresholds.Entry{}, false
+	}
+	return thresholds.Default.Entry(id)
+}
+
+func sendThresholdsJSON(conn net.Conn, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		sendErrorResponse(conn, 500)
+		return
+	}
+	sendHTTPResponse(conn, 200, "application/json", string(body))
+}
@@ -10,6 +10,7 @@ import (
 
 func registerPlatform() {
 	state.IsNewRobot = false
+	state.BoardName = "pi4"
 	pi4.RegisterLink()
 	receive.SetPlayBallDetectedSound(pi4.PlayBallDetectedSound)
 }
@@ -10,6 +10,7 @@ import (
 
 func registerPlatform() {
 	state.IsNewRobot = true
+	state.BoardName = "rock5a"
 	rock5a.RegisterLink()
 	receive.SetPlayBallDetectedSound(rock5a.PlayBallDetectedSound)
 }
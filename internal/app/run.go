@@ -3,25 +3,52 @@
 package app
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net"
 	"os"
 	"os/exec"
 	"os/signal"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/Rione/ssl-RACOON-Pi2/internal/api"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/autocalib"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/balltrack"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camframe"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camgeom"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/config"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/connmgr"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/flightrec"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/logring"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/motorcal"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/mw"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/netif"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/possession"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/receive"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/selftest"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/telemetry"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/upgrade"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/vision"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/wheelgraph"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
 )
 
+// -selftest / -selftest-motion (see runSelfTest).
+var (
+	selfTestMode   bool
+	selfTestMotion bool
+)
+
+// selfTestWarmup lets the link and the camera process start before the
+// -selftest sequence.
+const selfTestWarmup = 3 * time.Second
+
 func kickCheck(done <-chan struct{}) {
 	ticker := time.NewTicker(16 * time.Millisecond)
 	defer ticker.Stop()
@@ -52,6 +79,7 @@ func kickCheck(done <-chan struct{}) {
 }
 
 func Run() {
+	log.SetOutput(io.MultiWriter(os.Stderr, logring.Default.Writer("robot")))
 	parseFlags()
 	registerPlatform()
 
@@ -79,15 +107,17 @@ func Run() {
 		}
 	}
 
+	state.SoftwareVersion = upgrade.CurrentVersion()
 	go upgrade.ConfirmAndSelfUpdate()
 
+	loadConfig()
+
 	initBoard()
 	defer cleanupBoard()
 
 	robotID := readRobotIDFromDIP()
 	fmt.Println("GOT ID FROM DIP SW:", robotID)
 
-	ip := getLocalIP()
 	ipCamera := "127.0.0.1"
 
 	setupSignalHandler()
@@ -96,30 +126,189 @@ func Run() {
 
 	done := make(chan struct{})
 
-	go receive.RunClient(done, myID, ip)
-	go mw.RunServer(done, myID)
-	go runLink(done, myID)
-	go kickCheck(done)
-	go runGPIO(done)
-	go api.Run(done, myID)
-	go receive.ReceiveData(done, myID, ipCamera)
+	configureNetwork(done)
+
+	receive.SetControlHandler(api.HandleControlCommand)
+	link.WatchConnection(connmgr.Default)
+	watchFlightRecorder()
+
+	goRecorded(func() { receive.RunClient(done, myID) })
+	goRecorded(func() { mw.RunServer(done, myID) })
+	goRecorded(func() { runLink(done, myID) })
+	goRecorded(func() { kickCheck(done) })
+	goRecorded(func() { runGPIO(done) })
+	goRecorded(func() { api.Run(done, myID) })
+	goRecorded(func() { receive.ReceiveData(done, myID, ipCamera) })
+	go camframe.Run(done)
 
 	if state.DebugWheelGraph {
 		wheelgraph.SetEnabled(true)
 		go wheelgraph.RunServer(done)
 	}
 
+	if selfTestMode {
+		goRecorded(runSelfTest)
+	}
+
 	select {}
 }
 
+// runSelfTest runs the self-test for -selftest, prints the report as JSON on
+// stdout and exits: 0 when it passed, 1 when a step failed, 2 when it is
+// incomplete.
+func runSelfTest() {
+	time.Sleep(selfTestWarmup)
+	report, err := selftest.Default.Start(selfTestMotion)
+	if err == nil {
+		report, err = selftest.Default.Wait()
+	}
+	if err != nil {
+		log.Fatalf("self-test: %v", err)
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	api.StopPythonProcess()
+	cleanupBoard()
+	switch report.Result {
+	case selftest.ResultPass:
+		os.Exit(0)
+	case selftest.ResultFail:
+		os.Exit(1)
+	default:
+		os.Exit(2)
+	}
+}
+
+// goRecorded runs fn in a goroutine that dumps the flight recorder if it
+// panics.
+func goRecorded(fn func()) {
+	go func() {
+		defer flightrec.Default.DumpOnPanic()
+		fn()
+	}()
+}
+
+// motionReady returns why a routine must not move the robot: it is stopped
+// on purpose, an AI controls it or another routine drives it.
+func motionReady() error {
+	switch {
+	case state.RemoteEmgStop.Load():
+		return errors.New("remote e-stop is active")
+	case state.DryRun.Load():
+		return errors.New("dry-run is on")
+	case state.LastCmdRecvTime.Since() <= state.NoRecvTimeout:
+		return errors.New("an AI is controlling the robot")
+	case link.DriveOverridden():
+		return errors.New("another routine is driving the robot")
+	}
+	return nil
+}
+
+// motorCalibrationRig lets the motor calibration drive the robot through the
+// link.
+func motorCalibrationRig() motorcal.Rig {
+	return motorcal.Rig{
+		Ready: func() error {
+			if selftest.Default.Running() {
+				return errors.New("a self-test is running")
+			}
+			return motionReady()
+		},
+		Spin: func(speed float64) {
+			radius := wheeltrack.Default.Config().Geometry.RadiusM
+			link.OverrideDrive(&link.Drive{Omega: speed / radius, Raw: true})
+		},
+		Stop: func() { link.OverrideDrive(nil) },
+		Measure: func() [wheeltrack.NumWheels]float64 {
+			g := wheeltrack.Default.Config().Geometry
+			v := [wheeltrack.NumWheels]float64{
+				float64(state.FlWheelSpeedRadS), float64(state.BlWheelSpeedRadS),
+				float64(state.BrWheelSpeedRadS), float64(state.FrWheelSpeedRadS),
+			}
+			for i := range v {
+				v[i] *= g.Sign(i)
+			}
+			return v
+		},
+	}
+}
+
+// selfTestRobot connects the self-test to the link, the camera and the
+// buzzer and LEDs.
+func selfTestRobot() selftest.Robot {
+	return selftest.Robot{
+		Read: func() selftest.Reading {
+			rd := state.Recvdata
+			return selftest.Reading{
+				Frames:   state.LinkRxFrames.Load(),
+				RxErrors: state.LinkRxErrors.Load(),
+				TxErrors: state.LinkTxErrors.Load(),
+				Volt:     float64(rd.Volt) / 10,
+				CapPower: rd.CapPower,
+				Wheels: [wheeltrack.NumWheels]float64{
+					float64(state.FlWheelSpeedRadS), float64(state.BlWheelSpeedRadS),
+					float64(state.BrWheelSpeedRadS), float64(state.FrWheelSpeedRadS),
+				},
+			}
+		},
+		MotionReady: func() error {
+			if job, ok := motorcal.DefaultRunner.Job(); ok && job.State == motorcal.StateRunning {
+				return errors.New("a motor calibration is running")
+			}
+			return motionReady()
+		},
+		Drive: func(c *selftest.Command) {
+			if c == nil {
+				link.OverrideDrive(nil)
+				return
+			}
+			link.OverrideDrive(&link.Drive{VX: c.VX, VY: c.VY, Omega: c.Omega, Raw: true, Dribble: c.Dribble, Charge: c.Charge})
+		},
+		Camera: func() (float64, time.Duration, bool) {
+			age, ok := state.CameraAge()
+			return float64(state.CameraFPS.Load()), age, ok
+		},
+		Signal: func(d time.Duration) {
+			link.SetLEDTest(true)
+			defer link.SetLEDTest(false)
+			end := time.Now().Add(d)
+			link.RingBuzzerSync(9, d/2, 0)
+			link.RingBuzzerSync(16, d/2, 0)
+			time.Sleep(time.Until(end))
+		},
+	}
+}
+
+// watchFlightRecorder records connection changes and faults in the flight
+// recorder and dumps it when a fault is raised.
+func watchFlightRecorder() {
+	connmgr.Default.Subscribe(func(ev connmgr.Event) {
+		flightrec.Default.Event("connection", ev.String())
+	})
+	fault.Subscribe(func(f fault.Fault, raised bool) {
+		if !raised {
+			flightrec.Default.Event("fault", fmt.Sprintf("[%d] cleared", f.Code))
+			return
+		}
+		flightrec.Default.Event("fault", fmt.Sprintf("[%d] %s", f.Code, f.Message))
+		flightrec.Default.Trigger(fmt.Sprintf("fault-%d", f.Code))
+	})
+}
+
 func parseFlags() {
 	flag.BoolVar(&state.DebugSerial, "ds", false, "ロボットリンク送受信のモニタリングを有効化")
 	flag.BoolVar(&state.DebugReceive, "dr", false, "AIからの受信結果表示を有効化")
 	flag.BoolVar(&state.DebugCamera, "dc", false, "カメラプロセスのデバッグログを有効化")
 	flag.BoolVar(&state.DebugWheelGraph, "dw", false, "Wheel(raw)のリアルタイムグラフを有効化 (http://<robot>:9192/wheel-graph)")
-	flag.BoolVar(&state.DryRun, "dryrun", false, "serial/SPIへ速度・キック等の動作指令を送らない")
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dryrun", false, "serial/SPIへ速度・キック等の動作指令を送らない")
 	flag.BoolVar(&state.VelX1000, "velx1000", false, "テスト用: VelX=1000 を送信フレームに設定")
+	flag.BoolVar(&selfTestMode, "selftest", false, "自己診断を実行し、結果の JSON を表示して終了")
+	flag.BoolVar(&selfTestMotion, "selftest-motion", false, "自己診断でホイール・ドリブラー・充電も試験する（ロボットが動きます。-selftest を含む）")
 	flag.Parse()
+	selfTestMode = selfTestMode || selfTestMotion
+	state.DryRun.Store(dryRun)
 
 	if state.DebugSerial {
 		log.Println("Debug Mode: Link monitoring enabled (-ds)")
@@ -133,12 +322,144 @@ func parseFlags() {
 	if state.DebugWheelGraph {
 		log.Println("Debug Mode: Wheel(raw) graph enabled (-dw)")
 	}
-	if state.DryRun {
+	if dryRun {
 		log.Println("Dry-run mode: motion commands are not sent on serial/SPI (-dryrun)")
 	}
 	if state.VelX1000 {
 		log.Println("Test mode: VelX=1000 (-velx1000)")
 	}
+	if selfTestMode {
+		log.Printf("Self-test mode: the robot exits after the self-test (-selftest, motion steps: %v)", selfTestMotion)
+	}
+}
+
+// loadConfig reads config.json and applies it to the connection manager. An
+// invalid file is reported and the defaults are kept.
+func loadConfig() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("config load error (using defaults): %v", err)
+	}
+	cc := cfg.Connection
+	connmgr.Default.Configure(connmgr.Config{
+		DiscoverInterval:    config.Ms(cc.DiscoverIntervalMs),
+		DiscoverMaxInterval: config.Ms(cc.DiscoverMaxIntervalMs),
+		DiscoverBackoff:     cc.DiscoverBackoff,
+		OkInterval:          config.Ms(cc.OkIntervalMs),
+		LostTimeout:         config.Ms(cc.LostTimeoutMs),
+		RecoverHold:         config.Ms(cc.RecoverHoldMs),
+		Timeout:             config.Ms(cc.TimeoutMs),
+	})
+	state.CameraStaleTimeout = config.Ms(cfg.Camera.StaleTimeoutMs)
+	policy, _ := vision.ParsePolicy(cfg.Camera.BallPolicy)
+	vision.Default.Configure(policy, cfg.Camera.MinBallConfidence)
+	mw.SetForwardDetections(cfg.Camera.ForwardDetections)
+	tc, ex := cfg.Camera.Tracker, cfg.Camera.Extrinsics
+	balltrack.Default.Configure(balltrack.Config{
+		Alpha:       tc.Alpha,
+		Beta:        tc.Beta,
+		MaxCoast:    config.Ms(tc.MaxCoastMs),
+		Gate:        tc.GatePx,
+		MaxOutliers: tc.MaxOutliers,
+		Ground:      camgeom.Default,
+	})
+	ac := cfg.Camera.AutoCalib
+	autocalib.Default.Configure(autocalib.Config{
+		Enabled:          ac.Enabled,
+		Window:           time.Duration(ac.WindowSec) * time.Second,
+		MinSamples:       ac.MinSamples,
+		MinDetectionRate: ac.MinDetectionRate,
+		MinCircularity:   ac.MinCircularity,
+		MinInterval:      time.Duration(ac.MinIntervalSec) * time.Second,
+		MaxPerHour:       ac.MaxPerHour,
+	})
+	pc := cfg.Camera.Possession
+	possession.Default.Configure(possession.Config{
+		Acquire:      config.Ms(pc.AcquireMs),
+		Release:      config.Ms(pc.ReleaseMs),
+		CameraWindow: config.Ms(pc.CameraWindowMs),
+		GateKick:     pc.GateKick,
+	})
+	possession.DefaultRecorder.Configure(possession.SampleConfig{
+		Enabled:    pc.Samples.Enabled,
+		Interval:   config.Ms(pc.Samples.IntervalMs),
+		MaxSamples: pc.Samples.MaxSamples,
+	})
+	wc := cfg.Wheels
+	wheeltrack.Default.Configure(wheeltrack.Config{
+		Geometry: wheeltrack.Geometry{
+			AnglesDeg: wc.AnglesDeg,
+			RadiusM:   wc.RadiusMm / 1000,
+			Inverted:  wc.Inverted,
+		},
+		Window:     config.Ms(wc.Tracking.WindowMs),
+		MinSpeed:   wc.Tracking.MinSpeed,
+		StallRatio: wc.Tracking.StallRatio,
+		Faults:     wc.Tracking.Faults,
+	})
+	if err := motorcal.Default.Load(); err != nil {
+		log.Printf("motor calibration load error (uncalibrated): %v", err)
+	}
+	motorcal.DefaultRunner.Configure(motorCalibrationRig(), motorcal.RoutineConfig{
+		Speeds: wc.Calibration.Speeds,
+		Settle: config.Ms(wc.Calibration.SettleMs),
+		Sample: config.Ms(wc.Calibration.SampleMs),
+	})
+	st := cfg.SelfTest
+	selftest.Default.Configure(selfTestRobot(), selftest.Config{
+		Window:         config.Ms(st.WindowMs),
+		MinLinkRate:    st.MinLinkRate,
+		MaxLinkErrors:  st.MaxLinkErrors,
+		MinVolt:        st.MinVolt,
+		MaxVolt:        st.MaxVolt,
+		MinCameraFPS:   st.MinCameraFps,
+		CameraTimeout:  config.Ms(st.CameraTimeoutMs),
+		SignalTime:     config.Ms(st.SignalMs),
+		WheelSpeed:     st.WheelSpeed,
+		WheelTolerance: st.WheelTolerance,
+		Settle:         config.Ms(st.SettleMs),
+		Sample:         config.Ms(st.SampleMs),
+		DribblePower:   uint8(st.DribblePower),
+		DribbleTime:    config.Ms(st.DribbleMs),
+		MinCapPower:    uint8(st.MinCapPower),
+		ChargeTimeout:  config.Ms(st.ChargeTimeoutMs),
+	})
+	fr := cfg.FlightRecorder
+	flightrec.Default.Configure(flightrec.Config{
+		Window:      time.Duration(fr.WindowSec) * time.Second,
+		MaxEntries:  fr.MaxEntries,
+		MaxDumps:    fr.MaxDumps,
+		MinInterval: time.Duration(fr.MinDumpIntervalSec) * time.Second,
+	})
+	tm := cfg.Telemetry
+	telemetry.Default.Configure(telemetry.Config{
+		Rate:       tm.RateHz,
+		MaxRate:    tm.MaxRateHz,
+		MaxClients: tm.MaxClients,
+		Buffer:     tm.Buffer,
+	})
+	camgeom.Default.SetExtrinsics(camgeom.Extrinsics{
+		HeightMm:      ex.HeightMm,
+		PitchDeg:      ex.PitchDeg,
+		YawDeg:        ex.YawDeg,
+		OffsetXMm:     ex.OffsetXMm,
+		OffsetYMm:     ex.OffsetYMm,
+		FocalLengthPx: ex.FocalLengthPx,
+		BallRadiusMm:  ex.BallRadiusMm,
+	})
+	if err := camgeom.Default.Reload(); err != nil {
+		log.Printf("camera calibration load error (using config extrinsics): %v", err)
+	}
+	state.CameraSmoothMCU = tc.SmoothMCU
+
+	// Lists are validated by config.Load.
+	allowed, _ := config.ParseIPs(cc.AllowedControllers)
+	preferred, _ := config.ParseIPs(cc.PreferredControllers)
+	connmgr.Default.SetPolicy(connmgr.Policy{
+		Allowed:           allowed,
+		Preferred:         preferred,
+		PreferredTakeover: cc.PreferredTakeover,
+	})
 }
 
 func getHostname() string {
@@ -150,51 +471,25 @@ func getHostname() string {
 	return string(out)
 }
 
-func getLocalIP() string {
-	ifaces, err := net.Interfaces()
-	if err != nil {
-		log.Println("Local IP for AI receive: not found (using 0.0.0.0)")
-		return "0.0.0.0"
-	}
-	for _, iface := range ifaces {
-		if !interfaceLinkUp(iface) {
-			continue
-		}
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
-		}
-		for _, addr := range addrs {
-			ipNet, ok := addr.(*net.IPNet)
-			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
-				continue
-			}
-			ip := ipNet.IP.String()
-			// 同じNICのMACアドレスを記録しておく。RAVEN側で各ロボットの基板を
-			// 一意に識別し、モータ個体差の管理に使う。
-			if mac := iface.HardwareAddr.String(); mac != "" {
-				state.MACAddress = mac
-				log.Printf("Local MAC for AI receive: %s (%s)", mac, iface.Name)
-			}
-			log.Printf("Local IP for AI receive: %s (%s)", ip, iface.Name)
-			return ip
+// configureNetwork selects the interface for the AI/MW sockets from
+// config.json and keeps watching it for address changes.
+func configureNetwork(done <-chan struct{}) {
+	nc := config.Get().Network
+	subnet, _ := nc.ParseSubnet() // validated by config.Load
+	netif.Default.Configure(netif.Selector{
+		Interface: nc.Interface,
+		Subnet:    subnet,
+		IPv6:      nc.IPv6Multicast,
+	})
+	// 同じNICのMACアドレスを記録しておく。RAVEN側で各ロボットの基板を
+	// 一意に識別し、モータ個体差の管理に使う。
+	netif.Default.Subscribe(func(b netif.Binding) {
+		if b.Iface != nil && b.Iface.HardwareAddr.String() != "" {
+			state.MACAddress = b.Iface.HardwareAddr.String()
 		}
-	}
-	log.Println("Local IP for AI receive: not found (using 0.0.0.0)")
-	return "0.0.0.0"
-}
-
-// interfaceLinkUp reports whether the interface has an active link (not merely admin-up).
-// On Linux, eth0 can stay FlagUp with NO-CARRIER; operstate stays "down" until carrier is present.
-func interfaceLinkUp(iface net.Interface) bool {
-	if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
-		return false
-	}
-	data, err := os.ReadFile(filepath.Join("/sys/class/net", iface.Name, "operstate"))
-	if err != nil {
-		return iface.Flags&net.FlagRunning != 0
-	}
-	return strings.TrimSpace(string(data)) == "up"
+	})
+	netif.Default.Refresh()
+	go netif.Default.Run(done, config.Ms(nc.RebindIntervalMs))
 }
 
 func setupSignalHandler() {
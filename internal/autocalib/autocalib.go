@@ -0,0 +1,437 @@
+// Package autocalib re-tunes the ball colour thresholds when the detection
+// quality drops, so that a change of lighting does not need a human at
+// /calibballcolor or /relaxcolor.
+//
+// The monitor evaluates the camera once per window:
+//
+//   - detection rate: the share of camera frames with a ball while the photo
+//     sensor (state.SensorPhotoMask) reports the ball at the dribbler, i.e.
+//     frames where the ball must be visible;
+//   - contour circularity: the mean circularity of the largest HSV contour,
+//     read from the camera process (camctl.MethodDetectStats).
+//
+// A window is only judged when the photo sensor saw the ball in at least
+// MinSamples frames. A low detection rate first widens the thresholds (relax
+// step); when the rate is still low in a later window, or when the contours
+// are not round (the mask picks up the wrong shape, which relaxing would make
+// worse), a YOLO calibration is run and applied. Actions are rate limited
+// (MinInterval, MaxPerHour) and every action is appended to LogFile with the
+// statistics and the thresholds before and after.
+package autocalib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+)
+
+const (
+	// LogFile is the audit log of automatic changes, next to threshold.json.
+	LogFile = "autocalib_log.json"
+	// LogLimit is how many entries LogFile keeps.
+	LogLimit = 100
+
+	statsTimeout  = 5 * time.Second
+	actionTimeout = 60 * time.Second
+)
+
+// Actions.
+const (
+	ActionRelax     = "relax"
+	ActionCalibrate = "calibrate"
+)
+
+// Config tunes the monitor.
+type Config struct {
+	Enabled bool
+	// Window is the evaluation period.
+	Window time.Duration
+	// MinSamples is how many frames with the photo sensor on a window needs
+	// to be judged.
+	MinSamples int
+	// MinDetectionRate is the lowest acceptable detection rate (0-1).
+	MinDetectionRate float64
+	// MinCircularity is the lowest acceptable mean contour circularity (0-1).
+	// 0 disables the check.
+	MinCircularity float64
+	// MinInterval is the shortest time between two actions.
+	MinInterval time.Duration
+	// MaxPerHour caps the actions in any hour.
+	MaxPerHour int
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{
+	Window:           10 * time.Second,
+	MinSamples:       30,
+	MinDetectionRate: 0.6,
+	MinCircularity:   0.5,
+	MinInterval:      time.Minute,
+	MaxPerHour:       6,
+}
+
+// Actions are the camera operations of the monitor, provided by the API.
+type Actions struct {
+	// Stats reads and resets the detector statistics of the camera process.
+	Stats func(ctx context.Context) (camctl.DetectStats, error)
+	// Relax widens and saves the thresholds, Calibrate runs and applies a
+	// YOLO calibration. Both return the thresholds in effect afterwards.
+	Relax     func(ctx context.Context) (state.Adjustment, error)
+	Calibrate func(ctx context.Context) (state.Adjustment, error)
+	// Current returns the thresholds in effect.
+	Current func() state.Adjustment
+	// Busy reports a calibration started by a user; the monitor waits.
+	Busy func() bool
+}
+
+// Stats is the evaluation of one window.
+type Stats struct {
+	// Samples is the number of camera frames with the photo sensor on,
+	// Detected those with a ball.
+	Samples       int     `json:"samples"`
+	Detected      int     `json:"detected"`
+	DetectionRate float64 `json:"detectionRate"`
+	// Camera is nil when the camera process did not answer.
+	Camera *camctl.DetectStats `json:"camera"`
+}
+
+// Entry is one automatic change in LogFile.
+type Entry struct {
+	Time   time.Time        `json:"time"`
+	Action string           `json:"action"`
+	Reason string           `json:"reason"`
+	Stats  Stats            `json:"stats"`
+	Before state.Adjustment `json:"before"`
+	// After is nil when the action failed.
+	After *state.Adjustment `json:"after"`
+	OK    bool              `json:"ok"`
+	Error string            `json:"error,omitempty"`
+}
+
+// Status is the monitor state for the API.
+type Status struct {
+	Enabled          bool    `json:"enabled"`
+	WindowSec        float64 `json:"windowSec"`
+	MinSamples       int     `json:"minSamples"`
+	MinDetectionRate float64 `json:"minDetectionRate"`
+	MinCircularity   float64 `json:"minCircularity"`
+	MinIntervalSec   float64 `json:"minIntervalSec"`
+	MaxPerHour       int     `json:"maxPerHour"`
+
+	// LastCheck and LastStats describe the last evaluated window, Decision
+	// what was done about it ("ok", "insufficient samples", an action or
+	// the reason it was skipped).
+	LastCheck  *time.Time `json:"lastCheck"`
+	LastStats  *Stats     `json:"lastStats"`
+	Decision   string     `json:"decision"`
+	LastAction *Entry     `json:"lastAction"`
+	// ActionsLastHour counts towards MaxPerHour.
+	ActionsLastHour int `json:"actionsLastHour"`
+	// Relaxed is true after a relax step until the quality recovers; a
+	// further low window escalates to a calibration.
+	Relaxed bool `json:"relaxed"`
+}
+
+// Monitor watches the detection quality. It is safe for concurrent use.
+type Monitor struct {
+	dir string
+	now func() time.Time
+
+	mu       sync.Mutex
+	cfg      Config
+	samples  int
+	detected int
+
+	relaxed    bool
+	actions    []time.Time // within the last hour
+	lastCheck  time.Time
+	lastStats  *Stats
+	decision   string
+	lastAction *Entry
+
+	logMu sync.Mutex
+}
+
+// New returns a monitor that writes its log to dir.
+func New(dir string) *Monitor {
+	return &Monitor{dir: dir, now: time.Now, cfg: DefaultConfig}
+}
+
+// Default monitors the camera of this robot.
+var Default = New(".")
+
+// Configure replaces the configuration and starts a new window.
+func (m *Monitor) Configure(cfg Config) {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.samples, m.detected = 0, 0
+	m.mu.Unlock()
+}
+
+// SetEnabled switches the monitor on or off at runtime.
+func (m *Monitor) SetEnabled(enabled bool) {
+	m.mu.Lock()
+	if m.cfg.Enabled != enabled {
+		m.cfg.Enabled = enabled
+		m.samples, m.detected = 0, 0
+		m.relaxed = false
+	}
+	m.mu.Unlock()
+}
+
+// Observe counts one camera frame. photo is the photo sensor state, detected
+// whether the frame had a ball.
+func (m *Monitor) Observe(photo, detected bool) {
+	if !photo {
+		return
+	}
+	m.mu.Lock()
+	if m.cfg.Enabled {
+		m.samples++
+		if detected {
+			m.detected++
+		}
+	}
+	m.mu.Unlock()
+}
+
+// Run evaluates a window every Config.Window until done.
+func (m *Monitor) Run(done <-chan struct{}, actions Actions) {
+	window := m.Config().Window
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.Check(actions)
+			if w := m.Config().Window; w != window {
+				window = w
+				ticker.Reset(window)
+			}
+		}
+	}
+}
+
+// Config returns the current configuration.
+func (m *Monitor) Config() Config {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg
+}
+
+// Check evaluates the current window and acts on it. It returns the entry of
+// the action taken, nil when there was none.
+func (m *Monitor) Check(actions Actions) *Entry {
+	m.mu.Lock()
+	if !m.cfg.Enabled {
+		m.mu.Unlock()
+		return nil
+	}
+	cfg := m.cfg
+	stats := Stats{Samples: m.samples, Detected: m.detected}
+	m.samples, m.detected = 0, 0
+	m.mu.Unlock()
+
+	if stats.Samples > 0 {
+		stats.DetectionRate = float64(stats.Detected) / float64(stats.Samples)
+	}
+	// Read the camera statistics every window so that the next one starts
+	// fresh, even when this window is not judged.
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	cam, err := actions.Stats(ctx)
+	cancel()
+	if err == nil {
+		stats.Camera = &cam
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	m.lastCheck = now
+	m.lastStats = &stats
+	action, reason := m.decideLocked(cfg, stats)
+	if action == "" {
+		m.decision = reason
+		m.mu.Unlock()
+		return nil
+	}
+	if skip := m.limitLocked(cfg, now); skip != "" {
+		m.decision = fmt.Sprintf("%s skipped: %s", action, skip)
+		m.mu.Unlock()
+		return nil
+	}
+	if actions.Busy != nil && actions.Busy() {
+		m.decision = action + " skipped: calibration in progress"
+		m.mu.Unlock()
+		return nil
+	}
+	m.actions = append(m.actions, now)
+	m.decision = action
+	m.mu.Unlock()
+
+	entry := m.execute(actions, action, reason, stats, now)
+
+	m.mu.Lock()
+	m.lastAction = &entry
+	if entry.OK {
+		// A relax step is followed by a calibration if it did not help; a
+		// calibration starts over.
+		m.relaxed = action == ActionRelax
+	}
+	m.mu.Unlock()
+	return &entry
+}
+
+// decideLocked returns the action for a window and why, or "" and the
+// decision when nothing is to be done.
+func (m *Monitor) decideLocked(cfg Config, s Stats) (action, reason string) {
+	if s.Samples < cfg.MinSamples {
+		return "", "insufficient samples"
+	}
+	if c := s.Camera; cfg.MinCircularity > 0 && c != nil && c.Contours > 0 && c.Circularity < cfg.MinCircularity {
+		return ActionCalibrate, fmt.Sprintf("circularity %.2f < %.2f", c.Circularity, cfg.MinCircularity)
+	}
+	if s.DetectionRate >= cfg.MinDetectionRate {
+		m.relaxed = false
+		return "", "ok"
+	}
+	reason = fmt.Sprintf("detection rate %.2f < %.2f (%d/%d)", s.DetectionRate, cfg.MinDetectionRate, s.Detected, s.Samples)
+	if m.relaxed {
+		return ActionCalibrate, reason + " after relax"
+	}
+	return ActionRelax, reason
+}
+
+// limitLocked returns why an action is not allowed now, "" when it is.
+func (m *Monitor) limitLocked(cfg Config, now time.Time) string {
+	kept := m.actions[:0]
+	for _, t := range m.actions {
+		if now.Sub(t) < time.Hour {
+			kept = append(kept, t)
+		}
+	}
+	m.actions = kept
+	if n := len(m.actions); n > 0 && now.Sub(m.actions[n-1]) < cfg.MinInterval {
+		return "rate limited (minInterval)"
+	}
+	if len(m.actions) >= cfg.MaxPerHour {
+		return "rate limited (maxPerHour)"
+	}
+	return ""
+}
+
+func (m *Monitor) execute(actions Actions, action, reason string, stats Stats, now time.Time) Entry {
+	entry := Entry{Time: now, Action: action, Reason: reason, Stats: stats, Before: actions.Current()}
+	log.Printf("[autocalib] %s: %s", action, reason)
+
+	run := actions.Relax
+	if action == ActionCalibrate {
+		run = actions.Calibrate
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	after, err := run(ctx)
+	cancel()
+	if err != nil {
+		entry.Error = err.Error()
+		log.Printf("[autocalib] %s failed: %v", action, err)
+	} else {
+		entry.OK = true
+		entry.After = &after
+	}
+
+	if err := m.appendLog(entry); err != nil {
+		log.Printf("[autocalib] log write error: %v", err)
+	}
+	return entry
+}
+
+// Status returns the monitor state.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg := m.cfg
+	st := Status{
+		Enabled:          cfg.Enabled,
+		WindowSec:        cfg.Window.Seconds(),
+		MinSamples:       cfg.MinSamples,
+		MinDetectionRate: cfg.MinDetectionRate,
+		MinCircularity:   cfg.MinCircularity,
+		MinIntervalSec:   cfg.MinInterval.Seconds(),
+		MaxPerHour:       cfg.MaxPerHour,
+		LastStats:        m.lastStats,
+		Decision:         m.decision,
+		LastAction:       m.lastAction,
+		Relaxed:          m.relaxed,
+	}
+	if !m.lastCheck.IsZero() {
+		t := m.lastCheck
+		st.LastCheck = &t
+	}
+	now := m.now()
+	for _, t := range m.actions {
+		if now.Sub(t) < time.Hour {
+			st.ActionsLastHour++
+		}
+	}
+	return st
+}
+
+// Log returns the audit log, newest first.
+func (m *Monitor) Log() ([]Entry, error) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	entries, err := m.readLogLocked()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, len(entries))
+	for i, e := range entries {
+		out[len(entries)-1-i] = e
+	}
+	return out, nil
+}
+
+func (m *Monitor) appendLog(e Entry) error {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	entries, err := m.readLogLocked()
+	if err != nil {
+		log.Printf("[autocalib] %s unreadable, starting a new log: %v", LogFile, err)
+		entries = nil
+	}
+	entries = append(entries, e)
+	if len(entries) > LogLimit {
+		entries = entries[len(entries)-LogLimit:]
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(m.dir, LogFile), append(data, '\n'))
+}
+
+func (m *Monitor) readLogLocked() ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(m.dir, LogFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", LogFile, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,166 @@
+package autocalib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+)
+
+type fakeCamera struct {
+	stats     camctl.DetectStats
+	statsErr  error
+	actionErr error
+	busy      bool
+	calls     []string
+}
+
+func (f *fakeCamera) actions() Actions {
+	adj := state.DefaultAdjustment
+	run := func(name, min string) func(context.Context) (state.Adjustment, error) {
+		return func(context.Context) (state.Adjustment, error) {
+			f.calls = append(f.calls, name)
+			if f.actionErr != nil {
+				return state.Adjustment{}, f.actionErr
+			}
+			adj.MinThreshold = min
+			return adj, nil
+		}
+	}
+	return Actions{
+		Stats: func(context.Context) (camctl.DetectStats, error) {
+			return f.stats, f.statsErr
+		},
+		Relax:     run(ActionRelax, "0,100,80"),
+		Calibrate: run(ActionCalibrate, "5,130,110"),
+		Current:   func() state.Adjustment { return adj },
+		Busy:      func() bool { return f.busy },
+	}
+}
+
+func newMonitor(t *testing.T) (*Monitor, *time.Time) {
+	m := New(t.TempDir())
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	cfg := DefaultConfig
+	cfg.Enabled = true
+	cfg.MinSamples = 10
+	cfg.MaxPerHour = 3
+	m.Configure(cfg)
+	return m, &now
+}
+
+// observe feeds n frames with the photo sensor on, hits of them with a ball.
+func observe(m *Monitor, n, hits int) {
+	for i := 0; i < n; i++ {
+		m.Observe(true, i < hits)
+	}
+	m.Observe(false, false) // ignored
+}
+
+func TestEscalation(t *testing.T) {
+	m, now := newMonitor(t)
+	cam := &fakeCamera{stats: camctl.DetectStats{Contours: 20, Circularity: 0.8}}
+	actions := cam.actions()
+
+	observe(m, 5, 0)
+	if e := m.Check(actions); e != nil || m.Status().Decision != "insufficient samples" {
+		t.Fatalf("few samples: entry %+v, decision %q", e, m.Status().Decision)
+	}
+
+	observe(m, 20, 18)
+	if e := m.Check(actions); e != nil || m.Status().Decision != "ok" {
+		t.Fatalf("good window: entry %+v, decision %q", e, m.Status().Decision)
+	}
+
+	observe(m, 20, 4)
+	e := m.Check(actions)
+	if e == nil || e.Action != ActionRelax || !e.OK || e.After.MinThreshold != "0,100,80" || e.Stats.DetectionRate != 0.2 {
+		t.Fatalf("low rate: %+v", e)
+	}
+
+	// Still low after the relax step: calibrate.
+	*now = now.Add(2 * time.Minute)
+	observe(m, 20, 4)
+	e = m.Check(actions)
+	if e == nil || e.Action != ActionCalibrate || e.Before.MinThreshold != "0,100,80" {
+		t.Fatalf("low rate after relax: %+v", e)
+	}
+
+	// Low circularity calibrates right away.
+	*now = now.Add(2 * time.Minute)
+	cam.stats.Circularity = 0.3
+	observe(m, 20, 20)
+	if e := m.Check(actions); e == nil || e.Action != ActionCalibrate {
+		t.Fatalf("low circularity: %+v", e)
+	}
+
+	log, err := m.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 3 || log[0].Action != ActionCalibrate || log[2].Action != ActionRelax {
+		t.Fatalf("log = %+v", log)
+	}
+	if len(cam.calls) != 3 || cam.calls[0] != ActionRelax || cam.calls[1] != ActionCalibrate {
+		t.Fatalf("calls = %v", cam.calls)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	m, now := newMonitor(t)
+	cam := &fakeCamera{statsErr: errors.New("camera down")}
+	actions := cam.actions()
+	low := func() *Entry {
+		observe(m, 20, 0)
+		return m.Check(actions)
+	}
+
+	if e := low(); e == nil || e.Stats.Camera != nil {
+		t.Fatalf("first action: %+v", e)
+	}
+	*now = now.Add(30 * time.Second)
+	if e := low(); e != nil || m.Status().Decision != "calibrate skipped: rate limited (minInterval)" {
+		t.Fatalf("within minInterval: %+v, %q", e, m.Status().Decision)
+	}
+
+	cam.actionErr = errors.New("tuner down")
+	for i := 0; i < 2; i++ {
+		*now = now.Add(2 * time.Minute)
+		if e := low(); e == nil || e.OK || e.Error != "tuner down" {
+			t.Fatalf("failed action: %+v", e)
+		}
+	}
+	*now = now.Add(2 * time.Minute)
+	if e := low(); e != nil || m.Status().ActionsLastHour != 3 {
+		t.Fatalf("maxPerHour: %+v, status %+v", e, m.Status())
+	}
+
+	*now = now.Add(time.Hour)
+	cam.actionErr = nil
+	cam.busy = true
+	if e := low(); e != nil || m.Status().Decision != "calibrate skipped: calibration in progress" {
+		t.Fatalf("busy: %+v, %q", e, m.Status().Decision)
+	}
+	cam.busy = false
+	if e := low(); e == nil || !e.OK {
+		t.Fatalf("after an hour: %+v", e)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	m, _ := newMonitor(t)
+	cam := &fakeCamera{}
+	m.SetEnabled(false)
+	observe(m, 20, 0)
+	if e := m.Check(cam.actions()); e != nil || len(cam.calls) != 0 || m.Status().LastCheck != nil {
+		t.Fatalf("disabled monitor acted: %+v", e)
+	}
+	m.SetEnabled(true)
+	if e := m.Check(cam.actions()); e != nil || m.Status().Decision != "insufficient samples" {
+		t.Fatalf("samples from the disabled period were kept: %+v", e)
+	}
+}
@@ -0,0 +1,202 @@
+// Package balltrack smooths the tracked camera ball with an alpha-beta filter.
+//
+// Measurements are the selected ball's graph coordinates (pixels, origin at the
+// frame centre, y up; see internal/camproto). The tracker estimates position
+// and velocity, keeps predicting through short dropouts (coasting), rejects
+// measurements that jump further than a gate from the prediction, and can
+// project the estimate onto the floor in robot coordinates (see Projector and
+// internal/camgeom).
+package balltrack
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Config tunes the filter.
+type Config struct {
+	// Alpha and Beta are the position and velocity gains (0 < Alpha <= 1,
+	// 0 <= Beta < 2).
+	Alpha float64
+	Beta  float64
+	// MaxCoast is how long the track is kept (and extrapolated) without an
+	// accepted measurement.
+	MaxCoast time.Duration
+	// Gate is the largest accepted distance in pixels between a measurement
+	// and the prediction. 0 disables outlier rejection.
+	Gate float64
+	// MaxOutliers is how many consecutive gated measurements restart the
+	// track at the new position (the ball really moved, e.g. it was kicked).
+	MaxOutliers int
+	// Ground projects the estimate onto the floor. nil disables it.
+	Ground Projector
+}
+
+// Projector maps graph coordinates to robot coordinates in mm (x forward,
+// y left). ok is false when the point is not on the floor.
+type Projector interface {
+	Project(x, y float64) (gx, gy float64, ok bool)
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{
+	Alpha:       0.6,
+	Beta:        0.2,
+	MaxCoast:    300 * time.Millisecond,
+	Gate:        80,
+	MaxOutliers: 3,
+}
+
+// State is a track estimate.
+type State struct {
+	// Valid is false when there is no track.
+	Valid bool
+	// Coasting is true while the estimate is extrapolated because the last
+	// frames had no (accepted) ball.
+	Coasting bool
+	// Age is the time since the last accepted measurement.
+	Age time.Duration
+
+	// X, Y in pixels and VX, VY in pixels/s, graph coordinates.
+	X, Y, VX, VY float64
+
+	// Ground is true when GroundX/Y (mm) and GroundVX/VY (mm/s) are set:
+	// robot coordinates, x forward and y to the left of the robot centre.
+	Ground             bool
+	GroundX, GroundY   float64
+	GroundVX, GroundVY float64
+}
+
+// Tracker is a single-ball alpha-beta tracker. It is safe for concurrent use.
+type Tracker struct {
+	mu  sync.Mutex
+	cfg Config
+
+	valid    bool
+	coasting bool
+	outliers int
+	t        time.Time // time of x/y/vx/vy (last accepted measurement)
+	x, y     float64
+	vx, vy   float64
+}
+
+// New returns a tracker with the given configuration.
+func New(cfg Config) *Tracker {
+	return &Tracker{cfg: cfg}
+}
+
+// Default tracks the ball selected from the camera stream.
+var Default = New(DefaultConfig)
+
+// Configure replaces the configuration and drops the current track.
+func (tr *Tracker) Configure(cfg Config) {
+	tr.mu.Lock()
+	tr.cfg = cfg
+	tr.valid = false
+	tr.mu.Unlock()
+}
+
+// Config returns the current configuration.
+func (tr *Tracker) Config() Config {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.cfg
+}
+
+// Update feeds one camera frame captured at t. seen is false when the frame
+// had no ball; x/y are then ignored.
+func (tr *Tracker) Update(t time.Time, x, y float64, seen bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.valid && t.Sub(tr.t) > tr.cfg.MaxCoast {
+		tr.valid = false
+	}
+	if !seen {
+		tr.coasting = tr.valid
+		return
+	}
+	if !tr.valid {
+		tr.resetLocked(t, x, y)
+		return
+	}
+
+	dt := t.Sub(tr.t).Seconds()
+	if dt <= 0 {
+		dt = 1e-3
+	}
+	px, py := tr.x+tr.vx*dt, tr.y+tr.vy*dt
+	rx, ry := x-px, y-py
+	if tr.cfg.Gate > 0 && math.Hypot(rx, ry) > tr.cfg.Gate {
+		tr.outliers++
+		if tr.outliers > tr.cfg.MaxOutliers {
+			tr.resetLocked(t, x, y)
+			return
+		}
+		tr.coasting = true
+		return
+	}
+
+	tr.x = px + tr.cfg.Alpha*rx
+	tr.y = py + tr.cfg.Alpha*ry
+	tr.vx += tr.cfg.Beta / dt * rx
+	tr.vy += tr.cfg.Beta / dt * ry
+	tr.t = t
+	tr.outliers = 0
+	tr.coasting = false
+}
+
+func (tr *Tracker) resetLocked(t time.Time, x, y float64) {
+	tr.valid = true
+	tr.coasting = false
+	tr.outliers = 0
+	tr.t = t
+	tr.x, tr.y = x, y
+	tr.vx, tr.vy = 0, 0
+}
+
+// Estimate returns the track at now. While coasting the position is
+// extrapolated with the estimated velocity.
+func (tr *Tracker) Estimate(now time.Time) State {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	age := now.Sub(tr.t)
+	if !tr.valid || age > tr.cfg.MaxCoast {
+		return State{}
+	}
+	s := State{
+		Valid:    true,
+		Coasting: tr.coasting,
+		Age:      age,
+		X:        tr.x,
+		Y:        tr.y,
+		VX:       tr.vx,
+		VY:       tr.vy,
+	}
+	if s.Coasting && age > 0 {
+		s.X += s.VX * age.Seconds()
+		s.Y += s.VY * age.Seconds()
+	}
+	if tr.cfg.Ground != nil {
+		s.Ground, s.GroundX, s.GroundY, s.GroundVX, s.GroundVY = projectTrack(tr.cfg.Ground, s.X, s.Y, s.VX, s.VY)
+	}
+	return s
+}
+
+// velocityStep is the horizon used to turn the pixel velocity into a ground
+// velocity.
+const velocityStep = 0.1
+
+func projectTrack(p Projector, x, y, vx, vy float64) (ok bool, gx, gy, gvx, gvy float64) {
+	gx, gy, ok = p.Project(x, y)
+	if !ok {
+		return false, 0, 0, 0, 0
+	}
+	if nx, ny, ok := p.Project(x+vx*velocityStep, y+vy*velocityStep); ok {
+		gvx = (nx - gx) / velocityStep
+		gvy = (ny - gy) / velocityStep
+	}
+	return true, gx, gy, gvx, gvy
+}
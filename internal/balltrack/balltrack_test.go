@@ -0,0 +1,72 @@
+package balltrack
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var t0 = time.Unix(1000, 0)
+
+func at(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+
+func TestTrackerConvergesOnConstantVelocity(t *testing.T) {
+	tr := New(DefaultConfig)
+	// 200 px/s to the right, 30 fps.
+	for i := 0; i <= 60; i++ {
+		ms := i * 33
+		tr.Update(at(ms), 0.2*float64(ms), 10, true)
+	}
+	s := tr.Estimate(at(60 * 33))
+	if !s.Valid || s.Coasting {
+		t.Fatalf("state = %+v", s)
+	}
+	if math.Abs(s.VX-200) > 10 || math.Abs(s.VY) > 1 {
+		t.Fatalf("velocity = (%v, %v), want (200, 0)", s.VX, s.VY)
+	}
+	if math.Abs(s.X-0.2*60*33) > 2 {
+		t.Fatalf("x = %v", s.X)
+	}
+}
+
+func TestTrackerCoastsThenDrops(t *testing.T) {
+	tr := New(DefaultConfig)
+	for i := 0; i <= 30; i++ {
+		tr.Update(at(i*33), 0.1*float64(i*33), 0, true)
+	}
+	last := tr.Estimate(at(30 * 33))
+
+	tr.Update(at(31*33), 0, 0, false)
+	s := tr.Estimate(at(30*33 + 100))
+	if !s.Valid || !s.Coasting {
+		t.Fatalf("expected coasting, got %+v", s)
+	}
+	if s.X <= last.X {
+		t.Fatalf("coasting x = %v, want extrapolated past %v", s.X, last.X)
+	}
+
+	if s := tr.Estimate(at(30*33 + 400)); s.Valid {
+		t.Fatalf("expected track dropped after MaxCoast, got %+v", s)
+	}
+}
+
+func TestTrackerRejectsOutliers(t *testing.T) {
+	tr := New(DefaultConfig)
+	for i := 0; i < 10; i++ {
+		tr.Update(at(i*33), 50, 50, true)
+	}
+	tr.Update(at(10*33), 300, -200, true)
+	s := tr.Estimate(at(10 * 33))
+	if math.Abs(s.X-50) > 1 || math.Abs(s.Y-50) > 1 {
+		t.Fatalf("outlier moved the track: %+v", s)
+	}
+
+	// Repeated far measurements restart the track there.
+	for i := 11; i <= 10+DefaultConfig.MaxOutliers; i++ {
+		tr.Update(at(i*33), 300, -200, true)
+	}
+	s = tr.Estimate(at((10 + DefaultConfig.MaxOutliers) * 33))
+	if s.X != 300 || s.Y != -200 || s.VX != 0 {
+		t.Fatalf("expected restart at new position, got %+v", s)
+	}
+}
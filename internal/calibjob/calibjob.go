@@ -0,0 +1,238 @@
+// Package calibjob runs the YOLO ball colour calibration as background jobs.
+// A job reports the progress of the camera process while it runs and, when it
+// completes, keeps the proposed thresholds (with the preview image) until the
+// user accepts them, so they can be reviewed before they are applied.
+//
+// One job runs at a time. Finished jobs are kept until they are accepted,
+// deleted or evicted by newer jobs (MaxJobs).
+package calibjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+)
+
+// MaxJobs is the number of jobs kept; the oldest finished job is evicted.
+const MaxJobs = 8
+
+// States of a job.
+const (
+	StateRunning   = "running"
+	StateDone      = "done" // proposed thresholds waiting for Accept
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+	StateAccepted  = "accepted"
+)
+
+var (
+	ErrBusy     = errors.New("a calibration is already running")
+	ErrNotFound = errors.New("calibration job not found")
+	// ErrState is returned when the job is not in the state the operation
+	// needs (e.g. Accept before it is done).
+	ErrState = errors.New("calibration job is not in a suitable state")
+)
+
+// Job is a snapshot of one calibration job.
+type Job struct {
+	ID         int        `json:"id"`
+	State      string     `json:"state"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	// Progress is the last progress report of the camera process.
+	Progress camctl.Progress `json:"progress"`
+	// Result holds the proposed thresholds once the job is done.
+	Result *camctl.ColorCalibration `json:"result"`
+	Error  string                   `json:"error,omitempty"`
+	// Code is the camera error code (camctl.Code*), "" for other failures.
+	Code string `json:"code,omitempty"`
+}
+
+// RunFunc computes a calibration without applying it.
+type RunFunc func(ctx context.Context, progress func(camctl.Progress)) (camctl.ColorCalibration, error)
+
+type job struct {
+	Job
+	cancel context.CancelFunc
+}
+
+// Manager owns the jobs.
+type Manager struct {
+	run RunFunc
+	now func() time.Time
+
+	mu     sync.Mutex
+	nextID int
+	jobs   map[int]*job
+}
+
+// New returns a manager that runs jobs with run.
+func New(run RunFunc) *Manager {
+	return &Manager{run: run, now: time.Now, jobs: map[int]*job{}}
+}
+
+// Start starts a job. It fails with ErrBusy while another job runs.
+func (m *Manager) Start() (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.State == StateRunning {
+			return j.Job, ErrBusy
+		}
+	}
+
+	m.nextID++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job:    Job{ID: m.nextID, State: StateRunning, CreatedAt: m.now()},
+		cancel: cancel,
+	}
+	m.jobs[j.ID] = j
+	m.evictLocked()
+
+	go m.execute(ctx, j)
+	return j.Job, nil
+}
+
+func (m *Manager) execute(ctx context.Context, j *job) {
+	result, err := m.run(ctx, func(p camctl.Progress) {
+		m.mu.Lock()
+		if j.State == StateRunning {
+			j.Progress = p
+		}
+		m.mu.Unlock()
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j.State != StateRunning {
+		return // cancelled meanwhile
+	}
+	now := m.now()
+	j.FinishedAt = &now
+	if err != nil {
+		j.State = StateFailed
+		j.Error = err.Error()
+		j.Code = camctl.ErrorCode(err)
+		var e *camctl.Error
+		if errors.As(err, &e) {
+			j.Error = e.Message
+		}
+		return
+	}
+	j.State = StateDone
+	j.Progress = camctl.Progress{Stage: "done", Fraction: 1}
+	j.Result = &result
+}
+
+// evictLocked drops the oldest finished jobs beyond MaxJobs.
+func (m *Manager) evictLocked() {
+	if len(m.jobs) <= MaxJobs {
+		return
+	}
+	ids := make([]int, 0, len(m.jobs))
+	for id := range m.jobs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if len(m.jobs) <= MaxJobs {
+			return
+		}
+		if m.jobs[id].State != StateRunning {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// Get returns a job.
+func (m *Manager) Get(id int) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.Job, true
+}
+
+// Running returns the running job, if any.
+func (m *Manager) Running() (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.State == StateRunning {
+			return j.Job, true
+		}
+	}
+	return Job{}, false
+}
+
+// List returns the jobs, newest first, without their preview images.
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		s := j.Job
+		if s.Result != nil {
+			r := *s.Result
+			r.PreviewFrame = ""
+			s.Result = &r
+		}
+		list = append(list, s)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].ID > list[b].ID })
+	return list
+}
+
+// Delete cancels a running job (it is kept as cancelled) or discards a
+// finished one with its proposal.
+func (m *Manager) Delete(id int) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if j.State != StateRunning {
+		delete(m.jobs, id)
+		return j.Job, nil
+	}
+	j.cancel()
+	now := m.now()
+	j.State = StateCancelled
+	j.FinishedAt = &now
+	return j.Job, nil
+}
+
+// Accept passes the proposed thresholds of a done job to apply and marks the
+// job accepted when apply succeeds.
+func (m *Manager) Accept(id int, apply func(camctl.ColorCalibration) error) (Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, ErrNotFound
+	}
+	if j.State != StateDone {
+		m.mu.Unlock()
+		return j.Job, fmt.Errorf("%w: %s", ErrState, j.State)
+	}
+	snapshot := j.Job
+	m.mu.Unlock()
+
+	if err := apply(*snapshot.Result); err != nil {
+		return snapshot, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j.State = StateAccepted
+	return j.Job, nil
+}
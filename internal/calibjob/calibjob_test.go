@@ -0,0 +1,138 @@
+package calibjob
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+)
+
+// waitState polls until job id reaches state.
+func waitState(t *testing.T, m *Manager, id int, state string) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if j, ok := m.Get(id); ok && j.State == state {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	j, _ := m.Get(id)
+	t.Fatalf("job %d state = %q, want %q", id, j.State, state)
+	return j
+}
+
+func TestJobLifecycle(t *testing.T) {
+	release := make(chan struct{})
+	m := New(func(ctx context.Context, progress func(camctl.Progress)) (camctl.ColorCalibration, error) {
+		progress(camctl.Progress{Stage: "detect", Fraction: 0.3})
+		<-release
+		return camctl.ColorCalibration{MinThreshold: "10,100,100", MaxThreshold: "20,255,255", BallDetectRadius: 150, PreviewFrame: "jpeg"}, nil
+	})
+
+	job, err := m.Start()
+	if err != nil || job.State != StateRunning {
+		t.Fatalf("Start = %+v, %v", job, err)
+	}
+	if running, err := m.Start(); !errors.Is(err, ErrBusy) || running.ID != job.ID {
+		t.Fatalf("second Start = %+v, %v; want ErrBusy", running, err)
+	}
+	if running, ok := m.Running(); !ok || running.ID != job.ID {
+		t.Fatalf("Running = %+v, %v", running, ok)
+	}
+	if _, err := m.Accept(job.ID, func(camctl.ColorCalibration) error { return nil }); !errors.Is(err, ErrState) {
+		t.Fatalf("Accept while running: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for j, _ := m.Get(job.ID); j.Progress.Stage != "detect"; j, _ = m.Get(job.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("progress not recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	done := waitState(t, m, job.ID, StateDone)
+	if done.Result == nil || done.Result.PreviewFrame != "jpeg" || done.FinishedAt == nil {
+		t.Fatalf("done job = %+v", done)
+	}
+	if _, ok := m.Running(); ok {
+		t.Fatal("Running after the job finished")
+	}
+	if list := m.List(); len(list) != 1 || list[0].Result.PreviewFrame != "" {
+		t.Fatalf("List should omit previews: %+v", list)
+	}
+
+	// A failed apply keeps the proposal.
+	if _, err := m.Accept(job.ID, func(camctl.ColorCalibration) error { return errors.New("tuner down") }); err == nil {
+		t.Fatal("Accept ignored the apply error")
+	}
+	var applied camctl.ColorCalibration
+	accepted, err := m.Accept(job.ID, func(r camctl.ColorCalibration) error {
+		applied = r
+		return nil
+	})
+	if err != nil || accepted.State != StateAccepted || applied.MinThreshold != "10,100,100" {
+		t.Fatalf("Accept = %+v, %v (applied %+v)", accepted, err, applied)
+	}
+
+	if _, err := m.Delete(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get(job.ID); ok {
+		t.Fatal("deleted job still listed")
+	}
+}
+
+func TestJobCancelAndFailure(t *testing.T) {
+	var fail atomic.Bool
+	m := New(func(ctx context.Context, progress func(camctl.Progress)) (camctl.ColorCalibration, error) {
+		if fail.Load() {
+			return camctl.ColorCalibration{}, &camctl.Error{Code: camctl.CodeNotFound, Message: "ball not detected"}
+		}
+		<-ctx.Done()
+		return camctl.ColorCalibration{}, ctx.Err()
+	})
+
+	job, _ := m.Start()
+	cancelled, err := m.Delete(job.ID)
+	if err != nil || cancelled.State != StateCancelled {
+		t.Fatalf("Delete running = %+v, %v", cancelled, err)
+	}
+	// The cancelled job stays cancelled after its run returns.
+	time.Sleep(20 * time.Millisecond)
+	if j, _ := m.Get(job.ID); j.State != StateCancelled {
+		t.Fatalf("cancelled job state = %q", j.State)
+	}
+
+	fail.Store(true)
+	job, err = m.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := waitState(t, m, job.ID, StateFailed)
+	if failed.Code != camctl.CodeNotFound || failed.Error != "ball not detected" {
+		t.Fatalf("failed job = %+v", failed)
+	}
+}
+
+func TestJobEviction(t *testing.T) {
+	m := New(func(ctx context.Context, progress func(camctl.Progress)) (camctl.ColorCalibration, error) {
+		return camctl.ColorCalibration{}, nil
+	})
+	var last Job
+	for i := 0; i < MaxJobs+3; i++ {
+		job, err := m.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = waitState(t, m, job.ID, StateDone)
+	}
+	list := m.List()
+	if len(list) != MaxJobs || list[0].ID != last.ID {
+		t.Fatalf("kept %d jobs (newest %d), want %d ending with %d", len(list), list[0].ID, MaxJobs, last.ID)
+	}
+}
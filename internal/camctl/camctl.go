@@ -0,0 +1,359 @@
+// Package camctl is the client of the camera control channel, the
+// request/response protocol between the Go API and the Python camera process
+// (tuner, colour calibration, checkerboard calibration, camera settings). The
+// Python implementation is camera/control_server.py; both follow the
+// definition below.
+//
+// Transport: TCP 127.0.0.1:31137 (state.CameraControlPort). Every message in
+// both directions is one frame:
+//
+//	0  length  u32 big endian, size of the JSON object that follows
+//	4  JSON    UTF-8 object, at most MaxFrameSize bytes
+//
+// Request (client to camera):
+//
+//	{"id": 7, "method": "tuner.set", "params": {...}}
+//
+// Replies (camera to client) carry the id of their request:
+//
+//	{"id": 7, "progress": {"stage": "detect", "fraction": 0.4, "message": "..."}}
+//	{"id": 7, "result": {...}}
+//	{"id": 7, "error": {"code": "not_found", "message": "ball not detected", "details": {...}}}
+//
+// A request gets any number of progress replies followed by exactly one
+// result or error. Several requests may be in flight on one connection; the
+// camera handles each in its own thread and replies may arrive in any order.
+// Requests that use the capture device are serialized by the camera process.
+//
+// When the caller gives up (context done), the client sends a "cancel" request
+// with {"id": <request id>}. Long requests stop at their next progress report
+// and fail with CodeCancelled; a reply that still arrives is discarded.
+//
+// Methods and their params / results are listed in methods.go; error codes
+// are the Code* constants.
+package camctl
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+)
+
+const (
+	// MaxFrameSize bounds one JSON message (preview frames are base64 JPEGs).
+	MaxFrameSize = 16 << 20
+
+	dialTimeout = 3 * time.Second
+	// The camera process may be (re)starting: dialing is retried, a request
+	// that was already sent is not.
+	dialAttempts   = 5
+	dialRetryDelay = 200 * time.Millisecond
+	// writeTimeout applies when the context has no deadline.
+	writeTimeout  = 10 * time.Second
+	cancelTimeout = 2 * time.Second
+)
+
+// Error codes.
+const (
+	CodeBadRequest    = "bad_request"    // malformed frame or invalid params
+	CodeUnknownMethod = "unknown_method" // method not implemented by the camera
+	CodeCaptureFailed = "capture_failed" // no frame from the camera
+	CodeNotFound      = "not_found"      // ball / checkerboard not detected
+	CodeUnavailable   = "unavailable"    // YOLO model missing, device cannot be opened
+	CodeFailed        = "failed"         // the operation failed otherwise
+	CodeInternal      = "internal"       // unexpected exception in the camera process
+	CodeCancelled     = "cancelled"      // cancelled by a "cancel" request
+)
+
+// Error is an error reply of the camera process.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details is an optional object with partial results (e.g. the preview
+	// frame of a failed checkerboard capture).
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ErrorCode returns the code of a camera error reply, "" for other errors
+// (connection failures, timeouts).
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// Progress is an intermediate report of a long request.
+type Progress struct {
+	Stage string `json:"stage"`
+	// Fraction is the completed part, 0..1.
+	Fraction float64 `json:"fraction"`
+	Message  string  `json:"message,omitempty"`
+}
+
+type request struct {
+	ID     uint32 `json:"id"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+type reply struct {
+	ID       uint32          `json:"id"`
+	Result   json.RawMessage `json:"result"`
+	Error    *Error          `json:"error"`
+	Progress *Progress       `json:"progress"`
+
+	err error // transport failure, set by the client
+}
+
+type call struct {
+	conn     net.Conn
+	progress func(Progress)
+	done     chan reply
+}
+
+// Client is a connection to the camera control channel, shared by concurrent
+// callers. It connects on first use and reconnects after a failure.
+type Client struct {
+	addr string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	nextID  uint32
+	pending map[uint32]*call
+
+	writeMu sync.Mutex
+}
+
+// New returns a client for the control channel at addr.
+func New(addr string) *Client {
+	return &Client{addr: addr, pending: map[uint32]*call{}}
+}
+
+// Default is the client for the local camera process.
+var Default = New(fmt.Sprintf("127.0.0.1:%d", state.CameraControlPort))
+
+// Call sends a request and waits for its result. params is encoded as JSON
+// (nil for none). progress, if not nil, is called from the receiving
+// goroutine for each progress reply and must not block. A camera error reply
+// is returned as *Error.
+func (c *Client) Call(ctx context.Context, method string, params any, progress func(Progress)) (json.RawMessage, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cl := &call{conn: conn, progress: progress, done: make(chan reply, 1)}
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = cl
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(request{ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(writeTimeout)
+	}
+	c.writeMu.Lock()
+	conn.SetWriteDeadline(deadline)
+	err = WriteFrame(conn, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.drop(conn, err)
+		return nil, fmt.Errorf("camctl: send %s: %w", method, err)
+	}
+
+	select {
+	case r := <-cl.done:
+		if r.err != nil {
+			return nil, fmt.Errorf("camctl: %s: %w", method, r.err)
+		}
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		return r.Result, nil
+	case <-ctx.Done():
+		if method != MethodCancel {
+			go c.cancel(id)
+		}
+		return nil, fmt.Errorf("camctl: %s: %w", method, ctx.Err())
+	}
+}
+
+// cancel asks the camera process to stop request id.
+func (c *Client) cancel(id uint32) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	c.Call(ctx, MethodCancel, map[string]uint32{"id": id}, nil)
+}
+
+// call is Call with the result decoded into out.
+func (c *Client) call(ctx context.Context, method string, params, out any, progress func(Progress)) error {
+	raw, err := c.Call(ctx, method, params, progress)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("camctl: %s: decode result: %w", method, err)
+	}
+	return nil
+}
+
+// Close closes the connection; the next call reconnects.
+func (c *Client) Close() {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		c.drop(conn, net.ErrClosed)
+	}
+}
+
+// connect returns the shared connection, dialing it if needed. The dial runs
+// without c.mu so that Close and calls on other goroutines are not held up
+// by the retries; if another caller connected meanwhile, its connection wins.
+func (c *Client) connect(ctx context.Context) (net.Conn, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+
+	var err error
+	for attempt := 0; attempt < dialAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(dialRetryDelay):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("camctl: connect: %w", ctx.Err())
+			}
+		}
+		d := net.Dialer{Timeout: dialTimeout}
+		conn, err = d.DialContext(ctx, "tcp", c.addr)
+		if err == nil {
+			return c.install(conn), nil
+		}
+	}
+	return nil, fmt.Errorf("camctl: カメラプロセスへ接続できませんでした: %w", err)
+}
+
+// install makes conn the shared connection unless another caller installed
+// one first, in which case conn is closed and the existing one returned.
+func (c *Client) install(conn net.Conn) net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		conn.Close()
+		return c.conn
+	}
+	c.conn = conn
+	go c.readLoop(conn)
+	return conn
+}
+
+func (c *Client) readLoop(conn net.Conn) {
+	for {
+		data, err := ReadFrame(conn)
+		if err != nil {
+			c.drop(conn, err)
+			return
+		}
+		var r reply
+		if err := json.Unmarshal(data, &r); err != nil {
+			c.drop(conn, fmt.Errorf("bad reply: %w", err))
+			return
+		}
+
+		c.mu.Lock()
+		cl := c.pending[r.ID]
+		if cl != nil && r.Progress == nil {
+			delete(c.pending, r.ID)
+		}
+		c.mu.Unlock()
+		switch {
+		case cl == nil:
+			// The caller gave up (context done); drop the late reply.
+		case r.Progress != nil:
+			if cl.progress != nil {
+				cl.progress(*r.Progress)
+			}
+		default:
+			cl.done <- r
+		}
+	}
+}
+
+// drop closes conn and fails the requests waiting on it.
+func (c *Client) drop(conn net.Conn, err error) {
+	conn.Close()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	for id, cl := range c.pending {
+		if cl.conn == conn {
+			delete(c.pending, id)
+			cl.done <- reply{ID: id, err: err}
+		}
+	}
+}
+
+// WriteFrame writes one length-prefixed message.
+func WriteFrame(w io.Writer, data []byte) error {
+	if len(data) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds %d", len(data), MaxFrameSize)
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads one length-prefixed message.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(head[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds %d", n, MaxFrameSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,242 @@
+package camctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCamera serves the control channel like camera/control_server.py, one
+// goroutine per request.
+func fakeCamera(t *testing.T, handle func(method string, params json.RawMessage, progress func(Progress)) (any, *Error)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(conn, handle)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFake(conn net.Conn, handle func(string, json.RawMessage, func(Progress)) (any, *Error)) {
+	defer conn.Close()
+	var mu sync.Mutex
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		mu.Lock()
+		WriteFrame(conn, data)
+		mu.Unlock()
+	}
+	for {
+		data, err := ReadFrame(conn)
+		if err != nil {
+			return
+		}
+		var req struct {
+			ID     uint32          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		json.Unmarshal(data, &req)
+		go func() {
+			result, e := handle(req.Method, req.Params, func(p Progress) {
+				send(map[string]any{"id": req.ID, "progress": p})
+			})
+			if e != nil {
+				send(map[string]any{"id": req.ID, "error": e})
+				return
+			}
+			send(map[string]any{"id": req.ID, "result": result})
+		}()
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestCall(t *testing.T) {
+	release := make(chan struct{})
+	addr := fakeCamera(t, func(method string, params json.RawMessage, progress func(Progress)) (any, *Error) {
+		switch method {
+		case MethodTunerSet:
+			var p ThresholdParams
+			json.Unmarshal(params, &p)
+			return Thresholds{Saved: p.Save, MinThreshold: p.MinThreshold, MaxThreshold: p.MaxThreshold}, nil
+		case MethodCalibColor:
+			progress(Progress{Stage: "model", Fraction: 0.1})
+			progress(Progress{Stage: "detect", Fraction: 0.5})
+			<-release
+			return ColorCalibration{MinThreshold: "1,2,3", BallDetectRadius: 150}, nil
+		case MethodGeomCapture:
+			return nil, &Error{Code: CodeNotFound, Message: "checkerboard not found", Details: json.RawMessage(`{"found":false}`)}
+		}
+		return nil, &Error{Code: CodeUnknownMethod, Message: method}
+	})
+	c := New(addr)
+	defer c.Close()
+	ctx := testContext(t)
+
+	// A long request does not block the others on the same connection.
+	var stages []string
+	calibDone := make(chan error, 1)
+	go func() {
+		r, err := c.CalibrateColor(ctx, true, func(p Progress) { stages = append(stages, p.Stage) })
+		if err == nil && r.MinThreshold != "1,2,3" {
+			err = errors.New("unexpected calibration result")
+		}
+		calibDone <- err
+	}()
+
+	th, err := c.SetThresholds(ctx, ThresholdParams{MinThreshold: "0,0,0", MaxThreshold: "179,255,255", Save: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !th.Saved || th.MaxThreshold != "179,255,255" {
+		t.Fatalf("SetThresholds = %+v", th)
+	}
+
+	close(release)
+	if err := <-calibDone; err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 2 || stages[0] != "model" || stages[1] != "detect" {
+		t.Fatalf("progress stages = %v", stages)
+	}
+
+	_, err = c.Geometry(ctx, MethodGeomCapture, nil, nil)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != CodeNotFound || string(e.Details) != `{"found":false}` {
+		t.Fatalf("Geometry error = %v", err)
+	}
+	if code := ErrorCode(err); code != CodeNotFound {
+		t.Fatalf("ErrorCode = %q", code)
+	}
+	if _, err := c.Call(ctx, "nope", nil, nil); ErrorCode(err) != CodeUnknownMethod {
+		t.Fatalf("unknown method error = %v", err)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	addr := fakeCamera(t, func(method string, params json.RawMessage, progress func(Progress)) (any, *Error) {
+		return Info{Version: ProtocolVersion, Board: "pi4"}, nil
+	})
+	c := New(addr)
+	defer c.Close()
+	ctx := testContext(t)
+
+	if info, err := c.Ping(ctx); err != nil || info.Board != "pi4" {
+		t.Fatalf("Ping = %+v, %v", info, err)
+	}
+	// The camera process restarted: the next call connects again.
+	c.mu.Lock()
+	c.conn.Close()
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping after reconnect: %v", err)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	addr := fakeCamera(t, func(method string, params json.RawMessage, progress func(Progress)) (any, *Error) {
+		select {} // never replies
+	})
+	c := New(addr)
+	defer c.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Call(testContext(t), MethodCalibColor, nil, nil)
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	err := <-errc
+	if err == nil || ErrorCode(err) != "" {
+		t.Fatalf("pending call after connection loss: %v", err)
+	}
+}
+
+func TestCloseWhileConnecting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	c := New(addr)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Call(testContext(t), MethodPing, nil, nil)
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// The dial retries must not hold the client lock.
+	start := time.Now()
+	c.Close()
+	if d := time.Since(start); d > dialRetryDelay/2 {
+		t.Errorf("Close blocked %v while connecting", d)
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("Call to a closed port succeeded")
+	}
+}
+
+func TestFrameLimit(t *testing.T) {
+	if err := WriteFrame(nil, make([]byte, MaxFrameSize+1)); err == nil {
+		t.Fatal("oversized frame accepted")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	cancelled := make(chan uint32, 1)
+	addr := fakeCamera(t, func(method string, params json.RawMessage, progress func(Progress)) (any, *Error) {
+		if method == MethodCancel {
+			var p struct {
+				ID uint32 `json:"id"`
+			}
+			json.Unmarshal(params, &p)
+			cancelled <- p.ID
+			return map[string]bool{"cancelled": true}, nil
+		}
+		progress(Progress{Stage: "model"})
+		select {} // until cancelled
+	})
+	c := New(addr)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err := c.CalibrateColor(ctx, false, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CalibrateColor after cancel: %v", err)
+	}
+	select {
+	case id := <-cancelled:
+		if id != 1 {
+			t.Fatalf("cancel request for id %d, want 1", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no cancel request sent")
+	}
+}
@@ -0,0 +1,193 @@
+package camctl
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Methods of the control channel. Params and results are JSON objects; the
+// types below document their fields.
+const (
+	// MethodPing returns Info.
+	MethodPing = "ping"
+	// MethodTunerPreview captures and detects one frame: Preview.
+	MethodTunerPreview = "tuner.preview"
+	// MethodTunerSet hot-applies ThresholdParams: Thresholds.
+	MethodTunerSet = "tuner.set"
+	// MethodTunerRelax widens the current thresholds, params {"save"}:
+	// Thresholds.
+	MethodTunerRelax = "tuner.relax"
+	// MethodCameraApply hot-applies capture settings, params {"values": the
+	// threshold.json camera keys, null = default}: CameraApplied. Fails with
+	// CodeUnavailable (and keeps the old settings) when the device cannot be
+	// reopened.
+	MethodCameraApply = "camera.apply"
+	// MethodCalibColor runs the YOLO colour calibration on one frame, params
+	// {"apply"}: ColorCalibration. With apply (the default) the thresholds are
+	// saved and hot-applied, otherwise only proposed. Reports progress.
+	MethodCalibColor = "calib.color"
+	// Checkerboard calibration (camera/geometry.py). Results are the session
+	// status; capture failures carry the preview frame in Error.Details.
+	MethodGeomStatus  = "geom.status"  // {}
+	MethodGeomReset   = "geom.reset"   // {"cols", "rows", "squareMm"}
+	MethodGeomCapture = "geom.capture" // {}, or {"floorPose": [xMm, yMm, yawDeg]}
+	MethodGeomSolve   = "geom.solve"   // {}: {"calibration"}; reports progress
+	// MethodDetectStats returns the DetectStats counted by the detector since
+	// the previous call and resets them.
+	MethodDetectStats = "detect.stats"
+	// MethodFrameCapture captures one raw (unannotated) frame at the capture
+	// resolution: Frame.
+	MethodFrameCapture = "frame.capture"
+	// MethodCancel stops a request of the same connection, params {"id"}:
+	// {"cancelled"}, false when it already finished.
+	MethodCancel = "cancel"
+)
+
+// ProtocolVersion is reported by ping; bump it on incompatible changes.
+const ProtocolVersion = 1
+
+// Info is the ping result.
+type Info struct {
+	Version int    `json:"version"`
+	Board   string `json:"board"`
+}
+
+// Preview is the tuner preview: detection result and base64 JPEG frames.
+type Preview struct {
+	IsBall               bool    `json:"isball"`
+	X                    float64 `json:"x"`
+	Y                    float64 `json:"y"`
+	MinThreshold         string  `json:"minThreshold"`
+	MaxThreshold         string  `json:"maxThreshold"`
+	BallDetectRadius     int     `json:"ballDetectRadius"`
+	CircularityThreshold float64 `json:"circularityThreshold"`
+	CameraFrame          string  `json:"cameraFrame"`
+	MaskFrame            string  `json:"maskFrame"`
+}
+
+// ThresholdParams are the tuner.set params.
+type ThresholdParams struct {
+	MinThreshold         string  `json:"minThreshold"`
+	MaxThreshold         string  `json:"maxThreshold"`
+	BallDetectRadius     int     `json:"ballDetectRadius"`
+	CircularityThreshold float64 `json:"circularityThreshold"`
+	// Save also writes threshold.json.
+	Save bool `json:"save"`
+}
+
+// Thresholds are the thresholds in effect after tuner.set / tuner.relax.
+type Thresholds struct {
+	Saved                bool    `json:"saved"`
+	MinThreshold         string  `json:"minThreshold"`
+	MaxThreshold         string  `json:"maxThreshold"`
+	BallDetectRadius     int     `json:"ballDetectRadius"`
+	CircularityThreshold float64 `json:"circularityThreshold"`
+}
+
+// CameraApplied is the camera.apply result.
+type CameraApplied struct {
+	// Reopened reports that the capture device was reopened.
+	Reopened bool `json:"reopened"`
+}
+
+// ColorCalibration is the calib.color result.
+type ColorCalibration struct {
+	// Applied reports that the thresholds were saved and hot-applied.
+	Applied              bool    `json:"applied"`
+	MinThreshold         string  `json:"minThreshold"`
+	MaxThreshold         string  `json:"maxThreshold"`
+	BallDetectRadius     int     `json:"ballDetectRadius"`
+	CircularityThreshold float64 `json:"circularityThreshold"`
+	// BBox is the detected ball, x1, y1, x2, y2 in pixels.
+	BBox         []int    `json:"bbox"`
+	Confidence   *float64 `json:"confidence"`
+	SamplePoints [][2]int `json:"samplePoints"`
+	PreviewFrame string   `json:"previewFrame"`
+}
+
+// DetectStats summarizes the HSV detector over the frames since the previous
+// detect.stats call.
+type DetectStats struct {
+	// Frames is the number of processed frames, Contours the frames with a
+	// contour larger than the minimum area and Hits the frames where that
+	// contour passed the circularity check.
+	Frames   int `json:"frames"`
+	Contours int `json:"contours"`
+	Hits     int `json:"hits"`
+	// Circularity is the mean circularity (4πA/P², 1 for a circle) of the
+	// largest contour over the Contours frames, 0 when there were none.
+	Circularity          float64 `json:"circularity"`
+	CircularityThreshold float64 `json:"circularityThreshold"`
+}
+
+// Frame is a captured camera frame.
+type Frame struct {
+	// Frame is the base64 JPEG.
+	Frame  string `json:"frame"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Ping checks that the camera process answers.
+func (c *Client) Ping(ctx context.Context) (Info, error) {
+	var info Info
+	err := c.call(ctx, MethodPing, nil, &info, nil)
+	return info, err
+}
+
+// Preview captures one frame with the detection overlay and HSV mask.
+func (c *Client) Preview(ctx context.Context) (Preview, error) {
+	var p Preview
+	err := c.call(ctx, MethodTunerPreview, nil, &p, nil)
+	return p, err
+}
+
+// SetThresholds hot-applies thresholds in the detector.
+func (c *Client) SetThresholds(ctx context.Context, params ThresholdParams) (Thresholds, error) {
+	var t Thresholds
+	err := c.call(ctx, MethodTunerSet, params, &t, nil)
+	return t, err
+}
+
+// RelaxThresholds widens the current thresholds.
+func (c *Client) RelaxThresholds(ctx context.Context, save bool) (Thresholds, error) {
+	var t Thresholds
+	err := c.call(ctx, MethodTunerRelax, map[string]bool{"save": save}, &t, nil)
+	return t, err
+}
+
+// ApplyCamera hot-applies capture settings given as threshold.json keys
+// (thresholds.CameraSettings.FileValues).
+func (c *Client) ApplyCamera(ctx context.Context, values map[string]any) (CameraApplied, error) {
+	var a CameraApplied
+	err := c.call(ctx, MethodCameraApply, map[string]any{"values": values}, &a, nil)
+	return a, err
+}
+
+// CalibrateColor runs the YOLO colour calibration; apply saves and
+// hot-applies the result.
+func (c *Client) CalibrateColor(ctx context.Context, apply bool, progress func(Progress)) (ColorCalibration, error) {
+	var r ColorCalibration
+	err := c.call(ctx, MethodCalibColor, map[string]bool{"apply": apply}, &r, progress)
+	return r, err
+}
+
+// DetectStats reads and resets the detector statistics.
+func (c *Client) DetectStats(ctx context.Context) (DetectStats, error) {
+	var s DetectStats
+	err := c.call(ctx, MethodDetectStats, nil, &s, nil)
+	return s, err
+}
+
+// CaptureFrame captures one raw frame.
+func (c *Client) CaptureFrame(ctx context.Context) (Frame, error) {
+	var f Frame
+	err := c.call(ctx, MethodFrameCapture, nil, &f, nil)
+	return f, err
+}
+
+// Geometry sends a checkerboard calibration request (MethodGeom*) and returns
+// its result as is.
+func (c *Client) Geometry(ctx context.Context, method string, params any, progress func(Progress)) (json.RawMessage, error) {
+	return c.Call(ctx, method, params, progress)
+}
@@ -0,0 +1,188 @@
+// Package camframe receives the annotated JPEG frames of the camera process.
+// Frames are opt-in (see internal/camproto): they are only requested while a
+// viewer (the /image API, a stream, ...) has asked for one recently, so the
+// camera does not encode JPEGs at frame rate for nobody.
+//
+// Frames are published by replacing the latest one; viewers never block the
+// receiver. A viewer that is slower than the camera simply skips frames.
+package camframe
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+)
+
+const (
+	// viewerTimeout is how long frames keep being requested after the last
+	// Want call.
+	viewerTimeout = 3 * time.Second
+	// subscribeInterval renews the camera side lease (camproto.FrameLease).
+	subscribeInterval = 500 * time.Millisecond
+)
+
+var (
+	mu       sync.Mutex
+	latest   []byte
+	latestAt time.Time
+	updated  = make(chan struct{})
+	lastWant state.AtomicTime
+	viewers  = map[*Viewer]struct{}{}
+)
+
+// Want marks that a viewer needs frames at the camera defaults. Call it on
+// every request.
+func Want() {
+	lastWant.Store(time.Now())
+}
+
+// Viewer is a long-lived consumer (a stream) with its own size and rate.
+// Frames are requested at the combination of all viewers' requests until it
+// leaves.
+type Viewer struct {
+	req camproto.FrameRequest
+}
+
+// Join registers a viewer.
+func Join(req camproto.FrameRequest) *Viewer {
+	v := &Viewer{req: req}
+	mu.Lock()
+	viewers[v] = struct{}{}
+	mu.Unlock()
+	return v
+}
+
+// Leave unregisters the viewer.
+func (v *Viewer) Leave() {
+	mu.Lock()
+	delete(viewers, v)
+	mu.Unlock()
+}
+
+// request returns the combined frame request of the current viewers, false
+// when nobody is watching.
+func request() (camproto.FrameRequest, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var req camproto.FrameRequest
+	active := lastWant.Since() <= viewerTimeout
+	for v := range viewers {
+		if active {
+			req = req.Merge(v.req)
+		} else {
+			req = v.req
+			active = true
+		}
+	}
+	return req, active
+}
+
+// Viewers returns the number of joined viewers.
+func Viewers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(viewers)
+}
+
+// Latest returns the last received frame and when it arrived.
+func Latest() ([]byte, time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+	return latest, latestAt
+}
+
+// Next waits up to timeout for a frame newer than the current one.
+func Next(timeout time.Duration) ([]byte, bool) {
+	mu.Lock()
+	ch := updated
+	mu.Unlock()
+
+	select {
+	case <-ch:
+		frame, _ := Latest()
+		return frame, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+// Fresh returns the latest frame if it is younger than maxAge, otherwise waits
+// up to timeout for the next one. It also marks a viewer.
+func Fresh(maxAge, timeout time.Duration) ([]byte, bool) {
+	Want()
+	if frame, at := Latest(); frame != nil && time.Since(at) < maxAge {
+		return frame, true
+	}
+	return Next(timeout)
+}
+
+func publish(frame []byte) {
+	mu.Lock()
+	latest = frame
+	latestAt = time.Now()
+	close(updated)
+	updated = make(chan struct{})
+	mu.Unlock()
+}
+
+// Run requests and receives frames until done is closed.
+func Run(done <-chan struct{}) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		log.Printf("camera frame socket error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	camAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: state.UDPCameraFramePort}
+	go subscribeLoop(done, conn, camAddr)
+
+	buf := make([]byte, camproto.HeaderSize+8+camproto.ChunkSize)
+	var asm camproto.Assembler
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			continue
+		}
+		chunk, err := camproto.DecodeFrameChunk(buf[:n])
+		if err != nil {
+			if state.DebugCamera {
+				log.Printf("camera frame chunk error: %v", err)
+			}
+			continue
+		}
+		if frame, ok := asm.Add(chunk); ok {
+			publish(frame)
+		}
+	}
+}
+
+func subscribeLoop(done <-chan struct{}, conn *net.UDPConn, camAddr *net.UDPAddr) {
+	ticker := time.NewTicker(subscribeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			req, ok := request()
+			if !ok {
+				continue
+			}
+			conn.WriteToUDP(camproto.Subscribe(req), camAddr)
+		}
+	}
+}
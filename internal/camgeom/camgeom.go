@@ -0,0 +1,240 @@
+// Package camgeom converts camera coordinates to metric positions on the
+// floor, relative to the robot centre (mm, x forward, y left).
+//
+// Two camera models are supported. A Calibration is produced by the
+// checkerboard workflow (camera/geometry.py, API /cameracalib) and stored in
+// camera_calibration.json: OpenCV intrinsics with lens distortion and the
+// camera-to-robot transform. Without it, the hand-measured Extrinsics from
+// config.json (camera.extrinsics) are used with an ideal pinhole camera.
+package camgeom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+)
+
+// CalibrationFile is written by the camera process next to threshold.json.
+const CalibrationFile = "camera_calibration.json"
+
+// Transform is a rigid transform: p_robot = Rotation * p_camera + Translation.
+type Transform struct {
+	// Rotation is row-major 3x3.
+	Rotation [9]float64 `json:"rotation"`
+	// TranslationMm is the camera position in robot coordinates.
+	TranslationMm [3]float64 `json:"translationMm"`
+}
+
+// Calibration is the content of CalibrationFile.
+type Calibration struct {
+	ImageWidth  int `json:"imageWidth"`
+	ImageHeight int `json:"imageHeight"`
+	// CameraMatrix is the row-major OpenCV camera matrix (fx 0 cx; 0 fy cy;
+	// 0 0 1) in pixels at ImageWidth x ImageHeight.
+	CameraMatrix [9]float64 `json:"cameraMatrix"`
+	// DistCoeffs are OpenCV distortion coefficients (k1 k2 p1 p2 [k3 [k4 k5
+	// k6]]).
+	DistCoeffs []float64 `json:"distCoeffs"`
+	// RMS is the reprojection error of the intrinsic calibration in pixels.
+	RMS float64 `json:"rms"`
+	// Frames is the number of checkerboard views used.
+	Frames int `json:"frames"`
+	// RobotFromCamera maps OpenCV camera coordinates (x right, y down, z
+	// forward) to robot coordinates (x forward, y left, z up, origin on the
+	// floor below the robot centre).
+	RobotFromCamera Transform `json:"robotFromCamera"`
+	// BallRadiusMm lifts the projection plane to the ball centre.
+	BallRadiusMm float64   `json:"ballRadiusMm"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// LoadCalibration reads and validates a calibration file.
+func LoadCalibration(path string) (*Calibration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Calibration
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Validate checks that the calibration can be used for projection.
+func (c *Calibration) Validate() error {
+	if c.ImageWidth <= 0 || c.ImageHeight <= 0 {
+		return errors.New("image size must be positive")
+	}
+	if c.CameraMatrix[0] <= 0 || c.CameraMatrix[4] <= 0 {
+		return errors.New("focal lengths must be positive")
+	}
+	switch len(c.DistCoeffs) {
+	case 0, 4, 5, 8:
+	default:
+		return fmt.Errorf("unsupported number of distortion coefficients: %d", len(c.DistCoeffs))
+	}
+	return nil
+}
+
+// Project maps graph coordinates (pixels, origin at the frame centre, y up)
+// of a frameWidth x frameHeight image to robot coordinates in mm. A frame size
+// different from the calibration is scaled (same field of view assumed). ok
+// is false for points that do not hit the floor in front of the camera.
+func (c *Calibration) Project(x, y float64, frameWidth, frameHeight int) (gx, gy float64, ok bool) {
+	u := x + float64(frameWidth)/2
+	v := float64(frameHeight)/2 - y
+	if frameWidth > 0 && frameHeight > 0 {
+		u *= float64(c.ImageWidth) / float64(frameWidth)
+		v *= float64(c.ImageHeight) / float64(frameHeight)
+	}
+
+	k := c.CameraMatrix
+	xn, yn := c.undistort((u-k[2])/k[0], (v-k[5])/k[4])
+
+	r := c.RobotFromCamera.Rotation
+	t := c.RobotFromCamera.TranslationMm
+	dx := r[0]*xn + r[1]*yn + r[2]
+	dy := r[3]*xn + r[4]*yn + r[5]
+	dz := r[6]*xn + r[7]*yn + r[8]
+	if dz >= -1e-9 {
+		return 0, 0, false
+	}
+	s := (c.BallRadiusMm - t[2]) / dz
+	if s <= 0 {
+		return 0, 0, false
+	}
+	return t[0] + s*dx, t[1] + s*dy, true
+}
+
+// undistort inverts the OpenCV distortion model on normalized coordinates by
+// fixed-point iteration (as cv::undistortPoints does).
+func (c *Calibration) undistort(xd, yd float64) (float64, float64) {
+	d := c.DistCoeffs
+	if len(d) == 0 {
+		return xd, yd
+	}
+	var k [8]float64
+	copy(k[:], d)
+	k1, k2, p1, p2, k3, k4, k5, k6 := k[0], k[1], k[2], k[3], k[4], k[5], k[6], k[7]
+
+	x, y := xd, yd
+	for i := 0; i < 20; i++ {
+		r2 := x*x + y*y
+		radial := (1 + ((k3*r2+k2)*r2+k1)*r2) / (1 + ((k6*r2+k5)*r2+k4)*r2)
+		if radial <= 0 || math.IsNaN(radial) {
+			return xd, yd
+		}
+		tx := 2*p1*x*y + p2*(r2+2*x*x)
+		ty := p1*(r2+2*y*y) + 2*p2*x*y
+		x = (xd - tx) / radial
+		y = (yd - ty) / radial
+	}
+	return x, y
+}
+
+// Ground is the active floor projection: the calibration file when present,
+// otherwise the configured extrinsics. It implements balltrack.Projector.
+type Ground struct {
+	mu          sync.RWMutex
+	calibration *Calibration
+	extrinsics  Extrinsics
+	frameWidth  int
+	frameHeight int
+}
+
+// Default is the projection for the robot's camera.
+var Default = &Ground{}
+
+// SetExtrinsics sets the fallback used without a calibration file.
+func (g *Ground) SetExtrinsics(e Extrinsics) {
+	g.mu.Lock()
+	g.extrinsics = e
+	g.mu.Unlock()
+}
+
+// SetCalibration replaces the calibration; nil falls back to the extrinsics.
+func (g *Ground) SetCalibration(c *Calibration) {
+	g.mu.Lock()
+	g.calibration = c
+	g.mu.Unlock()
+}
+
+// Calibration returns the loaded calibration or nil.
+func (g *Ground) Calibration() *Calibration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.calibration
+}
+
+// Reload reads CalibrationFile. A missing file clears the calibration and is
+// not an error.
+func (g *Ground) Reload() error {
+	c, err := LoadCalibration(CalibrationFile)
+	if errors.Is(err, os.ErrNotExist) {
+		g.SetCalibration(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	g.SetCalibration(c)
+	log.Printf("Camera calibration loaded (%dx%d, rms %.3f px)", c.ImageWidth, c.ImageHeight, c.RMS)
+	return nil
+}
+
+// SetFrameSize records the capture size of the incoming detections.
+func (g *Ground) SetFrameSize(width, height int) {
+	g.mu.Lock()
+	g.frameWidth, g.frameHeight = width, height
+	g.mu.Unlock()
+}
+
+// Source is "calibration", "extrinsics" or "" when no projection is set up.
+func (g *Ground) Source() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	switch {
+	case g.calibration != nil:
+		return "calibration"
+	case g.extrinsics.Valid():
+		return "extrinsics"
+	default:
+		return ""
+	}
+}
+
+// ProjectDetection places a detection on the floor: the ball at its centre,
+// other objects at the bottom centre of the box where they touch the floor.
+func (g *Ground) ProjectDetection(d camproto.Detection) (gx, gy float64, ok bool) {
+	x, y := float64(d.X), float64(d.Y)
+	if d.Class != camproto.ClassBall {
+		y -= float64(d.Height) / 2
+	}
+	return g.Project(x, y)
+}
+
+// Project maps graph coordinates of the current frame to robot coordinates in
+// mm.
+func (g *Ground) Project(x, y float64) (gx, gy float64, ok bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.calibration != nil {
+		w, h := g.frameWidth, g.frameHeight
+		if w <= 0 || h <= 0 {
+			w, h = g.calibration.ImageWidth, g.calibration.ImageHeight
+		}
+		return g.calibration.Project(x, y, w, h)
+	}
+	return g.extrinsics.Project(x, y)
+}
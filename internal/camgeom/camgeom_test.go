@@ -0,0 +1,85 @@
+package camgeom
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtrinsicsProject(t *testing.T) {
+	e := Extrinsics{
+		HeightMm:      150,
+		PitchDeg:      45,
+		FocalLengthPx: 500,
+		OffsetXMm:     60,
+	}
+	// The image centre looks 45 degrees down: height == forward distance.
+	x, y, ok := e.Project(0, 0)
+	if !ok || math.Abs(x-210) > 1e-6 || math.Abs(y) > 1e-6 {
+		t.Fatalf("centre = (%v, %v, %v)", x, y, ok)
+	}
+	// Points right of centre are to the robot's right (negative y).
+	if _, y, ok := e.Project(100, 0); !ok || y >= 0 {
+		t.Fatalf("right pixel projected to y = %v", y)
+	}
+	// Above the horizon there is no ground point.
+	if _, _, ok := e.Project(0, 600); ok {
+		t.Fatal("expected no projection above the horizon")
+	}
+	if _, _, ok := (Extrinsics{}).Project(0, 0); ok {
+		t.Fatal("zero extrinsics must not project")
+	}
+}
+
+// pinholeCalibration is the calibration equivalent of Extrinsics{HeightMm:
+// 150, PitchDeg: 45, FocalLengthPx: 500, OffsetXMm: 60} for a 640x480 image.
+func pinholeCalibration() *Calibration {
+	s, c := math.Sincos(math.Pi / 4)
+	return &Calibration{
+		ImageWidth:   640,
+		ImageHeight:  480,
+		CameraMatrix: [9]float64{500, 0, 320, 0, 500, 240, 0, 0, 1},
+		RobotFromCamera: Transform{
+			// Columns: camera x (right), y (down), z (forward) in robot axes.
+			Rotation:      [9]float64{0, -s, c, -1, 0, 0, 0, -c, -s},
+			TranslationMm: [3]float64{60, 0, 150},
+		},
+	}
+}
+
+func TestCalibrationMatchesExtrinsics(t *testing.T) {
+	cal := pinholeCalibration()
+	if err := cal.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	e := Extrinsics{HeightMm: 150, PitchDeg: 45, FocalLengthPx: 500, OffsetXMm: 60}
+	for _, p := range [][2]float64{{0, 0}, {100, 0}, {-80, -50}, {30, 60}} {
+		cx, cy, cok := cal.Project(p[0], p[1], 640, 480)
+		ex, ey, eok := e.Project(p[0], p[1])
+		if cok != eok || math.Abs(cx-ex) > 1e-6 || math.Abs(cy-ey) > 1e-6 {
+			t.Errorf("%v: calibration (%v, %v, %v), extrinsics (%v, %v, %v)", p, cx, cy, cok, ex, ey, eok)
+		}
+	}
+
+	// Half resolution frames see the same field of view.
+	x1, y1, _ := cal.Project(100, -40, 640, 480)
+	x2, y2, _ := cal.Project(50, -20, 320, 240)
+	if math.Abs(x1-x2) > 1e-6 || math.Abs(y1-y2) > 1e-6 {
+		t.Errorf("scaled frame: (%v, %v) vs (%v, %v)", x2, y2, x1, y1)
+	}
+}
+
+func TestUndistortInvertsDistortion(t *testing.T) {
+	cal := &Calibration{DistCoeffs: []float64{-0.3, 0.1, 0.001, -0.002, -0.02}}
+	k1, k2, p1, p2, k3 := -0.3, 0.1, 0.001, -0.002, -0.02
+	for _, p := range [][2]float64{{0, 0}, {0.2, -0.1}, {-0.4, 0.3}} {
+		x, y := p[0], p[1]
+		r2 := x*x + y*y
+		radial := 1 + k1*r2 + k2*r2*r2 + k3*r2*r2*r2
+		xd := x*radial + 2*p1*x*y + p2*(r2+2*x*x)
+		yd := y*radial + p1*(r2+2*y*y) + 2*p2*x*y
+		ux, uy := cal.undistort(xd, yd)
+		if math.Abs(ux-x) > 1e-6 || math.Abs(uy-y) > 1e-6 {
+			t.Errorf("undistort(distort(%v)) = (%v, %v)", p, ux, uy)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package camgeom
+
+import "math"
+
+// Extrinsics is a hand-measured camera pose (config.json camera.extrinsics)
+// for an ideal pinhole camera with the principal point at the frame centre.
+type Extrinsics struct {
+	// HeightMm is the lens height above the floor.
+	HeightMm float64
+	// PitchDeg tilts the optical axis down from horizontal.
+	PitchDeg float64
+	// YawDeg turns the camera to the left of the robot's forward axis.
+	YawDeg float64
+	// OffsetXMm / OffsetYMm is the lens position from the robot centre
+	// (x forward, y left).
+	OffsetXMm float64
+	OffsetYMm float64
+	// FocalLengthPx is the focal length in pixels at the capture resolution.
+	FocalLengthPx float64
+	// BallRadiusMm lifts the projection plane to the ball centre.
+	BallRadiusMm float64
+}
+
+// Valid reports whether the projection can be used.
+func (e Extrinsics) Valid() bool {
+	return e.FocalLengthPx > 0 && e.HeightMm > e.BallRadiusMm
+}
+
+// Project maps graph coordinates (pixels, origin at the frame centre, y up)
+// to robot coordinates in mm. ok is false for points at or above the horizon.
+func (e Extrinsics) Project(x, y float64) (gx, gy float64, ok bool) {
+	if !e.Valid() {
+		return 0, 0, false
+	}
+	sin, cos := math.Sincos(e.PitchDeg * math.Pi / 180)
+	f := e.FocalLengthPx
+	// Ray through the pixel in robot axes (x forward, y left, z up).
+	rx := f*cos + y*sin
+	ry := -x
+	rz := -f*sin + y*cos
+	if rz >= -1e-9 || rx <= 0 {
+		return 0, 0, false
+	}
+	t := (e.HeightMm - e.BallRadiusMm) / -rz
+	cx, cy := t*rx, t*ry
+
+	ysin, ycos := math.Sincos(e.YawDeg * math.Pi / 180)
+	gx = ycos*cx - ysin*cy + e.OffsetXMm
+	gy = ysin*cx + ycos*cy + e.OffsetYMm
+	return gx, gy, true
+}
@@ -0,0 +1,361 @@
+// Package camproto is the binary protocol between the Python camera process
+// and the Go side. The Python implementation is camera/transport/protocol.py;
+// both follow the layout below (all integers little endian, floats IEEE 754).
+//
+// Every datagram starts with an 8-byte header:
+//
+//	0  magic    "RC"
+//	2  version  u8 (Version)
+//	3  kind     u8 (KindDetections / KindFrameChunk)
+//	4  seq      u32  frame sequence number, shared by the detections and the
+//	                 JPEG of the same capture
+//
+// KindDetections (UDP 31133, every frame):
+//
+//	8  capture_us  u64  capture time, Unix microseconds
+//	16 width       u16  capture width in pixels
+//	18 height      u16  capture height in pixels
+//	20 count       u8
+//	21 count x 22-byte detection:
+//	   class u8, flags u8 (reserved, 0), x f32, y f32, width f32, height f32,
+//	   confidence f32
+//
+// x/y is the bounding box centre in graph coordinates (origin at the frame
+// centre, x right, y up), width/height the box size in pixels and confidence
+// 0..1 (1 for the HSV detector). Detections of each class are ordered best
+// first.
+//
+// KindFrameChunk (UDP 31136, only while subscribed):
+//
+//	8  index  u16  chunk index
+//	10 count  u16  number of chunks of this frame
+//	12 total  u32  JPEG size in bytes, at most MaxFrameSize
+//	16 data        JPEG bytes [index*ChunkSize, ...)
+//
+// Frames are opt-in: the Go side sends the ASCII datagram "SUB" to UDP 31136
+// at least every second while a viewer is connected, and the camera process
+// sends the annotated JPEG chunks back to the sender for FrameLease after the
+// last "SUB". "SUB <width> <height> <fps> <quality>" additionally asks for a
+// frame size, a maximum rate and a JPEG quality; 0 keeps the camera default
+// (threshold.json outputFrameWidth / outputFrameHeight / jpegQuality, every
+// frame).
+package camproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	Version = 2
+
+	HeaderSize    = 8
+	detectionSize = 22
+	// MaxDetections is the largest count that fits the u8 field.
+	MaxDetections = 255
+	// ChunkSize is the JPEG payload per frame chunk. Loopback UDP carries it
+	// in one datagram.
+	ChunkSize = 32 * 1024
+	// MaxFrameSize bounds the JPEG size a chunk header may announce, so that
+	// a corrupt or spoofed datagram cannot make the Go side allocate up to
+	// 4 GiB. A 1280x960 JPEG is well below 1 MiB.
+	MaxFrameSize = 8 * 1024 * 1024
+	// FrameLease is how long the camera keeps sending frames after a "SUB".
+	FrameLease = 2 * time.Second
+)
+
+// FrameRequest is what a frame subscription asks for. Zero fields keep the
+// camera defaults.
+type FrameRequest struct {
+	Width   int
+	Height  int
+	FPS     int
+	Quality int
+}
+
+// Merge combines the requests of two viewers, since the camera encodes one
+// stream for all of them: the largest requested size and quality and the
+// highest rate win. For size and rate 0 (the camera default) means the full
+// frame and every frame, so a viewer leaving them at 0 wins over any explicit
+// value. A quality of 0 has no preference and yields to the other viewer.
+func (r FrameRequest) Merge(o FrameRequest) FrameRequest {
+	return FrameRequest{
+		Width:   mergeDefaultWins(r.Width, o.Width),
+		Height:  mergeDefaultWins(r.Height, o.Height),
+		FPS:     mergeDefaultWins(r.FPS, o.FPS),
+		Quality: max(r.Quality, o.Quality),
+	}
+}
+
+// mergeDefaultWins returns the larger value, or 0 when either is 0.
+func mergeDefaultWins(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return max(a, b)
+}
+
+// Subscribe returns the frame subscription request datagram.
+func Subscribe(r FrameRequest) []byte {
+	if r == (FrameRequest{}) {
+		return []byte("SUB")
+	}
+	return fmt.Appendf(nil, "SUB %d %d %d %d", r.Width, r.Height, r.FPS, r.Quality)
+}
+
+// Kind is the datagram type.
+type Kind uint8
+
+const (
+	KindDetections Kind = 1
+	KindFrameChunk Kind = 2
+)
+
+// Class is the detected object type.
+type Class uint8
+
+const (
+	ClassBall  Class = 0
+	ClassRobot Class = 1
+	ClassGoal  Class = 2
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassBall:
+		return "ball"
+	case ClassRobot:
+		return "robot"
+	case ClassGoal:
+		return "goal"
+	default:
+		return fmt.Sprintf("class%d", uint8(c))
+	}
+}
+
+// Detection is one detected object.
+type Detection struct {
+	Class      Class
+	X          float32
+	Y          float32
+	Width      float32
+	Height     float32
+	Confidence float32
+}
+
+// Radius returns the radius of the circle inscribed in the bounding box.
+func (d Detection) Radius() float32 {
+	return min(d.Width, d.Height) / 2
+}
+
+// Detections is the result for one captured frame.
+type Detections struct {
+	Seq         uint32
+	CaptureTime time.Time
+	Width       int
+	Height      int
+	Items       []Detection
+}
+
+// FrameChunk is one part of a JPEG frame.
+type FrameChunk struct {
+	Seq   uint32
+	Index int
+	Count int
+	Total int
+	Data  []byte
+}
+
+var ErrShort = errors.New("camproto: short datagram")
+
+// ParseHeader validates the header and returns the kind and sequence number.
+func ParseHeader(buf []byte) (Kind, uint32, error) {
+	if len(buf) < HeaderSize {
+		return 0, 0, ErrShort
+	}
+	if buf[0] != 'R' || buf[1] != 'C' {
+		return 0, 0, errors.New("camproto: bad magic")
+	}
+	if buf[2] != Version {
+		return 0, 0, fmt.Errorf("camproto: unsupported version %d", buf[2])
+	}
+	return Kind(buf[3]), binary.LittleEndian.Uint32(buf[4:8]), nil
+}
+
+func putHeader(buf []byte, kind Kind, seq uint32) {
+	buf[0], buf[1], buf[2], buf[3] = 'R', 'C', Version, byte(kind)
+	binary.LittleEndian.PutUint32(buf[4:8], seq)
+}
+
+// EncodeDetections serializes d. Items beyond MaxDetections are dropped.
+func EncodeDetections(d Detections) []byte {
+	items := d.Items
+	if len(items) > MaxDetections {
+		items = items[:MaxDetections]
+	}
+	buf := make([]byte, HeaderSize+13+len(items)*detectionSize)
+	putHeader(buf, KindDetections, d.Seq)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(d.CaptureTime.UnixMicro()))
+	binary.LittleEndian.PutUint16(buf[16:18], uint16(d.Width))
+	binary.LittleEndian.PutUint16(buf[18:20], uint16(d.Height))
+	buf[20] = byte(len(items))
+	off := 21
+	for _, it := range items {
+		buf[off] = byte(it.Class)
+		buf[off+1] = 0
+		putFloat(buf[off+2:], it.X)
+		putFloat(buf[off+6:], it.Y)
+		putFloat(buf[off+10:], it.Width)
+		putFloat(buf[off+14:], it.Height)
+		putFloat(buf[off+18:], it.Confidence)
+		off += detectionSize
+	}
+	return buf
+}
+
+// DecodeDetections parses a KindDetections datagram.
+func DecodeDetections(buf []byte) (Detections, error) {
+	kind, seq, err := ParseHeader(buf)
+	if err != nil {
+		return Detections{}, err
+	}
+	if kind != KindDetections {
+		return Detections{}, fmt.Errorf("camproto: kind %d is not detections", kind)
+	}
+	if len(buf) < HeaderSize+13 {
+		return Detections{}, ErrShort
+	}
+	count := int(buf[20])
+	if len(buf) < 21+count*detectionSize {
+		return Detections{}, ErrShort
+	}
+
+	d := Detections{
+		Seq:         seq,
+		CaptureTime: time.UnixMicro(int64(binary.LittleEndian.Uint64(buf[8:16]))),
+		Width:       int(binary.LittleEndian.Uint16(buf[16:18])),
+		Height:      int(binary.LittleEndian.Uint16(buf[18:20])),
+		Items:       make([]Detection, count),
+	}
+	off := 21
+	for i := range d.Items {
+		d.Items[i] = Detection{
+			Class:      Class(buf[off]),
+			X:          getFloat(buf[off+2:]),
+			Y:          getFloat(buf[off+6:]),
+			Width:      getFloat(buf[off+10:]),
+			Height:     getFloat(buf[off+14:]),
+			Confidence: getFloat(buf[off+18:]),
+		}
+		off += detectionSize
+	}
+	return d, nil
+}
+
+// EncodeFrame splits a JPEG into KindFrameChunk datagrams.
+func EncodeFrame(seq uint32, jpeg []byte) [][]byte {
+	count := (len(jpeg) + ChunkSize - 1) / ChunkSize
+	if count == 0 {
+		count = 1
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		part := jpeg[i*ChunkSize : min((i+1)*ChunkSize, len(jpeg))]
+		buf := make([]byte, HeaderSize+8+len(part))
+		putHeader(buf, KindFrameChunk, seq)
+		binary.LittleEndian.PutUint16(buf[8:10], uint16(i))
+		binary.LittleEndian.PutUint16(buf[10:12], uint16(count))
+		binary.LittleEndian.PutUint32(buf[12:16], uint32(len(jpeg)))
+		copy(buf[16:], part)
+		chunks = append(chunks, buf)
+	}
+	return chunks
+}
+
+// DecodeFrameChunk parses a KindFrameChunk datagram. Data aliases buf.
+func DecodeFrameChunk(buf []byte) (FrameChunk, error) {
+	kind, seq, err := ParseHeader(buf)
+	if err != nil {
+		return FrameChunk{}, err
+	}
+	if kind != KindFrameChunk {
+		return FrameChunk{}, fmt.Errorf("camproto: kind %d is not a frame chunk", kind)
+	}
+	if len(buf) < HeaderSize+8 {
+		return FrameChunk{}, ErrShort
+	}
+	c := FrameChunk{
+		Seq:   seq,
+		Index: int(binary.LittleEndian.Uint16(buf[8:10])),
+		Count: int(binary.LittleEndian.Uint16(buf[10:12])),
+		Total: int(binary.LittleEndian.Uint32(buf[12:16])),
+		Data:  buf[16:],
+	}
+	if err := c.check(); err != nil {
+		return FrameChunk{}, err
+	}
+	return c, nil
+}
+
+// check rejects a chunk whose total size is above MaxFrameSize or whose
+// index, count, total and data length do not agree with EncodeFrame.
+func (c FrameChunk) check() error {
+	if c.Total < 0 || c.Total > MaxFrameSize {
+		return fmt.Errorf("camproto: frame size %d exceeds %d", c.Total, MaxFrameSize)
+	}
+	count := max(1, (c.Total+ChunkSize-1)/ChunkSize)
+	if c.Count != count || c.Index < 0 || c.Index >= c.Count {
+		return fmt.Errorf("camproto: chunk %d/%d does not fit a %d-byte frame", c.Index, c.Count, c.Total)
+	}
+	if want := min(ChunkSize, c.Total-c.Index*ChunkSize); len(c.Data) != want {
+		return fmt.Errorf("camproto: chunk %d has %d bytes, want %d", c.Index, len(c.Data), want)
+	}
+	return nil
+}
+
+// Assembler rebuilds JPEG frames from chunks. A chunk of a newer frame drops
+// an incomplete older one, so a lost datagram costs at most one frame.
+type Assembler struct {
+	seq  uint32
+	buf  []byte
+	got  []bool
+	left int
+}
+
+// Add stores c and returns the JPEG when its frame is complete. Chunks that
+// DecodeFrameChunk would reject are ignored.
+func (a *Assembler) Add(c FrameChunk) ([]byte, bool) {
+	if c.check() != nil {
+		return nil, false
+	}
+	if a.got == nil || c.Seq != a.seq || len(a.got) != c.Count || len(a.buf) != c.Total {
+		a.seq = c.Seq
+		a.buf = make([]byte, c.Total)
+		a.got = make([]bool, c.Count)
+		a.left = c.Count
+	}
+	if a.got[c.Index] {
+		return nil, false
+	}
+	copy(a.buf[c.Index*ChunkSize:], c.Data)
+	a.got[c.Index] = true
+	a.left--
+	if a.left > 0 {
+		return nil, false
+	}
+	frame := a.buf
+	a.got = nil
+	a.buf = nil
+	return frame, true
+}
+
+func putFloat(b []byte, v float32) {
+	binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+}
+
+func getFloat(b []byte) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b))
+}
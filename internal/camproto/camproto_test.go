@@ -0,0 +1,120 @@
+package camproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDetectionsRoundTrip(t *testing.T) {
+	in := Detections{
+		Seq:         42,
+		CaptureTime: time.UnixMicro(1700000000123456),
+		Width:       1640,
+		Height:      1232,
+		Items: []Detection{
+			{Class: ClassBall, X: -12.5, Y: 30, Width: 36, Height: 36, Confidence: 1},
+			{Class: ClassRobot, X: 100, Y: -4, Width: 80, Height: 52, Confidence: 0.4},
+		},
+	}
+	out, err := DecodeDetections(EncodeDetections(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Seq != in.Seq || !out.CaptureTime.Equal(in.CaptureTime) || out.Width != in.Width || out.Height != in.Height {
+		t.Errorf("header = %+v, want %+v", out, in)
+	}
+	if len(out.Items) != len(in.Items) {
+		t.Fatalf("items = %d, want %d", len(out.Items), len(in.Items))
+	}
+	for i := range in.Items {
+		if out.Items[i] != in.Items[i] {
+			t.Errorf("item %d = %+v, want %+v", i, out.Items[i], in.Items[i])
+		}
+	}
+}
+
+func TestDecodeRejectsTruncated(t *testing.T) {
+	buf := EncodeDetections(Detections{Items: []Detection{{}}})
+	if _, err := DecodeDetections(buf[:len(buf)-1]); err == nil {
+		t.Error("truncated detections decoded without error")
+	}
+	if _, _, err := ParseHeader([]byte(`{"x":1}`)); err == nil {
+		t.Error("JSON accepted as a binary header")
+	}
+}
+
+func TestFrameChunksReassemble(t *testing.T) {
+	jpeg := bytes.Repeat([]byte{1, 2, 3, 4, 5}, ChunkSize/2)
+	chunks := EncodeFrame(7, jpeg)
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want 3", len(chunks))
+	}
+
+	var a Assembler
+	// A partial older frame is dropped when the next one starts.
+	old, _ := DecodeFrameChunk(EncodeFrame(6, jpeg)[0])
+	a.Add(old)
+
+	for _, i := range []int{2, 0, 1} {
+		c, err := DecodeFrameChunk(chunks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame, ok := a.Add(c)
+		if ok != (i == 1) {
+			t.Fatalf("complete after chunk %d = %v", i, ok)
+		}
+		if ok && !bytes.Equal(frame, jpeg) {
+			t.Error("reassembled frame differs")
+		}
+	}
+}
+
+func TestFrameChunkLimits(t *testing.T) {
+	chunk := func(index, count, total, size int) []byte {
+		buf := make([]byte, HeaderSize+8+size)
+		putHeader(buf, KindFrameChunk, 1)
+		binary.LittleEndian.PutUint16(buf[8:10], uint16(index))
+		binary.LittleEndian.PutUint16(buf[10:12], uint16(count))
+		binary.LittleEndian.PutUint32(buf[12:16], uint32(total))
+		return buf
+	}
+	cases := []struct {
+		name                      string
+		index, count, total, size int
+	}{
+		{"4 GiB frame", 0, 65535, math.MaxUint32, 16},
+		{"above MaxFrameSize", 0, MaxFrameSize/ChunkSize + 1, MaxFrameSize + 1, ChunkSize},
+		{"count too large", 0, 5, 100, 100},
+		{"count too small", 0, 1, 2 * ChunkSize, ChunkSize},
+		{"short middle chunk", 0, 2, ChunkSize + 1, 10},
+		{"long last chunk", 1, 2, ChunkSize + 1, 2},
+	}
+	var a Assembler
+	for _, c := range cases {
+		buf := chunk(c.index, c.count, c.total, c.size)
+		if _, err := DecodeFrameChunk(buf); err == nil {
+			t.Errorf("%s: decoded", c.name)
+		}
+		fc := FrameChunk{Index: c.index, Count: c.count, Total: c.total, Data: buf[16:]}
+		if _, ok := a.Add(fc); ok || a.buf != nil {
+			t.Errorf("%s: assembler allocated %d bytes", c.name, len(a.buf))
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	if got := string(Subscribe(FrameRequest{})); got != "SUB" {
+		t.Errorf("default subscription = %q", got)
+	}
+	r := FrameRequest{Width: 320, Height: 240, FPS: 10, Quality: 70}.Merge(FrameRequest{Width: 640, Height: 480, FPS: 5})
+	if got := string(Subscribe(r)); got != "SUB 640 480 10 70" {
+		t.Errorf("merged subscription = %q", got)
+	}
+	if r := r.Merge(FrameRequest{}); r != (FrameRequest{Quality: 70}) {
+		t.Errorf("merge with a default viewer = %+v", r)
+	}
+}
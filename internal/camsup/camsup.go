@@ -0,0 +1,316 @@
+// Package camsup supervises the Python camera process: it watches the child's
+// exit and the freshness of its detection packets, restarts it with backoff,
+// and reports its state through internal/state and a fault.
+package camsup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/logring"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+)
+
+const (
+	// startupGrace covers camera open and model/library import before the
+	// first detection packet is expected.
+	startupGrace = 15 * time.Second
+	// staleTimeout restarts a running process that stopped sending detections.
+	staleTimeout = 5 * time.Second
+	minBackoff   = 1 * time.Second
+	maxBackoff   = 30 * time.Second
+	// stableRun resets the backoff once the process ran this long.
+	stableRun = 30 * time.Second
+	// stopTimeout is how long SIGTERM is given before SIGKILL.
+	stopTimeout = 2 * time.Second
+	checkPeriod = 500 * time.Millisecond
+)
+
+// processPattern matches camera processes for orphan cleanup (pkill -f).
+const processPattern = "python3 -m camera"
+
+// Status is the supervisor state for the API.
+type Status struct {
+	State        string `json:"state"`
+	Pid          int    `json:"pid"`
+	Restarts     uint32 `json:"restarts"`
+	LastExitCode int    `json:"lastExitCode"`
+	LastError    string `json:"lastError,omitempty"`
+}
+
+// Supervisor runs one camera process.
+type Supervisor struct {
+	mu       sync.Mutex
+	newCmd   func() *exec.Cmd
+	cmd      *exec.Cmd
+	exited   chan struct{}
+	started  time.Time
+	wanted   bool
+	backoff  time.Duration
+	retryAt  time.Time
+	restarts uint32
+	lastExit int
+	lastErr  string
+}
+
+// Default is the camera process supervisor.
+var Default = &Supervisor{backoff: minBackoff}
+
+// SetCommand sets the factory for the camera command. Stdout/Stderr are
+// replaced by the supervisor.
+func (s *Supervisor) SetCommand(newCmd func() *exec.Cmd) {
+	s.mu.Lock()
+	s.newCmd = newCmd
+	s.mu.Unlock()
+}
+
+// Restart stops the process (if any) and starts a fresh one, resetting the
+// backoff.
+func (s *Supervisor) Restart() error {
+	s.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wanted = true
+	s.backoff = minBackoff
+	if err := s.startLocked(); err != nil {
+		s.scheduleRetryLocked(time.Now())
+		return err
+	}
+	return nil
+}
+
+// Stop terminates the process and disables automatic restart until the next
+// Restart.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	s.wanted = false
+	cmd, exited := s.cmd, s.exited
+	s.mu.Unlock()
+
+	if cmd != nil {
+		log.Println("既存のPythonプロセスを停止します。")
+		terminate(cmd, exited)
+	}
+	// Orphans survive Ctrl+C of the Go binary; clear them before reopening the camera.
+	killOrphans()
+
+	state.CameraProcessState.Store(state.CameraProcessStopped)
+	fault.Clear(fault.CodeCamera)
+}
+
+// Run checks the process and restarts it when needed until done is closed.
+func (s *Supervisor) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(checkPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+// Status returns the current supervisor state.
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Status{
+		State:        stateName(state.CameraProcessState.Load()),
+		Restarts:     s.restarts,
+		LastExitCode: s.lastExit,
+		LastError:    s.lastErr,
+	}
+	if s.cmd != nil && s.cmd.Process != nil {
+		st.Pid = s.cmd.Process.Pid
+	}
+	return st
+}
+
+// Restarts returns how many times the process was restarted automatically.
+func (s *Supervisor) Restarts() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// LastExitCode returns the exit code of the last exit (-1 for a signal).
+func (s *Supervisor) LastExitCode() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastExit
+}
+
+func (s *Supervisor) check() {
+	s.mu.Lock()
+	if !s.wanted {
+		s.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if s.cmd == nil {
+		if now.Before(s.retryAt) {
+			s.mu.Unlock()
+			return
+		}
+		s.restarts++
+		log.Printf("Pythonプロセスを再起動します（%d 回目）。", s.restarts)
+		if err := s.startLocked(); err != nil {
+			log.Println(err)
+			s.scheduleRetryLocked(now)
+		}
+		s.mu.Unlock()
+		return
+	}
+
+	cmd, exited := s.cmd, s.exited
+	running := now.Sub(s.started)
+	if running >= stableRun {
+		s.backoff = minBackoff
+	}
+	s.mu.Unlock()
+
+	// Before the first packet of this process, LastCameraRecvTime may still be
+	// from a previous one; count from the start instead.
+	sinceRecv := state.LastCameraRecvTime.Since()
+	lastRecv := min(sinceRecv, running)
+	switch {
+	case running > startupGrace && lastRecv > staleTimeout:
+		msg := fmt.Sprintf("camera process stale: no detections for %s", lastRecv.Round(time.Second))
+		log.Println(msg)
+		fault.Raise(fault.CodeCamera, msg)
+		terminate(cmd, exited)
+	case sinceRecv < staleTimeout:
+		fault.Clear(fault.CodeCamera)
+	}
+}
+
+// startLocked starts the process. Called with s.mu held.
+func (s *Supervisor) startLocked() error {
+	if s.newCmd == nil {
+		return errors.New("camera command not configured")
+	}
+
+	log.Println("Pythonプロセスを開始します。")
+	cmd := s.newCmd()
+	cmd.Stdout = io.MultiWriter(os.Stdout, logring.Default.Writer("camera"))
+	cmd.Stderr = io.MultiWriter(os.Stderr, logring.Default.Writer("camera"))
+	if err := cmd.Start(); err != nil {
+		s.lastErr = err.Error()
+		state.CameraProcessState.Store(state.CameraProcessExited)
+		fault.Raise(fault.CodeCamera, "camera process failed to start: "+err.Error())
+		return fmt.Errorf("Pythonプロセス開始エラー: %w", err)
+	}
+
+	exited := make(chan struct{})
+	s.cmd = cmd
+	s.exited = exited
+	s.started = time.Now()
+	s.lastErr = ""
+	state.CameraProcessState.Store(state.CameraProcessRunning)
+	go s.wait(cmd, exited)
+
+	log.Println("Pythonプロセスが正常に開始されました。")
+	return nil
+}
+
+// wait reaps the process and records how it ended.
+func (s *Supervisor) wait(cmd *exec.Cmd, exited chan struct{}) {
+	err := cmd.Wait()
+	close(exited)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd != cmd {
+		return
+	}
+	s.cmd = nil
+	s.exited = nil
+	s.lastExit = exitCode(cmd, err)
+	if err != nil {
+		s.lastErr = err.Error()
+	}
+	if !s.wanted {
+		return
+	}
+
+	state.CameraProcessState.Store(state.CameraProcessRestarting)
+	log.Printf("Pythonプロセスが終了しました（exit=%d）。%s 後に再起動します。", s.lastExit, s.backoff)
+	fault.Raise(fault.CodeCamera, fmt.Sprintf("camera process exited (code %d)", s.lastExit))
+	s.scheduleRetryLocked(time.Now())
+}
+
+func (s *Supervisor) scheduleRetryLocked(now time.Time) {
+	s.retryAt = now.Add(s.backoff)
+	s.backoff *= 2
+	if s.backoff > maxBackoff {
+		s.backoff = maxBackoff
+	}
+}
+
+// terminate sends SIGTERM and escalates to SIGKILL after stopTimeout.
+func terminate(cmd *exec.Cmd, exited <-chan struct{}) {
+	if cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// killOrphans terminates camera processes not started by this supervisor
+// (e.g. left over from a previous run), waiting until they are gone.
+func killOrphans() {
+	if exec.Command("pgrep", "-f", processPattern).Run() != nil {
+		return
+	}
+	_ = exec.Command("pkill", "-TERM", "-f", processPattern).Run()
+	deadline := time.Now().Add(stopTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if exec.Command("pgrep", "-f", processPattern).Run() != nil {
+			return
+		}
+	}
+	_ = exec.Command("pkill", "-KILL", "-f", processPattern).Run()
+}
+
+func exitCode(cmd *exec.Cmd, err error) int {
+	if cmd.ProcessState != nil {
+		return cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+func stateName(v int32) string {
+	switch v {
+	case state.CameraProcessRunning:
+		return "running"
+	case state.CameraProcessExited:
+		return "exited"
+	case state.CameraProcessRestarting:
+		return "restarting"
+	default:
+		return "stopped"
+	}
+}
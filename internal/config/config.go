@@ -0,0 +1,551 @@
+// Package config loads the optional robot configuration file (config.json,
+// next to threshold.json). Every field has a default, so a missing file or a
+// missing key keeps the built-in behaviour.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/connmgr"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/vision"
+)
+
+const configFile = "config.json"
+
+// Config is the root of config.json.
+type Config struct {
+	Connection ConnectionConfig `json:"connection"`
+	Network    NetworkConfig    `json:"network"`
+	Camera     CameraConfig     `json:"camera"`
+	Telemetry  TelemetryConfig  `json:"telemetry"`
+
+	FlightRecorder FlightRecorderConfig `json:"flightRecorder"`
+	Wheels         WheelsConfig         `json:"wheels"`
+	SelfTest       SelfTestConfig       `json:"selfTest"`
+}
+
+// CameraConfig tunes how camera detections are consumed.
+type CameraConfig struct {
+	// StaleTimeoutMs reports the ball as missing when no detection arrived
+	// for this long.
+	StaleTimeoutMs int `json:"staleTimeoutMs"`
+	// BallPolicy chooses the tracked ball: "best", "confidence", "largest"
+	// or "nearest" (see internal/vision).
+	BallPolicy string `json:"ballPolicy"`
+	// MinBallConfidence ignores ball detections below this confidence.
+	MinBallConfidence float32 `json:"minBallConfidence"`
+	// ForwardDetections is how many detections are sent to the controller.
+	ForwardDetections int `json:"forwardDetections"`
+
+	Tracker    TrackerConfig    `json:"tracker"`
+	Extrinsics ExtrinsicsConfig `json:"extrinsics"`
+	Stream     StreamConfig     `json:"stream"`
+	AutoCalib  AutoCalibConfig  `json:"autoCalib"`
+	Possession PossessionConfig `json:"possession"`
+}
+
+// PossessionConfig tunes the fused ball possession state (see
+// internal/possession).
+type PossessionConfig struct {
+	// AcquireMs debounces the photo sensor, ReleaseMs keeps a held ball
+	// through short photo sensor dropouts.
+	AcquireMs int `json:"acquireMs"`
+	ReleaseMs int `json:"releaseMs"`
+	// CameraWindowMs is how long a camera sighting confirms the photo sensor.
+	CameraWindowMs int `json:"cameraWindowMs"`
+	// GateKick withholds kicks that wait for the ball (not direct kicks)
+	// until the ball is held.
+	GateKick bool `json:"gateKick"`
+	// Samples records training frames labelled with the sensor truth.
+	Samples PossessionSamplesConfig `json:"samples"`
+}
+
+// PossessionSamplesConfig controls the training sample recorder.
+type PossessionSamplesConfig struct {
+	Enabled    bool `json:"enabled"`
+	IntervalMs int  `json:"intervalMs"`
+	MaxSamples int  `json:"maxSamples"`
+}
+
+// AutoCalibConfig tunes the automatic threshold re-calibration (see
+// internal/autocalib).
+type AutoCalibConfig struct {
+	// Enabled starts the monitor at boot; it can be toggled at runtime with
+	// the /autocalib API.
+	Enabled bool `json:"enabled"`
+	// WindowSec is the evaluation period.
+	WindowSec int `json:"windowSec"`
+	// MinSamples is how many frames with the photo sensor on a window needs
+	// to be judged.
+	MinSamples int `json:"minSamples"`
+	// MinDetectionRate and MinCircularity (0 = off) are the quality limits.
+	MinDetectionRate float64 `json:"minDetectionRate"`
+	MinCircularity   float64 `json:"minCircularity"`
+	// MinIntervalSec and MaxPerHour rate limit the automatic changes.
+	MinIntervalSec int `json:"minIntervalSec"`
+	MaxPerHour     int `json:"maxPerHour"`
+}
+
+// StreamConfig sets the defaults and limits of the /stream.mjpeg API.
+type StreamConfig struct {
+	// Fps, Width and Height are used when the request does not give them.
+	Fps    int `json:"fps"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// MaxFps caps the rate a viewer may request.
+	MaxFps  int `json:"maxFps"`
+	Quality int `json:"quality"`
+	// MaxClients limits concurrent streams; further requests get HTTP 503.
+	MaxClients int `json:"maxClients"`
+}
+
+// TrackerConfig tunes the ball tracking filter (see internal/balltrack).
+type TrackerConfig struct {
+	Alpha       float64 `json:"alpha"`
+	Beta        float64 `json:"beta"`
+	MaxCoastMs  int     `json:"maxCoastMs"`
+	GatePx      float64 `json:"gatePx"`
+	MaxOutliers int     `json:"maxOutliers"`
+	// SmoothMCU sends the tracked (filtered, coasting) ball to the MCU
+	// instead of the raw per-frame detection.
+	SmoothMCU bool `json:"smoothMcu"`
+}
+
+// ExtrinsicsConfig places the camera on the robot for the ground plane
+// projection. The projection is off while heightMm or focalLengthPx is 0.
+type ExtrinsicsConfig struct {
+	HeightMm      float64 `json:"heightMm"`
+	PitchDeg      float64 `json:"pitchDeg"`
+	YawDeg        float64 `json:"yawDeg"`
+	OffsetXMm     float64 `json:"offsetXMm"`
+	OffsetYMm     float64 `json:"offsetYMm"`
+	FocalLengthPx float64 `json:"focalLengthPx"`
+	BallRadiusMm  float64 `json:"ballRadiusMm"`
+}
+
+// ConnectionConfig tunes the discovery handshake (see internal/connmgr).
+// Durations are in milliseconds.
+type ConnectionConfig struct {
+	DiscoverIntervalMs    int     `json:"discoverIntervalMs"`
+	DiscoverMaxIntervalMs int     `json:"discoverMaxIntervalMs"`
+	DiscoverBackoff       float64 `json:"discoverBackoff"`
+	OkIntervalMs          int     `json:"okIntervalMs"`
+	LostTimeoutMs         int     `json:"lostTimeoutMs"`
+	RecoverHoldMs         int     `json:"recoverHoldMs"`
+	TimeoutMs             int     `json:"timeoutMs"`
+
+	// AllowedControllers limits which PCs may connect (IP addresses). Empty
+	// allows any PC.
+	AllowedControllers []string `json:"allowedControllers"`
+	// PreferredControllers ranks PCs, most preferred first.
+	PreferredControllers []string `json:"preferredControllers"`
+	// PreferredTakeover lets a more preferred PC take the robot from the
+	// current one instead of waiting for it to time out.
+	PreferredTakeover bool `json:"preferredTakeover"`
+}
+
+// WheelsConfig describes the drive base for the wheel tracking (see
+// internal/wheeltrack).
+type WheelsConfig struct {
+	// AnglesDeg is the position of the FL, BL, BR and FR wheels seen from the
+	// robot centre, counter-clockwise from the front.
+	AnglesDeg [4]float64 `json:"anglesDeg"`
+	// RadiusMm is the distance from the robot centre to the wheels.
+	RadiusMm float64 `json:"radiusMm"`
+	// Inverted marks the wheels (same order) whose MCU speed is positive
+	// when the robot turns clockwise.
+	Inverted [4]bool `json:"inverted"`
+
+	Tracking    WheelTrackingConfig    `json:"tracking"`
+	Calibration WheelCalibrationConfig `json:"calibration"`
+}
+
+// WheelCalibrationConfig tunes the motor calibration routine (see
+// internal/motorcal).
+type WheelCalibrationConfig struct {
+	// Speeds are the commanded wheel speeds (m/s), each run in both
+	// directions.
+	Speeds []float64 `json:"speeds"`
+	// SettleMs is the wait after each speed change, SampleMs the averaging.
+	SettleMs int `json:"settleMs"`
+	SampleMs int `json:"sampleMs"`
+}
+
+// WheelTrackingConfig tunes the commanded versus measured wheel speed
+// comparison.
+type WheelTrackingConfig struct {
+	// WindowMs is the length of a judged block.
+	WindowMs int `json:"windowMs"`
+	// MinSpeed (m/s) is the smallest commanded wheel speed that is judged.
+	MinSpeed float64 `json:"minSpeed"`
+	// StallRatio is the fraction of the commanded speed below which a wheel
+	// counts as stalled.
+	StallRatio float64 `json:"stallRatio"`
+	// Faults raises the motor faults; without it only the tracking error is
+	// reported.
+	Faults bool `json:"faults"`
+}
+
+// SelfTestConfig sets the pass criteria of the self-test (see
+// internal/selftest).
+type SelfTestConfig struct {
+	// WindowMs is how long the link is watched; MinLinkRate (frames/s) and
+	// MaxLinkErrors (errors per frame) judge it.
+	WindowMs      int     `json:"windowMs"`
+	MinLinkRate   float64 `json:"minLinkRate"`
+	MaxLinkErrors float64 `json:"maxLinkErrors"`
+	// MinVolt, MaxVolt bound the battery voltage.
+	MinVolt float64 `json:"minVolt"`
+	MaxVolt float64 `json:"maxVolt"`
+	// MinCameraFps is the lowest detection rate; no detection for
+	// CameraTimeoutMs fails.
+	MinCameraFps    float64 `json:"minCameraFps"`
+	CameraTimeoutMs int     `json:"cameraTimeoutMs"`
+	// SignalMs is how long the buzzer and the LEDs are on.
+	SignalMs int `json:"signalMs"`
+	// WheelSpeed (m/s) is run forward and backward; a wheel passes within
+	// WheelTolerance (fraction of WheelSpeed).
+	WheelSpeed     float64 `json:"wheelSpeed"`
+	WheelTolerance float64 `json:"wheelTolerance"`
+	SettleMs       int     `json:"settleMs"`
+	SampleMs       int     `json:"sampleMs"`
+	// DribblePower (0-100) is run for DribbleMs.
+	DribblePower int `json:"dribblePower"`
+	DribbleMs    int `json:"dribbleMs"`
+	// MinCapPower is the capacitor reading to reach within ChargeTimeoutMs.
+	MinCapPower     int `json:"minCapPower"`
+	ChargeTimeoutMs int `json:"chargeTimeoutMs"`
+}
+
+// FlightRecorderConfig sizes the flight recorder (see internal/flightrec).
+type FlightRecorderConfig struct {
+	// WindowSec is how far back a dump reaches.
+	WindowSec int `json:"windowSec"`
+	// MaxEntries bounds the in-memory ring (link frames, commands, events).
+	MaxEntries int `json:"maxEntries"`
+	// MaxDumps bounds the dump directory; the oldest dumps are deleted.
+	MaxDumps int `json:"maxDumps"`
+	// MinDumpIntervalSec is the shortest time between two automatic dumps
+	// (fault, e-stop).
+	MinDumpIntervalSec int `json:"minDumpIntervalSec"`
+}
+
+// TelemetryConfig sets the defaults and limits of the /telemetry API (see
+// internal/telemetry).
+type TelemetryConfig struct {
+	// RateHz is the per-channel rate when the request gives none.
+	RateHz float64 `json:"rateHz"`
+	// MaxRateHz caps the rate a client may request.
+	MaxRateHz float64 `json:"maxRateHz"`
+	// MaxClients limits concurrent streams; further requests get HTTP 503.
+	MaxClients int `json:"maxClients"`
+	// Buffer is the number of samples queued per client before samples are
+	// dropped.
+	Buffer int `json:"buffer"`
+}
+
+// NetworkConfig selects the interface used for the AI/MW sockets (see
+// internal/netif).
+type NetworkConfig struct {
+	// Interface is an interface name such as "wlan0". Empty means any.
+	Interface string `json:"interface"`
+	// Subnet is a CIDR such as "192.168.100.0/24". Empty means any.
+	Subnet string `json:"subnet"`
+	// RebindIntervalMs is how often the interface address is re-checked.
+	RebindIntervalMs int `json:"rebindIntervalMs"`
+	// IPv6Multicast additionally sends DISCOVER to MulticastAddr6 and accepts
+	// the controller over IPv6.
+	IPv6Multicast  bool   `json:"ipv6Multicast"`
+	MulticastAddr6 string `json:"multicastAddr6"`
+}
+
+// Default is used for every key absent from config.json.
+var Default = Config{
+	Connection: ConnectionConfig{
+		DiscoverIntervalMs:    toMs(connmgr.DefaultConfig.DiscoverInterval),
+		DiscoverMaxIntervalMs: toMs(connmgr.DefaultConfig.DiscoverMaxInterval),
+		DiscoverBackoff:       connmgr.DefaultConfig.DiscoverBackoff,
+		OkIntervalMs:          toMs(connmgr.DefaultConfig.OkInterval),
+		LostTimeoutMs:         toMs(connmgr.DefaultConfig.LostTimeout),
+		RecoverHoldMs:         toMs(connmgr.DefaultConfig.RecoverHold),
+		TimeoutMs:             toMs(connmgr.DefaultConfig.Timeout),
+	},
+	Network: NetworkConfig{
+		RebindIntervalMs: 2000,
+		MulticastAddr6:   "ff02::5:69:4",
+	},
+	Telemetry: TelemetryConfig{
+		RateHz:     20,
+		MaxRateHz:  200,
+		MaxClients: 4,
+		Buffer:     256,
+	},
+	FlightRecorder: FlightRecorderConfig{
+		WindowSec:          10,
+		MaxEntries:         8192,
+		MaxDumps:           20,
+		MinDumpIntervalSec: 30,
+	},
+	Wheels: WheelsConfig{
+		AnglesDeg: [4]float64{60, 135, 225, 300},
+		RadiusMm:  80,
+		Tracking: WheelTrackingConfig{
+			WindowMs:   500,
+			MinSpeed:   0.3,
+			StallRatio: 0.2,
+			Faults:     true,
+		},
+		Calibration: WheelCalibrationConfig{
+			Speeds:   []float64{0.05, 0.1, 0.15, 0.2, 0.3, 0.4, 0.5},
+			SettleMs: 400,
+			SampleMs: 400,
+		},
+	},
+	SelfTest: SelfTestConfig{
+		WindowMs:        1000,
+		MinLinkRate:     50,
+		MaxLinkErrors:   0.05,
+		MinVolt:         14,
+		MaxVolt:         17,
+		MinCameraFps:    10,
+		CameraTimeoutMs: 1000,
+		SignalMs:        1000,
+		WheelSpeed:      0.3,
+		WheelTolerance:  0.3,
+		SettleMs:        500,
+		SampleMs:        500,
+		DribblePower:    50,
+		DribbleMs:       1000,
+		MinCapPower:     100,
+		ChargeTimeoutMs: 10000,
+	},
+	Camera: CameraConfig{
+		StaleTimeoutMs:    500,
+		BallPolicy:        "best",
+		ForwardDetections: 8,
+		Tracker: TrackerConfig{
+			Alpha:       0.6,
+			Beta:        0.2,
+			MaxCoastMs:  300,
+			GatePx:      80,
+			MaxOutliers: 3,
+		},
+		Extrinsics: ExtrinsicsConfig{
+			BallRadiusMm: 21.5,
+		},
+		Stream: StreamConfig{
+			Fps:        10,
+			Width:      320,
+			Height:     240,
+			MaxFps:     30,
+			Quality:    70,
+			MaxClients: 3,
+		},
+		AutoCalib: AutoCalibConfig{
+			WindowSec:        10,
+			MinSamples:       30,
+			MinDetectionRate: 0.6,
+			MinCircularity:   0.5,
+			MinIntervalSec:   60,
+			MaxPerHour:       6,
+		},
+		Possession: PossessionConfig{
+			AcquireMs:      30,
+			ReleaseMs:      150,
+			CameraWindowMs: 500,
+			Samples: PossessionSamplesConfig{
+				IntervalMs: 2000,
+				MaxSamples: 500,
+			},
+		},
+	},
+}
+
+var (
+	mu      sync.RWMutex
+	current = Default
+)
+
+// Get returns the loaded configuration (Default until Load is called).
+func Get() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Load reads config.json on top of Default and validates it. A missing file is
+// not an error.
+func Load() (Config, error) {
+	cfg := Default
+	// json.Unmarshal decodes a slice into the existing backing array when it
+	// fits, which would overwrite the one of Default.
+	cfg.Wheels.Calibration.Speeds = append([]float64(nil), Default.Wheels.Calibration.Speeds...)
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		log.Printf("%s not found, using defaults", configFile)
+	} else if err != nil {
+		return Default, err
+	} else if err := json.Unmarshal(data, &cfg); err != nil {
+		return Default, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return Default, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	mu.Lock()
+	current = cfg
+	mu.Unlock()
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	cc := c.Connection
+	if cc.DiscoverIntervalMs <= 0 || cc.OkIntervalMs <= 0 || cc.TimeoutMs <= 0 || cc.LostTimeoutMs <= 0 {
+		return fmt.Errorf("connection: intervals and timeouts must be positive")
+	}
+	if cc.DiscoverMaxIntervalMs < cc.DiscoverIntervalMs {
+		return fmt.Errorf("connection: discoverMaxIntervalMs must be >= discoverIntervalMs")
+	}
+	if cc.DiscoverBackoff < 1 {
+		return fmt.Errorf("connection: discoverBackoff must be >= 1")
+	}
+	if cc.LostTimeoutMs > cc.TimeoutMs {
+		return fmt.Errorf("connection: lostTimeoutMs must be <= timeoutMs")
+	}
+	if cc.RecoverHoldMs < 0 {
+		return fmt.Errorf("connection: recoverHoldMs must not be negative")
+	}
+	for _, list := range [][]string{cc.AllowedControllers, cc.PreferredControllers} {
+		if _, err := ParseIPs(list); err != nil {
+			return fmt.Errorf("connection: %w", err)
+		}
+	}
+
+	nc := c.Network
+	if _, err := nc.ParseSubnet(); err != nil {
+		return fmt.Errorf("network: %w", err)
+	}
+	if nc.RebindIntervalMs <= 0 {
+		return fmt.Errorf("network: rebindIntervalMs must be positive")
+	}
+	if tc := c.Telemetry; tc.RateHz <= 0 || tc.MaxRateHz < tc.RateHz || tc.MaxClients <= 0 || tc.Buffer <= 0 {
+		return fmt.Errorf("telemetry: rateHz, maxClients and buffer must be positive and maxRateHz >= rateHz")
+	}
+	if fc := c.FlightRecorder; fc.WindowSec <= 0 || fc.MaxEntries <= 0 || fc.MaxDumps <= 0 || fc.MinDumpIntervalSec < 0 {
+		return fmt.Errorf("flightRecorder: windowSec, maxEntries and maxDumps must be positive and minDumpIntervalSec not negative")
+	}
+	if c.Wheels.RadiusMm <= 0 {
+		return fmt.Errorf("wheels: radiusMm must be positive")
+	}
+	if tc := c.Wheels.Tracking; tc.WindowMs <= 0 || tc.MinSpeed <= 0 || tc.StallRatio <= 0 || tc.StallRatio >= 1 {
+		return fmt.Errorf("wheels.tracking: windowMs and minSpeed must be positive and stallRatio between 0 and 1")
+	}
+	if wc := c.Wheels.Calibration; len(wc.Speeds) < 2 || wc.SettleMs < 0 || wc.SampleMs <= 0 {
+		return fmt.Errorf("wheels.calibration: at least 2 speeds, settleMs not negative and sampleMs positive")
+	}
+	for _, v := range c.Wheels.Calibration.Speeds {
+		if v <= 0 || v > 3 {
+			return fmt.Errorf("wheels.calibration: speeds must be in (0, 3] m/s")
+		}
+	}
+	st := c.SelfTest
+	if st.WindowMs <= 0 || st.CameraTimeoutMs <= 0 || st.SampleMs <= 0 || st.ChargeTimeoutMs <= 0 || st.SignalMs < 0 || st.SettleMs < 0 || st.DribbleMs < 0 {
+		return fmt.Errorf("selfTest: windowMs, cameraTimeoutMs, sampleMs and chargeTimeoutMs must be positive and the other times not negative")
+	}
+	if st.MinLinkRate < 0 || st.MaxLinkErrors < 0 || st.MinCameraFps < 0 || st.MinVolt > st.MaxVolt {
+		return fmt.Errorf("selfTest: minLinkRate, maxLinkErrors and minCameraFps must not be negative and minVolt <= maxVolt")
+	}
+	if st.WheelSpeed <= 0 || st.WheelSpeed > 3 || st.WheelTolerance <= 0 {
+		return fmt.Errorf("selfTest: wheelSpeed must be in (0, 3] m/s and wheelTolerance positive")
+	}
+	if st.DribblePower < 0 || st.DribblePower > 100 || st.MinCapPower < 0 || st.MinCapPower > 255 {
+		return fmt.Errorf("selfTest: dribblePower must be within 0-100 and minCapPower within 0-255")
+	}
+	cam := c.Camera
+	if cam.StaleTimeoutMs <= 0 {
+		return fmt.Errorf("camera: staleTimeoutMs must be positive")
+	}
+	if _, err := vision.ParsePolicy(cam.BallPolicy); err != nil {
+		return fmt.Errorf("camera: %w", err)
+	}
+	if cam.MinBallConfidence < 0 || cam.MinBallConfidence > 1 {
+		return fmt.Errorf("camera: minBallConfidence must be within 0-1")
+	}
+	if cam.ForwardDetections < 0 || cam.ForwardDetections > 32 {
+		return fmt.Errorf("camera: forwardDetections must be within 0-32")
+	}
+	tc := cam.Tracker
+	if tc.Alpha <= 0 || tc.Alpha > 1 || tc.Beta < 0 || tc.Beta >= 2 {
+		return fmt.Errorf("camera.tracker: alpha must be within (0, 1] and beta within [0, 2)")
+	}
+	if tc.MaxCoastMs < 0 || tc.GatePx < 0 || tc.MaxOutliers < 0 {
+		return fmt.Errorf("camera.tracker: maxCoastMs, gatePx and maxOutliers must not be negative")
+	}
+	if ex := cam.Extrinsics; ex.HeightMm < 0 || ex.FocalLengthPx < 0 || ex.BallRadiusMm < 0 {
+		return fmt.Errorf("camera.extrinsics: heightMm, focalLengthPx and ballRadiusMm must not be negative")
+	}
+	if sc := cam.Stream; sc.Fps <= 0 || sc.MaxFps < sc.Fps || sc.Width <= 0 || sc.Height <= 0 || sc.MaxClients <= 0 {
+		return fmt.Errorf("camera.stream: fps, width, height and maxClients must be positive and maxFps >= fps")
+	}
+	if q := cam.Stream.Quality; q < 1 || q > 100 {
+		return fmt.Errorf("camera.stream: quality must be within 1-100")
+	}
+	if ac := cam.AutoCalib; ac.WindowSec <= 0 || ac.MinSamples <= 0 || ac.MinIntervalSec < 0 || ac.MaxPerHour <= 0 {
+		return fmt.Errorf("camera.autoCalib: windowSec, minSamples and maxPerHour must be positive and minIntervalSec not negative")
+	}
+	if ac := cam.AutoCalib; ac.MinDetectionRate < 0 || ac.MinDetectionRate > 1 || ac.MinCircularity < 0 || ac.MinCircularity > 1 {
+		return fmt.Errorf("camera.autoCalib: minDetectionRate and minCircularity must be within 0-1")
+	}
+	if pc := cam.Possession; pc.AcquireMs < 0 || pc.ReleaseMs < 0 || pc.CameraWindowMs < 0 {
+		return fmt.Errorf("camera.possession: acquireMs, releaseMs and cameraWindowMs must not be negative")
+	}
+	if sc := cam.Possession.Samples; sc.IntervalMs <= 0 || sc.MaxSamples <= 0 {
+		return fmt.Errorf("camera.possession.samples: intervalMs and maxSamples must be positive")
+	}
+	if ip := net.ParseIP(nc.MulticastAddr6); nc.IPv6Multicast && (ip == nil || ip.To4() != nil || !ip.IsMulticast()) {
+		return fmt.Errorf("network: multicastAddr6 %q is not an IPv6 multicast address", nc.MulticastAddr6)
+	}
+	return nil
+}
+
+// ParseSubnet returns the configured subnet, or nil when unset.
+func (nc NetworkConfig) ParseSubnet() (*net.IPNet, error) {
+	if nc.Subnet == "" {
+		return nil, nil
+	}
+	_, subnet, err := net.ParseCIDR(nc.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q", nc.Subnet)
+	}
+	return subnet, nil
+}
+
+// ParseIPs parses a list of IP addresses.
+func ParseIPs(list []string) ([]net.IP, error) {
+	ips := make([]net.IP, 0, len(list))
+	for _, v := range list {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", v)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// Ms converts a millisecond config value to a time.Duration.
+func Ms(v int) time.Duration {
+	return time.Duration(v) * time.Millisecond
+}
+
+// toMs is the inverse of Ms, for defaults owned by other packages.
+func toMs(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
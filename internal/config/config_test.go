@@ -0,0 +1,25 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestLoadKeepsDefault(t *testing.T) {
+	t.Chdir(t.TempDir())
+	want := slices.Clone(Default.Wheels.Calibration.Speeds)
+	if err := os.WriteFile(configFile, []byte(`{"wheels": {"calibration": {"speeds": [0.2, 0.4]}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.Wheels.Calibration.Speeds, []float64{0.2, 0.4}) {
+		t.Fatalf("speeds = %v", cfg.Wheels.Calibration.Speeds)
+	}
+	if !slices.Equal(Default.Wheels.Calibration.Speeds, want) {
+		t.Fatalf("Default speeds overwritten: %v", Default.Wheels.Calibration.Speeds)
+	}
+}
@@ -0,0 +1,479 @@
+// Package connmgr implements the robot side of the discovery handshake with the
+// controller (RACOON-MW):
+//
+//	DISCOVERING --OFFER--> OFFERED --OK_PC--> CONNECTED
+//	     ^                    |                  |
+//	     +------ timeout -----+---- timeout -----+
+//
+// While CONNECTED the link is additionally tracked as lost/healthy with
+// hysteresis, so a short Wi-Fi dropout (lost -> recovered without a new OFFER)
+// can be told apart from a controller restart (a new OFFER while connected).
+//
+// Which controller the robot follows is decided by Policy: an optional allow
+// list, an optional preference order, and an operator pin (see Pin). By default
+// the current controller is kept until it times out, so two controllers on the
+// same network do not take a robot from each other.
+//
+// The manager is driven by the receive loop (On* methods) and the MW send loop
+// (Tick), and does no I/O itself so it can be tested with a fake clock.
+package connmgr
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// State is the discovery handshake state.
+type State int
+
+const (
+	Discovering State = iota
+	Offered
+	Connected
+)
+
+func (s State) String() string {
+	switch s {
+	case Offered:
+		return "offered"
+	case Connected:
+		return "connected"
+	default:
+		return "discovering"
+	}
+}
+
+// Event is a connection transition delivered to subscribers.
+type Event int
+
+const (
+	// EventConnected fires when the handshake completes (OK_PC received).
+	EventConnected Event = iota
+	// EventLost fires when no packet arrived for Config.LostTimeout while connected.
+	EventLost
+	// EventRecovered fires when packets from the same controller resumed for
+	// Config.RecoverHold after EventLost.
+	EventRecovered
+	// EventDisconnected fires when the connection is dropped after
+	// Config.Timeout without packets (or an unanswered OFFER).
+	EventDisconnected
+	// EventReoffered fires when a new OFFER arrives while connected, i.e. the
+	// controller was restarted or re-discovered the robot.
+	EventReoffered
+)
+
+func (e Event) String() string {
+	switch e {
+	case EventConnected:
+		return "connected"
+	case EventLost:
+		return "lost"
+	case EventRecovered:
+		return "recovered"
+	case EventDisconnected:
+		return "disconnected"
+	case EventReoffered:
+		return "reoffered"
+	default:
+		return "unknown"
+	}
+}
+
+// Clock abstracts time.Now for tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// Config holds the handshake and timeout timing.
+type Config struct {
+	// DiscoverInterval is the first DISCOVER retransmission interval. The PC
+	// discards DISCOVERs within 1.5s of the last exchange as duplicates.
+	DiscoverInterval time.Duration
+	// DiscoverMaxInterval caps the exponential backoff of DISCOVER.
+	DiscoverMaxInterval time.Duration
+	// DiscoverBackoff multiplies the interval after each unanswered DISCOVER.
+	DiscoverBackoff float64
+	// OkInterval is the OK_ROBOT retransmission interval while OFFERED.
+	OkInterval time.Duration
+	// LostTimeout marks the link lost (but keeps the controller) when no
+	// packet arrived for this long.
+	LostTimeout time.Duration
+	// RecoverHold is how long packets must keep arriving after a loss before
+	// the link is considered recovered.
+	RecoverHold time.Duration
+	// Timeout drops the connection and restarts discovery.
+	Timeout time.Duration
+}
+
+// DefaultConfig matches the fixed timing used before the manager existed. It is
+// also the default of the connection section of config.json.
+var DefaultConfig = Config{
+	DiscoverInterval:    1500 * time.Millisecond,
+	DiscoverMaxInterval: 6 * time.Second,
+	DiscoverBackoff:     2,
+	OkInterval:          100 * time.Millisecond,
+	LostTimeout:         1 * time.Second,
+	RecoverHold:         300 * time.Millisecond,
+	Timeout:             3 * time.Second,
+}
+
+// Policy selects which controllers are followed.
+type Policy struct {
+	// Allowed restricts OFFERs to these hosts. Empty allows any host.
+	Allowed []net.IP
+	// Preferred ranks controllers, most preferred first. Hosts not listed rank
+	// below all listed ones.
+	Preferred []net.IP
+	// PreferredTakeover lets an OFFER from a higher ranked controller replace
+	// the current one. Otherwise the current controller is kept until it times
+	// out.
+	PreferredTakeover bool
+}
+
+// ActionKind is what the send loop has to transmit after a Tick.
+type ActionKind int
+
+const (
+	ActionNone ActionKind = iota
+	ActionSendDiscover
+	ActionSendOk
+	ActionSendStatus
+)
+
+// Action is the result of Tick. Addr is the controller for ActionSendOk and
+// ActionSendStatus.
+type Action struct {
+	Kind ActionKind
+	Addr *net.UDPAddr
+}
+
+// Manager is the connection state machine. All methods are safe for
+// concurrent use.
+type Manager struct {
+	mu    sync.Mutex
+	cfg   Config
+	clock Clock
+
+	state    State
+	pc       *net.UDPAddr
+	lastRecv time.Time
+
+	lost         bool
+	recoverSince time.Time
+
+	discoverInterval time.Duration
+	nextDiscover     time.Time
+	lastOkSent       time.Time
+	rtt              time.Duration
+
+	policy       Policy
+	pinned       net.IP
+	lastRejected string
+
+	hooks []func(Event)
+}
+
+// New returns a manager in the DISCOVERING state.
+func New(cfg Config, clock Clock) *Manager {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Manager{
+		cfg:              cfg,
+		clock:            clock,
+		discoverInterval: cfg.DiscoverInterval,
+	}
+}
+
+// Default is the manager shared by the receive and MW loops.
+var Default = New(DefaultConfig, SystemClock)
+
+// Configure replaces the timing. Called once at startup before the loops run.
+func (m *Manager) Configure(cfg Config) {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.discoverInterval = cfg.DiscoverInterval
+	m.mu.Unlock()
+}
+
+// SetPolicy replaces the controller selection policy.
+func (m *Manager) SetPolicy(p Policy) {
+	m.mu.Lock()
+	m.policy = p
+	m.mu.Unlock()
+}
+
+// Pin restricts the robot to the controller at ip until Release. If another
+// controller is currently followed, the connection is dropped so the pinned
+// one can take over with its next OFFER.
+func (m *Manager) Pin(ip net.IP) {
+	var events []Event
+	m.mu.Lock()
+	m.pinned = ip
+	if m.state != Discovering && !m.pc.IP.Equal(ip) {
+		m.resetLocked(m.clock.Now())
+		events = append(events, EventDisconnected)
+	}
+	m.mu.Unlock()
+
+	log.Printf("Controller pinned to %s", ip)
+	m.emit(events)
+}
+
+// Release removes the pin set by Pin.
+func (m *Manager) Release() {
+	m.mu.Lock()
+	m.pinned = nil
+	m.mu.Unlock()
+	log.Println("Controller pin released")
+}
+
+// Pinned returns the pinned controller, or nil.
+func (m *Manager) Pinned() net.IP {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pinned
+}
+
+// Subscribe registers fn for every event. fn is called without the manager
+// lock held, from the goroutine that caused the transition, and must not block.
+func (m *Manager) Subscribe(fn func(Event)) {
+	m.mu.Lock()
+	m.hooks = append(m.hooks, fn)
+	m.mu.Unlock()
+}
+
+// State returns the handshake state.
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Lost reports whether the connected link is currently considered lost.
+func (m *Manager) Lost() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state == Connected && m.lost
+}
+
+// Controller returns the controller address (nil while DISCOVERING).
+func (m *Manager) Controller() *net.UDPAddr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pc
+}
+
+// RTT returns the OK_ROBOT -> OK_PC round trip of the last handshake.
+func (m *Manager) RTT() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rtt
+}
+
+// OnOffer handles OFFER from pc (already rewritten to the controller's
+// receive port) and reports whether it was accepted under the current policy.
+func (m *Manager) OnOffer(pc *net.UDPAddr) bool {
+	var events []Event
+	m.mu.Lock()
+	if reason := m.rejectLocked(pc.IP); reason != "" {
+		host := pc.IP.String()
+		logIt := host != m.lastRejected
+		m.lastRejected = host
+		m.mu.Unlock()
+		if logIt {
+			log.Printf("[AI RX] Ignored OFFER from %s (%s)", host, reason)
+		}
+		return false
+	}
+	if m.state == Connected {
+		events = append(events, EventReoffered)
+	}
+	m.lastRejected = ""
+	m.pc = pc
+	m.state = Offered
+	m.lost = false
+	m.lastRecv = m.clock.Now()
+	m.lastOkSent = time.Time{}
+	m.mu.Unlock()
+
+	log.Printf("[AI RX] Received OFFER from %s. State -> OFFERED", pc.String())
+	m.emit(events)
+	return true
+}
+
+// OnOkPc handles OK_PC and reports whether it completed the handshake.
+func (m *Manager) OnOkPc(from *net.UDPAddr) bool {
+	m.mu.Lock()
+	if m.state != Offered || !m.isControllerLocked(from) {
+		m.mu.Unlock()
+		return false
+	}
+	now := m.clock.Now()
+	m.state = Connected
+	m.lastRecv = now
+	m.lost = false
+	m.discoverInterval = m.cfg.DiscoverInterval
+	if !m.lastOkSent.IsZero() {
+		m.rtt = now.Sub(m.lastOkSent)
+	}
+	m.mu.Unlock()
+
+	log.Printf("[AI RX] Received OK_PC from %s. State -> CONNECTED", from.IP.String())
+	m.emit([]Event{EventConnected})
+	return true
+}
+
+// OnPacket handles DATA / KEEP_ALIVE / CONTROL and reports whether the packet
+// comes from the connected controller and should be processed.
+func (m *Manager) OnPacket(from *net.UDPAddr) bool {
+	var events []Event
+	m.mu.Lock()
+	if m.state != Connected || !m.isControllerLocked(from) {
+		m.mu.Unlock()
+		return false
+	}
+	now := m.clock.Now()
+	if m.lost {
+		// Hysteresis: a single stray packet is not a recovery; packets have to
+		// keep arriving (no gap longer than LostTimeout) for RecoverHold.
+		if m.recoverSince.IsZero() || now.Sub(m.lastRecv) > m.cfg.LostTimeout {
+			m.recoverSince = now
+		}
+		if now.Sub(m.recoverSince) >= m.cfg.RecoverHold {
+			m.lost = false
+			m.recoverSince = time.Time{}
+			events = append(events, EventRecovered)
+		}
+	}
+	m.lastRecv = now
+	m.mu.Unlock()
+
+	m.emit(events)
+	return true
+}
+
+// Tick advances timeouts and returns what the send loop should transmit now.
+func (m *Manager) Tick() Action {
+	var events []Event
+	var action Action
+
+	m.mu.Lock()
+	now := m.clock.Now()
+	silence := now.Sub(m.lastRecv)
+
+	if m.state != Discovering && silence > m.cfg.Timeout {
+		log.Println("[AI TX] PC connection timed out. Reverting to DISCOVERING.")
+		m.resetLocked(now)
+		events = append(events, EventDisconnected)
+	}
+
+	switch m.state {
+	case Discovering:
+		if !now.Before(m.nextDiscover) {
+			action = Action{Kind: ActionSendDiscover}
+			m.nextDiscover = now.Add(m.discoverInterval)
+			next := time.Duration(float64(m.discoverInterval) * m.cfg.DiscoverBackoff)
+			if next > m.cfg.DiscoverMaxInterval {
+				next = m.cfg.DiscoverMaxInterval
+			}
+			if next < m.cfg.DiscoverInterval {
+				next = m.cfg.DiscoverInterval
+			}
+			m.discoverInterval = next
+		}
+
+	case Offered:
+		if m.lastOkSent.IsZero() || now.Sub(m.lastOkSent) > m.cfg.OkInterval {
+			action = Action{Kind: ActionSendOk, Addr: m.pc}
+			m.lastOkSent = now
+		}
+
+	case Connected:
+		if !m.lost && silence > m.cfg.LostTimeout {
+			m.lost = true
+			m.recoverSince = time.Time{}
+			events = append(events, EventLost)
+		}
+		action = Action{Kind: ActionSendStatus, Addr: m.pc}
+	}
+	m.mu.Unlock()
+
+	m.emit(events)
+	return action
+}
+
+// resetLocked returns to DISCOVERING and sends a DISCOVER on the next Tick.
+func (m *Manager) resetLocked(now time.Time) {
+	m.state = Discovering
+	m.pc = nil
+	m.lost = false
+	m.recoverSince = time.Time{}
+	m.discoverInterval = m.cfg.DiscoverInterval
+	m.nextDiscover = now
+}
+
+// rejectLocked returns why an OFFER from ip is not accepted, or "".
+func (m *Manager) rejectLocked(ip net.IP) string {
+	if m.pinned != nil {
+		if !m.pinned.Equal(ip) {
+			return "pinned to " + m.pinned.String()
+		}
+		return ""
+	}
+	if len(m.policy.Allowed) > 0 && rank(m.policy.Allowed, ip) < 0 {
+		return "not in allowed controllers"
+	}
+	if m.state == Discovering || m.pc.IP.Equal(ip) {
+		return ""
+	}
+	if m.policy.PreferredTakeover && m.rankLocked(ip) < m.rankLocked(m.pc.IP) {
+		return ""
+	}
+	return "keeping current controller " + m.pc.IP.String()
+}
+
+// rankLocked returns the preference rank of ip (lower is preferred).
+func (m *Manager) rankLocked(ip net.IP) int {
+	if r := rank(m.policy.Preferred, ip); r >= 0 {
+		return r
+	}
+	return len(m.policy.Preferred)
+}
+
+func rank(list []net.IP, ip net.IP) int {
+	for i, v := range list {
+		if v.Equal(ip) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Manager) isControllerLocked(from *net.UDPAddr) bool {
+	return m.pc != nil && from != nil && m.pc.IP.Equal(from.IP)
+}
+
+func (m *Manager) emit(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	m.mu.Lock()
+	hooks := append([]func(Event){}, m.hooks...)
+	m.mu.Unlock()
+
+	for _, ev := range events {
+		for _, fn := range hooks {
+			fn(ev)
+		}
+	}
+}
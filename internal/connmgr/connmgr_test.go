@@ -0,0 +1,223 @@
+package connmgr
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+var (
+	pcAddr    = &net.UDPAddr{IP: net.ParseIP("192.168.100.10"), Port: 30011}
+	otherAddr = &net.UDPAddr{IP: net.ParseIP("192.168.100.20"), Port: 30011}
+)
+
+func newTestManager() (*Manager, *fakeClock, *[]Event) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	m := New(DefaultConfig, clock)
+	events := &[]Event{}
+	m.Subscribe(func(ev Event) { *events = append(*events, ev) })
+	return m, clock, events
+}
+
+// connect runs the handshake and returns with the manager CONNECTED.
+func connect(t *testing.T, m *Manager, clock *fakeClock) {
+	t.Helper()
+	m.OnOffer(pcAddr)
+	if a := m.Tick(); a.Kind != ActionSendOk {
+		t.Fatalf("expected OK_ROBOT after OFFER, got %v", a.Kind)
+	}
+	clock.Advance(20 * time.Millisecond)
+	if !m.OnOkPc(pcAddr) {
+		t.Fatal("OK_PC did not complete the handshake")
+	}
+}
+
+func TestDiscoverBackoff(t *testing.T) {
+	m, clock, _ := newTestManager()
+
+	var sent []time.Duration
+	start := clock.now
+	for clock.now.Sub(start) < 20*time.Second {
+		if m.Tick().Kind == ActionSendDiscover {
+			sent = append(sent, clock.now.Sub(start))
+		}
+		clock.Advance(100 * time.Millisecond)
+	}
+
+	want := []time.Duration{0, 1500, 4500, 10500, 16500}
+	if len(sent) != len(want) {
+		t.Fatalf("DISCOVER sent at %v, want %d sends", sent, len(want))
+	}
+	for i, w := range want {
+		if sent[i] != w*time.Millisecond {
+			t.Errorf("DISCOVER #%d at %v, want %v", i, sent[i], w*time.Millisecond)
+		}
+	}
+}
+
+func TestHandshakeRTT(t *testing.T) {
+	m, clock, events := newTestManager()
+	connect(t, m, clock)
+
+	if m.State() != Connected {
+		t.Fatalf("state = %v, want connected", m.State())
+	}
+	if m.RTT() != 20*time.Millisecond {
+		t.Errorf("RTT = %v, want 20ms", m.RTT())
+	}
+	if len(*events) != 1 || (*events)[0] != EventConnected {
+		t.Errorf("events = %v, want [connected]", *events)
+	}
+	if a := m.Tick(); a.Kind != ActionSendStatus || !a.Addr.IP.Equal(pcAddr.IP) {
+		t.Errorf("connected tick = %+v, want status to controller", a)
+	}
+}
+
+func TestOkPcFromOtherHostIgnored(t *testing.T) {
+	m, _, _ := newTestManager()
+	m.OnOffer(pcAddr)
+	if m.OnOkPc(otherAddr) {
+		t.Fatal("OK_PC from another host completed the handshake")
+	}
+	if m.OnPacket(pcAddr) {
+		t.Fatal("DATA accepted before the handshake completed")
+	}
+}
+
+func TestLostAndRecoveredHysteresis(t *testing.T) {
+	m, clock, events := newTestManager()
+	connect(t, m, clock)
+	*events = nil
+
+	clock.Advance(1100 * time.Millisecond)
+	m.Tick()
+	if !m.Lost() {
+		t.Fatal("link not lost after LostTimeout")
+	}
+
+	// A single packet is not enough to recover.
+	m.OnPacket(pcAddr)
+	if !m.Lost() {
+		t.Fatal("recovered after a single packet")
+	}
+	for i := 0; i < 4; i++ {
+		clock.Advance(100 * time.Millisecond)
+		m.OnPacket(pcAddr)
+	}
+	if m.Lost() {
+		t.Fatal("still lost after RecoverHold of steady packets")
+	}
+
+	want := []Event{EventLost, EventRecovered}
+	if len(*events) != len(want) || (*events)[0] != want[0] || (*events)[1] != want[1] {
+		t.Errorf("events = %v, want %v", *events, want)
+	}
+}
+
+func TestTimeoutDisconnects(t *testing.T) {
+	m, clock, events := newTestManager()
+	connect(t, m, clock)
+	*events = nil
+
+	clock.Advance(1100 * time.Millisecond)
+	m.Tick()
+	clock.Advance(2000 * time.Millisecond)
+	if a := m.Tick(); a.Kind != ActionSendDiscover {
+		t.Errorf("tick after timeout = %v, want DISCOVER", a.Kind)
+	}
+	if m.State() != Discovering || m.Controller() != nil {
+		t.Errorf("state = %v controller = %v, want discovering/nil", m.State(), m.Controller())
+	}
+	want := []Event{EventLost, EventDisconnected}
+	if len(*events) != len(want) || (*events)[0] != want[0] || (*events)[1] != want[1] {
+		t.Errorf("events = %v, want %v", *events, want)
+	}
+}
+
+func TestReofferWhileConnected(t *testing.T) {
+	m, clock, events := newTestManager()
+	connect(t, m, clock)
+	*events = nil
+
+	m.OnOffer(pcAddr)
+	if m.State() != Offered {
+		t.Fatalf("state = %v, want offered", m.State())
+	}
+	if len(*events) != 1 || (*events)[0] != EventReoffered {
+		t.Errorf("events = %v, want [reoffered]", *events)
+	}
+}
+
+func TestKeepCurrentController(t *testing.T) {
+	m, clock, _ := newTestManager()
+	connect(t, m, clock)
+
+	if m.OnOffer(otherAddr) {
+		t.Fatal("OFFER from a second controller replaced the current one")
+	}
+	if !m.Controller().IP.Equal(pcAddr.IP) || m.State() != Connected {
+		t.Errorf("controller = %v state = %v, want %v connected", m.Controller(), m.State(), pcAddr.IP)
+	}
+
+	// After a timeout the other controller may take over.
+	clock.Advance(3100 * time.Millisecond)
+	m.Tick()
+	if !m.OnOffer(otherAddr) {
+		t.Fatal("OFFER rejected after the current controller timed out")
+	}
+}
+
+func TestAllowedControllers(t *testing.T) {
+	m, _, _ := newTestManager()
+	m.SetPolicy(Policy{Allowed: []net.IP{pcAddr.IP}})
+
+	if m.OnOffer(otherAddr) {
+		t.Fatal("OFFER accepted from a controller not in the allow list")
+	}
+	if !m.OnOffer(pcAddr) {
+		t.Fatal("OFFER rejected from an allowed controller")
+	}
+}
+
+func TestPreferredTakeover(t *testing.T) {
+	m, clock, _ := newTestManager()
+	m.SetPolicy(Policy{Preferred: []net.IP{otherAddr.IP}, PreferredTakeover: true})
+	connect(t, m, clock)
+
+	if !m.OnOffer(otherAddr) {
+		t.Fatal("preferred controller could not take over")
+	}
+	if m.OnOffer(pcAddr) {
+		t.Fatal("less preferred controller took the robot back")
+	}
+}
+
+func TestPinAndRelease(t *testing.T) {
+	m, clock, events := newTestManager()
+	connect(t, m, clock)
+	*events = nil
+
+	m.Pin(otherAddr.IP)
+	if m.State() != Discovering {
+		t.Fatalf("state = %v after pinning another controller, want discovering", m.State())
+	}
+	if len(*events) != 1 || (*events)[0] != EventDisconnected {
+		t.Errorf("events = %v, want [disconnected]", *events)
+	}
+	if m.OnOffer(pcAddr) {
+		t.Fatal("OFFER accepted from a controller other than the pinned one")
+	}
+	if !m.OnOffer(otherAddr) {
+		t.Fatal("OFFER rejected from the pinned controller")
+	}
+
+	m.Release()
+	if m.Pinned() != nil {
+		t.Errorf("pinned = %v after release", m.Pinned())
+	}
+}
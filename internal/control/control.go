@@ -0,0 +1,109 @@
+// Package control keeps the bookkeeping for MwToPi commands received from the
+// controller: duplicate suppression by command_id and the acknowledgements
+// that are echoed back in the PiToMw status stream.
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/proto/pb_gen"
+)
+
+const (
+	// ackRetention is how long an acknowledgement keeps being repeated in the
+	// status stream. The status is sent at 60 Hz over UDP, so a few seconds is
+	// plenty for the controller to see it at least once.
+	ackRetention = 3 * time.Second
+	// seenRetention is how long a command_id is remembered for duplicate
+	// suppression of controller retransmissions.
+	seenRetention = 10 * time.Second
+	maxAcks       = 16
+)
+
+type ack struct {
+	id      uint32
+	status  pb_gen.Command_Ack_Status
+	message string
+	at      time.Time
+}
+
+var (
+	mu   sync.Mutex
+	acks []ack
+	seen = map[uint32]time.Time{}
+)
+
+// MarkSeen records a command_id and reports whether it is new. Retransmissions
+// of an already seen id return false and must not be executed again.
+func MarkSeen(id uint32) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	for k, t := range seen {
+		if now.Sub(t) > seenRetention {
+			delete(seen, k)
+		}
+	}
+	if _, ok := seen[id]; ok {
+		return false
+	}
+	seen[id] = now
+	return true
+}
+
+// Reset forgets all seen command ids and pending acknowledgements. Called when
+// a (possibly restarted) controller offers a new connection, since its
+// command_id counter may start over.
+func Reset() {
+	mu.Lock()
+	seen = map[uint32]time.Time{}
+	acks = nil
+	mu.Unlock()
+}
+
+// Ack records the latest status of a command. A newer status for the same id
+// replaces the previous one.
+func Ack(id uint32, status pb_gen.Command_Ack_Status, message string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := range acks {
+		if acks[i].id == id {
+			acks = append(acks[:i], acks[i+1:]...)
+			break
+		}
+	}
+	acks = append(acks, ack{id: id, status: status, message: message, at: time.Now()})
+	if len(acks) > maxAcks {
+		acks = acks[len(acks)-maxAcks:]
+	}
+}
+
+// RecentAcks returns the acknowledgements to embed in the next status packet.
+func RecentAcks() []*pb_gen.Command_Ack {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	kept := acks[:0]
+	for _, a := range acks {
+		if now.Sub(a.at) <= ackRetention {
+			kept = append(kept, a)
+		}
+	}
+	acks = kept
+
+	out := make([]*pb_gen.Command_Ack, 0, len(acks))
+	for _, a := range acks {
+		id, status := a.id, a.status
+		pbAck := &pb_gen.Command_Ack{CommandId: &id, Status: &status}
+		if a.message != "" {
+			message := a.message
+			pbAck.Message = &message
+		}
+		out = append(out, pbAck)
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+// Package dashboard embeds the web dashboard served by the HTTP API at
+// /dashboard. The page only talks to the robot's own API, and every script
+// and style sheet (including the line chart) is embedded, so it works at
+// venues without internet access.
+package dashboard
+
+import (
+	"embed"
+	"path"
+)
+
+//go:embed static
+var static embed.FS
+
+// Index is the asset served for /dashboard itself.
+const Index = "index.html"
+
+var contentTypes = map[string]string{
+	".html": "text/html",
+	".js":   "text/javascript",
+	".css":  "text/css",
+}
+
+// Asset returns an embedded file and its content type. ok is false for an
+// unknown name.
+func Asset(name string) (data []byte, contentType string, ok bool) {
+	if name == "" {
+		name = Index
+	}
+	contentType, known := contentTypes[path.Ext(name)]
+	if !known || name != path.Base(name) {
+		return nil, "", false
+	}
+	data, err := static.ReadFile("static/" + name)
+	if err != nil {
+		return nil, "", false
+	}
+	return data, contentType, true
+}
@@ -0,0 +1,54 @@
+package dashboard
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAsset(t *testing.T) {
+	for name, want := range map[string]string{
+		"":             "text/html",
+		"index.html":   "text/html",
+		"dashboard.js": "text/javascript",
+		"chart.js":     "text/javascript",
+	} {
+		data, contentType, ok := Asset(name)
+		if !ok || contentType != want || len(data) == 0 {
+			t.Errorf("Asset(%q) = %d bytes, %q, %v", name, len(data), contentType, ok)
+		}
+	}
+	for _, name := range []string{"missing.js", "../dashboard.go", "static/index.html", "dashboard.go"} {
+		if _, _, ok := Asset(name); ok {
+			t.Errorf("Asset(%q) found", name)
+		}
+	}
+}
+
+// TestOffline checks that the pages load nothing from outside the robot and
+// that every asset they reference is embedded.
+func TestOffline(t *testing.T) {
+	ref := regexp.MustCompile(`(?:src|href)="(/dashboard/[^"]+)"`)
+	err := fs.WalkDir(static, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := static.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "://") {
+			t.Errorf("%s references an external URL", path)
+		}
+		for _, m := range ref.FindAllStringSubmatch(string(data), -1) {
+			if _, _, ok := Asset(strings.TrimPrefix(m[1], "/dashboard/")); !ok {
+				t.Errorf("%s references missing asset %s", path, m[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+// Minimal canvas line chart, embedded so the pages work without a CDN.
+// Used by the dashboard and by the -dw wheel graph.
+//
+//   const chart = new LineChart(canvas, [{ label: "FL", color: "#4ade80" }, ...]);
+//   chart.update([[...FL values], [...BL values], ...]);
+class LineChart {
+  constructor(canvas, series, opts) {
+    this.canvas = canvas;
+    this.series = series;
+    this.opts = Object.assign({ grid: "#333", text: "#888", background: "#1a1a1a", lineWidth: 1.5 }, opts || {});
+    this.data = series.map(() => []);
+    window.addEventListener("resize", () => this.draw());
+  }
+
+  update(data) {
+    this.data = data;
+    this.draw();
+  }
+
+  draw() {
+    const c = this.canvas;
+    const dpr = window.devicePixelRatio || 1;
+    const w = c.clientWidth;
+    const h = c.clientHeight;
+    if (c.width !== Math.round(w * dpr) || c.height !== Math.round(h * dpr)) {
+      c.width = Math.round(w * dpr);
+      c.height = Math.round(h * dpr);
+    }
+    const ctx = c.getContext("2d");
+    ctx.setTransform(dpr, 0, 0, dpr, 0, 0);
+    ctx.fillStyle = this.opts.background;
+    ctx.fillRect(0, 0, w, h);
+
+    let min = Infinity;
+    let max = -Infinity;
+    let len = 0;
+    for (const values of this.data) {
+      len = Math.max(len, values.length);
+      for (const v of values) {
+        if (v < min) min = v;
+        if (v > max) max = v;
+      }
+    }
+    if (!isFinite(min)) {
+      min = -1;
+      max = 1;
+    }
+    if (min === max) {
+      min -= 1;
+      max += 1;
+    }
+
+    const left = 48;
+    const top = 22;
+    const right = w - 8;
+    const bottom = h - 18;
+    const x = (i) => left + (len > 1 ? (i / (len - 1)) * (right - left) : 0);
+    const y = (v) => bottom - ((v - min) / (max - min)) * (bottom - top);
+
+    // Grid and y labels.
+    ctx.font = "11px sans-serif";
+    ctx.textBaseline = "middle";
+    ctx.lineWidth = 1;
+    for (let i = 0; i <= 4; i++) {
+      const v = min + ((max - min) * i) / 4;
+      const py = y(v);
+      ctx.strokeStyle = this.opts.grid;
+      ctx.beginPath();
+      ctx.moveTo(left, py);
+      ctx.lineTo(right, py);
+      ctx.stroke();
+      ctx.fillStyle = this.opts.text;
+      ctx.textAlign = "right";
+      ctx.fillText(Math.abs(v) >= 100 ? v.toFixed(0) : v.toFixed(2), left - 4, py);
+    }
+
+    // Series.
+    ctx.lineWidth = this.opts.lineWidth;
+    this.data.forEach((values, s) => {
+      if (values.length === 0) return;
+      ctx.strokeStyle = this.series[s].color;
+      ctx.beginPath();
+      values.forEach((v, i) => (i === 0 ? ctx.moveTo(x(i), y(v)) : ctx.lineTo(x(i), y(v))));
+      ctx.stroke();
+    });
+
+    // Legend.
+    ctx.textAlign = "left";
+    let lx = left;
+    for (const s of this.series) {
+      ctx.fillStyle = s.color;
+      ctx.fillRect(lx, 6, 10, 10);
+      ctx.fillStyle = this.opts.text;
+      ctx.fillText(s.label, lx + 14, 11);
+      lx += 20 + ctx.measureText(s.label).width + 12;
+    }
+  }
+}
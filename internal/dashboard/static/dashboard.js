@@ -0,0 +1,318 @@
+// RACOON-Pi2 dashboard. Everything comes from the robot's own HTTP API:
+// /status (polled), /telemetry (wheel graph), /stream.mjpeg, /logs, /buzzer, /estop, /dryrun,
+// /calibrations and /flightrec.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// Battery thresholds of internal/state (BatteryLowThreshold /
+// BatteryCriticalThreshold) and the range of the bar, in volts.
+const VOLT_LOW = 14.0;
+const VOLT_CRITICAL = 13.5;
+const VOLT_MIN = 13.0;
+const VOLT_MAX = 16.8;
+
+const WHEEL_SAMPLES = 300;
+const WHEEL_RATE_HZ = 50;
+const WHEEL_REDRAW_MS = 100;
+const STATUS_INTERVAL_MS = 200;
+const LOG_INTERVAL_MS = 2000;
+const DUMPS_INTERVAL_MS = 5000;
+const DUMPS_SHOWN = 5;
+const STREAM_URL = "/stream.mjpeg/10/320/240";
+
+const WHEEL_SERIES = [
+  { label: "FL", color: "#4ade80" },
+  { label: "BL", color: "#60a5fa" },
+  { label: "BR", color: "#f472b6" },
+  { label: "FR", color: "#fbbf24" },
+];
+const wheelChart = new LineChart($("wheels"), WHEEL_SERIES);
+const wheelErrChart = new LineChart($("wheelErr"), WHEEL_SERIES);
+const wheels = [[], [], [], []];
+const wheelErrs = [[], [], [], []];
+
+let last = null;
+
+function message(text) {
+  $("message").textContent = text;
+}
+
+function setBadge(el, text, cls) {
+  el.textContent = text;
+  el.className = "badge " + cls;
+}
+
+function onOff(v) {
+  return v ? "on" : "off";
+}
+
+function renderStatus(s) {
+  last = s;
+  $("robotId").textContent = "#" + s.robotId;
+  const conn = s.linkLost ? ["link lost", "bad"] : s.connectionState === "connected" ? ["connected", "ok"] : [s.connectionState, "warn"];
+  setBadge($("conn"), conn[0], conn[1]);
+  $("estopBadge").classList.toggle("hidden", !s.remoteEmgStop);
+  $("dryrunBadge").classList.toggle("hidden", !s.dryRun);
+  $("estopBtn").textContent = s.remoteEmgStop ? "Release E-STOP" : "E-STOP";
+  $("dryrunBtn").classList.toggle("active", s.dryRun);
+  $("updated").textContent = new Date().toLocaleTimeString();
+
+  $("board").textContent = s.isNewRobot ? "Rock5A" : "Pi 4B";
+  const cam = s.camera || {};
+  $("camera").textContent = cam.state + " (restarts " + cam.restarts + (cam.lastError ? ", " + cam.lastError : "") + ")";
+  const b = s.ball || {};
+  $("ball").textContent = b.detected
+    ? "x=" + b.cameraX.toFixed(1) + " y=" + b.cameraY.toFixed(1) + " (" + b.cameraAgeMs + "ms)"
+    : "not detected" + (b.cameraAgeMs >= 0 ? " (" + b.cameraAgeMs + "ms)" : "");
+  $("possession").textContent = b.possession || "-";
+  $("sensors").textContent = "photo " + onOff(s.ISDETECTPHOTOSENSOR) + " / dribbler " + onOff(s.ISDETECTDRIBBLERSENSOR);
+  const t = s.thresholds || {};
+  $("thresholds").textContent = t.minThreshold + " – " + t.maxThreshold + " r=" + t.ballDetectRadius + " c=" + t.circularityThreshold;
+
+  const volt = s.VOLT;
+  $("volt").textContent = volt.toFixed(1) + " V";
+  const bar = $("voltBar");
+  bar.style.width = Math.max(0, Math.min(100, ((volt - VOLT_MIN) / (VOLT_MAX - VOLT_MIN)) * 100)) + "%";
+  bar.style.background = volt <= VOLT_CRITICAL ? "#dc2626" : volt <= VOLT_LOW ? "#fbbf24" : "#4ade80";
+  $("cap").textContent = s.capPower;
+
+  $("linkState").textContent = s.connectionState + (s.linkLost ? " (lost)" : "");
+  $("controller").textContent = s.controller || "-";
+  $("pinned").textContent = s.controllerPinned || "-";
+  $("rtt").textContent = s.rttMs > 0 ? s.rttMs.toFixed(1) + " ms" : "-";
+
+  for (const w of (s.wheelTracking || {}).wheels || []) {
+    const cond = $("cond" + w.name);
+    cond.textContent = w.condition;
+    cond.className = w.condition === "ok" ? "" : "active";
+    $("rms" + w.name).textContent = w.rmsError.toFixed(2);
+  }
+
+  const faults = $("faults");
+  faults.innerHTML = "";
+  const list = s.faults || [];
+  if (list.length === 0) {
+    faults.innerHTML = '<li class="muted">none</li>';
+  }
+  for (const f of list) {
+    const li = document.createElement("li");
+    li.className = "active";
+    li.textContent = "[" + f.code + "] " + f.message + " (since " + new Date(f.since).toLocaleTimeString() + ")";
+    faults.appendChild(li);
+  }
+}
+
+// The wheel graph is fed by the telemetry stream; the browser reconnects by
+// itself when the stream drops.
+function subscribeWheels() {
+  const es = new EventSource("/telemetry/wheelRaw:" + WHEEL_RATE_HZ + ",wheelErr:" + WHEEL_RATE_HZ);
+  const push = (series) => (e) => {
+    const v = JSON.parse(e.data).v;
+    [v.fl, v.bl, v.br, v.fr].forEach((x, i) => {
+      series[i].push(x);
+      if (series[i].length > WHEEL_SAMPLES) series[i].shift();
+    });
+  };
+  es.addEventListener("wheelRaw", push(wheels));
+  es.addEventListener("wheelErr", push(wheelErrs));
+  setInterval(() => {
+    wheelChart.update(wheels);
+    wheelErrChart.update(wheelErrs);
+  }, WHEEL_REDRAW_MS);
+}
+
+async function pollStatus() {
+  try {
+    const r = await fetch("/status");
+    renderStatus(await r.json());
+  } catch (e) {
+    setBadge($("conn"), "no response", "bad");
+  }
+  setTimeout(pollStatus, STATUS_INTERVAL_MS);
+}
+
+async function pollLogs() {
+  if ($("follow").checked) {
+    try {
+      const r = await fetch("/logs/200");
+      const pre = $("logs");
+      pre.textContent = await r.text();
+      pre.scrollTop = pre.scrollHeight;
+    } catch (e) {
+      // The status poll already shows that the robot does not answer.
+    }
+  }
+  setTimeout(pollLogs, LOG_INTERVAL_MS);
+}
+
+// The flight recorder dumps itself on faults, panics and remote e-stops; the
+// newest dumps are listed for download.
+async function pollDumps() {
+  try {
+    const st = await (await fetch("/flightrec")).json();
+    const ul = $("dumps");
+    ul.innerHTML = "";
+    if (st.dumps.length === 0) {
+      ul.innerHTML = '<li class="muted">no dumps</li>';
+    }
+    for (const d of st.dumps.slice(0, DUMPS_SHOWN)) {
+      const li = document.createElement("li");
+      const a = document.createElement("a");
+      a.href = "/flightrec/dumps/" + d.name;
+      a.download = d.name;
+      a.textContent = d.name;
+      li.appendChild(a);
+      ul.appendChild(li);
+    }
+  } catch (e) {
+    // The status poll already shows that the robot does not answer.
+  }
+  setTimeout(pollDumps, DUMPS_INTERVAL_MS);
+}
+
+async function call(url, method) {
+  const r = await fetch(url, { method: method || "GET" });
+  const text = await r.text();
+  if (!r.ok) throw new Error(r.status + " " + text.trim());
+  return text;
+}
+
+$("estopBtn").onclick = async () => {
+  const on = !(last && last.remoteEmgStop);
+  try {
+    await call("/estop/" + (on ? "1" : "0"));
+    message("e-stop " + onOff(on));
+  } catch (e) {
+    message("e-stop failed: " + e.message);
+  }
+};
+
+$("dryrunBtn").onclick = async () => {
+  const on = !(last && last.dryRun);
+  try {
+    await call("/dryrun/" + (on ? "1" : "0"));
+    message("dry-run " + onOff(on));
+  } catch (e) {
+    message("dry-run failed: " + e.message);
+  }
+};
+
+$("buzzerBtn").onclick = async () => {
+  try {
+    await call("/buzzer/tone/" + $("tone").value + "/" + $("toneMs").value);
+    message("buzzer");
+  } catch (e) {
+    message("buzzer failed: " + e.message);
+  }
+};
+
+$("dumpBtn").onclick = async () => {
+  try {
+    const d = JSON.parse(await call("/flightrec/dump"));
+    message("flight recorder dump " + d.name);
+  } catch (e) {
+    message("dump failed: " + e.message);
+  }
+};
+
+// Ball colour calibration runs as a job (/calibrations); the proposed
+// thresholds are only applied on Accept.
+let calibJob = null;
+
+function renderCalib(job) {
+  calibJob = job;
+  const done = job.state === "done";
+  $("acceptBtn").classList.toggle("hidden", !done);
+  $("discardBtn").classList.toggle("hidden", job.state !== "running" && !done);
+  $("discardBtn").textContent = done ? "Discard" : "Cancel";
+  let text = "calibration #" + job.id + ": " + job.state;
+  if (job.state === "running" && job.progress) {
+    text += " " + job.progress.stage + " " + Math.round(job.progress.fraction * 100) + "%";
+  }
+  if (job.result) {
+    text += " → " + job.result.minThreshold + " – " + job.result.maxThreshold;
+  }
+  if (job.error) text += " (" + job.error + ")";
+  $("calib").textContent = text;
+}
+
+async function pollCalib() {
+  if (!calibJob) return;
+  try {
+    const r = await fetch("/calibrations/" + calibJob.id);
+    const job = await r.json();
+    renderCalib(job);
+    if (job.state === "running") setTimeout(pollCalib, 500);
+  } catch (e) {
+    $("calib").textContent = "calibration: " + e;
+  }
+}
+
+$("calibBtn").onclick = async () => {
+  try {
+    const r = await fetch("/calibrations", { method: "POST" });
+    const body = await r.json();
+    if (r.status === 409) {
+      message("a calibration is already running");
+      if (body.id) {
+        calibJob = { id: body.id };
+        pollCalib();
+      }
+      return;
+    }
+    if (!r.ok) throw new Error(body.error || r.status);
+    renderCalib(body);
+    pollCalib();
+  } catch (e) {
+    message("calibration failed: " + e.message);
+  }
+};
+
+$("acceptBtn").onclick = async () => {
+  try {
+    await call("/calibrations/" + calibJob.id + "/accept", "POST");
+    message("calibration accepted");
+  } catch (e) {
+    message("accept failed: " + e.message);
+  }
+  pollCalib();
+};
+
+$("discardBtn").onclick = async () => {
+  try {
+    await call("/calibrations/" + calibJob.id, "DELETE");
+  } catch (e) {
+    message("discard failed: " + e.message);
+  }
+  pollCalib();
+};
+
+// The camera only encodes frames while someone watches, so the stream can be
+// stopped from here.
+let streaming = false;
+
+function setStream(on) {
+  streaming = on;
+  // The API does not take query strings; clearing src first forces a reconnect.
+  $("stream").src = "";
+  if (on) $("stream").src = STREAM_URL;
+  $("streamBtn").textContent = on ? "stop" : "start";
+  $("streamMsg").textContent = on ? "" : "stopped";
+}
+
+$("stream").onerror = () => {
+  if (!streaming) return;
+  $("streamMsg").textContent = "no stream (camera down or too many viewers), retrying…";
+  setTimeout(() => streaming && setStream(true), 3000);
+};
+$("stream").onload = () => {
+  $("streamMsg").textContent = "";
+};
+$("streamBtn").onclick = () => setStream(!streaming);
+
+setStream(true);
+subscribeWheels();
+pollStatus();
+pollLogs();
+pollDumps();
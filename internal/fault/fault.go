@@ -0,0 +1,103 @@
+// Package fault keeps the set of currently active robot faults so that the MW
+// status stream and the HTTP API can report them.
+package fault
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fault codes. CodeBattery keeps the value historically used as
+// state.RobotErrorCode for battery alarms. The motor codes are raised by
+// internal/wheeltrack.
+const (
+	CodeLink    uint32 = 1
+	CodeBattery uint32 = 2
+	CodeCamera  uint32 = 3
+	CodeMotorFL uint32 = 4
+	CodeMotorBL uint32 = 5
+	CodeMotorBR uint32 = 6
+	CodeMotorFR uint32 = 7
+)
+
+// Fault is one active fault.
+type Fault struct {
+	Code    uint32    `json:"code"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+var (
+	mu     sync.Mutex
+	active = map[uint32]Fault{}
+	hooks  []func(f Fault, raised bool)
+)
+
+// Subscribe registers fn for every fault that is raised (raised true) or
+// cleared. fn is called without the lock held and must not block.
+func Subscribe(fn func(f Fault, raised bool)) {
+	mu.Lock()
+	hooks = append(hooks, fn)
+	mu.Unlock()
+}
+
+func notify(fns []func(Fault, bool), f Fault, raised bool) {
+	for _, fn := range fns {
+		fn(f, raised)
+	}
+}
+
+// Raise marks a fault as active. Raising an already active code only updates
+// its message.
+func Raise(code uint32, message string) {
+	mu.Lock()
+	if f, ok := active[code]; ok {
+		f.Message = message
+		active[code] = f
+		mu.Unlock()
+		return
+	}
+	f := Fault{Code: code, Message: message, Since: time.Now()}
+	active[code] = f
+	fns := hooks
+	mu.Unlock()
+	log.Printf("Fault raised: [%d] %s", code, message)
+	notify(fns, f, true)
+}
+
+// Clear deactivates a fault. Clearing an inactive code is a no-op.
+func Clear(code uint32) {
+	mu.Lock()
+	f, ok := active[code]
+	if !ok {
+		mu.Unlock()
+		return
+	}
+	delete(active, code)
+	fns := hooks
+	mu.Unlock()
+	log.Printf("Fault cleared: [%d]", code)
+	notify(fns, f, false)
+}
+
+// IsActive reports whether the given fault code is active.
+func IsActive(code uint32) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := active[code]
+	return ok
+}
+
+// Active returns the active faults ordered by code.
+func Active() []Fault {
+	mu.Lock()
+	out := make([]Fault, 0, len(active))
+	for _, f := range active {
+		out = append(out, f)
+	}
+	mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
@@ -0,0 +1,392 @@
+// Package flightrec is an always-on flight recorder: a fixed-size ring of
+// everything that went between the controller, the robot and the MCU in the
+// last seconds (AI commands, link RX/TX frames, connection and e-stop events,
+// faults). The ring is written to a JSON dump on a fault, a panic, a remote
+// e-stop or on request (/flightrec), so that what happened right before a
+// crash can be analysed afterwards.
+package flightrec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+)
+
+// DumpDir holds the dumps, next to threshold.json.
+const DumpDir = "flightrec"
+
+// nameTimeFormat starts the dump file names, so that they sort by time.
+const nameTimeFormat = "20060102-150405.000"
+
+// MaxTX is the longest recorded TX frame; longer frames are truncated.
+const MaxTX = 32
+
+// Kind is the type of an entry.
+type Kind uint8
+
+const (
+	// KindRX is a frame received from the MCU (Entry.RX).
+	KindRX Kind = iota
+	// KindTX is a frame sent to the MCU (Entry.TX).
+	KindTX
+	// KindCmd is a command from the AI (Entry.Cmd).
+	KindCmd
+	// KindEvent is a state change (Entry.Source, Entry.Text).
+	KindEvent
+)
+
+var kindNames = [...]string{"rx", "tx", "cmd", "event"}
+
+func (k Kind) String() string {
+	if int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// Entry is one recorded item. Only the fields of its Kind are set; the ring
+// stores entries by value so that recording does not allocate.
+type Entry struct {
+	Time   time.Time
+	Kind   Kind
+	RX     state.RecvData
+	TX     [MaxTX]byte
+	TXLen  uint8
+	Cmd    state.SendPayload
+	Source string
+	Text   string
+}
+
+// MarshalJSON writes only the fields of the entry's kind.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Time   time.Time          `json:"t"`
+		Kind   string             `json:"kind"`
+		RX     *state.RecvData    `json:"rx,omitempty"`
+		TX     string             `json:"tx,omitempty"`
+		Cmd    *state.SendPayload `json:"cmd,omitempty"`
+		Source string             `json:"source,omitempty"`
+		Text   string             `json:"text,omitempty"`
+	}{Time: e.Time, Kind: e.Kind.String(), Source: e.Source, Text: e.Text}
+	switch e.Kind {
+	case KindRX:
+		out.RX = &e.RX
+	case KindTX:
+		out.TX = hex.EncodeToString(e.TX[:e.TXLen])
+	case KindCmd:
+		out.Cmd = &e.Cmd
+	}
+	return json.Marshal(out)
+}
+
+// Config sizes the recorder.
+type Config struct {
+	// Window is how far back a dump reaches.
+	Window time.Duration
+	// MaxEntries bounds the ring; at high link rates it may cover less than
+	// Window.
+	MaxEntries int
+	// MaxDumps bounds the dump directory; the oldest dumps are deleted.
+	MaxDumps int
+	// MinInterval is the shortest time between two automatic dumps, so that a
+	// flapping fault does not fill the disk. Requested dumps are not limited.
+	MinInterval time.Duration
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{
+	Window:      10 * time.Second,
+	MaxEntries:  8192,
+	MaxDumps:    20,
+	MinInterval: 30 * time.Second,
+}
+
+// Dump is one dump file.
+type Dump struct {
+	Reason  string    `json:"reason"`
+	Time    time.Time `json:"time"`
+	Window  string    `json:"window"`
+	Entries []Entry   `json:"entries"`
+}
+
+// DumpInfo describes a dump file in listings.
+type DumpInfo struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// Status describes the recorder for the API.
+type Status struct {
+	Entries  int        `json:"entries"`
+	Capacity int        `json:"capacity"`
+	WindowMs int64      `json:"windowMs"`
+	LastDump *time.Time `json:"lastDump"`
+	Dumps    []DumpInfo `json:"dumps"`
+}
+
+// ErrNotFound is returned by Open for an unknown dump.
+var ErrNotFound = errors.New("flight recorder dump not found")
+
+// Recorder is the ring and its dump directory. It is safe for concurrent use.
+type Recorder struct {
+	dir string
+	now func() time.Time
+
+	mu       sync.Mutex
+	cfg      Config
+	entries  []Entry
+	next     int
+	full     bool
+	lastAuto time.Time
+	lastDump time.Time
+
+	// writeMu serialises the dump files.
+	writeMu sync.Mutex
+}
+
+// New returns a recorder that writes its dumps into dir.
+func New(dir string) *Recorder {
+	r := &Recorder{dir: dir, now: time.Now}
+	r.Configure(DefaultConfig)
+	return r
+}
+
+// Default records this robot.
+var Default = New(DumpDir)
+
+// Configure replaces the configuration. Changing MaxEntries empties the ring.
+func (r *Recorder) Configure(cfg Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) != cfg.MaxEntries {
+		r.entries = make([]Entry, cfg.MaxEntries)
+		r.next = 0
+		r.full = false
+	}
+	r.cfg = cfg
+}
+
+func (r *Recorder) add(fill func(e *Entry)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return
+	}
+	e := &r.entries[r.next]
+	*e = Entry{Time: r.now()}
+	fill(e)
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// RX records a frame received from the MCU.
+func (r *Recorder) RX(rd state.RecvData) {
+	r.add(func(e *Entry) {
+		e.Kind = KindRX
+		e.RX = rd
+	})
+}
+
+// TX records a frame sent to the MCU.
+func (r *Recorder) TX(frame []byte) {
+	r.add(func(e *Entry) {
+		e.Kind = KindTX
+		e.TXLen = uint8(copy(e.TX[:], frame))
+	})
+}
+
+// Command records a command from the AI.
+func (r *Recorder) Command(p state.SendPayload) {
+	r.add(func(e *Entry) {
+		e.Kind = KindCmd
+		e.Cmd = p
+	})
+}
+
+// Event records a state change, e.g. Event("link", "lost").
+func (r *Recorder) Event(source, text string) {
+	r.add(func(e *Entry) {
+		e.Kind = KindEvent
+		e.Source = source
+		e.Text = text
+	})
+}
+
+// snapshot returns the entries of the last window, oldest first.
+func (r *Recorder) snapshot(now time.Time) []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ordered []Entry
+	if r.full {
+		ordered = append(ordered, r.entries[r.next:]...)
+	}
+	ordered = append(ordered, r.entries[:r.next]...)
+	from := now.Add(-r.cfg.Window)
+	i := sort.Search(len(ordered), func(i int) bool { return !ordered[i].Time.Before(from) })
+	return ordered[i:]
+}
+
+// Trigger writes a dump in the background for an automatic reason (fault,
+// e-stop). It is ignored within MinInterval of the previous automatic dump
+// and reports whether a dump was started.
+func (r *Recorder) Trigger(reason string) bool {
+	now := r.now()
+	r.mu.Lock()
+	if !r.lastAuto.IsZero() && now.Sub(r.lastAuto) < r.cfg.MinInterval {
+		r.mu.Unlock()
+		return false
+	}
+	r.lastAuto = now
+	r.mu.Unlock()
+
+	// The copy of the ring is taken in the background too: the caller may be
+	// the link loop. The dump then also holds the moments after the trigger.
+	go func() {
+		if _, err := r.write(r.newDump(reason, now)); err != nil {
+			log.Printf("flight recorder dump error: %v", err)
+		}
+	}()
+	return true
+}
+
+// DumpNow writes a dump and returns it once it is on disk.
+func (r *Recorder) DumpNow(reason string) (DumpInfo, error) {
+	return r.write(r.newDump(reason, r.now()))
+}
+
+// DumpOnPanic writes a dump when the calling goroutine panics and then
+// panics again with the same value. Use it as
+//
+//	defer flightrec.Default.DumpOnPanic()
+func (r *Recorder) DumpOnPanic() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	r.Event("panic", fmt.Sprintf("%v\n%s", v, debug.Stack()))
+	if _, err := r.DumpNow("panic"); err != nil {
+		log.Printf("flight recorder dump error: %v", err)
+	}
+	panic(v)
+}
+
+func (r *Recorder) newDump(reason string, now time.Time) Dump {
+	r.mu.Lock()
+	window := r.cfg.Window
+	r.mu.Unlock()
+	return Dump{Reason: reason, Time: now, Window: window.String(), Entries: r.snapshot(now)}
+}
+
+func (r *Recorder) write(d Dump) (DumpInfo, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return DumpInfo{}, err
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return DumpInfo{}, err
+	}
+	name := d.Time.Format(nameTimeFormat) + "-" + safeReason(d.Reason) + ".json"
+	if err := util.WriteFileAtomic(filepath.Join(r.dir, name), append(data, '\n')); err != nil {
+		return DumpInfo{}, err
+	}
+
+	r.mu.Lock()
+	r.lastDump = d.Time
+	maxDumps := r.cfg.MaxDumps
+	r.mu.Unlock()
+	dumps, err := r.List()
+	if err != nil {
+		return DumpInfo{}, err
+	}
+	for len(dumps) > maxDumps {
+		os.Remove(filepath.Join(r.dir, dumps[len(dumps)-1].Name))
+		dumps = dumps[:len(dumps)-1]
+	}
+	log.Printf("flight recorder: %s dump with %d entries", d.Reason, len(d.Entries))
+	return DumpInfo{Name: name, Time: d.Time, Size: int64(len(data) + 1)}, nil
+}
+
+// safeReason keeps the reason usable in a file name.
+func safeReason(reason string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' {
+			return c
+		}
+		return '_'
+	}, reason)
+}
+
+// List returns the dumps, newest first.
+func (r *Recorder) List() ([]DumpInfo, error) {
+	entries, err := os.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return []DumpInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dumps := []DumpInfo{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		dumps = append(dumps, DumpInfo{Name: e.Name(), Time: fi.ModTime(), Size: fi.Size()})
+	}
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].Name > dumps[j].Name })
+	return dumps, nil
+}
+
+// Open returns the content of the dump name (as listed by List).
+func (r *Recorder) Open(name string) ([]byte, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".json") {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(r.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Status returns the ring size and the dumps.
+func (r *Recorder) Status() (Status, error) {
+	dumps, err := r.List()
+	if err != nil {
+		return Status{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := Status{Capacity: len(r.entries), WindowMs: r.cfg.Window.Milliseconds(), Dumps: dumps}
+	st.Entries = r.next
+	if r.full {
+		st.Entries = len(r.entries)
+	}
+	if !r.lastDump.IsZero() {
+		t := r.lastDump
+		st.LastDump = &t
+	}
+	return st, nil
+}
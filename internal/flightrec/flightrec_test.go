@@ -0,0 +1,168 @@
+package flightrec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+)
+
+// clock is a settable time source for the recorder.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestRecorder(t *testing.T, cfg Config) (*Recorder, *clock) {
+	t.Helper()
+	c := &clock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	r := New(t.TempDir())
+	r.now = c.now
+	r.Configure(cfg)
+	return r, c
+}
+
+func TestRingWindow(t *testing.T) {
+	r, c := newTestRecorder(t, Config{Window: time.Second, MaxEntries: 50, MaxDumps: 5})
+
+	// 100 entries 10 ms apart: the ring keeps the last 50 (0.5 s).
+	for i := 0; i < 100; i++ {
+		r.RX(state.RecvData{Volt: uint8(i)})
+		c.t = c.t.Add(10 * time.Millisecond)
+	}
+	got := r.snapshot(c.t)
+	if len(got) != 50 || got[0].RX.Volt != 50 || got[49].RX.Volt != 99 {
+		t.Fatalf("ring: %d entries from %d", len(got), got[0].RX.Volt)
+	}
+
+	// Only the last second of a sparse history is dumped.
+	c.t = c.t.Add(5 * time.Second)
+	r.Event("link", "lost")
+	c.t = c.t.Add(500 * time.Millisecond)
+	r.TX([]byte{0xFF, 0x01, 0x02})
+	got = r.snapshot(c.t)
+	if len(got) != 2 || got[0].Kind != KindEvent || got[1].Kind != KindTX {
+		t.Fatalf("window: %+v", got)
+	}
+
+	data, err := json.Marshal(got[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tx map[string]any
+	json.Unmarshal(data, &tx)
+	if tx["kind"] != "tx" || tx["tx"] != "ff0102" || tx["rx"] != nil {
+		t.Fatalf("tx entry: %s", data)
+	}
+}
+
+func TestDumps(t *testing.T) {
+	r, c := newTestRecorder(t, Config{Window: time.Minute, MaxEntries: 16, MaxDumps: 3})
+	r.Command(state.SendPayload{})
+
+	var names []string
+	for i := 0; i < 5; i++ {
+		c.t = c.t.Add(time.Second)
+		info, err := r.DumpNow(fmt.Sprintf("api %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, info.Name)
+	}
+	if names[4] != "20260501-120005.000-api_4.json" {
+		t.Fatalf("name = %s", names[4])
+	}
+
+	// The oldest dumps are evicted; the list is newest first.
+	dumps, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dumps) != 3 || dumps[0].Name != names[4] || dumps[2].Name != names[2] {
+		t.Fatalf("dumps = %+v", dumps)
+	}
+
+	data, err := r.Open(names[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d struct {
+		Reason  string           `json:"reason"`
+		Entries []map[string]any `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Reason != "api 4" || len(d.Entries) != 1 || d.Entries[0]["kind"] != "cmd" {
+		t.Fatalf("dump = %s", data)
+	}
+
+	for _, name := range []string{names[0], "../" + names[4], "x.txt"} {
+		if _, err := r.Open(name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) = %v", name, err)
+		}
+	}
+
+	st, err := r.Status()
+	if err != nil || st.Entries != 1 || st.Capacity != 16 || len(st.Dumps) != 3 || !st.LastDump.Equal(c.t) {
+		t.Fatalf("status = %+v, %v", st, err)
+	}
+}
+
+func TestTriggerRateLimit(t *testing.T) {
+	r, c := newTestRecorder(t, Config{Window: time.Minute, MaxEntries: 16, MaxDumps: 5, MinInterval: 30 * time.Second})
+	if !r.Trigger("fault-1") {
+		t.Fatal("first trigger ignored")
+	}
+	c.t = c.t.Add(10 * time.Second)
+	if r.Trigger("fault-2") {
+		t.Fatal("trigger within MinInterval")
+	}
+	c.t = c.t.Add(30 * time.Second)
+	if !r.Trigger("estop") {
+		t.Fatal("trigger after MinInterval ignored")
+	}
+
+	// The dumps are written in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dumps, _ := r.List()
+		if len(dumps) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dumps = %+v", dumps)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDumpOnPanic(t *testing.T) {
+	r, _ := newTestRecorder(t, Config{Window: time.Minute, MaxEntries: 16, MaxDumps: 5})
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Fatalf("recovered %v", v)
+			}
+		}()
+		defer r.DumpOnPanic()
+		panic("boom")
+	}()
+
+	matches, _ := filepath.Glob(filepath.Join(r.dir, "*-panic.json"))
+	if len(matches) != 1 {
+		t.Fatalf("panic dumps = %v", matches)
+	}
+	data, _ := os.ReadFile(matches[0])
+	var d struct {
+		Reason  string           `json:"reason"`
+		Entries []map[string]any `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &d); err != nil || d.Reason != "panic" || len(d.Entries) != 1 || d.Entries[0]["source"] != "panic" {
+		t.Fatalf("dump = %s", data)
+	}
+}
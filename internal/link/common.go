@@ -7,6 +7,10 @@ import (
 	"log"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/balltrack"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/flightrec"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/possession"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
 )
 
@@ -14,6 +18,7 @@ var (
 	isSignalReceived     bool
 	prevIsSignalReceived bool
 	prevEmgStop          bool = true
+	prevRemoteEmgStop    bool
 	prevPowerShutdown    bool
 )
 
@@ -26,11 +31,12 @@ const (
 func cameraFrameHalfSizes() (halfW, halfH int) {
 	halfW = cameraFrameHalfWidth
 	halfH = cameraFrameHalfHeight
-	if state.ImageDataPtr == nil {
+	data := state.ImageDataPtr
+	if data == nil {
 		return halfW, halfH
 	}
-	if state.ImageDataPtr.FrameWidth > 0 && state.ImageDataPtr.FrameHeight > 0 {
-		return state.ImageDataPtr.FrameWidth / 2, state.ImageDataPtr.FrameHeight / 2
+	if data.FrameWidth > 0 && data.FrameHeight > 0 {
+		return data.FrameWidth / 2, data.FrameHeight / 2
 	}
 	return halfW, halfH
 }
@@ -49,6 +55,7 @@ func scaleCameraCoord(coord float32, halfSize int) int {
 func PrepareSendData() []byte {
 	sendbytes := frame.EnsureSendFrame()
 
+	updatePossession()
 	updateCameraCoordinates(sendbytes)
 	handleReceiveTimeout(sendbytes)
 
@@ -73,13 +80,24 @@ func PrepareSendData() []byte {
 		sendbytes[frame.IdxVelXHigh] = byte(uint16(1000) >> 8)
 	}
 
+	applyDriveOverride(sendbytes)
+
+	if state.RemoteEmgStop.Load() {
+		for i := frame.IdxVelXLow; i <= frame.IdxChip; i++ {
+			sendbytes[i] = 0
+		}
+		sendbytes[frame.IdxInfo] |= state.InfoEmgStop
+	}
+
 	handleEmgStopChange(sendbytes)
+	publishCmdVel(sendbytes)
 
 	return sendbytes
 }
 
 // PrepareHardwareTx returns the frame actually sent on serial/SPI.
 // In dry-run mode, motion fields (VelX/Y/Ang, dribble, kick, chip) are zeroed.
+// The velocity is then compensated for the calibrated motors.
 func PrepareHardwareTx(sendbytes []byte) []byte {
 	out := append([]byte(nil), sendbytes...)
 	if frame.IdxPowerCmd >= 0 {
@@ -95,24 +113,37 @@ func PrepareHardwareTx(sendbytes []byte) []byte {
 		}
 	}
 	handlePowerShutdownChange()
-	if !state.DryRun {
-		return out
-	}
-	for i := frame.IdxVelXLow; i <= frame.IdxChip; i++ {
-		out[i] = 0
+	gateKick(out)
+	if state.DryRun.Load() {
+		for i := frame.IdxVelXLow; i <= frame.IdxChip; i++ {
+			out[i] = 0
+		}
 	}
+	trackCommand(out)
+	compensateMotors(out)
+	flightrec.Default.TX(out)
 	return out
 }
 
 func CheckBatteryStatus() {
 	if state.Recvdata.Volt < uint8(state.BatteryCriticalThreshold) {
 		state.IsRobotError = true
-		state.RobotErrorCode = 2
+		state.RobotErrorCode = int(fault.CodeBattery)
 		state.RobotErrorMessage = "バッテリ電圧異常(回路故障の可能性)"
+		fault.Raise(fault.CodeBattery, state.RobotErrorMessage)
 	} else if state.Recvdata.Volt < uint8(state.BatteryLowThreshold) {
 		state.IsRobotError = true
-		state.RobotErrorCode = 2
+		state.RobotErrorCode = int(fault.CodeBattery)
 		state.RobotErrorMessage = "バッテリ電圧異常"
+		fault.Raise(fault.CodeBattery, state.RobotErrorMessage)
+	} else if state.Recvdata.Volt >= uint8(state.BatteryClearThreshold) && fault.IsActive(fault.CodeBattery) {
+		// 電池交換などで解除しきい値以上に戻ったら解除する。
+		if state.RobotErrorCode == int(fault.CodeBattery) {
+			state.IsRobotError = false
+			state.RobotErrorCode = 0
+			state.RobotErrorMessage = ""
+		}
+		fault.Clear(fault.CodeBattery)
 	}
 }
 
@@ -121,20 +152,58 @@ func FinishLinkCycle() {
 }
 
 func updateCameraCoordinates(sendbytes []byte) {
-	if state.ImageDataPtr == nil || !state.ImageDataPtr.IsBallExit {
+	x, y, ok := mcuBallCoords()
+	if !ok {
 		sendbytes[frame.IdxCamBallX] = 0
 		sendbytes[frame.IdxCamBallY] = 0
 		return
 	}
 
 	halfW, halfH := cameraFrameHalfSizes()
-	scaledX := scaleCameraCoord(state.ImageDataPtr.ImageX, halfW)
+	scaledX := scaleCameraCoord(x, halfW)
 	sendbytes[frame.IdxCamBallX] = byte(scaledX)
 
-	scaledY := scaleCameraCoord(state.ImageDataPtr.ImageY, halfH)
+	scaledY := scaleCameraCoord(y, halfH)
 	sendbytes[frame.IdxCamBallY] = byte(scaledY)
 }
 
+// mcuBallCoords returns the ball sent to the MCU: the tracker estimate when
+// state.CameraSmoothMCU is set, otherwise the latest fresh detection.
+func mcuBallCoords() (x, y float32, ok bool) {
+	if state.CameraSmoothMCU {
+		s := balltrack.Default.Estimate(time.Now())
+		return float32(s.X), float32(s.Y), s.Valid
+	}
+	data := state.FreshImageData()
+	if data == nil || !data.IsBallExit {
+		return 0, 0, false
+	}
+	return data.ImageX, data.ImageY, true
+}
+
+// updatePossession feeds the MCU sensors and the camera to the possession
+// tracker once per link cycle.
+func updatePossession() {
+	data := state.FreshImageData()
+	possession.Default.Update(time.Now(), possession.Inputs{
+		Photo:    state.Recvdata.SensorInformation&state.SensorPhotoMask != 0,
+		Dribbler: state.Recvdata.SensorInformation&state.SensorDribblerMask != 0,
+		Camera:   data != nil && data.IsBallExit,
+	})
+}
+
+// gateKick withholds kicks that wait for the ball until the possession
+// tracker holds it (camera.possession.gateKick). The frame kept for the next
+// cycle is untouched, so the kick goes out as soon as the ball is held.
+func gateKick(out []byte) {
+	if !possession.Default.KickAllowed(out[frame.IdxInfo]&state.InfoDirectKick != 0) {
+		out[frame.IdxKick] = 0
+	}
+	if !possession.Default.KickAllowed(out[frame.IdxInfo]&state.InfoDirectChip != 0) {
+		out[frame.IdxChip] = 0
+	}
+}
+
 func handleReceiveTimeout(sendbytes []byte) {
 	if state.LastCmdRecvTime.Since() > state.NoRecvTimeout && !state.IsControlByRobotMode {
 		for i := frame.IdxVelXLow; i <= frame.IdxChip; i++ {
@@ -148,26 +217,40 @@ func handleReceiveTimeout(sendbytes []byte) {
 	}
 }
 
+// handleReceiveStateChange beeps when the DATA stream stops, even while other
+// packets keep the connection alive. Recovery beeps and the LED are driven by
+// connection events (see WatchConnection).
 func handleReceiveStateChange() {
 	if !isSignalReceived && prevIsSignalReceived {
 		log.Println("No Data Recv")
 		RingBuzzerAsync(3, 500*time.Millisecond, 0)
 	}
-
-	if isSignalReceived && !prevIsSignalReceived {
-		RingBuzzerAsync(10, 500*time.Millisecond, 0)
-	}
 }
 
 func handleEmgStopChange(sendbytes []byte) {
 	emgActive := sendbytes[frame.IdxInfo]&state.InfoEmgStop != 0
 	if prevEmgStop && !emgActive {
 		log.Println("Emergency stop released (InfoEmgStop: 1 -> 0)")
+		flightrec.Default.Event("estop", "released")
 	}
 	if !prevEmgStop && emgActive {
 		log.Println("Emergency stop activated (InfoEmgStop: 0 -> 1)")
+		flightrec.Default.Event("estop", "activated")
 	}
 	prevEmgStop = emgActive
+
+	// InfoEmgStop is also set while no AI command arrives; only an explicit
+	// remote e-stop dumps the flight recorder.
+	remoteEmgStop := state.RemoteEmgStop.Load()
+	if remoteEmgStop != prevRemoteEmgStop {
+		if remoteEmgStop {
+			flightrec.Default.Event("estop", "remote activated")
+			flightrec.Default.Trigger("estop")
+		} else {
+			flightrec.Default.Event("estop", "remote released")
+		}
+	}
+	prevRemoteEmgStop = remoteEmgStop
 }
 
 func handlePowerShutdownChange() {
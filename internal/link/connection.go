@@ -0,0 +1,45 @@
+package link
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/connmgr"
+)
+
+var (
+	connectionLED atomic.Bool
+	ledTest       atomic.Bool
+)
+
+// WatchConnection hooks the buzzer and the connection LED to controller
+// connection events. Called once at startup.
+func WatchConnection(m *connmgr.Manager) {
+	m.Subscribe(func(ev connmgr.Event) {
+		switch ev {
+		case connmgr.EventConnected, connmgr.EventRecovered:
+			connectionLED.Store(true)
+			RingBuzzerAsync(10, 500*time.Millisecond, 0)
+		case connmgr.EventLost, connmgr.EventDisconnected, connmgr.EventReoffered:
+			// 受信が途切れたときのブザーは DATA のタイムアウトで鳴らす
+			// (handleReceiveStateChange) ので、ここでは二重に鳴らさない。
+			connectionLED.Store(false)
+		}
+	})
+}
+
+// ConnectionLED reports whether the connection LED should be lit (connected to
+// the controller and the link is healthy).
+func ConnectionLED() bool {
+	return connectionLED.Load()
+}
+
+// SetLEDTest lights every LED until it is called with false (self-test).
+func SetLEDTest(on bool) {
+	ledTest.Store(on)
+}
+
+// LEDTest reports whether the boards must light every LED.
+func LEDTest() bool {
+	return ledTest.Load()
+}
@@ -0,0 +1,39 @@
+package link
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Drive is a velocity that replaces the AI command (see OverrideDrive).
+type Drive struct {
+	// VX, VY in m/s and Omega in rad/s, as in the AI command.
+	VX, VY, Omega float64
+	// Raw skips the motor compensation, to measure the motors themselves.
+	Raw bool
+	// Dribble is the dribbler power (0-100) and Charge charges the kicker
+	// capacitor.
+	Dribble uint8
+	Charge  bool
+}
+
+var driveOverride atomic.Pointer[Drive]
+
+// OverrideDrive makes the link send d instead of the AI command until it is
+// called with nil. It is used by routines that move the robot themselves
+// (motor calibration, self-test). Kick and chip are off meanwhile; the remote
+// e-stop and dry-run still stop the motors.
+func OverrideDrive(d *Drive) {
+	prev := driveOverride.Swap(d)
+	switch {
+	case prev == nil && d != nil:
+		log.Println("Drive override started")
+	case prev != nil && d == nil:
+		log.Println("Drive override ended")
+	}
+}
+
+// DriveOverridden reports whether OverrideDrive is in effect.
+func DriveOverridden() bool {
+	return driveOverride.Load() != nil
+}
@@ -0,0 +1,61 @@
+//go:build pi4 || rock5a
+
+package link
+
+import (
+	"math"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/motorcal"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// applyDriveOverride replaces the AI command with the OverrideDrive velocity.
+// The MCU only moves with InfoSignalReceived set and InfoEmgStop clear, which
+// it does not get while no AI is connected.
+func applyDriveOverride(sendbytes []byte) {
+	d := driveOverride.Load()
+	if d == nil {
+		return
+	}
+	for i := frame.IdxVelXLow; i <= frame.IdxChip; i++ {
+		sendbytes[i] = 0
+	}
+	putCmdVel(sendbytes, d.VX, d.VY, d.Omega)
+	sendbytes[frame.IdxDribble] = d.Dribble
+	if d.Charge {
+		sendbytes[frame.IdxInfo] |= state.InfoDoCharge
+	} else {
+		sendbytes[frame.IdxInfo] &^= state.InfoDoCharge
+	}
+	sendbytes[frame.IdxInfo] &^= state.InfoEmgStop
+	sendbytes[frame.IdxInfo] |= state.InfoSignalReceived
+}
+
+// compensateMotors rewrites the velocity of out so that the calibrated motors
+// reach the commanded wheel speeds (see internal/motorcal).
+func compensateMotors(out []byte) {
+	if d := driveOverride.Load(); d != nil && d.Raw {
+		return
+	}
+	if !motorcal.Default.Compensated() {
+		return
+	}
+	vx, vy, omega := cmdVel(out)
+	cvx, cvy, comega := motorcal.Default.Compensate(wheeltrack.Default.Config().Geometry,
+		float64(vx), float64(vy), float64(omega))
+	putCmdVel(out, cvx, cvy, comega)
+}
+
+// putCmdVel writes a velocity in m/s and rad/s as the mm/s and mrad/s of the
+// frame, saturated to int16.
+func putCmdVel(b []byte, vx, vy, omega float64) {
+	put := func(low, high int, v float64) {
+		n := int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v*1000))))
+		b[low] = byte(uint16(n))
+		b[high] = byte(uint16(n) >> 8)
+	}
+	put(frame.IdxVelXLow, frame.IdxVelXHigh, vx)
+	put(frame.IdxVelYLow, frame.IdxVelYHigh, vy)
+	put(frame.IdxVelAngLow, frame.IdxVelAngHigh, omega)
+}
@@ -0,0 +1,78 @@
+//go:build pi4 || rock5a
+
+package link
+
+import (
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/flightrec"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/telemetry"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// ObserveRX records the MCU reading just parsed into state.Recvdata in the
+// flight recorder, feeds the wheel tracking and publishes it as telemetry. The
+// boards call it once per valid received frame.
+func ObserveRX() {
+	state.LinkRxFrames.Add(1)
+	flightrec.Default.RX(state.Recvdata)
+
+	now := time.Now()
+	rd := state.Recvdata
+	wheelErr := wheeltrack.Default.Observe(now,
+		[wheeltrack.NumWheels]float64{
+			float64(state.FlWheelSpeedRadS), float64(state.BlWheelSpeedRadS),
+			float64(state.BrWheelSpeedRadS), float64(state.FrWheelSpeedRadS),
+		},
+		[wheeltrack.NumWheels]int16{rd.FlWheelSpeed, rd.BlWheelSpeed, rd.BrWheelSpeed, rd.FrWheelSpeed})
+
+	hub := telemetry.Default
+	if !hub.Active() {
+		return
+	}
+	hub.Publish(telemetry.WheelRaw, now, telemetry.WheelRawValue{
+		FL: rd.FlWheelSpeed, BL: rd.BlWheelSpeed, BR: rd.BrWheelSpeed, FR: rd.FrWheelSpeed,
+	})
+	hub.Publish(telemetry.WheelMS, now, telemetry.WheelMSValue{
+		FL: state.FlWheelSpeedRadS, BL: state.BlWheelSpeedRadS, BR: state.BrWheelSpeedRadS, FR: state.FrWheelSpeedRadS,
+	})
+	hub.Publish(telemetry.WheelErr, now, telemetry.WheelMSValue{
+		FL: float32(wheelErr[wheeltrack.FL]), BL: float32(wheelErr[wheeltrack.BL]),
+		BR: float32(wheelErr[wheeltrack.BR]), FR: float32(wheelErr[wheeltrack.FR]),
+	})
+	hub.Publish(telemetry.Battery, now, telemetry.BatteryValue{Volt: float32(rd.Volt) / 10})
+	hub.Publish(telemetry.Cap, now, telemetry.CapValue{Power: rd.CapPower})
+	hub.Publish(telemetry.Sensors, now, telemetry.SensorsValue{
+		Photo:    rd.SensorInformation&state.SensorPhotoMask != 0,
+		Dribbler: rd.SensorInformation&state.SensorDribblerMask != 0,
+	})
+}
+
+// cmdVel decodes the velocity of a frame for the MCU, which carries mm/s and
+// mrad/s, into m/s and rad/s.
+func cmdVel(b []byte) (vx, vy, omega float32) {
+	le16 := func(low, high int) float32 {
+		return float32(int16(uint16(b[low]) | uint16(b[high])<<8))
+	}
+	return le16(frame.IdxVelXLow, frame.IdxVelXHigh) / 1000,
+		le16(frame.IdxVelYLow, frame.IdxVelYHigh) / 1000,
+		le16(frame.IdxVelAngLow, frame.IdxVelAngHigh) / 1000
+}
+
+// publishCmdVel publishes the velocity of the frame for the MCU (after the
+// emergency stop, before dry-run zeroing).
+func publishCmdVel(sendbytes []byte) {
+	if !telemetry.Default.Active() {
+		return
+	}
+	vx, vy, omega := cmdVel(sendbytes)
+	telemetry.Default.Publish(telemetry.CmdVel, time.Now(), telemetry.CmdVelValue{VX: vx, VY: vy, Omega: omega})
+}
+
+// trackCommand gives the velocity the MCU actually receives (after dry-run
+// zeroing) to the wheel tracking.
+func trackCommand(out []byte) {
+	vx, vy, omega := cmdVel(out)
+	wheeltrack.Default.Command(float64(vx), float64(vy), float64(omega))
+}
@@ -0,0 +1,93 @@
+// Package logring keeps the most recent log lines in memory so they can be
+// read over the API without shell access to the robot. The Go log output and
+// the camera process stdout/stderr are written into Default.
+package logring
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Line is one captured log line.
+type Line struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Text   string    `json:"text"`
+}
+
+// Ring is a fixed-capacity buffer of lines. The oldest line is dropped when
+// full.
+type Ring struct {
+	mu    sync.Mutex
+	lines []Line
+	next  int
+	full  bool
+}
+
+// New returns a ring holding up to capacity lines.
+func New(capacity int) *Ring {
+	return &Ring{lines: make([]Line, capacity)}
+}
+
+// Default is the process-wide ring.
+var Default = New(2000)
+
+// Add appends a line.
+func (r *Ring) Add(source, text string) {
+	r.mu.Lock()
+	r.lines[r.next] = Line{Time: time.Now(), Source: source, Text: text}
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// Tail returns up to n most recent lines, oldest first. n <= 0 returns all.
+func (r *Ring) Tail(n int) []Line {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []Line
+	if r.full {
+		out = append(out, r.lines[r.next:]...)
+	}
+	out = append(out, r.lines[:r.next]...)
+	if n > 0 && len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out
+}
+
+// Writer returns an io.Writer that adds every written line under source.
+// Partial lines are buffered until their newline.
+func (r *Ring) Writer(source string) *Writer {
+	return &Writer{ring: r, source: source}
+}
+
+// Writer splits writes into lines for a Ring.
+type Writer struct {
+	ring   *Ring
+	source string
+	mu     sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf.Next(i+1)), "\r\n")
+		w.ring.Add(w.source, line)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,275 @@
+// Package motorcal calibrates the individual differences of the drive motors
+// and compensates them in the command path.
+//
+// Each wheel is modelled as
+//
+//	measured = Gain * (command - sign(command) * Deadband) + Offset   if |command| > Deadband
+//	measured = 0                                                        otherwise
+//
+// with speeds in m/s at the wheel surface. The calibration routine (Runner)
+// spins the robot in place, which commands every wheel at the same known
+// speed, sweeps that speed in both directions and fits the model per wheel.
+// With compensation on, the link turns the commanded body velocity into wheel
+// speeds, inverts each wheel's model and sends the body velocity closest to
+// the result (least squares, see wheeltrack.Geometry.Body).
+//
+// The calibration is kept per robot in File together with the MAC address it
+// was measured on; a file copied from another robot is not applied.
+package motorcal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// File holds the calibration, next to threshold.json.
+const File = "motor_calibration.json"
+
+// movingSpeed (m/s) separates turning wheels from stopped ones in the fit.
+const movingSpeed = 0.02
+
+// Wheel is the model of one wheel, in the wheel's forward direction
+// (positive turns the robot counter-clockwise).
+type Wheel struct {
+	Gain   float64 `json:"gain"`
+	Offset float64 `json:"offset"`
+	// Deadband is the largest command (m/s) that does not turn the wheel.
+	Deadband float64 `json:"deadband"`
+	// RMS is the residual of the fit (m/s), 0 when not fitted.
+	RMS float64 `json:"rms"`
+}
+
+// Identity is an ideal wheel.
+var Identity = Wheel{Gain: 1}
+
+// Predict returns the speed the wheel reaches for cmd.
+func (w Wheel) Predict(cmd float64) float64 {
+	if math.Abs(cmd) <= w.Deadband {
+		return 0
+	}
+	return w.Gain*(cmd-math.Copysign(w.Deadband, cmd)) + w.Offset
+}
+
+// Command returns the command that makes the wheel reach target. A zero
+// target stays zero so that a stopped robot is not nudged by the offset.
+func (w Wheel) Command(target float64) float64 {
+	if target == 0 {
+		return 0
+	}
+	u := (target - w.Offset) / w.Gain
+	return u + math.Copysign(w.Deadband, u)
+}
+
+// Calibration is the content of File.
+type Calibration struct {
+	// MAC is the robot the wheels were measured on (state.MACAddress).
+	MAC string `json:"mac"`
+	// WheelDiameterMm replaces the board's nominal wheel diameter when the
+	// MCU wheel speeds are converted to m/s; 0 keeps the nominal one.
+	WheelDiameterMm float64                     `json:"wheelDiameterMm"`
+	Wheels          [wheeltrack.NumWheels]Wheel `json:"wheels"`
+	// Compensate applies the wheel models in the command path.
+	Compensate   bool       `json:"compensate"`
+	CalibratedAt *time.Time `json:"calibratedAt"`
+}
+
+// Uncalibrated has ideal wheels and no compensation.
+var Uncalibrated = Calibration{
+	Wheels: [wheeltrack.NumWheels]Wheel{Identity, Identity, Identity, Identity},
+}
+
+// Validate checks that the models can be inverted.
+func (c Calibration) Validate() error {
+	if c.WheelDiameterMm < 0 || math.IsNaN(c.WheelDiameterMm) {
+		return errors.New("wheelDiameterMm must not be negative")
+	}
+	for i, w := range c.Wheels {
+		if !(w.Gain > 0) || math.IsInf(w.Gain, 0) || !(w.Deadband >= 0) || math.IsNaN(w.Offset) {
+			return fmt.Errorf("%s: gain must be positive and deadband not negative", wheeltrack.WheelNames[i])
+		}
+	}
+	return nil
+}
+
+// Point is one measurement of a wheel.
+type Point struct {
+	Command  float64 `json:"command"`
+	Measured float64 `json:"measured"`
+}
+
+// Fit fits the model of a wheel to points measured in both directions.
+//
+// The turning points of each direction lie on lines of the same slope
+// (Gain); their intercepts are Offset -/+ Gain*Deadband.
+func Fit(points []Point) (Wheel, error) {
+	var sides [2][]Point // forward, backward
+	for _, p := range points {
+		if math.Abs(p.Measured) < movingSpeed || p.Command == 0 {
+			continue
+		}
+		if p.Command > 0 {
+			sides[0] = append(sides[0], p)
+		} else {
+			sides[1] = append(sides[1], p)
+		}
+	}
+
+	var sxy, sxx float64
+	var mean [2]Point
+	for k, side := range sides {
+		if len(side) < 2 {
+			return Wheel{}, errors.New("the wheel did not turn at two speeds in each direction")
+		}
+		for _, p := range side {
+			mean[k].Command += p.Command / float64(len(side))
+			mean[k].Measured += p.Measured / float64(len(side))
+		}
+		for _, p := range side {
+			dx := p.Command - mean[k].Command
+			sxy += dx * (p.Measured - mean[k].Measured)
+			sxx += dx * dx
+		}
+	}
+	if sxx == 0 {
+		return Wheel{}, errors.New("all speeds of a direction are equal")
+	}
+	gain := sxy / sxx
+	if gain <= 0 {
+		return Wheel{}, fmt.Errorf("the wheel turns against the command (gain %.2f)", gain)
+	}
+
+	forward := mean[0].Measured - gain*mean[0].Command
+	backward := mean[1].Measured - gain*mean[1].Command
+	w := Wheel{
+		Gain:     gain,
+		Offset:   (forward + backward) / 2,
+		Deadband: max(0, (backward-forward)/(2*gain)),
+	}
+	var sq float64
+	for _, p := range points {
+		e := w.Predict(p.Command) - p.Measured
+		sq += e * e
+	}
+	w.RMS = math.Sqrt(sq / float64(len(points)))
+	return w, nil
+}
+
+// Store holds the calibration of this robot. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu  sync.Mutex
+	cal Calibration
+}
+
+// NewStore returns an uncalibrated store saved to path.
+func NewStore(path string) *Store {
+	return &Store{path: path, cal: Uncalibrated}
+}
+
+// Default is the calibration of this robot.
+var Default = NewStore(File)
+
+// Load reads the file. A missing file keeps the robot uncalibrated.
+func (s *Store) Load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c := Uncalibrated
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.mu.Lock()
+	s.cal = c
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the calibration.
+func (s *Store) Get() Calibration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cal
+}
+
+// Set replaces the calibration and saves it.
+func (s *Store) Set(c Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := util.WriteFileAtomic(s.path, append(data, '\n')); err != nil {
+		return err
+	}
+	s.cal = c
+	log.Printf("Motor calibration saved (compensate %v, wheel diameter %.1f mm)", c.Compensate, c.WheelDiameterMm)
+	return nil
+}
+
+// Mismatch returns a reason when the calibration belongs to another robot,
+// "" otherwise. An unknown MAC address on either side is not a mismatch.
+func (s *Store) Mismatch() string {
+	s.mu.Lock()
+	mac := s.cal.MAC
+	s.mu.Unlock()
+	if mac != "" && state.MACAddress != "" && mac != state.MACAddress {
+		return fmt.Sprintf("%s was measured on %s, this robot is %s", filepath.Base(s.path), mac, state.MACAddress)
+	}
+	return ""
+}
+
+// Compensated reports whether Compensate changes the commands.
+func (s *Store) Compensated() bool {
+	return s.Get().Compensate && s.Mismatch() == ""
+}
+
+// Compensate returns the body velocity to send so that the wheels reach the
+// speeds of vx, vy (m/s) and omega (rad/s). It returns the velocity unchanged
+// when compensation is off or the calibration belongs to another robot.
+func (s *Store) Compensate(g wheeltrack.Geometry, vx, vy, omega float64) (float64, float64, float64) {
+	if !s.Compensated() || (vx == 0 && vy == 0 && omega == 0) {
+		return vx, vy, omega
+	}
+	wheels := s.Get().Wheels
+	targets := g.Expected(vx, vy, omega)
+	var cmds [wheeltrack.NumWheels]float64
+	for i, w := range wheels {
+		// The models are measured in the wheel's forward direction.
+		sign := g.Sign(i)
+		cmds[i] = sign * w.Command(sign*targets[i])
+	}
+	return g.Body(cmds)
+}
+
+// WheelDiameterMm returns the calibrated wheel diameter, or nominal when
+// there is none (or it belongs to another robot).
+func (s *Store) WheelDiameterMm(nominal float64) float64 {
+	d := s.Get().WheelDiameterMm
+	if d <= 0 || s.Mismatch() != "" {
+		return nominal
+	}
+	return d
+}
@@ -0,0 +1,206 @@
+package motorcal
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+func near(a, b, tol float64) bool { return math.Abs(a-b) <= tol }
+
+func TestFit(t *testing.T) {
+	truth := Wheel{Gain: 0.9, Offset: 0.01, Deadband: 0.04}
+	var points []Point
+	for _, s := range DefaultRoutine.Speeds {
+		for _, c := range []float64{s, -s} {
+			points = append(points, Point{Command: c, Measured: truth.Predict(c)})
+		}
+	}
+	w, err := Fit(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(w.Gain, truth.Gain, 1e-9) || !near(w.Offset, truth.Offset, 1e-9) || !near(w.Deadband, truth.Deadband, 1e-9) || w.RMS > 1e-9 {
+		t.Fatalf("Fit = %+v, want %+v", w, truth)
+	}
+
+	// Command inverts Predict outside the deadband.
+	for _, target := range []float64{0.3, -0.3, 0.05, -1} {
+		if got := w.Predict(w.Command(target)); !near(got, target, 1e-9) {
+			t.Errorf("Predict(Command(%v)) = %v", target, got)
+		}
+	}
+	if w.Command(0) != 0 {
+		t.Error("Command(0) != 0")
+	}
+
+	reversed := make([]Point, len(points))
+	for i, p := range points {
+		reversed[i] = Point{Command: p.Command, Measured: -p.Measured}
+	}
+	if _, err := Fit(reversed); err == nil {
+		t.Error("reversed wheel fitted")
+	}
+	if _, err := Fit(points[:3]); err == nil {
+		t.Error("fitted with one backward point")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+	s := NewStore(path)
+	if err := s.Load(); err != nil || s.Get().Wheels[0] != Identity {
+		t.Fatalf("missing file: %+v, %v", s.Get(), err)
+	}
+	g := wheeltrack.DefaultConfig.Geometry
+	if vx, vy, w := s.Compensate(g, 1, 0.5, 2); vx != 1 || vy != 0.5 || w != 2 {
+		t.Fatal("uncalibrated store compensates")
+	}
+
+	c := Uncalibrated
+	c.MAC = "aa:bb:cc:dd:ee:ff"
+	c.Compensate = true
+	c.WheelDiameterMm = 55
+	c.Wheels[wheeltrack.FL] = Wheel{Gain: 0.8}
+	if err := s.Set(c); err != nil {
+		t.Fatal(err)
+	}
+	bad := c
+	bad.Wheels[wheeltrack.BR].Gain = 0
+	if err := s.Set(bad); err == nil {
+		t.Fatal("zero gain saved")
+	}
+
+	loaded := NewStore(path)
+	if err := loaded.Load(); err != nil || loaded.Get().Wheels[wheeltrack.FL].Gain != 0.8 {
+		t.Fatalf("reload: %+v, %v", loaded.Get(), err)
+	}
+
+	// The wheels driven by the compensated command come closer to the target
+	// than with the raw one (the slow FL wheel cannot be fixed alone: the
+	// frame only carries the body velocity).
+	wheels := loaded.Get().Wheels
+	miss := func(vx, vy, omega float64) float64 {
+		var sq float64
+		want := g.Expected(0.5, 0, 0)
+		for i, c := range g.Expected(vx, vy, omega) {
+			e := wheels[i].Predict(c) - want[i]
+			sq += e * e
+		}
+		return sq
+	}
+	if raw, comp := miss(0.5, 0, 0), miss(loaded.Compensate(g, 0.5, 0, 0)); comp >= raw {
+		t.Fatalf("compensated error %v, raw %v", comp, raw)
+	}
+	if vx, vy, omega := loaded.Compensate(g, 0, 0, 0); vx != 0 || vy != 0 || omega != 0 {
+		t.Fatal("stop compensated")
+	}
+	if loaded.WheelDiameterMm(54) != 55 {
+		t.Fatal("wheel diameter not applied")
+	}
+
+	// A file of another robot is ignored.
+	defer func(mac string) { state.MACAddress = mac }(state.MACAddress)
+	state.MACAddress = "11:22:33:44:55:66"
+	if loaded.Mismatch() == "" || loaded.Compensated() || loaded.WheelDiameterMm(54) != 54 {
+		t.Fatal("calibration of another robot applied")
+	}
+}
+
+// fakeRig turns every wheel at truth.Predict of the commanded speed.
+type fakeRig struct {
+	truth [wheeltrack.NumWheels]Wheel
+	speed chan float64
+	cur   float64
+}
+
+func (f *fakeRig) rig() Rig {
+	return Rig{
+		Ready:   func() error { return nil },
+		Spin:    func(speed float64) { f.speed <- speed },
+		Stop:    func() { f.speed <- 0 },
+		Measure: func() [wheeltrack.NumWheels]float64 { return f.measure() },
+	}
+}
+
+func (f *fakeRig) measure() [wheeltrack.NumWheels]float64 {
+	select {
+	case f.cur = <-f.speed:
+	default:
+	}
+	var v [wheeltrack.NumWheels]float64
+	for i, w := range f.truth {
+		v[i] = w.Predict(f.cur)
+	}
+	return v
+}
+
+func waitJob(t *testing.T, r *Runner, st string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := r.Job()
+		if job.State == st {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job = %+v, want %s", job, st)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), File))
+	r := NewRunner(store)
+	if _, err := r.Start(); !errors.Is(err, ErrNoRig) {
+		t.Fatalf("start without rig: %v", err)
+	}
+
+	f := &fakeRig{speed: make(chan float64, 64)}
+	f.truth = [wheeltrack.NumWheels]Wheel{{Gain: 0.9}, {Gain: 1.1, Deadband: 0.03}, {Gain: 1, Offset: 0.02}, Identity}
+	r.Configure(f.rig(), RoutineConfig{Speeds: []float64{0.1, 0.2, 0.4}, Settle: time.Millisecond, Sample: 30 * time.Millisecond})
+	job, err := r.Start()
+	if err != nil || job.Steps != 6 {
+		t.Fatalf("start: %+v, %v", job, err)
+	}
+	if _, err := r.Start(); !errors.Is(err, ErrBusy) {
+		t.Fatalf("second start: %v", err)
+	}
+
+	job = waitJob(t, r, StateDone)
+	for i, w := range job.Result.Wheels {
+		if !near(w.Gain, f.truth[i].Gain, 1e-6) || !near(w.Deadband, f.truth[i].Deadband, 1e-6) || !near(w.Offset, f.truth[i].Offset, 1e-6) {
+			t.Errorf("%s = %+v, want %+v", wheeltrack.WheelNames[i], w, f.truth[i])
+		}
+	}
+	if store.Get().Compensate {
+		t.Fatal("applied before Accept")
+	}
+	if _, err := r.Accept(); err != nil || !store.Get().Compensate || store.Get().Wheels[0].Gain == 1 {
+		t.Fatalf("accept: %+v, %v", store.Get(), err)
+	}
+	if _, err := r.Accept(); !errors.Is(err, ErrState) {
+		t.Fatalf("second accept: %v", err)
+	}
+
+	// Cancelling stops the robot.
+	r.Configure(f.rig(), RoutineConfig{Speeds: []float64{0.1, 0.2}, Settle: time.Hour, Sample: time.Millisecond})
+	if _, err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, r, StateCancelled)
+
+	r.Configure(Rig{Ready: func() error { return errors.New("remote e-stop is active") }, Spin: func(float64) {}}, DefaultRoutine)
+	if _, err := r.Start(); err == nil {
+		t.Fatal("started while not ready")
+	}
+}
@@ -0,0 +1,244 @@
+package motorcal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/routine"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// States of a job.
+const (
+	StateRunning   = "running"
+	StateDone      = "done" // fitted calibration waiting for Accept
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+	StateAccepted  = "accepted"
+)
+
+var (
+	ErrBusy     = errors.New("a motor calibration is already running")
+	ErrNotFound = errors.New("no motor calibration job")
+	// ErrState is returned when the job is not in the state the operation
+	// needs (e.g. Accept before it is done).
+	ErrState = errors.New("motor calibration job is not in a suitable state")
+	// ErrNoRig is returned by Start before the runner is wired to the link.
+	ErrNoRig = errors.New("motor calibration is not available on this build")
+)
+
+// Rig connects the routine to the robot.
+type Rig struct {
+	// Ready returns why the robot must not move now, nil when it may.
+	Ready func() error
+	// Spin turns the robot in place so that every wheel is commanded at
+	// speed (m/s, uncompensated).
+	Spin func(speed float64)
+	// Stop ends Spin and returns the robot to the AI.
+	Stop func()
+	// Measure returns the current wheel speeds (m/s) in each wheel's forward
+	// direction (see wheeltrack.Geometry.Inverted), so that Spin reads back
+	// positive on every healthy wheel.
+	Measure func() [wheeltrack.NumWheels]float64
+}
+
+// RoutineConfig tunes the calibration routine.
+type RoutineConfig struct {
+	// Speeds are the commanded wheel speeds (m/s); each is run forward, then
+	// backward. Include speeds near the deadband.
+	Speeds []float64
+	// Settle is the time for the wheels to reach a new speed.
+	Settle time.Duration
+	// Sample is how long the speed is averaged.
+	Sample time.Duration
+}
+
+// DefaultRoutine is used until Configure is called.
+var DefaultRoutine = RoutineConfig{
+	Speeds: []float64{0.05, 0.1, 0.15, 0.2, 0.3, 0.4, 0.5},
+	Settle: 400 * time.Millisecond,
+	Sample: 400 * time.Millisecond,
+}
+
+// Job is a snapshot of the calibration job.
+type Job struct {
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	Step       int        `json:"step"`
+	Steps      int        `json:"steps"`
+	// Points are the measurements per wheel (FL, BL, BR, FR).
+	Points [wheeltrack.NumWheels][]Point `json:"points"`
+	// Result is the fitted calibration once the job is done.
+	Result *Calibration `json:"result"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// Runner runs one calibration job at a time and keeps the last one.
+type Runner struct {
+	store *Store
+	now   func() time.Time
+
+	mu  sync.Mutex
+	rig Rig
+	cfg RoutineConfig
+	job *Job
+	run *routine.Run
+}
+
+// NewRunner returns a runner that accepts into store.
+func NewRunner(store *Store) *Runner {
+	return &Runner{store: store, now: time.Now, cfg: DefaultRoutine}
+}
+
+// DefaultRunner calibrates Default. The app wires it to the link.
+var DefaultRunner = NewRunner(Default)
+
+// Configure sets the rig and the routine.
+func (r *Runner) Configure(rig Rig, cfg RoutineConfig) {
+	r.mu.Lock()
+	r.rig = rig
+	r.cfg = cfg
+	r.mu.Unlock()
+}
+
+// Start starts a job. It fails with ErrBusy while one runs, and with the
+// Ready error when the robot must not move.
+func (r *Runner) Start() (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job != nil && r.job.State == StateRunning {
+		return *r.job, ErrBusy
+	}
+	if r.rig.Spin == nil {
+		return Job{}, ErrNoRig
+	}
+	if err := r.rig.Ready(); err != nil {
+		return Job{}, err
+	}
+
+	r.job = &Job{State: StateRunning, StartedAt: r.now(), Steps: 2 * len(r.cfg.Speeds)}
+	rig, cfg := r.rig, r.cfg
+	r.run = routine.Start(func(ctx context.Context) { r.calibrate(ctx, rig, cfg) })
+	return *r.job, nil
+}
+
+func (r *Runner) calibrate(ctx context.Context, rig Rig, cfg RoutineConfig) {
+	var points [wheeltrack.NumWheels][]Point
+	err := func() error {
+		step := 0
+		for _, s := range cfg.Speeds {
+			for _, speed := range []float64{s, -s} {
+				step++
+				r.update(func(j *Job) { j.Step = step })
+				rig.Spin(speed)
+				if err := routine.Sleep(ctx, cfg.Settle); err != nil {
+					return err
+				}
+				avg, err := routine.Average(ctx, rig.Measure, cfg.Sample)
+				if err != nil {
+					return err
+				}
+				for i := range points {
+					points[i] = append(points[i], Point{Command: speed, Measured: avg[i]})
+				}
+				r.update(func(j *Job) { j.Points = points })
+			}
+		}
+		return nil
+	}()
+	rig.Stop()
+
+	if errors.Is(err, context.Canceled) {
+		r.finish(StateCancelled, nil, "")
+		return
+	}
+	if err != nil {
+		r.finish(StateFailed, nil, err.Error())
+		return
+	}
+
+	result := r.store.Get()
+	result.MAC = state.MACAddress
+	result.Compensate = true
+	var problems []string
+	for i := range points {
+		w, err := Fit(points[i])
+		if err != nil {
+			problems = append(problems, wheeltrack.WheelNames[i]+": "+err.Error())
+			continue
+		}
+		result.Wheels[i] = w
+	}
+	if len(problems) > 0 {
+		r.finish(StateFailed, nil, strings.Join(problems, "; "))
+		return
+	}
+	t := r.now()
+	result.CalibratedAt = &t
+	r.finish(StateDone, &result, "")
+}
+
+func (r *Runner) update(fn func(j *Job)) {
+	r.mu.Lock()
+	fn(r.job)
+	r.mu.Unlock()
+}
+
+func (r *Runner) finish(st string, result *Calibration, msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.now()
+	r.job.State = st
+	r.job.FinishedAt = &t
+	r.job.Result = result
+	r.job.Error = msg
+	log.Printf("Motor calibration %s %s", st, msg)
+}
+
+// Job returns the current or last job.
+func (r *Runner) Job() (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job == nil {
+		return Job{}, false
+	}
+	return *r.job, true
+}
+
+// Cancel stops a running job; the robot stops at once.
+func (r *Runner) Cancel() (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job == nil {
+		return Job{}, ErrNotFound
+	}
+	if r.job.State != StateRunning {
+		return *r.job, ErrState
+	}
+	r.run.Cancel()
+	return *r.job, nil
+}
+
+// Accept saves the fitted calibration of a done job.
+func (r *Runner) Accept() (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job == nil {
+		return Job{}, ErrNotFound
+	}
+	if r.job.State != StateDone {
+		return *r.job, ErrState
+	}
+	if err := r.store.Set(*r.job.Result); err != nil {
+		return *r.job, fmt.Errorf("save motor calibration: %w", err)
+	}
+	r.job.State = StateAccepted
+	return *r.job, nil
+}
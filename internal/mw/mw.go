@@ -1,15 +1,25 @@
 package mw
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
+	"math"
 	"net"
-	"os"
 	"sync"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/balltrack"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camgeom"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camsup"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/config"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/connmgr"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/control"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/netif"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/possession"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/sysinfo"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/thresholds"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
 	"github.com/Rione/ssl-RACOON-Pi2/proto/pb_gen"
 	"google.golang.org/protobuf/proto"
@@ -46,13 +56,7 @@ func ReloadAdjustment() state.Adjustment {
 	return adj
 }
 
-const (
-	thresholdFile    = "threshold.json"
-	sendInterval     = time.Second / 60
-	discoverInterval = 1500 * time.Millisecond // DISCOVER再送間隔。PCは最終通信から1.5s以内のDISCOVERを重複として破棄する
-	okInterval       = 100 * time.Millisecond
-	robotTimeout     = 3 * time.Second // PCから3s音沙汰がなければタイムアウト
-)
+const sendInterval = time.Second / 60
 
 func createStatus(robotID uint32, detectPhotoSensor, detectDribbler, isNewDribbler bool,
 	batteryVoltage, capPower uint32, isBallExit bool, imageX, imageY float32,
@@ -90,65 +94,225 @@ func createStatus(robotID uint32, detectPhotoSensor, detectDribbler, isNewDribbl
 		mac := state.MACAddress
 		piToMw.MacAddress = &mac
 	}
+	if age, ok := state.CameraAge(); ok {
+		ageMs := uint32(min(age.Milliseconds(), math.MaxUint32))
+		piToMw.BallStatus.CameraAgeMs = &ageMs
+	}
+	if isBallExit {
+		if gx, gy, ok := camgeom.Default.Project(float64(imageX), float64(imageY)); ok {
+			groundX, groundY := float32(gx), float32(gy)
+			piToMw.BallStatus.BallGroundX = &groundX
+			piToMw.BallStatus.BallGroundY = &groundY
+		}
+	}
+	piToMw.BallStatus.Track = createBallTrack()
+	if pos := possession.Default.Status(); !pos.Since.IsZero() {
+		possessionState := pb_gen.Ball_Possession(pos.State)
+		possessionMs := uint32(min(time.Since(pos.Since).Milliseconds(), math.MaxUint32))
+		piToMw.BallStatus.Possession = &possessionState
+		piToMw.BallStatus.PossessionMs = &possessionMs
+	}
+	piToMw.Detections = createDetections()
+	piToMw.Diagnostics = createDiagnostics()
+	piToMw.CommandAcks = control.RecentAcks()
 	return piToMw
 }
 
+// createBallTrack reports the ball tracker estimate, nil without a track.
+func createBallTrack() *pb_gen.Ball_Track {
+	s := balltrack.Default.Estimate(time.Now())
+	if !s.Valid {
+		return nil
+	}
+	coasting := s.Coasting
+	x, y, vx, vy := float32(s.X), float32(s.Y), float32(s.VX), float32(s.VY)
+	track := &pb_gen.Ball_Track{
+		Coasting: &coasting,
+		X:        &x,
+		Y:        &y,
+		Vx:       &vx,
+		Vy:       &vy,
+	}
+	if s.Ground {
+		gx, gy := float32(s.GroundX), float32(s.GroundY)
+		gvx, gvy := float32(s.GroundVX), float32(s.GroundVY)
+		track.GroundX = &gx
+		track.GroundY = &gy
+		track.GroundVx = &gvx
+		track.GroundVy = &gvy
+	}
+	return track
+}
+
+// forwardDetections is the maximum number of camera detections per status.
+var forwardDetections = 8
+
+// SetForwardDetections sets how many camera detections are sent to the MW.
+func SetForwardDetections(n int) {
+	forwardDetections = n
+}
+
+// createDetections lists the fresh camera detections, tracked ball first.
+func createDetections() []*pb_gen.Camera_Detection {
+	data := state.FreshImageData()
+	if data == nil || len(data.Detections) == 0 || forwardDetections <= 0 {
+		return nil
+	}
+
+	out := make([]*pb_gen.Camera_Detection, 0, min(len(data.Detections), forwardDetections))
+	add := func(d camproto.Detection, selected bool) {
+		class := pb_gen.Detection_Class(d.Class)
+		x, y, w, h, conf := d.X, d.Y, d.Width, d.Height, d.Confidence
+		det := &pb_gen.Camera_Detection{
+			Class:      &class,
+			CenterX:    &x,
+			CenterY:    &y,
+			Width:      &w,
+			Height:     &h,
+			Confidence: &conf,
+		}
+		if selected {
+			det.Selected = &selected
+		}
+		if gx, gy, ok := camgeom.Default.ProjectDetection(d); ok {
+			groundX, groundY := float32(gx), float32(gy)
+			det.GroundX = &groundX
+			det.GroundY = &groundY
+		}
+		out = append(out, det)
+	}
+	if data.BallIndex >= 0 {
+		add(data.Detections[data.BallIndex], true)
+	}
+	for i, d := range data.Detections {
+		if len(out) >= forwardDetections {
+			break
+		}
+		if i != data.BallIndex {
+			add(d, false)
+		}
+	}
+	return out
+}
+
+func createDiagnostics() *pb_gen.Robot_Diagnostics {
+	uptimeMs := uint64(time.Since(state.StartTime).Milliseconds())
+	rttMs := float32(connmgr.Default.RTT().Seconds() * 1000)
+	rxErrors := state.LinkRxErrors.Load()
+	txErrors := state.LinkTxErrors.Load()
+	var cameraFPS float32
+	if state.LastCameraRecvTime.Since() < state.CameraStaleTimeout {
+		cameraFPS = state.CameraFPS.Load()
+	}
+	cameraState := pb_gen.Camera_Process_State(state.CameraProcessState.Load())
+	dryRun := state.DryRun.Load()
+	ctrlByRobot := state.IsControlByRobotMode
+
+	diag := &pb_gen.Robot_Diagnostics{
+		UptimeMs:        &uptimeMs,
+		ConnectionRttMs: &rttMs,
+		LinkRxErrors:    &rxErrors,
+		LinkTxErrors:    &txErrors,
+		CameraFps:       &cameraFPS,
+		CameraState:     &cameraState,
+		DryRun:          &dryRun,
+		ControlByRobot:  &ctrlByRobot,
+	}
+	if state.SoftwareVersion != "" {
+		version := state.SoftwareVersion
+		diag.SoftwareVersion = &version
+	}
+	if state.BoardName != "" {
+		board := state.BoardName
+		diag.Board = &board
+	}
+	if temp, ok := sysinfo.CPUTemperature(); ok {
+		diag.CpuTemperature = &temp
+	}
+	if pc := connmgr.Default.Controller(); pc != nil {
+		controller := pc.IP.String()
+		diag.ControllerAddress = &controller
+	}
+	pinned := connmgr.Default.Pinned() != nil
+	diag.ControllerPinned = &pinned
+	cameraRestarts := camsup.Default.Restarts()
+	cameraExitCode := int32(camsup.Default.LastExitCode())
+	diag.CameraRestarts = &cameraRestarts
+	diag.CameraExitCode = &cameraExitCode
+	for _, f := range fault.Active() {
+		code, message := f.Code, f.Message
+		diag.Faults = append(diag.Faults, &pb_gen.Robot_Fault{
+			Code:    &code,
+			Message: &message,
+		})
+	}
+	return diag
+}
+
 func RunServer(done <-chan struct{}, myID uint32) {
-	mcastAddr, err := net.ResolveUDPAddr("udp", state.MulticastAddr+":"+state.MulticastPort)
+	mcastAddr, err := net.ResolveUDPAddr("udp4", state.MulticastAddr+":"+state.MulticastPort)
 	util.CheckError(err)
 
-	conn, err := net.ListenUDP("udp", nil)
-	util.CheckError(err)
-	defer conn.Close()
+	var mcastAddr6 *net.UDPAddr
+	if nc := config.Get().Network; nc.IPv6Multicast {
+		mcastAddr6, err = net.ResolveUDPAddr("udp6", net.JoinHostPort(nc.MulticastAddr6, state.MulticastPort))
+		util.CheckError(err)
+	}
+
+	var socks senderSockets
+	defer socks.close()
+	// 初回の tick で必ずバインドさせる。
+	gen := netif.Default.Generation() - 1
 
 	ReloadAdjustment()
 
 	ticker := time.NewTicker(sendInterval)
 	defer ticker.Stop()
 
-	var lastDiscoverTime time.Time
-	var lastOkTime time.Time
-
 	for {
 		select {
 		case <-done:
 			return
 		case <-ticker.C:
-			state.StateMu.Lock()
-
-			if state.ConnectionState != state.StateDiscovering && state.LastRecvTime.Since() > robotTimeout {
-				log.Println("[AI TX] PC connection timed out. Reverting to DISCOVERING.")
-				state.ConnectionState = state.StateDiscovering
-				state.PcAddress = nil
+			if netif.Default.Generation() != gen {
+				binding, current := netif.Default.Current()
+				if !socks.rebind(binding, mcastAddr6 != nil) {
+					continue
+				}
+				gen = current
 			}
 
-			currentState := state.ConnectionState
-			currentPcAddr := state.PcAddress
-
-			state.StateMu.Unlock()
+			action := connmgr.Default.Tick()
 
-			switch currentState {
-			case state.StateDiscovering:
-				if time.Since(lastDiscoverTime) > discoverInterval {
-					header := []byte{byte((myID << 4) | 0x01)}
-					if _, err := conn.WriteToUDP(header, mcastAddr); err != nil {
-						log.Printf("Failed to send DISCOVER: %v", err)
+			switch action.Kind {
+			case connmgr.ActionSendDiscover:
+				header := []byte{byte((myID << 4) | 0x01)}
+				if _, err := socks.v4.WriteToUDP(header, mcastAddr); err != nil {
+					log.Printf("Failed to send DISCOVER: %v", err)
+				}
+				if socks.v6 != nil {
+					addr6 := *mcastAddr6
+					if addr6.IP.IsLinkLocalMulticast() {
+						addr6.Zone = socks.iface
+					}
+					if _, err := socks.v6.WriteToUDP(header, &addr6); err != nil {
+						log.Printf("Failed to send IPv6 DISCOVER: %v", err)
 					}
-					lastDiscoverTime = time.Now()
 				}
 
-			case state.StateOffered:
-				if time.Since(lastOkTime) > okInterval && currentPcAddr != nil {
-					header := []byte{byte((myID << 4) | 0x03)}
-					if _, err := conn.WriteToUDP(header, currentPcAddr); err != nil {
-						log.Printf("Failed to send OK_ROBOT: %v", err)
-					}
-					lastOkTime = time.Now()
+			case connmgr.ActionSendOk:
+				conn := socks.forAddr(action.Addr)
+				if conn == nil {
+					break
+				}
+				header := []byte{byte((myID << 4) | 0x03)}
+				if _, err := conn.WriteToUDP(header, action.Addr); err != nil {
+					log.Printf("Failed to send OK_ROBOT: %v", err)
 				}
 
-			case state.StateConnected:
-				if currentPcAddr != nil {
-					sendStatusToMW(conn, currentPcAddr, myID, GetAdjustment())
+			case connmgr.ActionSendStatus:
+				if conn := socks.forAddr(action.Addr); conn != nil {
+					sendStatusToMW(conn, action.Addr, myID, GetAdjustment())
 				}
 			}
 		}
@@ -156,51 +320,11 @@ func RunServer(done <-chan struct{}, myID uint32) {
 }
 
 func loadOrCreateThresholdConfig() state.Adjustment {
-	if _, err := os.Stat(thresholdFile); os.IsNotExist(err) {
-		if err := saveAdjustmentConfig(state.DefaultAdjustment); err != nil {
-			log.Printf("しきい値ファイル作成エラー: %v", err)
-		}
-		return state.DefaultAdjustment
-	}
-
-	file, err := os.Open(thresholdFile)
+	set, err := thresholds.Default.Load()
 	if err != nil {
 		log.Printf("しきい値ファイル読み込みエラー: %v", err)
-		return state.DefaultAdjustment
-	}
-	defer file.Close()
-
-	var adjustment state.Adjustment
-	if err := json.NewDecoder(file).Decode(&adjustment); err != nil {
-		log.Printf("しきい値JSONデコードエラー: %v", err)
-		return state.DefaultAdjustment
 	}
-
-	return adjustment
-}
-
-func saveAdjustmentConfig(adjustment state.Adjustment) error {
-	// Preserve any extra keys (e.g. camera* settings shared with the Python
-	// camera process, such as cameraFlip180 / cameraExposure / cameraGain) by
-	// merging into the existing file instead of overwriting it with only the
-	// Adjustment fields.
-	merged := map[string]interface{}{}
-	if data, err := os.ReadFile(thresholdFile); err == nil {
-		if err := json.Unmarshal(data, &merged); err != nil {
-			merged = map[string]interface{}{}
-		}
-	}
-
-	merged["minThreshold"] = adjustment.MinThreshold
-	merged["maxThreshold"] = adjustment.MaxThreshold
-	merged["ballDetectRadius"] = adjustment.BallDetectRadius
-	merged["circularityThreshold"] = adjustment.CircularityThreshold
-
-	jsonData, err := json.Marshal(merged)
-	if err != nil {
-		return fmt.Errorf("JSON変換エラー: %w", err)
-	}
-	return os.WriteFile(thresholdFile, jsonData, 0644)
+	return set.Adjustment()
 }
 
 func sendStatusToMW(conn *net.UDPConn, targetAddr *net.UDPAddr, myID uint32, adjustment state.Adjustment) {
@@ -210,10 +334,10 @@ func sendStatusToMW(conn *net.UDPConn, targetAddr *net.UDPAddr, myID uint32, adj
 
 	var isBallExit bool
 	var imageX, imageY float32 = state.BallCoordMissing, state.BallCoordMissing
-	if state.ImageDataPtr != nil {
-		isBallExit = state.ImageDataPtr.IsBallExit
-		imageX = state.ImageDataPtr.ImageX
-		imageY = state.ImageDataPtr.ImageY
+	if data := state.FreshImageData(); data != nil {
+		isBallExit = data.IsBallExit
+		imageX = data.ImageX
+		imageY = data.ImageY
 		if !isBallExit {
 			imageX = state.BallCoordMissing
 			imageY = state.BallCoordMissing
@@ -254,6 +378,25 @@ func sendStatusToMW(conn *net.UDPConn, targetAddr *net.UDPAddr, myID uint32, adj
 	}
 }
 
-func SaveAdjustmentConfig(adjustment state.Adjustment) error {
-	return saveAdjustmentConfig(adjustment)
+// SaveAdjustmentConfig validates and saves thresholds (recorded in the
+// threshold history with source) and reloads the cache.
+func SaveAdjustmentConfig(adjustment state.Adjustment, source string) error {
+	set, err := thresholds.FromAdjustment(adjustment)
+	if err != nil {
+		return err
+	}
+	if err := thresholds.Default.Save(set, source); err != nil {
+		return err
+	}
+	ReloadAdjustment()
+	return nil
+}
+
+// RecordAdjustment reloads the cache after the camera process saved
+// threshold.json and records the new thresholds in the history.
+func RecordAdjustment(source string) state.Adjustment {
+	if _, err := thresholds.Default.Record(source); err != nil {
+		log.Printf("しきい値履歴の記録エラー: %v", err)
+	}
+	return ReloadAdjustment()
 }
@@ -0,0 +1,71 @@
+package mw
+
+import (
+	"log"
+	"net"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/netif"
+)
+
+// senderSockets are the MW send sockets bound to the selected interface, so
+// DISCOVER multicast and status unicast leave through it regardless of the
+// routing table.
+type senderSockets struct {
+	v4    *net.UDPConn
+	v6    *net.UDPConn
+	iface string
+}
+
+// rebind closes the sockets and opens new ones on b. It reports false when the
+// IPv4 socket could not be opened; the caller retries on the next tick.
+func (s *senderSockets) rebind(b netif.Binding, ipv6 bool) bool {
+	s.close()
+	s.iface = b.Name()
+
+	v4, err := net.ListenUDP("udp4", &net.UDPAddr{IP: b.IP4})
+	if err != nil {
+		log.Printf("[MW TX] Failed to open IPv4 socket on %s: %v", b, err)
+		return false
+	}
+	if b.Iface != nil {
+		if err := netif.SetMulticastInterface(v4, b.Iface, false); err != nil {
+			log.Printf("[MW TX] Failed to set multicast interface %s: %v", b.Iface.Name, err)
+		}
+	}
+	s.v4 = v4
+
+	if ipv6 && b.IP6 != nil {
+		v6, err := net.ListenUDP("udp6", &net.UDPAddr{IP: b.IP6, Zone: b.Zone(b.IP6)})
+		if err != nil {
+			log.Printf("[MW TX] Failed to open IPv6 socket on %s: %v", b, err)
+			return true
+		}
+		if err := netif.SetMulticastInterface(v6, b.Iface, true); err != nil {
+			log.Printf("[MW TX] Failed to set IPv6 multicast interface %s: %v", b.Iface.Name, err)
+		}
+		s.v6 = v6
+	}
+	return true
+}
+
+// forAddr returns the socket matching the address family of addr, or nil.
+func (s *senderSockets) forAddr(addr *net.UDPAddr) *net.UDPConn {
+	if addr == nil {
+		return nil
+	}
+	if addr.IP.To4() != nil {
+		return s.v4
+	}
+	return s.v6
+}
+
+func (s *senderSockets) close() {
+	if s.v4 != nil {
+		s.v4.Close()
+		s.v4 = nil
+	}
+	if s.v6 != nil {
+		s.v6.Close()
+		s.v6 = nil
+	}
+}
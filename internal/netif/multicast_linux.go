@@ -0,0 +1,28 @@
+package netif
+
+import (
+	"net"
+	"syscall"
+)
+
+// SetMulticastInterface makes conn send multicast through iface instead of the
+// interface chosen by the routing table.
+func SetMulticastInterface(conn *net.UDPConn, iface *net.Interface, ipv6 bool) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		if ipv6 {
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, iface.Index)
+			return
+		}
+		serr = syscall.SetsockoptIPMreqn(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF,
+			&syscall.IPMreqn{Ifindex: int32(iface.Index)})
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package netif
+
+import "net"
+
+// SetMulticastInterface is a no-op outside Linux; the routing table decides.
+func SetMulticastInterface(conn *net.UDPConn, iface *net.Interface, ipv6 bool) error {
+	return nil
+}
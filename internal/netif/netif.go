@@ -0,0 +1,225 @@
+// Package netif selects the network interface used for the AI receive socket
+// and the MW multicast sender, and watches it for address changes (e.g. Wi-Fi
+// reconnecting with a new DHCP lease) so the sockets can be rebound.
+package netif
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Selector chooses the interface. The zero value picks the first interface
+// with an active link and an IPv4 address, which was the behaviour before
+// interface selection existed.
+type Selector struct {
+	// Interface restricts the choice to this interface name (e.g. "wlan0").
+	Interface string
+	// Subnet restricts the choice to an interface with an address in it.
+	Subnet *net.IPNet
+	// IPv6 also looks up an IPv6 address of the chosen interface.
+	IPv6 bool
+}
+
+// Binding is the selected interface and its addresses. Iface is nil when no
+// interface matched; the sockets then bind to the unspecified address.
+type Binding struct {
+	Iface *net.Interface
+	IP4   net.IP
+	// IP6 prefers a global unicast address and falls back to link-local.
+	IP6 net.IP
+}
+
+// Name returns the interface name, or "" when none was selected.
+func (b Binding) Name() string {
+	if b.Iface == nil {
+		return ""
+	}
+	return b.Iface.Name
+}
+
+// Zone returns the IPv6 zone needed for link-local addresses.
+func (b Binding) Zone(ip net.IP) string {
+	if ip != nil && ip.IsLinkLocalUnicast() {
+		return b.Name()
+	}
+	return ""
+}
+
+func (b Binding) String() string {
+	if b.Iface == nil {
+		return "none"
+	}
+	s := b.Iface.Name
+	if b.IP4 != nil {
+		s += " " + b.IP4.String()
+	}
+	if b.IP6 != nil {
+		s += " " + b.IP6.String()
+	}
+	return s
+}
+
+func (b Binding) equal(o Binding) bool {
+	return b.Name() == o.Name() && b.IP4.Equal(o.IP4) && b.IP6.Equal(o.IP6)
+}
+
+// Select returns the first interface matching sel.
+func Select(sel Selector) (Binding, bool) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return Binding{}, false
+	}
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if sel.Interface != "" && iface.Name != sel.Interface {
+			continue
+		}
+		if !LinkUp(*iface) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		b := Binding{Iface: iface}
+		inSubnet := sel.Subnet == nil
+		var linkLocal6 net.IP
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() {
+				continue
+			}
+			ip := ipNet.IP
+			if sel.Subnet != nil && sel.Subnet.Contains(ip) {
+				inSubnet = true
+			}
+			switch {
+			case ip.To4() != nil:
+				if b.IP4 == nil && (sel.Subnet == nil || sel.Subnet.Contains(ip) || sel.Subnet.IP.To4() == nil) {
+					b.IP4 = ip.To4()
+				}
+			case !sel.IPv6:
+			case ip.IsLinkLocalUnicast():
+				if linkLocal6 == nil {
+					linkLocal6 = ip
+				}
+			case ip.IsGlobalUnicast():
+				if b.IP6 == nil {
+					b.IP6 = ip
+				}
+			}
+		}
+		if b.IP6 == nil {
+			b.IP6 = linkLocal6
+		}
+		if !inSubnet || (b.IP4 == nil && b.IP6 == nil) {
+			continue
+		}
+		return b, true
+	}
+	return Binding{}, false
+}
+
+// LinkUp reports whether the interface has an active link (not merely admin-up).
+// On Linux, eth0 can stay FlagUp with NO-CARRIER; operstate stays "down" until carrier is present.
+func LinkUp(iface net.Interface) bool {
+	if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", iface.Name, "operstate"))
+	if err != nil {
+		return iface.Flags&net.FlagRunning != 0
+	}
+	return strings.TrimSpace(string(data)) == "up"
+}
+
+// Watcher keeps the current Binding and bumps a generation counter whenever
+// it changes. Socket owners compare the generation to know when to rebind.
+type Watcher struct {
+	mu      sync.Mutex
+	sel     Selector
+	cur     Binding
+	gen     atomic.Uint64
+	hooks   []func(Binding)
+	started bool
+}
+
+// Default is the watcher shared by the AI and MW sockets.
+var Default = &Watcher{}
+
+// Configure sets the selector. Called once at startup before Refresh.
+func (w *Watcher) Configure(sel Selector) {
+	w.mu.Lock()
+	w.sel = sel
+	w.mu.Unlock()
+}
+
+// Subscribe registers fn for binding changes (including the first Refresh).
+func (w *Watcher) Subscribe(fn func(Binding)) {
+	w.mu.Lock()
+	w.hooks = append(w.hooks, fn)
+	w.mu.Unlock()
+}
+
+// Current returns the binding and its generation.
+func (w *Watcher) Current() (Binding, uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cur, w.gen.Load()
+}
+
+// Generation returns a counter that changes whenever the binding changes.
+func (w *Watcher) Generation() uint64 {
+	return w.gen.Load()
+}
+
+// Refresh re-selects the interface and reports whether the binding changed.
+func (w *Watcher) Refresh() bool {
+	w.mu.Lock()
+	b, ok := Select(w.sel)
+	if w.started && b.equal(w.cur) {
+		w.mu.Unlock()
+		return false
+	}
+	first := !w.started
+	w.started = true
+	w.cur = b
+	w.gen.Add(1)
+	hooks := append([]func(Binding){}, w.hooks...)
+	w.mu.Unlock()
+
+	switch {
+	case !ok:
+		log.Println("Network interface: not found (using unspecified address)")
+	case first:
+		log.Printf("Network interface: %s", b)
+	default:
+		log.Printf("Network interface changed: %s (rebinding sockets)", b)
+	}
+	for _, fn := range hooks {
+		fn(b)
+	}
+	return true
+}
+
+// Run refreshes the binding every interval until done is closed.
+func (w *Watcher) Run(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			w.Refresh()
+		}
+	}
+}
@@ -3,10 +3,13 @@
 package pi4
 
 import (
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/motorcal"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/wheelgraph"
 	"go.bug.st/serial"
@@ -14,8 +17,17 @@ import (
 
 const recvPacketSize = 12
 
+// serialReadTimeout detects a silent MCU: a byte that does not arrive within
+// it fails the frame.
+const serialReadTimeout = 200 * time.Millisecond
+
 var serialPreamble = []byte{0xFF}
 
+var (
+	isSerialFrameValid   bool = true
+	prevSerialFrameValid bool = true
+)
+
 func RunSerial(done <-chan struct{}, myID uint32) {
 	port, err := serial.Open(SerialPortName, &serial.Mode{})
 	if err != nil {
@@ -35,6 +47,9 @@ func RunSerial(done <-chan struct{}, myID uint32) {
 	if err := port.SetMode(mode); err != nil {
 		log.Fatal(err)
 	}
+	if err := port.SetReadTimeout(serialReadTimeout); err != nil {
+		log.Fatal(err)
+	}
 
 	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
 	state.LastRecvTime.Store(past)
@@ -51,7 +66,19 @@ func RunSerial(done <-chan struct{}, myID uint32) {
 }
 
 func processSerialCommunication(port serial.Port) {
-	recvbuf := waitForPreambleAndReceive(port)
+	recvbuf, frameErr := waitForPreambleAndReceive(port)
+	isSerialFrameValid = frameErr == nil
+	if frameErr != nil {
+		state.LinkRxErrors.Add(1)
+	}
+	handleSerialFrameValidationChange(frameErr)
+	prevSerialFrameValid = isSerialFrameValid
+	if frameErr != nil {
+		if state.DebugSerial {
+			log.Printf("[Serial RX] FRAME ERROR: %v", frameErr)
+		}
+		return
+	}
 
 	state.Recvdata = parseRecvBuf(recvbuf)
 
@@ -60,6 +87,8 @@ func processSerialCommunication(port serial.Port) {
 	state.BrWheelSpeedRadS = motorRawToWheelMS(state.Recvdata.BrWheelSpeed)
 	state.FrWheelSpeedRadS = motorRawToWheelMS(state.Recvdata.FrWheelSpeed)
 
+	link.ObserveRX()
+
 	if state.DebugWheelGraph {
 		wheelgraph.Record(
 			state.Recvdata.FlWheelSpeed,
@@ -86,12 +115,17 @@ func processSerialCommunication(port serial.Port) {
 
 	if state.DebugSerial {
 		link.LogSendData(sendbytes)
-		if state.DryRun {
+		if state.DryRun.Load() {
 			link.LogSendData(hwbytes)
 		}
 	}
 
-	port.Write(hwbytes)
+	if _, err := port.Write(hwbytes); err != nil {
+		state.LinkTxErrors.Add(1)
+		if state.DebugSerial {
+			log.Printf("[Serial TX] write error: %v", err)
+		}
+	}
 	link.FinishLinkCycle()
 }
 
@@ -110,19 +144,34 @@ func parseRecvBuf(recvbuf []byte) state.RecvData {
 
 func motorRawToWheelMS(raw int16) float32 {
 	wheelRadS := float32(raw) / 100.0
-	wheelRadiusM := float32(WheelDiameterMm / 2000.0)
+	wheelRadiusM := float32(motorcal.Default.WheelDiameterMm(WheelDiameterMm) / 2000.0)
 	return wheelRadS * wheelRadiusM
 }
 
-func waitForPreambleAndReceive(port serial.Port) []byte {
+// waitForPreambleAndReceive は preamble の後の 1 フレームを読む。読み込みエラーや
+// serialReadTimeout 以内にバイトが届かないときはエラーを返す。
+func waitForPreambleAndReceive(port serial.Port) ([]byte, error) {
 	buf := make([]byte, 1)
 	recvbuf := make([]byte, recvPacketSize)
 
 	port.ResetInputBuffer()
 
+	readByte := func() error {
+		n, err := port.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("no byte within %s", serialReadTimeout)
+		}
+		return nil
+	}
+
 	preambleIdx := 0
 	for preambleIdx < len(serialPreamble) {
-		port.Read(buf)
+		if err := readByte(); err != nil {
+			return nil, fmt.Errorf("preamble: %w", err)
+		}
 		if buf[0] == serialPreamble[preambleIdx] {
 			preambleIdx++
 		} else {
@@ -131,9 +180,24 @@ func waitForPreambleAndReceive(port serial.Port) []byte {
 	}
 
 	for i := 0; i < recvPacketSize; i++ {
-		port.Read(buf)
+		if err := readByte(); err != nil {
+			return nil, fmt.Errorf("byte %d: %w", i, err)
+		}
 		recvbuf[i] = buf[0]
 	}
 
-	return recvbuf
+	return recvbuf, nil
+}
+
+func handleSerialFrameValidationChange(frameErr error) {
+	if frameErr != nil && prevSerialFrameValid {
+		log.Printf("Serial recv frame error: %v", frameErr)
+		fault.Raise(fault.CodeLink, "UART受信異常")
+		link.RingBuzzerAsync(5, 300*time.Millisecond, 0)
+	}
+	if frameErr == nil && !prevSerialFrameValid {
+		log.Println("Serial recv frame recovered")
+		fault.Clear(fault.CodeLink)
+		link.RingBuzzerAsync(10, 200*time.Millisecond, 0)
+	}
 }
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
 	"github.com/stianeikeland/go-rpio/v4"
@@ -156,7 +157,7 @@ func RunGPIO(done <-chan struct{}) {
 			if state.Recvdata.Volt <= uint8(alarmVoltage) {
 				handleBatteryAlarm(led2, button1, &alarmVoltage)
 			} else {
-				ledInterval = handleNormalOperation(led, button1, button2, ledInterval)
+				ledInterval = handleNormalOperation(led, led2, button1, button2, ledInterval)
 			}
 		}
 	}
@@ -255,16 +256,31 @@ func playAlarmDismissSound() {
 }
 
 func PlayBallDetectedSound() {
-	for state.ImageDataPtr != nil && state.ImageDataPtr.IsBallExit {
+	for data := state.FreshImageData(); data != nil && data.IsBallExit; data = state.FreshImageData() {
 		RingBuzzer(10, 50*time.Millisecond, 0)
 		time.Sleep(80 * time.Millisecond)
 	}
 }
 
-func handleNormalOperation(led, button1, button2 rpio.Pin, ledInterval time.Duration) time.Duration {
+func handleNormalOperation(led, led2, button1, button2 rpio.Pin, ledInterval time.Duration) time.Duration {
 	const ledBlinkFast = 75 * time.Millisecond
 	const ledBlinkNormal = 500 * time.Millisecond
 
+	// 自己診断（internal/selftest）中は LED を全点灯する。
+	if link.LEDTest() {
+		led.Write(rpio.High)
+		led2.Write(rpio.High)
+		time.Sleep(ledBlinkFast)
+		return ledInterval
+	}
+
+	// LED2 は電池アラーム以外ではコントローラとの接続状態を示す。
+	if link.ConnectionLED() {
+		led2.Write(rpio.High)
+	} else {
+		led2.Write(rpio.Low)
+	}
+
 	time.Sleep(ledInterval)
 	led.Write(rpio.High)
 
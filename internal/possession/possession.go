@@ -0,0 +1,189 @@
+// Package possession fuses the ball sensors into one ball possession state.
+//
+// The MCU reports the photo sensor (state.SensorPhotoMask, the ball is in
+// front of the dribbler) and the dribbler sensor (state.SensorDribblerMask);
+// the camera independently reports whether it sees the ball. Each alone is
+// unreliable: the photo sensor also fires on a robot or a hand in front of the
+// dribbler, and the camera loses the ball below the frame once it is held.
+// The tracker combines them with timing:
+//
+//   - the photo sensor must be on for Acquire before it counts (debounce);
+//   - it is confirmed by the dribbler sensor, or by a camera sighting within
+//     CameraWindow (the camera saw the ball just before it reached the
+//     dribbler);
+//   - once held, possession is kept until the photo sensor has been off for
+//     Release, whatever the camera says (hysteresis).
+//
+// The state is sent to the controller (PiToMw ball_status.possession), can
+// gate the kicker (KickAllowed) and labels the training samples of Recorder.
+package possession
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the fused possession state. The values are those of the
+// Ball_Possession protobuf enum.
+type State int
+
+const (
+	// None: no sensor sees the ball.
+	None State = iota
+	// Seen: the camera sees the ball, the photo sensor does not.
+	Seen
+	// Unconfirmed: the photo sensor is on but neither the camera nor the
+	// dribbler sensor confirms a ball.
+	Unconfirmed
+	// Held: the photo sensor is on and confirmed.
+	Held
+)
+
+var stateNames = [...]string{"none", "seen", "unconfirmed", "held"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// MarshalText encodes the state by name in JSON.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state name.
+func (s *State) UnmarshalText(text []byte) error {
+	for i, name := range stateNames {
+		if string(text) == name {
+			*s = State(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown possession state %q", text)
+}
+
+// Config tunes the tracker.
+type Config struct {
+	// Acquire is how long the photo sensor must be on before it counts.
+	Acquire time.Duration
+	// Release is how long the photo sensor must be off before a held or
+	// unconfirmed ball is released.
+	Release time.Duration
+	// CameraWindow is how long a camera sighting confirms the photo sensor.
+	CameraWindow time.Duration
+	// GateKick withholds kicks that wait for the ball (not direct kicks)
+	// until the ball is Held.
+	GateKick bool
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{
+	Acquire:      30 * time.Millisecond,
+	Release:      150 * time.Millisecond,
+	CameraWindow: 500 * time.Millisecond,
+}
+
+// Inputs are the sensor readings of one update.
+type Inputs struct {
+	Photo    bool `json:"photo"`
+	Dribbler bool `json:"dribbler"`
+	// Camera is true when a fresh camera frame has the ball.
+	Camera bool `json:"camera"`
+}
+
+// Status is a snapshot of the tracker.
+type Status struct {
+	State State     `json:"state"`
+	Since time.Time `json:"since"`
+	Inputs
+	// LastCamera is the last camera sighting, zero when never.
+	LastCamera time.Time `json:"lastCamera"`
+}
+
+// Tracker is the possession state machine. It is safe for concurrent use.
+type Tracker struct {
+	mu  sync.Mutex
+	cfg Config
+
+	state      State
+	since      time.Time
+	in         Inputs
+	photoEdge  time.Time // last change of the photo sensor
+	lastCamera time.Time
+}
+
+// New returns a tracker with the given configuration.
+func New(cfg Config) *Tracker {
+	return &Tracker{cfg: cfg}
+}
+
+// Default tracks the ball of this robot. It is updated by the MCU link.
+var Default = New(DefaultConfig)
+
+// Configure replaces the configuration.
+func (t *Tracker) Configure(cfg Config) {
+	t.mu.Lock()
+	t.cfg = cfg
+	t.mu.Unlock()
+}
+
+// Config returns the current configuration.
+func (t *Tracker) Config() Config {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cfg
+}
+
+// Update feeds the sensor readings at now and returns the new state.
+func (t *Tracker) Update(now time.Time, in Inputs) State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if in.Camera {
+		t.lastCamera = now
+	}
+	if in.Photo != t.in.Photo || t.photoEdge.IsZero() {
+		t.photoEdge = now
+	}
+	t.in = in
+
+	stable := now.Sub(t.photoEdge)
+	photoOn := in.Photo && stable >= t.cfg.Acquire
+	photoGone := !in.Photo && stable >= t.cfg.Release
+	confirmed := in.Dribbler || (!t.lastCamera.IsZero() && now.Sub(t.lastCamera) <= t.cfg.CameraWindow)
+
+	next := None
+	switch {
+	case t.state == Held && !photoGone:
+		next = Held
+	case photoOn && confirmed:
+		next = Held
+	case photoOn || (t.state == Unconfirmed && !photoGone):
+		next = Unconfirmed
+	case in.Camera:
+		next = Seen
+	}
+	if next != t.state || t.since.IsZero() {
+		t.state = next
+		t.since = now
+	}
+	return next
+}
+
+// Status returns the current state.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Status{State: t.state, Since: t.since, Inputs: t.in, LastCamera: t.lastCamera}
+}
+
+// KickAllowed reports whether a kick may be passed to the MCU. Direct kicks
+// (fired without waiting for the ball) are never gated.
+func (t *Tracker) KickAllowed(direct bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.cfg.GateKick || direct || t.state == Held
+}
@@ -0,0 +1,136 @@
+package possession
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+)
+
+func TestTracker(t *testing.T) {
+	tr := New(DefaultConfig)
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+
+	steps := []struct {
+		ms   int
+		in   Inputs
+		want State
+	}{
+		{0, Inputs{}, None},
+		{10, Inputs{Camera: true}, Seen},
+		// The photo sensor is debounced, the recent sighting confirms it.
+		{100, Inputs{Photo: true}, None},
+		{140, Inputs{Photo: true}, Held},
+		// Short dropouts of the photo sensor keep the ball.
+		{200, Inputs{}, Held},
+		{250, Inputs{Photo: true}, Held},
+		{300, Inputs{}, Held},
+		{500, Inputs{}, None},
+		// Nothing confirms the sensor: something else is in front of it.
+		{2000, Inputs{Photo: true}, None},
+		{2040, Inputs{Photo: true}, Unconfirmed},
+		{2100, Inputs{}, Unconfirmed},
+		{2300, Inputs{}, None},
+		// The dribbler sensor confirms without the camera.
+		{3000, Inputs{Photo: true, Dribbler: true}, None},
+		{3050, Inputs{Photo: true, Dribbler: true}, Held},
+		{4000, Inputs{}, Held},
+		{4200, Inputs{}, None},
+		// The camera confirms an unconfirmed ball later.
+		{5000, Inputs{Photo: true}, None},
+		{5050, Inputs{Photo: true}, Unconfirmed},
+		{5100, Inputs{Photo: true, Camera: true}, Held},
+	}
+	for _, s := range steps {
+		if got := tr.Update(at(s.ms), s.in); got != s.want {
+			t.Fatalf("%dms %+v: state %v, want %v", s.ms, s.in, got, s.want)
+		}
+	}
+	if st := tr.Status(); !st.Since.Equal(at(5100)) || !st.Camera {
+		t.Fatalf("Status = %+v", st)
+	}
+}
+
+func TestKickAllowed(t *testing.T) {
+	tr := New(DefaultConfig)
+	if !tr.KickAllowed(false) {
+		t.Fatal("kick gated while gating is off")
+	}
+	cfg := DefaultConfig
+	cfg.GateKick = true
+	tr.Configure(cfg)
+	if tr.KickAllowed(false) || !tr.KickAllowed(true) {
+		t.Fatal("without the ball only direct kicks pass")
+	}
+	now := time.Now()
+	tr.Update(now, Inputs{Photo: true, Dribbler: true})
+	tr.Update(now.Add(time.Second), Inputs{Photo: true, Dribbler: true})
+	if !tr.KickAllowed(false) {
+		t.Fatal("kick gated while the ball is held")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	tr := New(DefaultConfig)
+	r := NewRecorder(dir, tr)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	r.Configure(SampleConfig{Enabled: true, Interval: time.Second, MaxSamples: 2})
+
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xd9}
+	var fail error
+	capture := func(context.Context) (camctl.Frame, error) {
+		return camctl.Frame{Frame: base64.StdEncoding.EncodeToString(jpeg), Width: 640, Height: 480}, fail
+	}
+
+	if r.Poll(capture) {
+		t.Fatal("sample without a ball")
+	}
+	tr.Update(now, Inputs{Photo: true})
+	tr.Update(now.Add(time.Second), Inputs{Photo: true})
+	if !r.Poll(capture) {
+		t.Fatal("no sample on Unconfirmed")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if r.Poll(capture) {
+		t.Fatal("sample within the interval")
+	}
+	// A state change is sampled at once.
+	tr.Update(now, Inputs{Photo: true, Dribbler: true})
+	if !r.Poll(capture) {
+		t.Fatal("no sample on Held")
+	}
+	now = now.Add(time.Second)
+	if !r.Poll(capture) {
+		t.Fatal("no periodic sample")
+	}
+
+	if st := r.Status(); st.Count != 2 || st.LastError != "" {
+		t.Fatalf("Status = %+v", st)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, now.Format("20060102-150405.000")+"-held.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var label Label
+	if err := json.Unmarshal(data, &label); err != nil || !label.Photo || !label.Dribbler || label.Width != 640 {
+		t.Fatalf("label = %s (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20260501-120000.000-unconfirmed.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("oldest sample not evicted: %v", err)
+	}
+
+	fail = errors.New("camera down")
+	now = now.Add(time.Second)
+	if r.Poll(capture) || r.Status().LastError != "camera down" {
+		t.Fatalf("capture error not reported: %+v", r.Status())
+	}
+}
@@ -0,0 +1,233 @@
+package possession
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camctl"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+)
+
+// SamplesDir holds the training samples, next to threshold.json.
+const SamplesDir = "possession_samples"
+
+const (
+	samplePollInterval = 100 * time.Millisecond
+	captureTimeout     = 3 * time.Second
+)
+
+// SampleConfig controls the training sample recorder.
+type SampleConfig struct {
+	Enabled bool
+	// Interval is the shortest time between two samples; while the state
+	// stays Held or Unconfirmed a sample is taken every Interval.
+	Interval time.Duration
+	// MaxSamples bounds the directory; the oldest samples are deleted.
+	MaxSamples int
+}
+
+// DefaultSampleConfig is used until Configure is called.
+var DefaultSampleConfig = SampleConfig{
+	Interval:   2 * time.Second,
+	MaxSamples: 500,
+}
+
+// Label is the sensor truth stored next to a sample frame (<name>.json).
+type Label struct {
+	Time  time.Time `json:"time"`
+	State State     `json:"state"`
+	// StateMs is how long the state had lasted.
+	StateMs int64 `json:"stateMs"`
+	Inputs
+	// Width and Height are the frame size in pixels.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// SamplesStatus describes the recorder for the API.
+type SamplesStatus struct {
+	Enabled bool `json:"enabled"`
+	Count   int  `json:"count"`
+	// Last is the last capture attempt.
+	Last      *time.Time `json:"last"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// Recorder saves raw camera frames labelled with the fused possession state
+// while the photo sensor reports a ball (Held: positive samples, including the
+// frames where the camera missed the ball; Unconfirmed: the sensor and the
+// camera disagree). Each sample is <time>-<state>.jpg with a Label in
+// <time>-<state>.json.
+type Recorder struct {
+	dir     string
+	tracker *Tracker
+	now     func() time.Time
+
+	mu        sync.Mutex
+	cfg       SampleConfig
+	count     int // -1 until the directory was scanned
+	last      time.Time
+	lastState State
+	lastErr   string
+}
+
+// NewRecorder returns a recorder that labels frames with tracker and stores
+// them in dir.
+func NewRecorder(dir string, tracker *Tracker) *Recorder {
+	return &Recorder{dir: dir, tracker: tracker, now: time.Now, cfg: DefaultSampleConfig, count: -1}
+}
+
+// DefaultRecorder records samples of Default.
+var DefaultRecorder = NewRecorder(SamplesDir, Default)
+
+// Configure replaces the configuration.
+func (r *Recorder) Configure(cfg SampleConfig) {
+	r.mu.Lock()
+	r.cfg = cfg
+	r.mu.Unlock()
+}
+
+// Run takes samples with capture until done.
+func (r *Recorder) Run(done <-chan struct{}, capture func(context.Context) (camctl.Frame, error)) {
+	ticker := time.NewTicker(samplePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			r.Poll(capture)
+		}
+	}
+}
+
+// Poll takes a sample if one is due. It reports whether a sample was saved.
+func (r *Recorder) Poll(capture func(context.Context) (camctl.Frame, error)) bool {
+	st := r.tracker.Status()
+	now := r.now()
+
+	r.mu.Lock()
+	cfg := r.cfg
+	due := cfg.Enabled && (st.State == Held || st.State == Unconfirmed) &&
+		(st.State != r.lastState || now.Sub(r.last) >= cfg.Interval)
+	r.lastState = st.State
+	if due {
+		// Also counts failed captures, so a missing camera is not retried at
+		// the poll rate.
+		r.last = now
+	}
+	r.mu.Unlock()
+	if !due {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	frame, err := capture(ctx)
+	cancel()
+	if err == nil {
+		err = r.save(frame, Label{
+			Time:    now,
+			State:   st.State,
+			StateMs: now.Sub(st.Since).Milliseconds(),
+			Inputs:  st.Inputs,
+			Width:   frame.Width,
+			Height:  frame.Height,
+		}, cfg.MaxSamples)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if r.lastErr != err.Error() {
+			log.Printf("possession sample error: %v", err)
+		}
+		r.lastErr = err.Error()
+		return false
+	}
+	r.lastErr = ""
+	return true
+}
+
+func (r *Recorder) save(frame camctl.Frame, label Label, maxSamples int) error {
+	jpeg, err := base64.StdEncoding.DecodeString(frame.Frame)
+	if err != nil {
+		return fmt.Errorf("decode frame: %w", err)
+	}
+	labelData, err := json.MarshalIndent(label, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+
+	// Samples are listed by their label, so it is written last: a crash never
+	// leaves a listed sample with a torn or missing image.
+	name := label.Time.Format("20060102-150405.000") + "-" + label.State.String()
+	if err := util.WriteFileAtomic(filepath.Join(r.dir, name+".jpg"), jpeg); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(filepath.Join(r.dir, name+".json"), append(labelData, '\n')); err != nil {
+		os.Remove(filepath.Join(r.dir, name+".jpg"))
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names, err := r.listLocked()
+	if err != nil {
+		return err
+	}
+	for len(names) > maxSamples {
+		os.Remove(filepath.Join(r.dir, names[0]+".jpg"))
+		os.Remove(filepath.Join(r.dir, names[0]+".json"))
+		names = names[1:]
+	}
+	r.count = len(names)
+	return nil
+}
+
+// listLocked returns the sample names (without extension), oldest first.
+func (r *Recorder) listLocked() ([]string, error) {
+	entries, err := os.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Status returns the recorder state.
+func (r *Recorder) Status() SamplesStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count < 0 {
+		names, _ := r.listLocked()
+		r.count = len(names)
+	}
+	st := SamplesStatus{Enabled: r.cfg.Enabled, Count: r.count, LastError: r.lastErr}
+	if !r.last.IsZero() {
+		t := r.last
+		st.Last = &t
+	}
+	return st
+}
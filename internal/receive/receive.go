@@ -9,13 +9,27 @@ import (
 	"net"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/autocalib"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/balltrack"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camgeom"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/config"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/connmgr"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/control"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/flightrec"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/netif"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/telemetry"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/vision"
 	"github.com/Rione/ssl-RACOON-Pi2/proto/pb_gen"
 	"google.golang.org/protobuf/proto"
 )
 
-const directKickThreshold float32 = 100
+const (
+	directKickThreshold float32 = 100
+	cameraFPSWindow             = time.Second
+)
 
 var playBallDetectedSound func()
 
@@ -23,82 +37,169 @@ func SetPlayBallDetectedSound(fn func()) {
 	playBallDetectedSound = fn
 }
 
-func RunClient(done <-chan struct{}, myID uint32, ip string) {
-	serverAddr := &net.UDPAddr{
-		IP:   net.ParseIP(ip),
-		Port: state.UDPRecvPort,
-	}
+var controlHandler func(*pb_gen.MwToPi)
 
-	serverConn, err := net.ListenUDP("udp", serverAddr)
-	util.CheckError(err)
-	defer serverConn.Close()
+// SetControlHandler registers the executor for MwToPi commands (cmd 0x08).
+// The handler is called from the receive loop and must not block for long.
+func SetControlHandler(fn func(*pb_gen.MwToPi)) {
+	controlHandler = fn
+}
 
-	buf := make([]byte, 1024)
+// rebindCheckInterval bounds how long a blocked read waits before checking for
+// shutdown and interface changes.
+const rebindCheckInterval = 500 * time.Millisecond
+
+// RunClient receives the AI packets from the PC on the interface selected by
+// netif.Default, rebinding when its address changes. With IPv6 enabled a second
+// socket accepts the controller over IPv6.
+func RunClient(done <-chan struct{}, myID uint32) {
 	log.Printf("[AI RX] Started listening for PC on port %d...", state.UDPRecvPort)
 
+	if config.Get().Network.IPv6Multicast {
+		go listenAI(done, myID, "udp6", func(b netif.Binding) *net.UDPAddr {
+			if b.IP6 == nil {
+				return nil
+			}
+			return &net.UDPAddr{IP: b.IP6, Port: state.UDPRecvPort, Zone: b.Zone(b.IP6)}
+		})
+	}
+	listenAI(done, myID, "udp4", func(b netif.Binding) *net.UDPAddr {
+		// IP4 が nil（インタフェース未検出）なら 0.0.0.0 で待ち受ける。
+		return &net.UDPAddr{IP: b.IP4, Port: state.UDPRecvPort}
+	})
+}
+
+// listenAI binds network to the address returned by laddr for the current
+// binding and handles packets until done, rebinding on interface changes.
+func listenAI(done <-chan struct{}, myID uint32, network string, laddr func(netif.Binding) *net.UDPAddr) {
+	buf := make([]byte, 1024)
+
 	for {
-		select {
-		case <-done:
-			return
-		default:
-			n, addr, err := serverConn.ReadFromUDP(buf)
+		binding, gen := netif.Default.Current()
+		addr := laddr(binding)
+		if addr == nil {
+			if waitRebind(done, gen) {
+				return
+			}
+			continue
+		}
+
+		serverConn, err := net.ListenUDP(network, addr)
+		if err != nil {
+			log.Printf("[AI RX] Failed to listen on %s: %v", addr, err)
+			if waitRebind(done, gen) {
+				return
+			}
+			continue
+		}
+
+		for {
+			select {
+			case <-done:
+				serverConn.Close()
+				return
+			default:
+			}
+			if netif.Default.Generation() != gen {
+				break
+			}
+
+			serverConn.SetReadDeadline(time.Now().Add(rebindCheckInterval))
+			n, from, err := serverConn.ReadFromUDP(buf)
 			if err != nil {
-				log.Printf("[AI RX] Error reading UDP message: %v", err)
+				if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+					log.Printf("[AI RX] Error reading UDP message: %v", err)
+				}
 				continue
 			}
 			if n == 0 {
 				continue
 			}
+			handlePacket(buf[:n], from, myID)
+		}
+		serverConn.Close()
+	}
+}
 
-			header := buf[0]
-			robotId := uint32((header >> 4) & 0x0F)
-			cmdId := header & 0x0F
+// waitRebind waits for an interface change or done (reported as true). The
+// interval also serves as a retry delay after a failed bind.
+func waitRebind(done <-chan struct{}, gen uint64) bool {
+	ticker := time.NewTicker(rebindCheckInterval)
+	defer ticker.Stop()
 
-			if robotId != myID {
-				continue
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+			return true
+		case <-ticker.C:
+			if netif.Default.Generation() != gen {
+				return false
 			}
+		}
+	}
+	return false
+}
 
-			state.StateMu.Lock()
-
-			switch cmdId {
-			case 0x02: // OFFER
-				state.PcAddress = pcReceiveAddr(addr)
-				state.ConnectionState = state.StateOffered
-				state.LastRecvTime.Store(time.Now())
-				log.Printf("[AI RX] Received OFFER from %s. State -> OFFERED", state.PcAddress.String())
+func handlePacket(buf []byte, addr *net.UDPAddr, myID uint32) {
+	header := buf[0]
+	robotId := uint32((header >> 4) & 0x0F)
+	cmdId := header & 0x0F
 
-			case 0x04: // OK_PC
-				if state.ConnectionState == state.StateOffered && isSamePcIP(addr) {
-					state.ConnectionState = state.StateConnected
-					state.LastRecvTime.Store(time.Now())
-					log.Printf("[AI RX] Received OK_PC from %s. State -> CONNECTED", addr.IP.String())
-				}
+	if robotId != myID {
+		return
+	}
 
-			case 0x06: // DATA (BotCmd)
-				if state.ConnectionState != state.StateConnected || !isSamePcIP(addr) {
-					break
-				}
+	switch cmdId {
+	case 0x02: // OFFER
+		if !connmgr.Default.OnOffer(pcReceiveAddr(addr)) {
+			break
+		}
+		state.LastRecvTime.Store(time.Now())
+		control.Reset()
 
-				state.LastRecvTime.Store(time.Now())
-				state.LastCmdRecvTime.Store(time.Now())
+	case 0x04: // OK_PC
+		if connmgr.Default.OnOkPc(addr) {
+			state.LastRecvTime.Store(time.Now())
+		}
 
-				if n > 1 {
-					packet := &pb_gen.GrSim_Packet{}
-					if err := proto.Unmarshal(buf[1:n], packet); err != nil {
-						log.Printf("Error unmarshaling DATA: %v", err)
-					} else {
-						processRobotCommands(packet, myID)
-					}
-				}
+	case 0x06: // DATA (BotCmd)
+		if !connmgr.Default.OnPacket(addr) {
+			break
+		}
 
-			case 0x07: // KEEP_ALIVE
-				if state.ConnectionState != state.StateConnected || !isSamePcIP(addr) {
-					break
-				}
+		state.LastRecvTime.Store(time.Now())
+		state.LastCmdRecvTime.Store(time.Now())
 
-				state.LastRecvTime.Store(time.Now())
+		if len(buf) > 1 {
+			packet := &pb_gen.GrSim_Packet{}
+			if err := proto.Unmarshal(buf[1:], packet); err != nil {
+				log.Printf("Error unmarshaling DATA: %v", err)
+			} else {
+				processRobotCommands(packet, myID)
 			}
-			state.StateMu.Unlock()
+		}
+
+	case 0x07: // KEEP_ALIVE
+		if !connmgr.Default.OnPacket(addr) {
+			break
+		}
+
+		state.LastRecvTime.Store(time.Now())
+
+	case 0x08: // CONTROL (MwToPi)
+		if len(buf) <= 1 || !connmgr.Default.OnPacket(addr) {
+			break
+		}
+
+		state.LastRecvTime.Store(time.Now())
+
+		msg := &pb_gen.MwToPi{}
+		if err := proto.Unmarshal(buf[1:], msg); err != nil {
+			log.Printf("Error unmarshaling CONTROL: %v", err)
+			break
+		}
+		if controlHandler != nil {
+			controlHandler(msg)
 		}
 	}
 }
@@ -114,10 +215,6 @@ func pcReceiveAddr(addr *net.UDPAddr) *net.UDPAddr {
 	}
 }
 
-func isSamePcIP(addr *net.UDPAddr) bool {
-	return state.PcAddress != nil && addr != nil && state.PcAddress.IP.Equal(addr.IP)
-}
-
 func processRobotCommands(packet *pb_gen.GrSim_Packet, myID uint32) {
 	robotCmds := packet.Commands.GetRobotCommands()
 
@@ -211,6 +308,7 @@ func processCommand(cmd *pb_gen.GrSim_Robot_Command) {
 	}
 	payload.Informations |= state.InfoDoCharge
 
+	flightrec.Default.Command(payload)
 	state.SetSendPayload(mustEncodeSendPayload(payload))
 }
 
@@ -232,7 +330,10 @@ func ReceiveData(done <-chan struct{}, myID uint32, ip string) {
 	util.CheckError(err)
 	defer serverConn.Close()
 
-	buf := make([]byte, 20240)
+	buf := make([]byte, 65536)
+
+	var fpsWindowStart time.Time
+	var fpsFrames int
 
 	for {
 		select {
@@ -241,16 +342,38 @@ func ReceiveData(done <-chan struct{}, myID uint32, ip string) {
 		default:
 			n, _, _ := serverConn.ReadFromUDP(buf)
 
-			jsonData := &state.ImageData{}
-			if err := json.Unmarshal(buf[0:n], jsonData); err != nil {
-				log.Printf("JSON unmarshal error: %v", err)
+			jsonData, err := decodeCameraData(buf[:n])
+			if err != nil {
+				log.Printf("Camera data decode error: %v", err)
 				continue
 			}
 
 			state.ApplyMissingBallCoords(jsonData)
 
+			now := time.Now()
+			jsonData.ReceivedAt = now
+			state.LastCameraRecvTime.Store(now)
+			fpsFrames++
+			if elapsed := now.Sub(fpsWindowStart); elapsed >= cameraFPSWindow {
+				if !fpsWindowStart.IsZero() {
+					state.CameraFPS.Store(float32(float64(fpsFrames) / elapsed.Seconds()))
+				}
+				fpsWindowStart = now
+				fpsFrames = 0
+			}
+
 			state.ImageDataPtr = jsonData
-			state.ImageResponseData.Frame = jsonData.Frame
+			camgeom.Default.SetFrameSize(jsonData.FrameWidth, jsonData.FrameHeight)
+
+			trackTime := jsonData.CaptureTime
+			if trackTime.IsZero() {
+				trackTime = now
+			}
+			balltrack.Default.Update(trackTime, float64(jsonData.ImageX), float64(jsonData.ImageY), jsonData.IsBallExit)
+			autocalib.Default.Observe(state.Recvdata.SensorInformation&state.SensorPhotoMask != 0, jsonData.IsBallExit)
+			telemetry.Default.Publish(telemetry.Ball, now, telemetry.BallValue{
+				Detected: jsonData.IsBallExit, X: jsonData.ImageX, Y: jsonData.ImageY,
+			})
 
 			if jsonData.IsBallExit && !state.PrevBallDetected {
 				if state.DebugCamera && playBallDetectedSound != nil {
@@ -261,3 +384,35 @@ func ReceiveData(done <-chan struct{}, myID uint32, ip string) {
 		}
 	}
 }
+
+// decodeCameraData parses a camera datagram: the binary detection message
+// (internal/camproto), or the legacy JSON of camera processes that predate it.
+func decodeCameraData(buf []byte) (*state.ImageData, error) {
+	if len(buf) > 0 && buf[0] == '{' {
+		data := &state.ImageData{BallIndex: -1}
+		if err := json.Unmarshal(buf, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	d, err := camproto.DecodeDetections(buf)
+	if err != nil {
+		return nil, err
+	}
+	data := &state.ImageData{
+		FrameWidth:  d.Width,
+		FrameHeight: d.Height,
+		Seq:         d.Seq,
+		CaptureTime: d.CaptureTime,
+		Detections:  d.Items,
+		BallIndex:   vision.Default.Select(d.Items),
+	}
+	if data.BallIndex >= 0 {
+		ball := d.Items[data.BallIndex]
+		data.IsBallExit = true
+		data.ImageX = ball.X
+		data.ImageY = ball.Y
+	}
+	return data, nil
+}
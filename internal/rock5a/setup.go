@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
 	"github.com/Yuzz1e/rock5a-gpio-go"
 )
@@ -223,7 +224,7 @@ func RunGPIO(done <-chan struct{}) {
 			if state.Recvdata.Volt <= uint8(alarmVoltage) {
 				handleBatteryAlarm(led2, button1, &alarmVoltage)
 			} else {
-				ledInterval = handleNormalOperation(led, button1, button2, ledInterval)
+				ledInterval = handleNormalOperation(led, led2, button1, button2, ledInterval)
 			}
 		}
 	}
@@ -334,13 +335,24 @@ func playAlarmDismissSound() {
 }
 
 func PlayBallDetectedSound() {
-	for state.ImageDataPtr != nil && state.ImageDataPtr.IsBallExit {
+	for data := state.FreshImageData(); data != nil && data.IsBallExit; data = state.FreshImageData() {
 		RingBuzzer(10, 50*time.Millisecond, 0)
 		time.Sleep(80 * time.Millisecond)
 	}
 }
 
-func handleNormalOperation(led, button1, button2 *gpio.GPIO, ledInterval time.Duration) time.Duration {
+func handleNormalOperation(led, led2, button1, button2 *gpio.GPIO, ledInterval time.Duration) time.Duration {
+	// 自己診断（internal/selftest）中は LED を全点灯する。
+	if link.LEDTest() {
+		setOutput(led, true)
+		setOutput(led2, true)
+		time.Sleep(ledBlinkFast)
+		return ledInterval
+	}
+
+	// LED2 は電池アラーム以外ではコントローラとの接続状態を示す。
+	setOutput(led2, link.ConnectionLED())
+
 	time.Sleep(ledInterval)
 	setOutput(led, true)
 
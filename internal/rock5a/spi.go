@@ -7,7 +7,9 @@ import (
 	"log"
 	"time"
 
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/link"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/motorcal"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
 	"github.com/Rione/ssl-RACOON-Pi2/internal/wheelgraph"
@@ -73,6 +75,9 @@ func processSPICommunication(conn spi.Conn) {
 	pushSPIRxWindow(spiRxWindow[:], rx)
 	frameOffset, frameErr := resolveSPIRxFrame(spiRxWindow[:])
 	isSPIFrameValid = frameErr == nil
+	if frameErr != nil {
+		state.LinkRxErrors.Add(1)
+	}
 	handleSPIFrameValidationChange(frameErr)
 
 	if frameErr == nil {
@@ -83,6 +88,8 @@ func processSPICommunication(conn spi.Conn) {
 		state.BrWheelSpeedRadS = motorRawToWheelMS(state.Recvdata.BrWheelSpeed)
 		state.FrWheelSpeedRadS = motorRawToWheelMS(state.Recvdata.FrWheelSpeed)
 
+		link.ObserveRX()
+
 		if state.DebugWheelGraph {
 			wheelgraph.Record(
 				state.Recvdata.FlWheelSpeed,
@@ -109,7 +116,7 @@ func processSPICommunication(conn spi.Conn) {
 		}
 		log.Printf("[SPI TX] full (%dB): % x", SPIFrameSize, tx)
 		link.LogSendData(sendbytes)
-		if state.DryRun {
+		if state.DryRun.Load() {
 			link.LogSendData(payload)
 		}
 	}
@@ -142,17 +149,19 @@ func parseRecvBufAt(rx []byte, frameOffset int) state.RecvData {
 
 func motorRawToWheelMS(raw int16) float32 {
 	wheelRadS := float32(raw) / 100.0
-	wheelRadiusM := float32(WheelDiameterMm / 2000.0)
+	wheelRadiusM := float32(motorcal.Default.WheelDiameterMm(WheelDiameterMm) / 2000.0)
 	return wheelRadS * wheelRadiusM
 }
 
 func handleSPIFrameValidationChange(frameErr error) {
 	if frameErr != nil && prevSPIFrameValid {
 		log.Printf("SPI recv frame mismatch: %v", frameErr)
+		fault.Raise(fault.CodeLink, "SPI受信フレーム異常")
 		link.RingBuzzerAsync(5, 300*time.Millisecond, 0)
 	}
 	if frameErr == nil && !prevSPIFrameValid {
 		log.Println("SPI recv frame recovered")
+		fault.Clear(fault.CodeLink)
 		link.RingBuzzerAsync(10, 200*time.Millisecond, 0)
 	}
 }
@@ -0,0 +1,90 @@
+// Package routine holds what the scripted robot routines (motor calibration,
+// self-test) share: one background run that can be cancelled and waited for,
+// and the sampling of the wheel speeds while the routine drives the robot.
+package routine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// SamplePeriod is the polling period, about one link cycle.
+const SamplePeriod = 10 * time.Millisecond
+
+// ErrNoSample is returned by Average when no wheel speed was read, i.e. the
+// averaging time is shorter than SamplePeriod.
+var ErrNoSample = errors.New("no wheel speed sample")
+
+// Run is a routine running in the background.
+type Run struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start runs fn in a new goroutine. Its context is cancelled by Cancel and
+// once fn returns.
+func Start(fn func(ctx context.Context)) *Run {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Run{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		defer cancel()
+		fn(ctx)
+	}()
+	return r
+}
+
+// Cancel asks the routine to stop; it does not wait for it.
+func (r *Run) Cancel() {
+	r.cancel()
+}
+
+// Wait blocks until the routine has returned.
+func (r *Run) Wait() {
+	<-r.done
+}
+
+// Sleep waits for d, or returns the context error when ctx ends first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Average reads the wheel speeds every SamplePeriod for d and returns their
+// mean. It fails with ErrNoSample when nothing was read.
+func Average(ctx context.Context, read func() [wheeltrack.NumWheels]float64, d time.Duration) ([wheeltrack.NumWheels]float64, error) {
+	var sum [wheeltrack.NumWheels]float64
+	n := 0
+	tick := time.NewTicker(SamplePeriod)
+	defer tick.Stop()
+	end := time.After(d)
+	for {
+		select {
+		case <-ctx.Done():
+			return sum, ctx.Err()
+		case <-end:
+			if n == 0 {
+				return sum, ErrNoSample
+			}
+			for i := range sum {
+				sum[i] /= float64(n)
+			}
+			return sum, nil
+		case <-tick.C:
+			v := read()
+			for i := range sum {
+				sum[i] += v[i]
+			}
+			n++
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+func TestAverage(t *testing.T) {
+	n := 0.0
+	read := func() [wheeltrack.NumWheels]float64 {
+		n++
+		return [wheeltrack.NumWheels]float64{1, n, -1, 0}
+	}
+	avg, err := Average(context.Background(), read, 5*SamplePeriod)
+	if err != nil || avg[0] != 1 || avg[2] != -1 || avg[1] < 1 {
+		t.Fatalf("Average = %v, %v", avg, err)
+	}
+
+	if _, err := Average(context.Background(), read, 0); !errors.Is(err, ErrNoSample) {
+		t.Fatalf("no sample: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Average(ctx, read, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled: %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	r := Start(func(ctx context.Context) {
+		if Sleep(ctx, time.Hour) == nil {
+			t.Error("sleep not cancelled")
+		}
+	})
+	r.Cancel()
+	r.Wait()
+}
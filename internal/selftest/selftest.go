@@ -0,0 +1,533 @@
+// Package selftest runs the on-robot self-test: a scripted sequence of bench
+// checks that replaces cmd/spi_test, cmd/kick_test and cmd/dip_test for a
+// quick go / no-go before a match.
+//
+// The sequence is link, battery, camera, buzzer and LEDs, then each wheel
+// forward and backward, the dribbler and the kicker capacitor. The last three
+// move the robot or charge the capacitor (Motion) and only run when the test
+// is started with confirmation; otherwise they are skipped and the report is
+// incomplete.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/routine"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// Status of a step.
+const (
+	Pass = "pass"
+	Fail = "fail"
+	Skip = "skip"
+	// Check means the step ran but only a person can tell whether it worked
+	// (buzzer, LEDs, dribbler).
+	Check = "check"
+)
+
+// Result of a report.
+const (
+	ResultPass = "pass"
+	ResultFail = "fail"
+	// ResultIncomplete is a report without failure in which steps were
+	// skipped or that was cancelled.
+	ResultIncomplete = "incomplete"
+)
+
+// States of a report.
+const (
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateCancelled = "cancelled"
+)
+
+var (
+	ErrBusy     = errors.New("a self-test is already running")
+	ErrNotFound = errors.New("no self-test has run")
+	ErrState    = errors.New("the self-test is not running")
+	// ErrNoRobot is returned by Start before the runner is wired to the link.
+	ErrNoRobot = errors.New("the self-test is not available on this build")
+)
+
+// Reading is what the robot reports.
+type Reading struct {
+	// Frames counts the valid frames received from the MCU.
+	Frames   uint64
+	RxErrors uint32
+	TxErrors uint32
+	Volt     float64 // battery (V)
+	CapPower uint8
+	// Wheels are the wheel speeds (m/s) FL, BL, BR, FR.
+	Wheels [wheeltrack.NumWheels]float64
+}
+
+// Command replaces the AI command during the motion steps.
+type Command struct {
+	// VX, VY in m/s and Omega in rad/s, sent without motor compensation.
+	VX, VY, Omega float64
+	Dribble       uint8
+	Charge        bool
+}
+
+// Robot connects the self-test to the robot.
+type Robot struct {
+	Read func() Reading
+	// MotionReady returns why the robot must not move now, nil when it may.
+	MotionReady func() error
+	// Drive sends c to the MCU instead of the AI command; nil hands the robot
+	// back.
+	Drive func(c *Command)
+	// Camera returns the detection rate and the age of the latest detection;
+	// ok is false before the first one.
+	Camera func() (fps float64, age time.Duration, ok bool)
+	// Signal rings the buzzer and lights every LED for about d.
+	Signal func(d time.Duration)
+}
+
+// Config sets the pass criteria.
+type Config struct {
+	// Window is how long the link is watched.
+	Window time.Duration
+	// MinLinkRate is the lowest rate of valid frames (frames/s).
+	MinLinkRate float64
+	// MaxLinkErrors is the highest number of RX/TX errors per valid frame.
+	MaxLinkErrors float64
+	// MinVolt, MaxVolt bound the battery voltage (V).
+	MinVolt, MaxVolt float64
+	// MinCameraFPS is the lowest detection rate; a detection older than
+	// CameraTimeout fails.
+	MinCameraFPS  float64
+	CameraTimeout time.Duration
+	// SignalTime is how long the buzzer and the LEDs are on.
+	SignalTime time.Duration
+
+	// WheelSpeed (m/s) is commanded to every wheel by spinning the robot in
+	// place, forward then backward. A wheel passes within WheelTolerance
+	// (fraction of WheelSpeed) in both directions.
+	WheelSpeed     float64
+	WheelTolerance float64
+	// Settle is the time for the wheels to reach the speed, Sample the
+	// averaging.
+	Settle, Sample time.Duration
+
+	DribblePower uint8
+	DribbleTime  time.Duration
+
+	// MinCapPower is the capacitor reading (MCU units) to reach within
+	// ChargeTimeout.
+	MinCapPower   uint8
+	ChargeTimeout time.Duration
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{
+	Window:         time.Second,
+	MinLinkRate:    50,
+	MaxLinkErrors:  0.05,
+	MinVolt:        float64(state.BatteryLowThreshold) / 10,
+	MaxVolt:        17,
+	MinCameraFPS:   10,
+	CameraTimeout:  time.Second,
+	SignalTime:     time.Second,
+	WheelSpeed:     0.3,
+	WheelTolerance: 0.3,
+	Settle:         500 * time.Millisecond,
+	Sample:         500 * time.Millisecond,
+	DribblePower:   50,
+	DribbleTime:    time.Second,
+	MinCapPower:    100,
+	ChargeTimeout:  10 * time.Second,
+}
+
+// Step is the outcome of one check.
+type Step struct {
+	Name   string `json:"name"`
+	Motion bool   `json:"motion"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Values are the measurements the status is based on.
+	Values     map[string]float64 `json:"values,omitempty"`
+	DurationMs int64              `json:"durationMs"`
+}
+
+// Report is the self-test report.
+type Report struct {
+	State  string `json:"state"`
+	Result string `json:"result,omitempty"`
+	// Confirmed reports whether the motion steps were allowed.
+	Confirmed  bool       `json:"confirmed"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	Board      string     `json:"board"`
+	Version    string     `json:"version"`
+	MAC        string     `json:"mac"`
+	// Current is the check that is running.
+	Current string `json:"current,omitempty"`
+	Steps   []Step `json:"steps"`
+}
+
+// check is one entry of the sequence. run returns a Step per name.
+type check struct {
+	names  []string
+	motion bool
+	run    func(ctx context.Context, r Robot, cfg Config) []Step
+}
+
+func sequence() []check {
+	var wheels []string
+	for _, n := range wheeltrack.WheelNames {
+		wheels = append(wheels, "wheel-"+n)
+	}
+	return []check{
+		{[]string{"link"}, false, checkLink},
+		{[]string{"battery"}, false, checkBattery},
+		{[]string{"camera"}, false, checkCamera},
+		{[]string{"buzzer-led"}, false, checkSignal},
+		{wheels, true, checkWheels},
+		{[]string{"dribbler"}, true, checkDribbler},
+		{[]string{"charge"}, true, checkCharge},
+	}
+}
+
+// checkLink watches the frames received from the MCU. The MCU does not echo
+// frames back, so only the rate of valid frames and the error counters are
+// judged; a frame the MCU drops on its side goes unnoticed.
+func checkLink(ctx context.Context, r Robot, cfg Config) []Step {
+	a := r.Read()
+	if routine.Sleep(ctx, cfg.Window) != nil {
+		return nil
+	}
+	b := r.Read()
+	frames := b.Frames - a.Frames
+	errs := (b.RxErrors - a.RxErrors) + (b.TxErrors - a.TxErrors)
+	rate := float64(frames) / cfg.Window.Seconds()
+	s := Step{Status: Pass, Values: map[string]float64{"rate": rate, "errors": float64(errs)}}
+	switch {
+	case frames == 0:
+		s.Status, s.Detail = Fail, fmt.Sprintf("no valid frame from the MCU (%d errors)", errs)
+	case rate < cfg.MinLinkRate:
+		s.Status, s.Detail = Fail, fmt.Sprintf("%.0f frames/s, want at least %.0f", rate, cfg.MinLinkRate)
+	case float64(errs) > cfg.MaxLinkErrors*float64(frames):
+		s.Status, s.Detail = Fail, fmt.Sprintf("%d errors in %d frames", errs, frames)
+	default:
+		s.Detail = fmt.Sprintf("%.0f frames/s, %d errors", rate, errs)
+	}
+	s.Detail += " (received frames only, no MCU loopback)"
+	return []Step{s}
+}
+
+func checkBattery(ctx context.Context, r Robot, cfg Config) []Step {
+	rd := r.Read()
+	if rd.Frames == 0 {
+		return []Step{{Status: Fail, Detail: "no reading from the MCU"}}
+	}
+	s := Step{Status: Pass, Values: map[string]float64{"volt": rd.Volt}}
+	s.Detail = fmt.Sprintf("%.1f V (%.1f-%.1f V)", rd.Volt, cfg.MinVolt, cfg.MaxVolt)
+	if rd.Volt < cfg.MinVolt || rd.Volt > cfg.MaxVolt {
+		s.Status = Fail
+	}
+	return []Step{s}
+}
+
+func checkCamera(ctx context.Context, r Robot, cfg Config) []Step {
+	fps, age, ok := r.Camera()
+	if !ok {
+		return []Step{{Status: Fail, Detail: "no detection from the camera process"}}
+	}
+	s := Step{Status: Pass, Values: map[string]float64{"fps": fps, "ageMs": float64(age.Milliseconds())}}
+	switch {
+	case age > cfg.CameraTimeout:
+		s.Status, s.Detail = Fail, fmt.Sprintf("no detection for %s", age.Round(time.Millisecond))
+	case fps < cfg.MinCameraFPS:
+		s.Status, s.Detail = Fail, fmt.Sprintf("%.1f fps, want at least %.1f", fps, cfg.MinCameraFPS)
+	default:
+		s.Detail = fmt.Sprintf("%.1f fps", fps)
+	}
+	return []Step{s}
+}
+
+func checkSignal(ctx context.Context, r Robot, cfg Config) []Step {
+	r.Signal(cfg.SignalTime)
+	return []Step{{Status: Check, Detail: "the buzzer sounded and every LED lit: check it"}}
+}
+
+// checkWheels spins the robot in place, which commands every wheel at the
+// same speed: the frame for the MCU only carries the body velocity, so a
+// wheel cannot be run alone and all four are judged on the same spin.
+func checkWheels(ctx context.Context, r Robot, cfg Config) []Step {
+	g := wheeltrack.Default.Config().Geometry
+	defer r.Drive(nil)
+	read := func() [wheeltrack.NumWheels]float64 { return r.Read().Wheels }
+	var got [2][wheeltrack.NumWheels]float64 // forward, backward
+	for k, dir := range []float64{1, -1} {
+		r.Drive(&Command{Omega: dir * cfg.WheelSpeed / g.RadiusM})
+		if routine.Sleep(ctx, cfg.Settle) != nil {
+			return nil
+		}
+		avg, err := routine.Average(ctx, read, cfg.Sample)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			steps := make([]Step, wheeltrack.NumWheels)
+			for i := range steps {
+				steps[i] = Step{Status: Fail, Detail: err.Error()}
+			}
+			return steps
+		}
+		got[k] = avg
+	}
+
+	steps := make([]Step, wheeltrack.NumWheels)
+	for i := range steps {
+		// Compare in the wheel's forward direction.
+		fwd, back := g.Sign(i)*got[0][i], g.Sign(i)*got[1][i]
+		tol := cfg.WheelTolerance * cfg.WheelSpeed
+		s := Step{Status: Pass, Values: map[string]float64{"expected": cfg.WheelSpeed, "forward": fwd, "backward": back}}
+		s.Detail = fmt.Sprintf("forward %.2f m/s, backward %.2f m/s (expected ±%.2f, all wheels spun together)", fwd, back, cfg.WheelSpeed)
+		if math.Abs(fwd-cfg.WheelSpeed) > tol || math.Abs(back+cfg.WheelSpeed) > tol {
+			s.Status = Fail
+		}
+		steps[i] = s
+	}
+	return steps
+}
+
+// checkDribbler spins the dribbler. The MCU reports no dribbler speed, so
+// the battery voltage is recorded as a hint of the load.
+func checkDribbler(ctx context.Context, r Robot, cfg Config) []Step {
+	before := r.Read().Volt
+	r.Drive(&Command{Dribble: cfg.DribblePower})
+	err := routine.Sleep(ctx, cfg.DribbleTime)
+	during := r.Read().Volt
+	r.Drive(nil)
+	if err != nil {
+		return nil
+	}
+	return []Step{{
+		Status: Check,
+		Detail: fmt.Sprintf("power %d for %s: check that the dribbler spun", cfg.DribblePower, cfg.DribbleTime),
+		Values: map[string]float64{"voltBefore": before, "voltDuring": during},
+	}}
+}
+
+// checkCharge charges the kicker capacitor until MinCapPower and stops
+// charging again.
+func checkCharge(ctx context.Context, r Robot, cfg Config) []Step {
+	start := time.Now()
+	from := r.Read().CapPower
+	r.Drive(&Command{Charge: true})
+	defer r.Drive(nil)
+
+	tick := time.NewTicker(routine.SamplePeriod)
+	defer tick.Stop()
+	deadline := time.After(cfg.ChargeTimeout)
+	for {
+		cp := r.Read().CapPower
+		values := map[string]float64{"from": float64(from), "reached": float64(cp), "seconds": time.Since(start).Seconds()}
+		if cp >= cfg.MinCapPower {
+			return []Step{{Status: Pass, Detail: fmt.Sprintf("%d -> %d", from, cp), Values: values}}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline:
+			return []Step{{
+				Status: Fail,
+				Detail: fmt.Sprintf("%d -> %d in %s, want %d", from, cp, cfg.ChargeTimeout, cfg.MinCapPower),
+				Values: values,
+			}}
+		case <-tick.C:
+		}
+	}
+}
+
+// Runner runs one self-test at a time and keeps the last report.
+type Runner struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	robot  Robot
+	cfg    Config
+	report *Report
+	run    *routine.Run
+}
+
+// NewRunner returns a runner that is not wired to a robot.
+func NewRunner() *Runner {
+	return &Runner{now: time.Now, cfg: DefaultConfig}
+}
+
+// Default is the runner of the API and the -selftest flag. The app wires it
+// to the link.
+var Default = NewRunner()
+
+// Configure sets the robot and the pass criteria.
+func (r *Runner) Configure(robot Robot, cfg Config) {
+	r.mu.Lock()
+	r.robot = robot
+	r.cfg = cfg
+	r.mu.Unlock()
+}
+
+// Start starts the sequence. The motion steps only run when confirmed.
+func (r *Runner) Start(confirmed bool) (Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.report != nil && r.report.State == StateRunning {
+		return *r.report, ErrBusy
+	}
+	if r.robot.Read == nil {
+		return Report{}, ErrNoRobot
+	}
+
+	r.report = &Report{
+		State:     StateRunning,
+		Confirmed: confirmed,
+		StartedAt: r.now(),
+		Board:     state.BoardName,
+		Version:   state.SoftwareVersion,
+		MAC:       state.MACAddress,
+		Steps:     []Step{},
+	}
+	log.Printf("Self-test started (motion confirmed: %v)", confirmed)
+	robot, cfg := r.robot, r.cfg
+	r.run = routine.Start(func(ctx context.Context) { r.test(ctx, robot, cfg, confirmed) })
+	return r.copyReport(), nil
+}
+
+func (r *Runner) test(ctx context.Context, robot Robot, cfg Config, confirmed bool) {
+	for _, c := range sequence() {
+		r.update(func(rep *Report) { rep.Current = c.names[0] })
+		start := r.now()
+		var steps []Step
+		if why := c.skip(robot, confirmed); why != "" {
+			steps = skipped(c, why)
+		} else {
+			steps = c.run(ctx, robot, cfg)
+		}
+		if ctx.Err() != nil {
+			r.finish(StateCancelled)
+			return
+		}
+		took := r.now().Sub(start).Milliseconds()
+		for i := range steps {
+			steps[i].Name = c.names[i]
+			steps[i].Motion = c.motion
+			steps[i].DurationMs = took
+			log.Printf("Self-test %s: %s %s", steps[i].Name, steps[i].Status, steps[i].Detail)
+		}
+		r.update(func(rep *Report) { rep.Steps = append(rep.Steps, steps...) })
+	}
+	r.finish(StateDone)
+}
+
+// skip returns why c must not run, "" when it may.
+func (c check) skip(robot Robot, confirmed bool) string {
+	if !c.motion {
+		return ""
+	}
+	if !confirmed {
+		return "motion steps need confirmation"
+	}
+	if err := robot.MotionReady(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func skipped(c check, why string) []Step {
+	steps := make([]Step, len(c.names))
+	for i := range steps {
+		steps[i] = Step{Status: Skip, Detail: why}
+	}
+	return steps
+}
+
+func (r *Runner) update(fn func(rep *Report)) {
+	r.mu.Lock()
+	fn(r.report)
+	r.mu.Unlock()
+}
+
+func (r *Runner) finish(st string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.now()
+	rep := r.report
+	rep.State = st
+	rep.FinishedAt = &t
+	rep.Current = ""
+	rep.Result = ResultPass
+	if st != StateDone {
+		rep.Result = ResultIncomplete
+	}
+	for _, s := range rep.Steps {
+		switch {
+		case s.Status == Fail:
+			rep.Result = ResultFail
+		case s.Status == Skip && rep.Result == ResultPass:
+			rep.Result = ResultIncomplete
+		}
+	}
+	log.Printf("Self-test %s: %s", st, rep.Result)
+}
+
+// copyReport returns a copy that the caller may keep. Called with r.mu held.
+func (r *Runner) copyReport() Report {
+	rep := *r.report
+	rep.Steps = append([]Step{}, rep.Steps...)
+	return rep
+}
+
+// Report returns the current or last report.
+func (r *Runner) Report() (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.report == nil {
+		return Report{}, false
+	}
+	return r.copyReport(), true
+}
+
+// Running reports whether a self-test runs.
+func (r *Runner) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report != nil && r.report.State == StateRunning
+}
+
+// Wait blocks until the running self-test ends and returns its report.
+func (r *Runner) Wait() (Report, error) {
+	r.mu.Lock()
+	run := r.run
+	r.mu.Unlock()
+	if run == nil {
+		return Report{}, ErrNotFound
+	}
+	run.Wait()
+	rep, _ := r.Report()
+	return rep, nil
+}
+
+// Cancel stops the running self-test; the robot is handed back at once.
+func (r *Runner) Cancel() (Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.report == nil {
+		return Report{}, ErrNotFound
+	}
+	if r.report.State != StateRunning {
+		return r.copyReport(), ErrState
+	}
+	r.run.Cancel()
+	return r.copyReport(), nil
+}
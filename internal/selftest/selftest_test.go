@@ -0,0 +1,206 @@
+package selftest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
+)
+
+// fakeRobot turns its wheels at the commanded speed times gain and charges
+// the capacitor by 10 per reading while charging.
+type fakeRobot struct {
+	mu      sync.Mutex
+	gain    [wheeltrack.NumWheels]float64
+	volt    float64
+	frames  uint64
+	cmd     *Command
+	cap     uint8
+	drives  int
+	signals int
+	ready   error
+}
+
+func newFakeRobot() *fakeRobot {
+	return &fakeRobot{gain: [wheeltrack.NumWheels]float64{1, 1, 1, 1}, volt: 15.5}
+}
+
+func (f *fakeRobot) robot() Robot {
+	return Robot{
+		Read: func() Reading {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.frames += 10
+			rd := Reading{Frames: f.frames, Volt: f.volt, CapPower: f.cap}
+			if f.cmd != nil {
+				radius := wheeltrack.Default.Config().Geometry.RadiusM
+				for i, g := range f.gain {
+					rd.Wheels[i] = g * radius * f.cmd.Omega
+				}
+				if f.cmd.Charge && f.cap < 250 {
+					f.cap += 10
+				}
+			}
+			return rd
+		},
+		MotionReady: func() error { return f.ready },
+		Drive: func(c *Command) {
+			f.mu.Lock()
+			f.cmd = c
+			f.drives++
+			f.mu.Unlock()
+		},
+		Camera: func() (float64, time.Duration, bool) { return 30, 20 * time.Millisecond, true },
+		Signal: func(time.Duration) {
+			f.mu.Lock()
+			f.signals++
+			f.mu.Unlock()
+		},
+	}
+}
+
+var fastConfig = func() Config {
+	c := DefaultConfig
+	c.Window = 20 * time.Millisecond
+	c.MinLinkRate = 100
+	c.Settle = 5 * time.Millisecond
+	c.Sample = 30 * time.Millisecond
+	c.DribbleTime = 5 * time.Millisecond
+	c.ChargeTimeout = time.Second
+	return c
+}()
+
+func run(t *testing.T, f *fakeRobot, cfg Config, confirmed bool) Report {
+	t.Helper()
+	r := NewRunner()
+	r.Configure(f.robot(), cfg)
+	if _, err := r.Start(confirmed); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := r.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+func statuses(rep Report) map[string]string {
+	m := map[string]string{}
+	for _, s := range rep.Steps {
+		m[s.Name] = s.Status
+	}
+	return m
+}
+
+func TestUnconfirmed(t *testing.T) {
+	f := newFakeRobot()
+	rep := run(t, f, fastConfig, false)
+	if rep.State != StateDone || rep.Result != ResultIncomplete || len(rep.Steps) != 10 {
+		t.Fatalf("report = %+v", rep)
+	}
+	for _, s := range rep.Steps {
+		want := Pass
+		switch {
+		case s.Motion:
+			want = Skip
+		case s.Name == "buzzer-led":
+			want = Check
+		}
+		if s.Status != want {
+			t.Errorf("%s: %s (%s), want %s", s.Name, s.Status, s.Detail, want)
+		}
+	}
+	if f.drives != 0 || f.signals != 1 {
+		t.Fatalf("drives %d, signals %d", f.drives, f.signals)
+	}
+}
+
+func TestConfirmed(t *testing.T) {
+	f := newFakeRobot()
+	rep := run(t, f, fastConfig, true)
+	if rep.Result != ResultPass {
+		t.Fatalf("report = %+v", rep)
+	}
+	st := statuses(rep)
+	if st["wheel-FL"] != Pass || st["dribbler"] != Check || st["charge"] != Pass {
+		t.Fatalf("steps = %v", st)
+	}
+	if f.cmd != nil {
+		t.Fatal("robot not handed back")
+	}
+
+	// A stopped wheel, a reversed one and a low battery fail.
+	f = newFakeRobot()
+	f.gain[wheeltrack.BR] = 0
+	f.gain[wheeltrack.FR] = -1
+	f.volt = 13.2
+	rep = run(t, f, fastConfig, true)
+	st = statuses(rep)
+	if rep.Result != ResultFail || st["wheel-BR"] != Fail || st["wheel-FR"] != Fail || st["wheel-FL"] != Pass || st["battery"] != Fail {
+		t.Fatalf("steps = %v", st)
+	}
+
+	// A wheel that turns the other way passes once it is marked inverted.
+	defer wheeltrack.Default.Configure(wheeltrack.Default.Config())
+	cfg := wheeltrack.Default.Config()
+	cfg.Geometry.Inverted[wheeltrack.FR] = true
+	wheeltrack.Default.Configure(cfg)
+	f = newFakeRobot()
+	f.gain[wheeltrack.FR] = -1
+	if st := statuses(run(t, f, fastConfig, true)); st["wheel-FR"] != Pass {
+		t.Fatalf("inverted FR: %v", st)
+	}
+
+	// Averaging without a sample fails the wheels instead of reading 0.
+	noSample := fastConfig
+	noSample.Sample = 0
+	if st := statuses(run(t, newFakeRobot(), noSample, true)); st["wheel-FL"] != Fail || st["charge"] != Pass {
+		t.Fatalf("no sample: %v", st)
+	}
+
+	// Not ready to move: skipped, nothing driven.
+	f = newFakeRobot()
+	f.ready = errors.New("remote e-stop is active")
+	rep = run(t, f, fastConfig, true)
+	if rep.Result != ResultIncomplete || statuses(rep)["charge"] != Skip || f.drives != 0 {
+		t.Fatalf("report = %+v", rep)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	r := NewRunner()
+	if _, err := r.Start(true); !errors.Is(err, ErrNoRobot) {
+		t.Fatalf("start without robot: %v", err)
+	}
+
+	f := newFakeRobot()
+	cfg := fastConfig
+	cfg.Settle = time.Hour
+	r.Configure(f.robot(), cfg)
+	if _, err := r.Start(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Start(true); !errors.Is(err, ErrBusy) {
+		t.Fatalf("second start: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if rep, _ := r.Report(); rep.Current == "wheel-FL" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("wheels not reached")
+		}
+	}
+	if _, err := r.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	rep, _ := r.Wait()
+	if rep.State != StateCancelled || rep.Result != ResultIncomplete || f.cmd != nil {
+		t.Fatalf("report = %+v, command %+v", rep, f.cmd)
+	}
+	if _, err := r.Cancel(); !errors.Is(err, ErrState) {
+		t.Fatalf("second cancel: %v", err)
+	}
+}
@@ -1,24 +1,31 @@
 package state
 
 import (
-	"net"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
 )
 
 const (
 	BatteryLowThreshold      = 140
 	BatteryCriticalThreshold = 135
+	// BatteryClearThreshold は電池の故障を解除する電圧（0.1V 単位）。しきい値付近で
+	// 故障が出たり消えたりしないよう、低電圧しきい値より高くしている。
+	BatteryClearThreshold = BatteryLowThreshold + 3
 
 	Port          = ":9191"
 	UDPRecvPort   = 20011
 	UDPCameraPort = 31133
-	CalibPort     = 31134
-	TunerPort     = 31135
-	MulticastAddr = "224.5.69.4"
-	MulticastPort = "16941"
-	PCRecvPort    = 16941
+	// UDPCameraFramePort はカメラプロセスの JPEG フレーム購読ポート（internal/camframe）。
+	UDPCameraFramePort = 31136
+	// CameraControlPort はカメラプロセスの制御チャネル（internal/camctl）。
+	CameraControlPort = 31137
+	MulticastAddr     = "224.5.69.4"
+	MulticastPort     = "16941"
+	PCRecvPort        = 16941
 
 	KickHoldDuration  = 500 * time.Millisecond
 	NoRecvTimeout     = 1 * time.Second
@@ -38,12 +45,6 @@ const (
 	PowerCmdShutdown = 0x99
 )
 
-const (
-	StateDiscovering = 0
-	StateOffered     = 1
-	StateConnected   = 2
-)
-
 // AtomicTime は time.Time を複数goroutineからロックなしで読み書きするためのラッパ。
 type AtomicTime struct {
 	nano atomic.Int64
@@ -55,6 +56,15 @@ func (a *AtomicTime) Since() time.Duration {
 	return time.Duration(time.Now().UnixNano() - a.nano.Load())
 }
 
+// AtomicFloat32 は float32 をロックなしで読み書きするためのラッパ。
+type AtomicFloat32 struct {
+	bits atomic.Uint32
+}
+
+func (a *AtomicFloat32) Store(v float32) { a.bits.Store(math.Float32bits(v)) }
+
+func (a *AtomicFloat32) Load() float32 { return math.Float32frombits(a.bits.Load()) }
+
 var (
 	sendPayloadMu sync.RWMutex
 	sendPayload   []byte
@@ -116,20 +126,59 @@ var (
 	ImuError bool = false
 )
 
+// 接続状態そのものは internal/connmgr が管理する。
 var (
-	StateMu         sync.Mutex
-	ConnectionState int = StateDiscovering
-	PcAddress       *net.UDPAddr
-	LastRecvTime    AtomicTime // OFFER/OK_PC/DATA/KEEP_ALIVE。接続生存・充電停止用
+	LastRecvTime    AtomicTime // OFFER/OK_PC/DATA/KEEP_ALIVE。充電停止用
 	LastCmdRecvTime AtomicTime // DATA(0x06)のみ。速度クリアのフェイルセーフ用
 )
 
+// LastCameraRecvTime is when the last camera detection packet arrived.
+var LastCameraRecvTime AtomicTime
+
 func init() {
 	now := time.Now()
 	LastRecvTime.Store(now)
 	LastCmdRecvTime.Store(now)
 }
 
+// StartTime is when the process started. Used for the uptime diagnostic.
+var StartTime = time.Now()
+
+// Diagnostics reported to the MW in PiToMw.diagnostics.
+var (
+	// SoftwareVersion is the release version embedded at build time. Set once at
+	// startup from the upgrade package.
+	SoftwareVersion string
+	// BoardName is "pi4" or "rock5a". Set by the board-specific registerPlatform.
+	BoardName string
+
+	LinkRxErrors atomic.Uint32
+	LinkTxErrors atomic.Uint32
+	// LinkRxFrames counts the valid frames received from the MCU.
+	LinkRxFrames atomic.Uint64
+
+	CameraFPS AtomicFloat32
+)
+
+const (
+	CameraProcessStopped    = 0
+	CameraProcessRunning    = 1
+	CameraProcessExited     = 2
+	CameraProcessRestarting = 3
+)
+
+// CameraProcessState is one of the CameraProcess* constants.
+var CameraProcessState atomic.Int32
+
+// RemoteEmgStop is set by an Estop command from the controller channel or the
+// API. While true every motion field is zeroed and InfoEmgStop is sent to the
+// MCU. Written by the API goroutines and read by the link loop every cycle.
+var RemoteEmgStop atomic.Bool
+
+// DryRun keeps motion commands off serial/SPI (-dryrun, /dryrun/0|1). The API
+// switches it at runtime while the link loop reads it.
+var DryRun atomic.Bool
+
 var (
 	IsRobotError      = false
 	RobotErrorCode    = 0
@@ -159,30 +208,68 @@ func ApplyMissingBallCoords(data *ImageData) {
 	data.ImageY = BallCoordMissing
 }
 
+// ImageData は 1 フレーム分の検出結果。JSON タグは旧 JSON 形式のカメラプロセス用。
 type ImageData struct {
+	// ReceivedAt は Go 側で受信した時刻。鮮度の判定に使う（FreshImageData）。
+	ReceivedAt time.Time `json:"-"`
+
 	IsBallExit  bool    `json:"isball"`
 	ImageX      float32 `json:"x"`
 	ImageY      float32 `json:"y"`
-	Frame       string  `json:"frame"`
 	FrameWidth  int     `json:"frameWidth"`
 	FrameHeight int     `json:"frameHeight"`
+
+	// Seq / CaptureTime / Detections はバイナリ形式（internal/camproto）のみ。
+	// BallIndex は Detections のうち追跡対象に選んだボール（なければ -1）。
+	Seq         uint32               `json:"-"`
+	CaptureTime time.Time            `json:"-"`
+	Detections  []camproto.Detection `json:"-"`
+	BallIndex   int                  `json:"-"`
 }
 
 var ImageDataPtr *ImageData
-var PrevBallDetected bool
 
-type ImageResponse struct {
-	Frame string `json:"frame"`
+// CameraStaleTimeout を過ぎた検出結果はボールなしとして扱う（config.json の
+// camera.staleTimeoutMs で変更可）。
+var CameraStaleTimeout = 500 * time.Millisecond
+
+// CameraSmoothMCU は MCU に生の検出座標ではなく追跡フィルタ（internal/balltrack）
+// の推定座標を送る（config.json の camera.tracker.smoothMcu）。
+var CameraSmoothMCU bool
+
+// FreshImageData は最新の検出結果を返す。CameraStaleTimeout より古ければ
+// ボール未検出に置き換えたコピーを返す（カメラプロセスが止まっても古い座標を
+// 使い続けないため）。まだ一度も受信していなければ nil。
+func FreshImageData() *ImageData {
+	data := ImageDataPtr
+	if data == nil || time.Since(data.ReceivedAt) <= CameraStaleTimeout {
+		return data
+	}
+	stale := *data
+	stale.IsBallExit = false
+	stale.ImageX = BallCoordMissing
+	stale.ImageY = BallCoordMissing
+	stale.Detections = nil
+	stale.BallIndex = -1
+	return &stale
+}
+
+// CameraAge は最新の検出結果を受信してからの経過時間。未受信なら ok=false。
+func CameraAge() (age time.Duration, ok bool) {
+	data := ImageDataPtr
+	if data == nil {
+		return 0, false
+	}
+	return time.Since(data.ReceivedAt), true
 }
 
-var ImageResponseData ImageResponse
+var PrevBallDetected bool
 
 var (
 	DebugSerial      bool = false
 	DebugReceive     bool = false
 	DebugCamera      bool = false
 	DebugWheelGraph  bool = false
-	DryRun       bool = false
 	VelX1000     bool = false
 
 	PowerShutdownMode bool = false
@@ -0,0 +1,49 @@
+// Package sysinfo reads host health values (CPU temperature) for diagnostics.
+package sysinfo
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	thermalZonePath = "/sys/class/thermal/thermal_zone0/temp"
+	// The status stream is sent at 60 Hz; sysfs is re-read at most this often.
+	cacheDuration = time.Second
+)
+
+var (
+	mu        sync.Mutex
+	lastRead  time.Time
+	lastTemp  float32
+	lastValid bool
+)
+
+// CPUTemperature returns the SoC temperature in °C. ok is false when the
+// thermal zone is not available (e.g. on a development PC).
+func CPUTemperature() (celsius float32, ok bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if time.Since(lastRead) < cacheDuration {
+		return lastTemp, lastValid
+	}
+	lastRead = time.Now()
+
+	data, err := os.ReadFile(thermalZonePath)
+	if err != nil {
+		lastValid = false
+		return 0, false
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		lastValid = false
+		return 0, false
+	}
+	lastTemp = float32(milli) / 1000
+	lastValid = true
+	return lastTemp, true
+}
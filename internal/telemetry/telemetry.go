@@ -0,0 +1,261 @@
+// Package telemetry publishes live robot data to subscribers of the
+// /telemetry stream (server-sent events) of the HTTP API.
+//
+// Producers call Publish for every new value of a channel: the MCU link once
+// per cycle (wheels, wheel tracking error, battery, capacitor, sensors,
+// commanded velocity) and the camera receiver once per detection packet
+// (ball). Each subscriber chooses its channels and a rate per channel; faster
+// sources are decimated to that rate. Publishing never blocks: a subscriber
+// that does not keep up loses samples and they are counted in Dropped.
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Channel names.
+const (
+	WheelRaw = "wheelRaw" // WheelRawValue: MCU wheel speeds as received
+	WheelMS  = "wheelMs"  // WheelMSValue: wheel speeds in m/s
+	WheelErr = "wheelErr" // WheelMSValue: commanded - measured wheel speeds in m/s
+	Battery  = "battery"  // BatteryValue
+	Cap      = "cap"      // CapValue: kicker capacitor
+	Sensors  = "sensors"  // SensorsValue: photo / dribbler sensors
+	CmdVel   = "cmdVel"   // CmdVelValue: velocity sent to the MCU
+	Ball     = "ball"     // BallValue: camera detection
+)
+
+// Channels lists every channel.
+var Channels = []string{WheelRaw, WheelMS, WheelErr, Battery, Cap, Sensors, CmdVel, Ball}
+
+// WheelRawValue is the WheelRaw channel.
+type WheelRawValue struct {
+	FL int16 `json:"fl"`
+	BL int16 `json:"bl"`
+	BR int16 `json:"br"`
+	FR int16 `json:"fr"`
+}
+
+// WheelMSValue is the WheelMS and the WheelErr channel.
+type WheelMSValue struct {
+	FL float32 `json:"fl"`
+	BL float32 `json:"bl"`
+	BR float32 `json:"br"`
+	FR float32 `json:"fr"`
+}
+
+// BatteryValue is the Battery channel.
+type BatteryValue struct {
+	Volt float32 `json:"volt"`
+}
+
+// CapValue is the Cap channel.
+type CapValue struct {
+	Power uint8 `json:"power"`
+}
+
+// SensorsValue is the Sensors channel.
+type SensorsValue struct {
+	Photo    bool `json:"photo"`
+	Dribbler bool `json:"dribbler"`
+}
+
+// CmdVelValue is the CmdVel channel: m/s and rad/s.
+type CmdVelValue struct {
+	VX    float32 `json:"vx"`
+	VY    float32 `json:"vy"`
+	Omega float32 `json:"omega"`
+}
+
+// BallValue is the Ball channel: image coordinates relative to the centre.
+type BallValue struct {
+	Detected bool    `json:"detected"`
+	X        float32 `json:"x"`
+	Y        float32 `json:"y"`
+}
+
+// Sample is one published value.
+type Sample struct {
+	Channel string
+	Time    time.Time
+	Value   any
+}
+
+// Config limits the subscriptions.
+type Config struct {
+	// Rate is the per-channel rate (Hz) of a subscription that gives none.
+	Rate float64
+	// MaxRate caps the requested rates.
+	MaxRate float64
+	// MaxClients limits concurrent subscriptions.
+	MaxClients int
+	// Buffer is the number of samples queued per subscriber.
+	Buffer int
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{Rate: 20, MaxRate: 200, MaxClients: 4, Buffer: 256}
+
+var (
+	// ErrTooManyClients is returned by Subscribe when MaxClients are
+	// subscribed.
+	ErrTooManyClients = errors.New("too many telemetry clients")
+	// ErrUnknownChannel is returned by Subscribe for a channel not in
+	// Channels.
+	ErrUnknownChannel = errors.New("unknown telemetry channel")
+)
+
+// Hub distributes samples to subscriptions. It is safe for concurrent use.
+type Hub struct {
+	mu   sync.Mutex
+	cfg  Config
+	subs map[*Subscription]struct{}
+	// active is len(subs), readable without the lock so that producers skip
+	// building samples while nobody listens.
+	active atomic.Int32
+}
+
+// New returns a hub with the given configuration.
+func New(cfg Config) *Hub {
+	return &Hub{cfg: cfg, subs: map[*Subscription]struct{}{}}
+}
+
+// Default is the hub of the /telemetry API.
+var Default = New(DefaultConfig)
+
+// Configure replaces the configuration. Existing subscriptions keep their
+// rates.
+func (h *Hub) Configure(cfg Config) {
+	h.mu.Lock()
+	h.cfg = cfg
+	h.mu.Unlock()
+}
+
+// Config returns the current configuration.
+func (h *Hub) Config() Config {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cfg
+}
+
+// Active reports whether anybody is subscribed.
+func (h *Hub) Active() bool {
+	return h.active.Load() > 0
+}
+
+// Subscription receives the samples of its channels on C.
+type Subscription struct {
+	C <-chan Sample
+
+	c     chan Sample
+	rates map[string]float64
+	// next is the earliest time of the next sample per channel.
+	next    map[string]time.Time
+	dropped atomic.Uint64
+}
+
+// Rates returns the effective rate (Hz) per subscribed channel.
+func (s *Subscription) Rates() map[string]float64 {
+	return s.rates
+}
+
+// Dropped returns the number of samples lost because C was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Subscribe starts a subscription. rates maps channels to Hz; a rate <= 0
+// uses the configured default and every rate is capped to MaxRate. An empty
+// map subscribes to all channels.
+func (h *Hub) Subscribe(rates map[string]float64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs) >= h.cfg.MaxClients {
+		return nil, ErrTooManyClients
+	}
+	if len(rates) == 0 {
+		rates = map[string]float64{}
+		for _, ch := range Channels {
+			rates[ch] = 0
+		}
+	}
+	s := &Subscription{
+		c:     make(chan Sample, h.cfg.Buffer),
+		rates: map[string]float64{},
+		next:  map[string]time.Time{},
+	}
+	s.C = s.c
+	for ch, hz := range rates {
+		if !known(ch) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownChannel, ch)
+		}
+		if hz <= 0 {
+			hz = h.cfg.Rate
+		}
+		s.rates[ch] = min(hz, h.cfg.MaxRate)
+	}
+	h.subs[s] = struct{}{}
+	h.active.Store(int32(len(h.subs)))
+	return s, nil
+}
+
+// Unsubscribe ends a subscription and closes its channel.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	h.active.Store(int32(len(h.subs)))
+	close(s.c)
+}
+
+// Publish offers a value of channel at time t to every subscription of the
+// channel whose rate allows another sample.
+func (h *Hub) Publish(channel string, t time.Time, value any) {
+	if !h.Active() {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		hz, ok := s.rates[channel]
+		if !ok {
+			continue
+		}
+		next := s.next[channel]
+		if t.Before(next) {
+			continue
+		}
+		// Advancing from the previous deadline keeps the average rate even
+		// when the source interval does not divide the requested one.
+		interval := time.Duration(float64(time.Second) / hz)
+		next = next.Add(interval)
+		if !t.Before(next) {
+			next = t.Add(interval)
+		}
+		s.next[channel] = next
+
+		select {
+		case s.c <- Sample{Channel: channel, Time: t, Value: value}:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+func known(channel string) bool {
+	for _, ch := range Channels {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func drain(s *Subscription) map[string]int {
+	counts := map[string]int{}
+	for {
+		select {
+		case sample, ok := <-s.C:
+			if !ok {
+				return counts
+			}
+			counts[sample.Channel]++
+		default:
+			return counts
+		}
+	}
+}
+
+func TestDecimation(t *testing.T) {
+	h := New(Config{Rate: 20, MaxRate: 200, MaxClients: 2, Buffer: 1000})
+	h.Publish(WheelRaw, time.Now(), WheelRawValue{}) // nobody listens
+
+	s, err := h.Subscribe(map[string]float64{WheelRaw: 30, Battery: 0, Ball: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Rates(); r[WheelRaw] != 30 || r[Battery] != 20 || r[Ball] != 200 {
+		t.Fatalf("rates = %v", r)
+	}
+
+	// One second of a 100 Hz link and a 30 Hz camera.
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		now := t0.Add(time.Duration(i) * 10 * time.Millisecond)
+		h.Publish(WheelRaw, now, WheelRawValue{FL: int16(i)})
+		h.Publish(Battery, now, BatteryValue{Volt: 15})
+		h.Publish(Sensors, now, SensorsValue{})
+		if i%3 == 0 {
+			h.Publish(Ball, now, BallValue{})
+		}
+	}
+	counts := drain(s)
+	if counts[WheelRaw] != 30 || counts[Battery] != 20 || counts[Ball] != 34 || counts[Sensors] != 0 {
+		t.Fatalf("counts = %v", counts)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h := New(Config{Rate: 20, MaxRate: 200, MaxClients: 1, Buffer: 2})
+	if _, err := h.Subscribe(map[string]float64{"gyro": 10}); !errors.Is(err, ErrUnknownChannel) {
+		t.Fatalf("unknown channel: %v", err)
+	}
+	s, err := h.Subscribe(nil)
+	if err != nil || len(s.Rates()) != len(Channels) {
+		t.Fatalf("all channels: %v, %v", s, err)
+	}
+	if _, err := h.Subscribe(nil); !errors.Is(err, ErrTooManyClients) {
+		t.Fatalf("second client: %v", err)
+	}
+
+	// A full buffer drops instead of blocking the producer.
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		h.Publish(Cap, t0.Add(time.Duration(i)*time.Second), CapValue{})
+	}
+	if s.Dropped() != 3 {
+		t.Fatalf("dropped = %d", s.Dropped())
+	}
+
+	h.Unsubscribe(s)
+	h.Unsubscribe(s)
+	if h.Active() {
+		t.Fatal("still active")
+	}
+	if drain(s)[Cap] != 2 {
+		t.Fatal("queued samples lost on unsubscribe")
+	}
+	if _, ok := <-s.C; ok {
+		t.Fatal("channel not closed")
+	}
+}
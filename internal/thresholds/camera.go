@@ -0,0 +1,337 @@
+package thresholds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+)
+
+// Boards with a camera backend (RACOON_BOARD of the camera process).
+const (
+	BoardPi4    = "pi4"    // Picamera2 (libcamera controls)
+	BoardRock5A = "rock5a" // OpenCV V4L2 + v4l2-ctl sensor controls
+)
+
+// CameraSettings are the capture settings kept in threshold.json next to the
+// thresholds. nil (null in JSON) means the camera process default.
+type CameraSettings struct {
+	// Exposure is the exposure time in µs on pi4 and the sensor exposure
+	// control (lines) on rock5a.
+	Exposure *int `json:"exposure"`
+	// Gain is the analogue gain (1.0-16.0) on pi4 and the sensor gain control
+	// on rock5a.
+	Gain         *float64 `json:"gain"`
+	AutoExposure *bool    `json:"autoExposure"`
+	// ColorGains is the white balance: red/blue colour gains on pi4 (manual
+	// white balance, nil = auto) and B,G,R software multipliers on rock5a.
+	ColorGains []float64 `json:"colorGains"`
+	Flip180    *bool     `json:"flip180"`
+	Width      *int      `json:"width"`
+	Height     *int      `json:"height"`
+	FPS        *int      `json:"fps"`
+	// Device is the /dev/video index (rock5a only).
+	Device *int `json:"device"`
+}
+
+// CameraLimits are the accepted ranges of one board.
+type CameraLimits struct {
+	Exposure   [2]int     `json:"exposure"`
+	Gain       [2]float64 `json:"gain"`
+	GainInt    bool       `json:"gainInteger"`
+	ColorGains int        `json:"colorGains"` // number of values
+	ColorGain  [2]float64 `json:"colorGain"`
+	Width      [2]int     `json:"width"`
+	Height     [2]int     `json:"height"`
+	FPS        [2]int     `json:"fps"`
+	Device     bool       `json:"device"`
+}
+
+// CameraBoardLimits lists the limits per board. The rock5a ranges cover both
+// supported sensors; the camera process clamps to the detected one (see
+// camera/sensor.py).
+var CameraBoardLimits = map[string]CameraLimits{
+	BoardPi4: {
+		Exposure:   [2]int{10, 1000000},
+		Gain:       [2]float64{1, 16},
+		ColorGains: 2,
+		ColorGain:  [2]float64{0, 32},
+		Width:      [2]int{64, 3280},
+		Height:     [2]int{64, 2464},
+		FPS:        [2]int{1, 120},
+	},
+	BoardRock5A: {
+		Exposure:   [2]int{1, 4095},
+		Gain:       [2]float64{16, 43663},
+		GainInt:    true,
+		ColorGains: 3,
+		ColorGain:  [2]float64{0, 4},
+		Width:      [2]int{64, 4096},
+		Height:     [2]int{64, 3072},
+		FPS:        [2]int{1, 120},
+		Device:     true,
+	},
+}
+
+// cameraKeys maps the CameraSettings fields to their threshold.json keys
+// (the names camera/capture and camera/sensor.py read).
+var cameraKeys = []struct {
+	name, key string
+}{
+	{"exposure", "cameraExposure"},
+	{"gain", "cameraGain"},
+	{"autoExposure", "cameraAutoExposure"},
+	{"colorGains", "cameraColorGains"},
+	{"flip180", "cameraFlip180"},
+	{"width", "frameWidth"},
+	{"height", "frameHeight"},
+	{"fps", "fps"},
+	{"device", "cameraDevice"},
+}
+
+// Set parses value into the setting called name. "default" clears it. c is
+// unchanged on error.
+func (c *CameraSettings) Set(name, value string) error {
+	clear := value == "default"
+	next := *c
+	var err error
+	switch name {
+	case "exposure":
+		next.Exposure, err = parseOptional(value, clear, strconv.Atoi)
+	case "gain":
+		next.Gain, err = parseOptional(value, clear, func(s string) (float64, error) {
+			return strconv.ParseFloat(s, 64)
+		})
+	case "autoExposure":
+		next.AutoExposure, err = parseOptional(value, clear, parseBool)
+	case "colorGains":
+		next.ColorGains = nil
+		if !clear {
+			next.ColorGains, err = parseFloatList(value)
+		}
+	case "flip180":
+		next.Flip180, err = parseOptional(value, clear, parseBool)
+	case "width":
+		next.Width, err = parseOptional(value, clear, strconv.Atoi)
+	case "height":
+		next.Height, err = parseOptional(value, clear, strconv.Atoi)
+	case "fps":
+		next.FPS, err = parseOptional(value, clear, strconv.Atoi)
+	case "device":
+		next.Device, err = parseOptional(value, clear, strconv.Atoi)
+	default:
+		return fmt.Errorf("unknown camera setting %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", name, value)
+	}
+	*c = next
+	return nil
+}
+
+func parseOptional[T any](value string, clear bool, parse func(string) (T, error)) (*T, error) {
+	if clear {
+		return nil, nil
+	}
+	v, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// parseBool accepts the forms camera/frame_post.py does.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+func parseFloatList(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	out := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// Validate checks the settings against the limits of board.
+func (c CameraSettings) Validate(board string) error {
+	l, ok := CameraBoardLimits[board]
+	if !ok {
+		return fmt.Errorf("unknown board %q", board)
+	}
+	inRange := func(name string, v *int, r [2]int) error {
+		if v != nil && (*v < r[0] || *v > r[1]) {
+			return fmt.Errorf("%s must be within %d-%d on %s", name, r[0], r[1], board)
+		}
+		return nil
+	}
+	for _, check := range []error{
+		inRange("exposure", c.Exposure, l.Exposure),
+		inRange("width", c.Width, l.Width),
+		inRange("height", c.Height, l.Height),
+		inRange("fps", c.FPS, l.FPS),
+	} {
+		if check != nil {
+			return check
+		}
+	}
+	if g := c.Gain; g != nil {
+		// Written so that NaN, which ParseFloat accepts, is out of range.
+		if !(*g >= l.Gain[0] && *g <= l.Gain[1]) {
+			return fmt.Errorf("gain must be within %g-%g on %s", l.Gain[0], l.Gain[1], board)
+		}
+		if l.GainInt && *g != float64(int(*g)) {
+			return fmt.Errorf("gain must be an integer on %s", board)
+		}
+	}
+	if c.ColorGains != nil {
+		if len(c.ColorGains) != l.ColorGains {
+			return fmt.Errorf("colorGains must have %d values on %s", l.ColorGains, board)
+		}
+		for _, v := range c.ColorGains {
+			if !(v >= l.ColorGain[0] && v <= l.ColorGain[1]) {
+				return fmt.Errorf("colorGains must be within %g-%g on %s", l.ColorGain[0], l.ColorGain[1], board)
+			}
+		}
+	}
+	if (c.Width == nil) != (c.Height == nil) {
+		return errors.New("width and height must be set together")
+	}
+	if c.Device != nil {
+		if !l.Device {
+			return fmt.Errorf("device cannot be selected on %s", board)
+		}
+		if *c.Device < 0 || *c.Device > 63 {
+			return errors.New("device must be within 0-63")
+		}
+	}
+	return nil
+}
+
+// FileValues returns the settings as threshold.json keys; nil values are
+// absent keys (camera default).
+func (c CameraSettings) FileValues() map[string]any {
+	values := map[string]any{}
+	put := func(key string, set bool, v any) {
+		if set {
+			values[key] = v
+		} else {
+			values[key] = nil
+		}
+	}
+	put("cameraExposure", c.Exposure != nil, deref(c.Exposure))
+	put("cameraGain", c.Gain != nil, deref(c.Gain))
+	put("cameraAutoExposure", c.AutoExposure != nil, deref(c.AutoExposure))
+	colorGains := make([]string, len(c.ColorGains))
+	for i, v := range c.ColorGains {
+		colorGains[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	put("cameraColorGains", c.ColorGains != nil, strings.Join(colorGains, ","))
+	put("cameraFlip180", c.Flip180 != nil, deref(c.Flip180))
+	put("frameWidth", c.Width != nil, deref(c.Width))
+	put("frameHeight", c.Height != nil, deref(c.Height))
+	put("fps", c.FPS != nil, deref(c.FPS))
+	put("cameraDevice", c.Device != nil, deref(c.Device))
+	return values
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// Camera reads the camera settings from threshold.json. Values written by
+// hand in other forms ("true", "1.1, 0.8, 1.1", [1.1, 0.8, 1.1]) are
+// accepted.
+func (st *Store) Camera() (CameraSettings, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var c CameraSettings
+	raw, err := st.readRawLocked()
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	for _, k := range cameraKeys {
+		v, ok := raw[k.key]
+		if !ok || string(v) == "null" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			var list []float64
+			if json.Unmarshal(v, &list) == nil {
+				parts := make([]string, len(list))
+				for i, f := range list {
+					parts[i] = strconv.FormatFloat(f, 'g', -1, 64)
+				}
+				s = strings.Join(parts, ",")
+			} else {
+				s = string(v)
+			}
+		}
+		if err := c.Set(k.name, strings.TrimSpace(s)); err != nil {
+			return c, fmt.Errorf("%s: %s: %w", File, k.key, err)
+		}
+	}
+	return c, nil
+}
+
+// SaveCamera validates c for board and writes it to threshold.json, keeping
+// the thresholds and other keys.
+func (st *Store) SaveCamera(c CameraSettings, board string) error {
+	if err := c.Validate(board); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	unlock, err := lockFile(st.path(LockFile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	raw, err := st.readRawLocked()
+	if errors.Is(err, os.ErrNotExist) {
+		raw = map[string]json.RawMessage{}
+	} else if err != nil {
+		return err
+	}
+	for key, v := range c.FileValues() {
+		if v == nil {
+			delete(raw, key)
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		raw[key] = data
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(st.path(File), data)
+}
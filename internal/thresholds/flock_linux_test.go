@@ -0,0 +1,28 @@
+package thresholds
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The camera process holds LockFile while it rewrites threshold.json; a save
+// must wait for it instead of racing its read-modify-write.
+func TestSaveWaitsForLock(t *testing.T) {
+	st := NewStore(t.TempDir())
+	unlock, err := lockFile(filepath.Join(st.dir, LockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- st.Save(DefaultSet, SourceManual) }()
+	select {
+	case err := <-done:
+		t.Fatalf("saved while locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package thresholds
+
+// lockFile is a no-op where the camera process does not run.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,129 @@
+package thresholds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+)
+
+// PresetsFile holds the named threshold sets of the robot (one per venue or
+// lighting condition, e.g. "lab", "venue-A-day").
+const PresetsFile = "threshold_presets.json"
+
+// SourcePreset is recorded in the history when a preset is applied.
+const SourcePreset = "preset"
+
+var presetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,31}$`)
+
+// Preset is one named threshold set.
+type Preset struct {
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Set       Set       `json:"thresholds"`
+}
+
+// ValidatePresetName checks that name can be used in URLs and file content:
+// 1-32 characters of letters, digits, '.', '_' and '-', starting with a letter
+// or digit.
+func ValidatePresetName(name string) error {
+	if !presetNamePattern.MatchString(name) {
+		return fmt.Errorf("preset name %q must be 1-32 characters of [A-Za-z0-9._-]", name)
+	}
+	return nil
+}
+
+// Presets returns the stored presets sorted by name.
+func (st *Store) Presets() ([]Preset, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.readPresetsLocked()
+}
+
+// Preset returns the preset with the given name.
+func (st *Store) Preset(name string) (Preset, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	presets, _ := st.readPresetsLocked()
+	for _, p := range presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// SavePreset stores set under name, replacing a preset of the same name.
+func (st *Store) SavePreset(name string, set Set) (Preset, error) {
+	if err := ValidatePresetName(name); err != nil {
+		return Preset{}, err
+	}
+	if err := set.Validate(); err != nil {
+		return Preset{}, err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	presets, err := st.readPresetsLocked()
+	if err != nil {
+		return Preset{}, err
+	}
+	p := Preset{Name: name, UpdatedAt: st.now(), Set: set}
+	replaced := false
+	for i := range presets {
+		if presets[i].Name == name {
+			presets[i] = p
+			replaced = true
+		}
+	}
+	if !replaced {
+		presets = append(presets, p)
+	}
+	return p, st.writePresetsLocked(presets)
+}
+
+// DeletePreset removes the preset with the given name.
+func (st *Store) DeletePreset(name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	presets, err := st.readPresetsLocked()
+	if err != nil {
+		return err
+	}
+	for i, p := range presets {
+		if p.Name == name {
+			return st.writePresetsLocked(append(presets[:i], presets[i+1:]...))
+		}
+	}
+	return fmt.Errorf("preset %q not found", name)
+}
+
+func (st *Store) readPresetsLocked() ([]Preset, error) {
+	data, err := os.ReadFile(st.path(PresetsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Preset{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var presets []Preset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("%s: %w", PresetsFile, err)
+	}
+	return presets, nil
+}
+
+func (st *Store) writePresetsLocked(presets []Preset) error {
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(st.path(PresetsFile), data)
+}
@@ -0,0 +1,430 @@
+// Package thresholds owns threshold.json, the ball detection thresholds shared
+// with the Python camera process (camera/settings.py).
+//
+// The file is validated against a typed schema (Set) and carries a schema
+// version; files written before the version field are migrated on load. Other
+// keys in the file (camera* settings read by the camera process) are kept
+// untouched. Every change is written atomically and recorded in
+// threshold_history.json (last HistoryLimit sets with time and source) so that
+// a bad calibration can be rolled back.
+//
+// The capture settings in the same file (exposure, gain, resolution, ...) are
+// typed by CameraSettings and validated per board; named threshold sets are
+// kept in PresetsFile.
+package thresholds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/state"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/util"
+)
+
+const (
+	File        = "threshold.json"
+	HistoryFile = "threshold_history.json"
+	// LockFile is flock'ed around every read-modify-write of File, by this
+	// process and by the camera process (camera/settings.py).
+	LockFile = "threshold.json.lock"
+
+	// SchemaVersion is written to the "version" key. Files without it are
+	// version 0 (free-form HSV strings such as "1, 120, 100").
+	SchemaVersion = 1
+	// HistoryLimit is how many threshold sets are kept in HistoryFile.
+	HistoryLimit = 20
+
+	maxBallDetectRadius = 2000
+)
+
+// Sources recorded in the history.
+const (
+	SourceDefault  = "default"  // file created with the built-in defaults
+	SourceMigrate  = "migrate"  // first load of a pre-version file
+	SourceManual   = "manual"   // API / controller / color tuner
+	SourceCalib    = "calib"    // YOLO color calibration
+	SourceRelax    = "relax"    // color tuner "relax"
+	SourceRollback = "rollback" // restored from the history
+	SourceExternal = "external" // changed on disk by someone else
+
+	SourceAutoRelax = "auto-relax" // internal/autocalib: relax step
+	SourceAutoCalib = "auto-calib" // internal/autocalib: YOLO color calibration
+)
+
+// HSV is an OpenCV HSV triple (H 0-179, S and V 0-255). In JSON it is the
+// comma-separated string form shared with the camera process ("1,120,100").
+type HSV [3]int
+
+var hsvMax = HSV{179, 255, 255}
+
+// ParseHSV parses "h,s,v". Spaces around the numbers are allowed.
+func ParseHSV(s string) (HSV, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return HSV{}, fmt.Errorf("HSV %q must have 3 comma-separated values", s)
+	}
+	var hsv HSV
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return HSV{}, fmt.Errorf("HSV %q: %q is not an integer", s, p)
+		}
+		hsv[i] = v
+	}
+	return hsv, hsv.validate()
+}
+
+func (h HSV) validate() error {
+	for i, v := range h {
+		if v < 0 || v > hsvMax[i] {
+			return fmt.Errorf("HSV %s: %c must be within 0-%d", h, "HSV"[i], hsvMax[i])
+		}
+	}
+	return nil
+}
+
+func (h HSV) String() string {
+	return fmt.Sprintf("%d,%d,%d", h[0], h[1], h[2])
+}
+
+func (h HSV) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+// UnmarshalJSON accepts the string form and, for old files, a [h, s, v] list.
+func (h *HSV) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := ParseHSV(s)
+		*h = v
+		return err
+	}
+	var list []int
+	if err := json.Unmarshal(data, &list); err != nil || len(list) != 3 {
+		return fmt.Errorf("HSV must be a \"h,s,v\" string, got %s", data)
+	}
+	*h = HSV{list[0], list[1], list[2]}
+	return h.validate()
+}
+
+// Set is one set of detection thresholds.
+type Set struct {
+	Min                  HSV     `json:"minThreshold"`
+	Max                  HSV     `json:"maxThreshold"`
+	BallDetectRadius     int     `json:"ballDetectRadius"`
+	CircularityThreshold float32 `json:"circularityThreshold"`
+}
+
+// DefaultSet is written when threshold.json does not exist.
+var DefaultSet = Set{
+	Min:                  HSV{1, 120, 100},
+	Max:                  HSV{15, 255, 255},
+	BallDetectRadius:     150,
+	CircularityThreshold: 0.2,
+}
+
+// Validate checks the ranges of every field.
+func (s Set) Validate() error {
+	if err := s.Min.validate(); err != nil {
+		return fmt.Errorf("minThreshold: %w", err)
+	}
+	if err := s.Max.validate(); err != nil {
+		return fmt.Errorf("maxThreshold: %w", err)
+	}
+	for i := range s.Min {
+		if s.Min[i] > s.Max[i] {
+			return fmt.Errorf("minThreshold %s exceeds maxThreshold %s", s.Min, s.Max)
+		}
+	}
+	if s.BallDetectRadius < 1 || s.BallDetectRadius > maxBallDetectRadius {
+		return fmt.Errorf("ballDetectRadius must be within 1-%d", maxBallDetectRadius)
+	}
+	if s.CircularityThreshold < 0 || s.CircularityThreshold > 1 {
+		return fmt.Errorf("circularityThreshold must be within 0-1")
+	}
+	return nil
+}
+
+// FromAdjustment parses and validates the string form used by the API and
+// the MW protocol.
+func FromAdjustment(adj state.Adjustment) (Set, error) {
+	minHSV, err := ParseHSV(adj.MinThreshold)
+	if err != nil {
+		return Set{}, fmt.Errorf("minThreshold: %w", err)
+	}
+	maxHSV, err := ParseHSV(adj.MaxThreshold)
+	if err != nil {
+		return Set{}, fmt.Errorf("maxThreshold: %w", err)
+	}
+	s := Set{
+		Min:                  minHSV,
+		Max:                  maxHSV,
+		BallDetectRadius:     adj.BallDetectRadius,
+		CircularityThreshold: adj.CircularityThreshold,
+	}
+	return s, s.Validate()
+}
+
+// Adjustment returns the string form with canonical HSV strings.
+func (s Set) Adjustment() state.Adjustment {
+	return state.Adjustment{
+		MinThreshold:         s.Min.String(),
+		MaxThreshold:         s.Max.String(),
+		BallDetectRadius:     s.BallDetectRadius,
+		CircularityThreshold: s.CircularityThreshold,
+	}
+}
+
+// Entry is one history record.
+type Entry struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Set    Set       `json:"thresholds"`
+}
+
+// Change is one differing field between two sets.
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Diff lists the fields that differ from a to b.
+func Diff(a, b Set) []Change {
+	changes := []Change{}
+	add := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, Change{Field: field, From: from, To: to})
+		}
+	}
+	add("minThreshold", a.Min.String(), b.Min.String())
+	add("maxThreshold", a.Max.String(), b.Max.String())
+	add("ballDetectRadius", strconv.Itoa(a.BallDetectRadius), strconv.Itoa(b.BallDetectRadius))
+	add("circularityThreshold",
+		strconv.FormatFloat(float64(a.CircularityThreshold), 'g', -1, 32),
+		strconv.FormatFloat(float64(b.CircularityThreshold), 'g', -1, 32))
+	return changes
+}
+
+// Store reads and writes the threshold and history files of one directory.
+type Store struct {
+	mu  sync.Mutex
+	dir string
+	now func() time.Time
+}
+
+// NewStore returns a store for the files in dir.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, now: time.Now}
+}
+
+// Default is the store in the working directory (next to the binary).
+var Default = NewStore(".")
+
+func (st *Store) path(name string) string {
+	return filepath.Join(st.dir, name)
+}
+
+// Load reads threshold.json, creating it with DefaultSet when missing and
+// migrating files without a version.
+func (st *Store) Load() (Set, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.loadLocked()
+}
+
+func (st *Store) loadLocked() (Set, error) {
+	raw, err := st.readRawLocked()
+	if errors.Is(err, os.ErrNotExist) {
+		if err := st.saveLocked(DefaultSet, SourceDefault); err != nil {
+			return DefaultSet, err
+		}
+		return DefaultSet, nil
+	}
+	if err != nil {
+		return DefaultSet, err
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return DefaultSet, fmt.Errorf("%s: version: %w", File, err)
+		}
+	}
+	if version > SchemaVersion {
+		return DefaultSet, fmt.Errorf("%s: version %d is newer than supported %d", File, version, SchemaVersion)
+	}
+
+	// Keys missing from old files keep their defaults.
+	set := DefaultSet
+	data, _ := json.Marshal(raw)
+	if err := json.Unmarshal(data, &set); err != nil {
+		return DefaultSet, fmt.Errorf("%s: %w", File, err)
+	}
+	if err := set.Validate(); err != nil {
+		return DefaultSet, fmt.Errorf("%s: %w", File, err)
+	}
+
+	if version < SchemaVersion {
+		log.Printf("%s: migrating schema version %d -> %d", File, version, SchemaVersion)
+		if err := st.saveLocked(set, SourceMigrate); err != nil {
+			return set, err
+		}
+	}
+	return set, nil
+}
+
+func (st *Store) readRawLocked() (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(st.path(File))
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", File, err)
+	}
+	return raw, nil
+}
+
+// Save validates and writes set, keeping the other keys of the file, and
+// records it in the history.
+func (st *Store) Save(set Set, source string) error {
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.saveLocked(set, source)
+}
+
+func (st *Store) saveLocked(set Set, source string) error {
+	unlock, err := lockFile(st.path(LockFile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	raw, err := st.readRawLocked()
+	if err != nil {
+		// A missing or unreadable file is replaced; its other keys are lost.
+		raw = map[string]json.RawMessage{}
+	}
+	fields, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields, &raw); err != nil {
+		return err
+	}
+	raw["version"] = json.RawMessage(strconv.Itoa(SchemaVersion))
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(st.path(File), data); err != nil {
+		return err
+	}
+	return st.appendHistoryLocked(set, source)
+}
+
+// Record validates threshold.json after another writer (the camera process)
+// changed it, and adds it to the history when it differs from the newest
+// entry.
+func (st *Store) Record(source string) (Set, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	set, err := st.loadLocked()
+	if err != nil {
+		return set, err
+	}
+	history, _ := st.readHistoryLocked()
+	if len(history) > 0 && history[len(history)-1].Set == set {
+		return set, nil
+	}
+	return set, st.appendHistoryLocked(set, source)
+}
+
+// History returns the recorded sets, newest first.
+func (st *Store) History() ([]Entry, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	history, err := st.readHistoryLocked()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, len(history))
+	for i, e := range history {
+		out[len(history)-1-i] = e
+	}
+	return out, nil
+}
+
+// Entry returns the history entry with the given id.
+func (st *Store) Entry(id int) (Entry, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	history, _ := st.readHistoryLocked()
+	for _, e := range history {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Rollback writes the set of history entry id back to threshold.json.
+func (st *Store) Rollback(id int) (Set, error) {
+	e, ok := st.Entry(id)
+	if !ok {
+		return Set{}, fmt.Errorf("history entry %d not found", id)
+	}
+	return e.Set, st.Save(e.Set, SourceRollback)
+}
+
+func (st *Store) readHistoryLocked() ([]Entry, error) {
+	data, err := os.ReadFile(st.path(HistoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []Entry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("%s: %w", HistoryFile, err)
+	}
+	return history, nil
+}
+
+func (st *Store) appendHistoryLocked(set Set, source string) error {
+	history, err := st.readHistoryLocked()
+	if err != nil {
+		log.Printf("threshold history unreadable, starting a new one: %v", err)
+		history = nil
+	}
+	id := 1
+	if len(history) > 0 {
+		id = history[len(history)-1].ID + 1
+	}
+	history = append(history, Entry{ID: id, Time: st.now(), Source: source, Set: set})
+	if len(history) > HistoryLimit {
+		history = history[len(history)-HistoryLimit:]
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(st.path(HistoryFile), data)
+}
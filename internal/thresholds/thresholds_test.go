@@ -0,0 +1,259 @@
+package thresholds
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseHSV(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want HSV
+		ok   bool
+	}{
+		{"1,120,100", HSV{1, 120, 100}, true},
+		{"1, 120, 100", HSV{1, 120, 100}, true},
+		{"179,255,255", HSV{179, 255, 255}, true},
+		{"180,0,0", HSV{}, false},
+		{"0,256,0", HSV{}, false},
+		{"-1,0,0", HSV{}, false},
+		{"1,2", HSV{}, false},
+		{"1,2,x", HSV{}, false},
+	} {
+		got, err := ParseHSV(tc.in)
+		if (err == nil) != tc.ok || (tc.ok && got != tc.want) {
+			t.Errorf("ParseHSV(%q) = %v, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestSetValidate(t *testing.T) {
+	s := DefaultSet
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s.Min, s.Max = s.Max, s.Min
+	if s.Validate() == nil {
+		t.Error("min > max accepted")
+	}
+	s = DefaultSet
+	s.CircularityThreshold = 1.5
+	if s.Validate() == nil {
+		t.Error("circularity 1.5 accepted")
+	}
+}
+
+func readJSON(t *testing.T, path string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestLoadMigratesAndKeepsOtherKeys(t *testing.T) {
+	dir := t.TempDir()
+	old := `{"minThreshold":"1, 115, 90","maxThreshold":[20,255,255],"ballDetectRadius":120,"cameraFlip180":true}`
+	if err := os.WriteFile(filepath.Join(dir, File), []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := NewStore(dir)
+	set, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Set{Min: HSV{1, 115, 90}, Max: HSV{20, 255, 255}, BallDetectRadius: 120, CircularityThreshold: DefaultSet.CircularityThreshold}
+	if set != want {
+		t.Fatalf("Load = %+v, want %+v", set, want)
+	}
+
+	m := readJSON(t, filepath.Join(dir, File))
+	if m["version"] != float64(SchemaVersion) || m["minThreshold"] != "1,115,90" || m["maxThreshold"] != "20,255,255" || m["cameraFlip180"] != true {
+		t.Fatalf("migrated file = %v", m)
+	}
+	h, _ := st.History()
+	if len(h) != 1 || h[0].Source != SourceMigrate {
+		t.Fatalf("history = %+v", h)
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	bad := `{"version":1,"minThreshold":"1,120,100","maxThreshold":"200,255,255","ballDetectRadius":150,"circularityThreshold":0.2}`
+	os.WriteFile(filepath.Join(dir, File), []byte(bad), 0644)
+	if _, err := NewStore(dir).Load(); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+func TestHistoryAndRollback(t *testing.T) {
+	st := NewStore(t.TempDir())
+	if _, err := st.Load(); err != nil { // creates the default file
+		t.Fatal(err)
+	}
+	calib := DefaultSet
+	calib.Min = HSV{5, 100, 80}
+	if err := st.Save(calib, SourceCalib); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Save(Set{}, SourceManual); err == nil {
+		t.Fatal("invalid set saved")
+	}
+
+	h, err := st.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h[0].Source != SourceCalib || h[1].Source != SourceDefault {
+		t.Fatalf("history = %+v", h)
+	}
+	if d := Diff(h[1].Set, h[0].Set); len(d) != 1 || d[0].Field != "minThreshold" || d[0].To != "5,100,80" {
+		t.Fatalf("diff = %+v", d)
+	}
+
+	set, err := st.Rollback(h[1].ID)
+	if err != nil || set != DefaultSet {
+		t.Fatalf("Rollback = %+v, %v", set, err)
+	}
+	if cur, _ := st.Load(); cur != DefaultSet {
+		t.Fatalf("after rollback Load = %+v", cur)
+	}
+	if h, _ := st.History(); h[0].Source != SourceRollback {
+		t.Fatalf("newest = %+v", h[0])
+	}
+
+	// Record only adds a new entry when the file changed.
+	if _, err := st.Record(SourceExternal); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := st.History(); len(h) != 3 {
+		t.Fatalf("unchanged file recorded again: %d entries", len(h))
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	st := NewStore(t.TempDir())
+	for i := 0; i < HistoryLimit+5; i++ {
+		s := DefaultSet
+		s.BallDetectRadius = 100 + i
+		if err := st.Save(s, SourceManual); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, _ := st.History()
+	if len(h) != HistoryLimit || h[0].Set.BallDetectRadius != 100+HistoryLimit+4 {
+		t.Fatalf("history len %d, newest %+v", len(h), h[0])
+	}
+}
+
+func TestPresets(t *testing.T) {
+	st := NewStore(t.TempDir())
+	night := DefaultSet
+	night.Min = HSV{0, 90, 60}
+	if _, err := st.SavePreset("venue-A-night", night); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.SavePreset("lab", DefaultSet); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "../x", "a b", "-lab"} {
+		if _, err := st.SavePreset(name, DefaultSet); err == nil {
+			t.Errorf("preset name %q accepted", name)
+		}
+	}
+	if _, err := st.SavePreset("bad", Set{}); err == nil {
+		t.Error("invalid set stored as preset")
+	}
+
+	// Saving an existing name replaces it.
+	night.BallDetectRadius = 90
+	if _, err := st.SavePreset("venue-A-night", night); err != nil {
+		t.Fatal(err)
+	}
+	presets, err := st.Presets()
+	if err != nil || len(presets) != 2 || presets[0].Name != "lab" {
+		t.Fatalf("Presets = %+v, %v", presets, err)
+	}
+	if p, ok := st.Preset("venue-A-night"); !ok || p.Set != night {
+		t.Fatalf("Preset = %+v, %v", p, ok)
+	}
+
+	if err := st.DeletePreset("lab"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeletePreset("lab"); err == nil {
+		t.Error("deleting a missing preset succeeded")
+	}
+	if _, ok := st.Preset("lab"); ok {
+		t.Error("deleted preset still present")
+	}
+}
+
+func TestCameraSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, File)
+	old := `{"minThreshold":"1,120,100","maxThreshold":"15,255,255","ballDetectRadius":150,"circularityThreshold":0.2,` +
+		`"cameraGain":80,"cameraFlip180":"yes","cameraColorGains":"1.15, 0.78, 1.12","cameraSensorSubdev":"/dev/v4l-subdev2"}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := NewStore(dir)
+	c, err := st.Camera()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *c.Gain != 80 || !*c.Flip180 || len(c.ColorGains) != 3 || c.Exposure != nil {
+		t.Fatalf("Camera = %+v", c)
+	}
+	if err := c.Validate(BoardRock5A); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(BoardPi4); err == nil {
+		t.Error("rock5a gain and BGR gains accepted on pi4")
+	}
+
+	for _, kv := range [][2]string{{"exposure", "1200"}, {"width", "1280"}, {"height", "720"}, {"flip180", "default"}} {
+		if err := c.Set(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Set("exposure", "fast"); err == nil {
+		t.Error("invalid exposure parsed")
+	}
+	if err := st.SaveCamera(c, BoardRock5A); err != nil {
+		t.Fatal(err)
+	}
+	m := readJSON(t, path)
+	if m["cameraExposure"] != 1200.0 || m["frameWidth"] != 1280.0 || m["cameraColorGains"] != "1.15,0.78,1.12" {
+		t.Fatalf("saved %v", m)
+	}
+	if _, ok := m["cameraFlip180"]; ok {
+		t.Error("cleared flip180 still in the file")
+	}
+	if m["cameraSensorSubdev"] != "/dev/v4l-subdev2" || m["minThreshold"] != "1,120,100" {
+		t.Errorf("other keys not kept: %v", m)
+	}
+
+	c.Height = nil
+	if err := st.SaveCamera(c, BoardRock5A); err == nil {
+		t.Error("width without height saved")
+	}
+
+	// NaN and Inf parse as floats but are out of every range.
+	for _, kv := range [][2]string{{"gain", "NaN"}, {"gain", "+Inf"}, {"colorGains", "NaN,1"}, {"colorGains", "1,Inf"}} {
+		bad := CameraSettings{}
+		if err := bad.Set(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := bad.Validate(BoardPi4); err == nil {
+			t.Errorf("%s %s accepted", kv[0], kv[1])
+		}
+	}
+}
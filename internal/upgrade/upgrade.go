@@ -43,6 +43,11 @@ func getVersion() string {
 	return buildInfo.Main.Version
 }
 
+// CurrentVersion returns the version of the running binary (see getVersion).
+func CurrentVersion() string {
+	return getVersion()
+}
+
 func normalizeVersion(v string) string {
 	return strings.TrimPrefix(v, "v")
 }
@@ -0,0 +1,110 @@
+// Package vision post-processes camera detections on the Go side: choosing
+// the ball to track among several candidates.
+package vision
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+)
+
+// Policy selects the tracked ball among the ball detections of a frame.
+type Policy string
+
+const (
+	// PolicyBest keeps the camera's own ranking (first ball detection).
+	PolicyBest Policy = "best"
+	// PolicyConfidence takes the most confident ball.
+	PolicyConfidence Policy = "confidence"
+	// PolicyLargest takes the largest bounding box (usually the nearest ball).
+	PolicyLargest Policy = "largest"
+	// PolicyNearest takes the ball closest to the previously selected one,
+	// so a second ball in view does not steal the track. It falls back to
+	// PolicyConfidence when there is no previous ball.
+	PolicyNearest Policy = "nearest"
+)
+
+// ParsePolicy validates a policy name. Empty means PolicyBest.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return PolicyBest, nil
+	case PolicyBest, PolicyConfidence, PolicyLargest, PolicyNearest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown ball policy %q", s)
+	}
+}
+
+// Selector picks the tracked ball frame by frame.
+type Selector struct {
+	mu            sync.Mutex
+	policy        Policy
+	minConfidence float32
+	prev          *camproto.Detection
+}
+
+// NewSelector returns a selector ignoring balls below minConfidence.
+func NewSelector(policy Policy, minConfidence float32) *Selector {
+	return &Selector{policy: policy, minConfidence: minConfidence}
+}
+
+// Default is the selector used for the camera stream.
+var Default = NewSelector(PolicyBest, 0)
+
+// Configure replaces the policy and forgets the previous ball.
+func (s *Selector) Configure(policy Policy, minConfidence float32) {
+	s.mu.Lock()
+	s.policy = policy
+	s.minConfidence = minConfidence
+	s.prev = nil
+	s.mu.Unlock()
+}
+
+// Select returns the index in items of the tracked ball, or -1.
+func (s *Selector) Select(items []camproto.Detection) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	best := -1
+	var bestScore float32
+	for i, it := range items {
+		if it.Class != camproto.ClassBall || it.Confidence < s.minConfidence {
+			continue
+		}
+		score := s.scoreLocked(it)
+		if best < 0 || score > bestScore {
+			best, bestScore = i, score
+			if s.policy == PolicyBest {
+				break
+			}
+		}
+	}
+
+	if best < 0 {
+		s.prev = nil
+		return -1
+	}
+	ball := items[best]
+	s.prev = &ball
+	return best
+}
+
+// scoreLocked ranks a candidate; higher is better.
+func (s *Selector) scoreLocked(it camproto.Detection) float32 {
+	switch s.policy {
+	case PolicyLargest:
+		return it.Width * it.Height
+	case PolicyNearest:
+		if s.prev != nil {
+			dx, dy := it.X-s.prev.X, it.Y-s.prev.Y
+			return -(dx*dx + dy*dy)
+		}
+		return it.Confidence
+	case PolicyConfidence:
+		return it.Confidence
+	default:
+		return 0
+	}
+}
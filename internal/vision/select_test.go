@@ -0,0 +1,44 @@
+package vision
+
+import (
+	"testing"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/camproto"
+)
+
+func ball(x, y, size, conf float32) camproto.Detection {
+	return camproto.Detection{Class: camproto.ClassBall, X: x, Y: y, Width: size, Height: size, Confidence: conf}
+}
+
+func TestSelectPolicies(t *testing.T) {
+	robot := camproto.Detection{Class: camproto.ClassRobot, Width: 500, Height: 500, Confidence: 1}
+	items := []camproto.Detection{robot, ball(0, 0, 10, 0.6), ball(50, 50, 30, 0.9), ball(-80, 0, 40, 0.2)}
+
+	cases := []struct {
+		policy  Policy
+		minConf float32
+		want    int
+	}{
+		{PolicyBest, 0, 1},
+		{PolicyConfidence, 0, 2},
+		{PolicyLargest, 0, 3},
+		{PolicyLargest, 0.5, 2},
+		{PolicyBest, 0.95, -1},
+	}
+	for _, c := range cases {
+		if got := NewSelector(c.policy, c.minConf).Select(items); got != c.want {
+			t.Errorf("%s (min %.2f) selected %d, want %d", c.policy, c.minConf, got, c.want)
+		}
+	}
+}
+
+func TestSelectNearestKeepsTrack(t *testing.T) {
+	s := NewSelector(PolicyNearest, 0)
+	if got := s.Select([]camproto.Detection{ball(100, 100, 10, 0.5), ball(0, 0, 10, 0.9)}); got != 1 {
+		t.Fatalf("first frame selected %d, want the most confident ball", got)
+	}
+	// A more confident ball far away does not steal the track.
+	if got := s.Select([]camproto.Detection{ball(95, 95, 10, 1), ball(5, -3, 10, 0.4)}); got != 1 {
+		t.Errorf("second frame selected %d, want the ball near the previous one", got)
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/dashboard"
+	"github.com/Rione/ssl-RACOON-Pi2/internal/wheeltrack"
 )
 
 const (
@@ -23,6 +26,9 @@ type Sample struct {
 	BL int16 `json:"bl"`
 	BR int16 `json:"br"`
 	FR int16 `json:"fr"`
+	// Err is the tracking error (commanded - measured, m/s) of FL, BL, BR,
+	// FR.
+	Err [wheeltrack.NumWheels]float32 `json:"err"`
 }
 
 var (
@@ -41,7 +47,8 @@ func SetEnabled(on bool) {
 	mu.Unlock()
 }
 
-// Record stores a Wheel(raw) sample when graph mode is enabled.
+// Record stores a Wheel(raw) sample when graph mode is enabled, with the
+// tracking error of the same reading (call it after link.ObserveRX).
 func Record(fl, bl, br, fr int16) {
 	if !enabled {
 		return
@@ -51,11 +58,12 @@ func Record(fl, bl, br, fr int16) {
 	defer mu.Unlock()
 
 	s := Sample{
-		T:  time.Now().UnixMilli(),
-		FL: fl,
-		BL: bl,
-		BR: br,
-		FR: fr,
+		T:   time.Now().UnixMilli(),
+		FL:  fl,
+		BL:  bl,
+		BR:  br,
+		FR:  fr,
+		Err: wheeltrack.Default.Errors(),
 	}
 	if len(samples) >= maxSamples {
 		samples = append(samples[1:], s)
@@ -64,11 +72,12 @@ func Record(fl, bl, br, fr int16) {
 	samples = append(samples, s)
 }
 
-// RunServer serves a live Chart.js page and JSON samples until done is closed.
+// RunServer serves a live graph page and JSON samples until done is closed.
 func RunServer(done <-chan struct{}) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/wheel-graph", handleGraphPage)
 	mux.HandleFunc("/wheel-raw.json", handleSamplesJSON)
+	mux.HandleFunc("/chart.js", handleChartJS)
 
 	srv := &http.Server{
 		Addr:    port,
@@ -101,62 +110,56 @@ func handleGraphPage(w http.ResponseWriter, _ *http.Request) {
 	fmt.Fprint(w, graphPageHTML)
 }
 
+// handleChartJS serves the dashboard's line chart, so the page needs no CDN.
+func handleChartJS(w http.ResponseWriter, _ *http.Request) {
+	data, contentType, _ := dashboard.Asset("chart.js")
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	_, _ = w.Write(data)
+}
+
 const graphPageHTML = `<!DOCTYPE html>
 <html lang="ja">
 <head>
   <meta charset="utf-8">
   <meta name="viewport" content="width=device-width, initial-scale=1">
   <title>Wheel(raw) Graph</title>
-  <script src="https://cdn.jsdelivr.net/npm/chart.js@4.4.1/dist/chart.umd.min.js"></script>
+  <script src="/chart.js"></script>
   <style>
     body { font-family: sans-serif; margin: 16px; background: #111; color: #eee; }
     h1 { font-size: 1.1rem; margin: 0 0 12px; }
     #meta { font-size: 0.85rem; color: #aaa; margin-bottom: 12px; }
-    canvas { background: #1a1a1a; border-radius: 8px; max-height: 70vh; }
+    canvas { width: 100%; height: 45vh; border-radius: 8px; }
+    h2 { font-size: 0.95rem; margin: 16px 0 8px; }
   </style>
 </head>
 <body>
   <h1>Wheel(raw) — FL / BL / BR / FR</h1>
   <div id="meta">loading…</div>
   <canvas id="chart"></canvas>
+  <h2>Tracking error (commanded - measured) [m/s]</h2>
+  <canvas id="errChart"></canvas>
   <script>
-    const colors = { fl: "#4ade80", bl: "#60a5fa", br: "#f472b6", fr: "#fbbf24" };
-    const ctx = document.getElementById("chart");
-    const chart = new Chart(ctx, {
-      type: "line",
-      data: {
-        labels: [],
-        datasets: [
-          { label: "FL", borderColor: colors.fl, data: [], tension: 0.1, pointRadius: 0, borderWidth: 1.5 },
-          { label: "BL", borderColor: colors.bl, data: [], tension: 0.1, pointRadius: 0, borderWidth: 1.5 },
-          { label: "BR", borderColor: colors.br, data: [], tension: 0.1, pointRadius: 0, borderWidth: 1.5 },
-          { label: "FR", borderColor: colors.fr, data: [], tension: 0.1, pointRadius: 0, borderWidth: 1.5 },
-        ],
-      },
-      options: {
-        animation: false,
-        responsive: true,
-        maintainAspectRatio: true,
-        interaction: { mode: "index", intersect: false },
-        scales: {
-          x: { ticks: { color: "#888" }, grid: { color: "#333" }, title: { display: true, text: "sample #", color: "#888" } },
-          y: { ticks: { color: "#888" }, grid: { color: "#333" }, title: { display: true, text: "raw", color: "#888" } },
-        },
-        plugins: { legend: { labels: { color: "#ccc" } } },
-      },
-    });
+    const series = [
+      { label: "FL", color: "#4ade80" },
+      { label: "BL", color: "#60a5fa" },
+      { label: "BR", color: "#f472b6" },
+      { label: "FR", color: "#fbbf24" },
+    ];
+    const chart = new LineChart(document.getElementById("chart"), series);
+    const errChart = new LineChart(document.getElementById("errChart"), series);
 
     async function poll() {
       try {
         const res = await fetch("/wheel-raw.json");
         const body = await res.json();
         const samples = body.samples || [];
-        chart.data.labels = samples.map((_, i) => i);
-        chart.data.datasets[0].data = samples.map(s => s.fl);
-        chart.data.datasets[1].data = samples.map(s => s.bl);
-        chart.data.datasets[2].data = samples.map(s => s.br);
-        chart.data.datasets[3].data = samples.map(s => s.fr);
-        chart.update("none");
+        chart.update([
+          samples.map(s => s.fl),
+          samples.map(s => s.bl),
+          samples.map(s => s.br),
+          samples.map(s => s.fr),
+        ]);
+        errChart.update([0, 1, 2, 3].map(i => samples.map(s => s.err[i])));
         const last = samples[samples.length - 1];
         const meta = document.getElementById("meta");
         if (last) {
@@ -0,0 +1,374 @@
+// Package wheeltrack compares the wheel speeds the MCU reports with the speeds
+// the commanded body velocity asks for, and detects broken motors.
+//
+// The link feeds the velocity of every frame sent to the MCU (Command) and
+// the wheel speeds of every frame received (Observe). The expected speed of
+// each wheel is the inverse kinematics of the omni-wheel base (Geometry).
+// Samples are collected in blocks of Window; a wheel is judged on a block only
+// when it was commanded steadily (at least MinSpeed, always in the same
+// direction), and then it is
+//
+//   - disconnected when its raw speed stayed exactly 0 (no encoder counts);
+//   - reversed when it turned the other way at a sizeable speed;
+//   - stalled when it reached less than StallRatio of the expected speed.
+//
+// A broken wheel raises its fault (fault.CodeMotorFL ...) until a later block
+// judges it healthy again. The per-wheel tracking error is reported
+// continuously for /status and the wheel graphs.
+package wheeltrack
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
+)
+
+// Wheel indices, in the order of state.RecvData.
+const (
+	FL = iota
+	BL
+	BR
+	FR
+	NumWheels
+)
+
+// WheelNames are the wheel labels used in messages and JSON.
+var WheelNames = [NumWheels]string{"FL", "BL", "BR", "FR"}
+
+// faultCodes are the fault codes of the wheels.
+var faultCodes = [NumWheels]uint32{fault.CodeMotorFL, fault.CodeMotorBL, fault.CodeMotorBR, fault.CodeMotorFR}
+
+// Geometry describes the omni-wheel base.
+type Geometry struct {
+	// AnglesDeg is the position of each wheel seen from the robot centre,
+	// counter-clockwise from the front (+x). A wheel turning positive drives
+	// the robot counter-clockwise around its centre.
+	AnglesDeg [NumWheels]float64
+	// RadiusM is the distance from the robot centre to the wheels.
+	RadiusM float64
+	// Inverted marks the wheels whose speed, as the MCU reports and drives
+	// it, is positive when the robot turns clockwise (motor mounted or wired
+	// the other way round).
+	Inverted [NumWheels]bool
+}
+
+// Sign is -1 for an inverted wheel and 1 otherwise.
+func (g Geometry) Sign(i int) float64 {
+	if g.Inverted[i] {
+		return -1
+	}
+	return 1
+}
+
+// Expected returns the wheel surface speeds (m/s, with the sign the MCU uses)
+// for a body velocity vx, vy (m/s, x forward, y left) and omega (rad/s,
+// counter-clockwise).
+func (g Geometry) Expected(vx, vy, omega float64) [NumWheels]float64 {
+	var v [NumWheels]float64
+	for i, deg := range g.AnglesDeg {
+		th := deg * math.Pi / 180
+		v[i] = g.Sign(i) * (-math.Sin(th)*vx + math.Cos(th)*vy + g.RadiusM*omega)
+	}
+	return v
+}
+
+// Body is the inverse of Expected: the body velocity (vx, vy in m/s, omega
+// in rad/s) whose wheel speeds are closest to wheels in the least-squares
+// sense. Four wheels over-determine three velocities, so wheel speeds that no
+// body velocity produces are projected.
+func (g Geometry) Body(wheels [NumWheels]float64) (vx, vy, omega float64) {
+	// Normal equations (JᵀJ) x = Jᵀ w with the rows of J = (-sin θ, cos θ, R).
+	// An inverted wheel's speed is turned back first.
+	var a [3][3]float64
+	var b [3]float64
+	for i, deg := range g.AnglesDeg {
+		th := deg * math.Pi / 180
+		row := [3]float64{-math.Sin(th), math.Cos(th), g.RadiusM}
+		for r := range row {
+			for c := range row {
+				a[r][c] += row[r] * row[c]
+			}
+			b[r] += row[r] * g.Sign(i) * wheels[i]
+		}
+	}
+	x, ok := solve3(a, b)
+	if !ok {
+		return 0, 0, 0
+	}
+	return x[0], x[1], x[2]
+}
+
+// solve3 solves a x = b by Cramer's rule; ok is false when a is singular
+// (a degenerate geometry).
+func solve3(a [3][3]float64, b [3]float64) (x [3]float64, ok bool) {
+	det := func(m [3][3]float64) float64 {
+		return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+			m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+			m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	}
+	d := det(a)
+	if math.Abs(d) < 1e-12 {
+		return x, false
+	}
+	for c := range x {
+		m := a
+		for r := range m {
+			m[r][c] = b[r]
+		}
+		x[c] = det(m) / d
+	}
+	return x, true
+}
+
+// Condition is the judgement of a wheel.
+type Condition int
+
+const (
+	// OK: the wheel follows the command (or was never judged).
+	OK Condition = iota
+	// Stalled: the wheel turns much slower than commanded.
+	Stalled
+	// Reversed: the wheel turns against the command.
+	Reversed
+	// Disconnected: the wheel reports no movement at all.
+	Disconnected
+)
+
+var conditionNames = [...]string{"ok", "stalled", "reversed", "disconnected"}
+
+func (c Condition) String() string {
+	if c < 0 || int(c) >= len(conditionNames) {
+		return "unknown"
+	}
+	return conditionNames[c]
+}
+
+// MarshalText encodes the condition by name in JSON.
+func (c Condition) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Config tunes the monitor.
+type Config struct {
+	Geometry Geometry
+	// Window is the length of a judged block.
+	Window time.Duration
+	// MinSpeed (m/s) is the smallest expected wheel speed that is judged;
+	// slower commands are within the MCU's dead band and ramps.
+	MinSpeed float64
+	// StallRatio is the fraction of the expected speed below which a wheel is
+	// stalled (or, turning the other way, reversed).
+	StallRatio float64
+	// Faults raises the motor faults; without it only the tracking error is
+	// reported.
+	Faults bool
+}
+
+// DefaultConfig is used until Configure is called.
+var DefaultConfig = Config{
+	Geometry: Geometry{
+		AnglesDeg: [NumWheels]float64{60, 135, 225, 300},
+		RadiusM:   0.08,
+	},
+	Window:     500 * time.Millisecond,
+	MinSpeed:   0.3,
+	StallRatio: 0.2,
+	Faults:     true,
+}
+
+// WheelStatus is the tracking of one wheel.
+type WheelStatus struct {
+	Name string `json:"name"`
+	// Expected and Measured are the latest speeds (m/s), Error is Expected -
+	// Measured.
+	Expected float32 `json:"expected"`
+	Measured float32 `json:"measured"`
+	Error    float32 `json:"error"`
+	// RMSError is the RMS tracking error of the last complete block.
+	RMSError  float32   `json:"rmsError"`
+	Condition Condition `json:"condition"`
+	// Since is when Condition last changed, zero when never.
+	Since time.Time `json:"since"`
+}
+
+// Status is a snapshot of the monitor.
+type Status struct {
+	Wheels [NumWheels]WheelStatus `json:"wheels"`
+}
+
+// block accumulates one Window of a wheel.
+type block struct {
+	n         int
+	sumExp    float64
+	sumMeas   float64
+	sumSqErr  float64
+	steady    bool // every sample commanded >= MinSpeed in one direction
+	sign      float64
+	nonZeroRx bool
+}
+
+func (b *block) add(exp, meas float64, raw int16, minSpeed float64) {
+	sign := math.Copysign(1, exp)
+	if b.n == 0 {
+		b.steady = true
+		b.sign = sign
+	}
+	if math.Abs(exp) < minSpeed || sign != b.sign {
+		b.steady = false
+	}
+	if raw != 0 {
+		b.nonZeroRx = true
+	}
+	b.n++
+	b.sumExp += exp
+	b.sumMeas += meas
+	b.sumSqErr += (exp - meas) * (exp - meas)
+}
+
+// judge returns the condition of a steady block.
+func (b *block) judge(stallRatio float64) Condition {
+	exp := b.sumExp / float64(b.n)
+	meas := b.sumMeas / float64(b.n)
+	switch {
+	case !b.nonZeroRx:
+		return Disconnected
+	case meas*exp < 0 && math.Abs(meas) >= stallRatio*math.Abs(exp):
+		return Reversed
+	case math.Abs(meas) < stallRatio*math.Abs(exp):
+		return Stalled
+	}
+	return OK
+}
+
+// Monitor tracks the wheels. It is safe for concurrent use.
+type Monitor struct {
+	mu  sync.Mutex
+	cfg Config
+
+	cmd        [3]float64 // vx, vy, omega of the last frame sent
+	blockStart time.Time
+	blocks     [NumWheels]block
+	wheels     [NumWheels]WheelStatus
+}
+
+// New returns a monitor with the given configuration.
+func New(cfg Config) *Monitor {
+	m := &Monitor{cfg: cfg}
+	for i := range m.wheels {
+		m.wheels[i].Name = WheelNames[i]
+	}
+	return m
+}
+
+// Default monitors the wheels of this robot. It is fed by the MCU link.
+var Default = New(DefaultConfig)
+
+// Configure replaces the configuration and starts a new block. Turning
+// Faults off clears the motor faults.
+func (m *Monitor) Configure(cfg Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg = cfg
+	m.blockStart = time.Time{}
+	m.blocks = [NumWheels]block{}
+	if !cfg.Faults {
+		for _, code := range faultCodes {
+			fault.Clear(code)
+		}
+	}
+}
+
+// Config returns the current configuration.
+func (m *Monitor) Config() Config {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg
+}
+
+// Command sets the body velocity the MCU was sent: vx, vy in m/s, omega in
+// rad/s.
+func (m *Monitor) Command(vx, vy, omega float64) {
+	m.mu.Lock()
+	m.cmd = [3]float64{vx, vy, omega}
+	m.mu.Unlock()
+}
+
+// Observe feeds the wheel speeds received at now (m/s, and the raw MCU
+// values) and returns the tracking error (expected - measured) per wheel.
+func (m *Monitor) Observe(now time.Time, measured [NumWheels]float64, raw [NumWheels]int16) [NumWheels]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expected := m.cfg.Geometry.Expected(m.cmd[0], m.cmd[1], m.cmd[2])
+	var errs [NumWheels]float64
+	for i := range expected {
+		errs[i] = expected[i] - measured[i]
+		w := &m.wheels[i]
+		w.Expected = float32(expected[i])
+		w.Measured = float32(measured[i])
+		w.Error = float32(errs[i])
+		m.blocks[i].add(expected[i], measured[i], raw[i], m.cfg.MinSpeed)
+	}
+
+	if m.blockStart.IsZero() {
+		m.blockStart = now
+	}
+	if now.Sub(m.blockStart) >= m.cfg.Window {
+		m.closeBlock(now)
+	}
+	return errs
+}
+
+// closeBlock judges the wheels on the finished block. Unsteady blocks keep
+// the previous condition.
+func (m *Monitor) closeBlock(now time.Time) {
+	for i := range m.blocks {
+		b := &m.blocks[i]
+		w := &m.wheels[i]
+		w.RMSError = float32(math.Sqrt(b.sumSqErr / float64(b.n)))
+		if b.steady {
+			c := b.judge(m.cfg.StallRatio)
+			if c != w.Condition {
+				w.Condition = c
+				w.Since = now
+			}
+			if m.cfg.Faults {
+				m.report(i, b)
+			}
+		}
+		*b = block{}
+	}
+	m.blockStart = now
+}
+
+func (m *Monitor) report(i int, b *block) {
+	w := &m.wheels[i]
+	if w.Condition == OK {
+		fault.Clear(faultCodes[i])
+		return
+	}
+	fault.Raise(faultCodes[i], fmt.Sprintf("%s motor %s (expected %.2f m/s, measured %.2f m/s)",
+		w.Name, w.Condition, b.sumExp/float64(b.n), b.sumMeas/float64(b.n)))
+}
+
+// Errors returns the latest tracking error (expected - measured, m/s) per
+// wheel.
+func (m *Monitor) Errors() [NumWheels]float32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs [NumWheels]float32
+	for i, w := range m.wheels {
+		errs[i] = w.Error
+	}
+	return errs
+}
+
+// Status returns the tracking of every wheel.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Status{Wheels: m.wheels}
+}
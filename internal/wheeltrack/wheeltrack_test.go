@@ -0,0 +1,152 @@
+package wheeltrack
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Rione/ssl-RACOON-Pi2/internal/fault"
+)
+
+func TestExpected(t *testing.T) {
+	g := Geometry{AnglesDeg: [NumWheels]float64{90, 180, 270, 0}, RadiusM: 0.1}
+	cases := []struct {
+		vx, vy, omega float64
+		want          [NumWheels]float64
+	}{
+		// Forward: the side wheels (90°, 270°) drive, the others roll.
+		{1, 0, 0, [NumWheels]float64{-1, 0, 1, 0}},
+		{0, 1, 0, [NumWheels]float64{0, -1, 0, 1}},
+		// Turning: every wheel at radius * omega.
+		{0, 0, 2, [NumWheels]float64{0.2, 0.2, 0.2, 0.2}},
+	}
+	for _, c := range cases {
+		got := g.Expected(c.vx, c.vy, c.omega)
+		for i := range got {
+			if math.Abs(got[i]-c.want[i]) > 1e-9 {
+				t.Errorf("Expected(%v, %v, %v) = %v, want %v", c.vx, c.vy, c.omega, got, c.want)
+				break
+			}
+		}
+	}
+
+	// An inverted wheel reports the opposite sign.
+	g.Inverted[BL] = true
+	if got := g.Expected(0, 0, 2); got != [NumWheels]float64{0.2, -0.2, 0.2, 0.2} {
+		t.Errorf("inverted BL: %v", got)
+	}
+}
+
+func TestBody(t *testing.T) {
+	g := DefaultConfig.Geometry
+	g.Inverted[FR] = true
+	vx, vy, omega := g.Body(g.Expected(1.2, -0.5, 3))
+	if math.Abs(vx-1.2) > 1e-9 || math.Abs(vy+0.5) > 1e-9 || math.Abs(omega-3) > 1e-9 {
+		t.Fatalf("Body(Expected) = %v, %v, %v", vx, vy, omega)
+	}
+	if vx, vy, omega := (Geometry{}).Body([NumWheels]float64{1, 1, 1, 1}); vx != 0 || vy != 0 || omega != 0 {
+		t.Fatalf("degenerate geometry: %v, %v, %v", vx, vy, omega)
+	}
+}
+
+// drive feeds link cycles (10 ms) for d, where the wheels turn at
+// measured(expected) and returns the time after them.
+func drive(m *Monitor, now time.Time, d time.Duration, measured func(i int, exp float64) (float64, int16)) time.Time {
+	for end := now.Add(d); now.Before(end); now = now.Add(10 * time.Millisecond) {
+		var meas [NumWheels]float64
+		var raw [NumWheels]int16
+		st := m.Status()
+		for i, w := range st.Wheels {
+			meas[i], raw[i] = measured(i, float64(w.Expected))
+		}
+		m.Observe(now, meas, raw)
+	}
+	return now
+}
+
+func tracking(i int, exp float64) (float64, int16) {
+	return exp, int16(exp * 100)
+}
+
+func TestFaults(t *testing.T) {
+	m := New(DefaultConfig)
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// The expected speeds are known from the first Observe on.
+	m.Command(0, 0, 5) // 0.4 m/s on every wheel
+	m.Observe(t0, [NumWheels]float64{}, [NumWheels]int16{})
+	m.Configure(DefaultConfig)
+
+	now := drive(m, t0, time.Second, tracking)
+	for _, w := range m.Status().Wheels {
+		if w.Condition != OK || w.RMSError > 1e-6 {
+			t.Fatalf("tracking wheel: %+v", w)
+		}
+	}
+
+	// FL does not move, BL turns backwards, BR reports nothing.
+	broken := func(i int, exp float64) (float64, int16) {
+		switch i {
+		case FL:
+			return 0.01, 1
+		case BL:
+			return -exp, -int16(exp * 100)
+		case BR:
+			return 0, 0
+		}
+		return tracking(i, exp)
+	}
+	now = drive(m, now, time.Second, broken)
+	want := [NumWheels]Condition{Stalled, Reversed, Disconnected, OK}
+	for i, w := range m.Status().Wheels {
+		if w.Condition != want[i] {
+			t.Errorf("%s: %s, want %s", w.Name, w.Condition, want[i])
+		}
+	}
+	if !fault.IsActive(fault.CodeMotorFL) || !fault.IsActive(fault.CodeMotorBL) || !fault.IsActive(fault.CodeMotorBR) || fault.IsActive(fault.CodeMotorFR) {
+		t.Fatalf("faults = %+v", fault.Active())
+	}
+
+	// Stopped, nothing is judged and the faults stay.
+	m.Command(0, 0, 0)
+	now = drive(m, now, time.Second, func(int, float64) (float64, int16) { return 0, 0 })
+	if !fault.IsActive(fault.CodeMotorFL) {
+		t.Fatal("fault cleared while stopped")
+	}
+
+	// Tracking again clears them.
+	m.Command(0, 0, 5)
+	drive(m, now, 1100*time.Millisecond, tracking)
+	for _, code := range faultCodes {
+		if fault.IsActive(code) {
+			t.Fatalf("fault %d still active", code)
+		}
+	}
+}
+
+func TestUnsteadyNotJudged(t *testing.T) {
+	cfg := DefaultConfig
+	m := New(cfg)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// The command reverses every 100 ms: the MCU cannot follow, but no wheel
+	// is blamed for it.
+	for i := 0; i < 10; i++ {
+		m.Command(0, 0, float64(5-10*(i%2)))
+		now = drive(m, now, 100*time.Millisecond, func(int, float64) (float64, int16) { return 0.01, 1 })
+	}
+	for _, w := range m.Status().Wheels {
+		if w.Condition != OK || w.RMSError == 0 {
+			t.Fatalf("unsteady wheel: %+v", w)
+		}
+	}
+
+	// Without Faults the condition is reported but no fault is raised.
+	cfg.Faults = false
+	m.Configure(cfg)
+	m.Command(0, 0, 5)
+	drive(m, now, 1100*time.Millisecond, func(int, float64) (float64, int16) { return 0, 0 })
+	if m.Status().Wheels[FL].Condition != Disconnected || fault.IsActive(fault.CodeMotorFL) {
+		t.Fatalf("faults off: %+v, %+v", m.Status().Wheels[FL], fault.Active())
+	}
+}
@@ -21,6 +21,257 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Detection_Class int32
+
+const (
+	Detection_Class_DETECTION_BALL  Detection_Class = 0
+	Detection_Class_DETECTION_ROBOT Detection_Class = 1
+	Detection_Class_DETECTION_GOAL  Detection_Class = 2
+)
+
+// Enum value maps for Detection_Class.
+var (
+	Detection_Class_name = map[int32]string{
+		0: "DETECTION_BALL",
+		1: "DETECTION_ROBOT",
+		2: "DETECTION_GOAL",
+	}
+	Detection_Class_value = map[string]int32{
+		"DETECTION_BALL":  0,
+		"DETECTION_ROBOT": 1,
+		"DETECTION_GOAL":  2,
+	}
+)
+
+func (x Detection_Class) Enum() *Detection_Class {
+	p := new(Detection_Class)
+	*p = x
+	return p
+}
+
+func (x Detection_Class) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Detection_Class) Descriptor() protoreflect.EnumDescriptor {
+	return file_pi_to_mw_proto_enumTypes[0].Descriptor()
+}
+
+func (Detection_Class) Type() protoreflect.EnumType {
+	return &file_pi_to_mw_proto_enumTypes[0]
+}
+
+func (x Detection_Class) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *Detection_Class) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = Detection_Class(num)
+	return nil
+}
+
+// Deprecated: Use Detection_Class.Descriptor instead.
+func (Detection_Class) EnumDescriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{0}
+}
+
+type Ball_Possession int32
+
+const (
+	// どのセンサーもボールを捉えていない。
+	Ball_Possession_POSSESSION_NONE Ball_Possession = 0
+	// カメラには写っているが、ドリブラーには来ていない。
+	Ball_Possession_POSSESSION_SEEN Ball_Possession = 1
+	// フォトセンサーは反応しているが、カメラ・ドリブラーセンサーで確認できない
+	// (他のロボットや手でセンサーが遮られている可能性)。
+	Ball_Possession_POSSESSION_UNCONFIRMED Ball_Possession = 2
+	// フォトセンサーの反応をカメラまたはドリブラーセンサーで確認済み。
+	Ball_Possession_POSSESSION_HELD Ball_Possession = 3
+)
+
+// Enum value maps for Ball_Possession.
+var (
+	Ball_Possession_name = map[int32]string{
+		0: "POSSESSION_NONE",
+		1: "POSSESSION_SEEN",
+		2: "POSSESSION_UNCONFIRMED",
+		3: "POSSESSION_HELD",
+	}
+	Ball_Possession_value = map[string]int32{
+		"POSSESSION_NONE":        0,
+		"POSSESSION_SEEN":        1,
+		"POSSESSION_UNCONFIRMED": 2,
+		"POSSESSION_HELD":        3,
+	}
+)
+
+func (x Ball_Possession) Enum() *Ball_Possession {
+	p := new(Ball_Possession)
+	*p = x
+	return p
+}
+
+func (x Ball_Possession) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Ball_Possession) Descriptor() protoreflect.EnumDescriptor {
+	return file_pi_to_mw_proto_enumTypes[1].Descriptor()
+}
+
+func (Ball_Possession) Type() protoreflect.EnumType {
+	return &file_pi_to_mw_proto_enumTypes[1]
+}
+
+func (x Ball_Possession) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *Ball_Possession) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = Ball_Possession(num)
+	return nil
+}
+
+// Deprecated: Use Ball_Possession.Descriptor instead.
+func (Ball_Possession) EnumDescriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{1}
+}
+
+type Camera_Process_State int32
+
+const (
+	Camera_Process_State_CAMERA_STOPPED Camera_Process_State = 0
+	Camera_Process_State_CAMERA_RUNNING Camera_Process_State = 1
+	Camera_Process_State_CAMERA_EXITED  Camera_Process_State = 2
+	// 異常終了・応答停止後、バックオフ待ちで再起動予定。
+	Camera_Process_State_CAMERA_RESTARTING Camera_Process_State = 3
+)
+
+// Enum value maps for Camera_Process_State.
+var (
+	Camera_Process_State_name = map[int32]string{
+		0: "CAMERA_STOPPED",
+		1: "CAMERA_RUNNING",
+		2: "CAMERA_EXITED",
+		3: "CAMERA_RESTARTING",
+	}
+	Camera_Process_State_value = map[string]int32{
+		"CAMERA_STOPPED":    0,
+		"CAMERA_RUNNING":    1,
+		"CAMERA_EXITED":     2,
+		"CAMERA_RESTARTING": 3,
+	}
+)
+
+func (x Camera_Process_State) Enum() *Camera_Process_State {
+	p := new(Camera_Process_State)
+	*p = x
+	return p
+}
+
+func (x Camera_Process_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Camera_Process_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_pi_to_mw_proto_enumTypes[2].Descriptor()
+}
+
+func (Camera_Process_State) Type() protoreflect.EnumType {
+	return &file_pi_to_mw_proto_enumTypes[2]
+}
+
+func (x Camera_Process_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *Camera_Process_State) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = Camera_Process_State(num)
+	return nil
+}
+
+// Deprecated: Use Camera_Process_State.Descriptor instead.
+func (Camera_Process_State) EnumDescriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{2}
+}
+
+type Command_Ack_Status int32
+
+const (
+	Command_Ack_Status_ACK_ACCEPTED Command_Ack_Status = 0
+	Command_Ack_Status_ACK_DONE     Command_Ack_Status = 1
+	Command_Ack_Status_ACK_FAILED   Command_Ack_Status = 2
+	Command_Ack_Status_ACK_REJECTED Command_Ack_Status = 3
+)
+
+// Enum value maps for Command_Ack_Status.
+var (
+	Command_Ack_Status_name = map[int32]string{
+		0: "ACK_ACCEPTED",
+		1: "ACK_DONE",
+		2: "ACK_FAILED",
+		3: "ACK_REJECTED",
+	}
+	Command_Ack_Status_value = map[string]int32{
+		"ACK_ACCEPTED": 0,
+		"ACK_DONE":     1,
+		"ACK_FAILED":   2,
+		"ACK_REJECTED": 3,
+	}
+)
+
+func (x Command_Ack_Status) Enum() *Command_Ack_Status {
+	p := new(Command_Ack_Status)
+	*p = x
+	return p
+}
+
+func (x Command_Ack_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Command_Ack_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_pi_to_mw_proto_enumTypes[3].Descriptor()
+}
+
+func (Command_Ack_Status) Type() protoreflect.EnumType {
+	return &file_pi_to_mw_proto_enumTypes[3]
+}
+
+func (x Command_Ack_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *Command_Ack_Status) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = Command_Ack_Status(num)
+	return nil
+}
+
+// Deprecated: Use Command_Ack_Status.Descriptor instead.
+func (Command_Ack_Status) EnumDescriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{3}
+}
+
 type PiToMw struct {
 	state        protoimpl.MessageState `protogen:"open.v1"`
 	RobotsStatus *Robot_Status          `protobuf:"bytes,1,req,name=robots_status,json=robotsStatus" json:"robots_status,omitempty"`
@@ -30,7 +281,17 @@ type PiToMw struct {
 	IsNewRobot *bool `protobuf:"varint,4,req,name=is_new_robot,json=isNewRobot" json:"is_new_robot,omitempty"`
 	// MACアドレス(NIC由来)。各ロボットの基板を一意に識別し、モータ個体差の
 	// 管理に使う。"aa:bb:cc:dd:ee:ff" 形式。取得できない場合は未設定。
-	MacAddress    *string `protobuf:"bytes,5,opt,name=mac_address,json=macAddress" json:"mac_address,omitempty"`
+	MacAddress *string `protobuf:"bytes,5,opt,name=mac_address,json=macAddress" json:"mac_address,omitempty"`
+	// ロボットの健全性情報。コントローラUIが各ロボットのHTTP APIを
+	// ポーリングせずに状態を表示するために使う。
+	Diagnostics *Robot_Diagnostics `protobuf:"bytes,6,opt,name=diagnostics" json:"diagnostics,omitempty"`
+	// 直近に受け付けた MwToPi コマンドの処理状況。同じ ACK が数秒間
+	// 繰り返し載るので、受信側は command_id と status で重複を判別する。
+	CommandAcks []*Command_Ack `protobuf:"bytes,7,rep,name=command_acks,json=commandAcks" json:"command_acks,omitempty"`
+	// カメラの検出結果 (ボール・ロボット・ゴール)。追跡中のボールが先頭で
+	// selected が true、残りはカメラ側の順位順。件数は config.json の
+	// camera.forwardDetections まで。カメラの鮮度タイムアウト後は空。
+	Detections    []*Camera_Detection `protobuf:"bytes,8,rep,name=detections" json:"detections,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -100,6 +361,140 @@ func (x *PiToMw) GetMacAddress() string {
 	return ""
 }
 
+func (x *PiToMw) GetDiagnostics() *Robot_Diagnostics {
+	if x != nil {
+		return x.Diagnostics
+	}
+	return nil
+}
+
+func (x *PiToMw) GetCommandAcks() []*Command_Ack {
+	if x != nil {
+		return x.CommandAcks
+	}
+	return nil
+}
+
+func (x *PiToMw) GetDetections() []*Camera_Detection {
+	if x != nil {
+		return x.Detections
+	}
+	return nil
+}
+
+type Camera_Detection struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Class *Detection_Class       `protobuf:"varint,1,req,name=class,enum=Detection_Class" json:"class,omitempty"`
+	// バウンディングボックス中心。ball_camera_x/y と同じ座標系 (画像中心が原点、y 上向き、px)。
+	CenterX *float32 `protobuf:"fixed32,2,req,name=center_x,json=centerX" json:"center_x,omitempty"`
+	CenterY *float32 `protobuf:"fixed32,3,req,name=center_y,json=centerY" json:"center_y,omitempty"`
+	// バウンディングボックスの幅・高さ [px]。
+	Width  *float32 `protobuf:"fixed32,4,req,name=width" json:"width,omitempty"`
+	Height *float32 `protobuf:"fixed32,5,req,name=height" json:"height,omitempty"`
+	// 0-1。HSV 検出は 1。
+	Confidence *float32 `protobuf:"fixed32,6,req,name=confidence" json:"confidence,omitempty"`
+	Selected   *bool    `protobuf:"varint,7,opt,name=selected" json:"selected,omitempty"`
+	// ロボット中心原点の床面座標 [mm] (x 前方、y 左)。投影できたときのみ。
+	// ボールは中心、それ以外はバウンディングボックス下端の中央 (床との接地点) を投影する。
+	GroundX       *float32 `protobuf:"fixed32,8,opt,name=ground_x,json=groundX" json:"ground_x,omitempty"`
+	GroundY       *float32 `protobuf:"fixed32,9,opt,name=ground_y,json=groundY" json:"ground_y,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Camera_Detection) Reset() {
+	*x = Camera_Detection{}
+	mi := &file_pi_to_mw_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Camera_Detection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Camera_Detection) ProtoMessage() {}
+
+func (x *Camera_Detection) ProtoReflect() protoreflect.Message {
+	mi := &file_pi_to_mw_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Camera_Detection.ProtoReflect.Descriptor instead.
+func (*Camera_Detection) Descriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Camera_Detection) GetClass() Detection_Class {
+	if x != nil && x.Class != nil {
+		return *x.Class
+	}
+	return Detection_Class_DETECTION_BALL
+}
+
+func (x *Camera_Detection) GetCenterX() float32 {
+	if x != nil && x.CenterX != nil {
+		return *x.CenterX
+	}
+	return 0
+}
+
+func (x *Camera_Detection) GetCenterY() float32 {
+	if x != nil && x.CenterY != nil {
+		return *x.CenterY
+	}
+	return 0
+}
+
+func (x *Camera_Detection) GetWidth() float32 {
+	if x != nil && x.Width != nil {
+		return *x.Width
+	}
+	return 0
+}
+
+func (x *Camera_Detection) GetHeight() float32 {
+	if x != nil && x.Height != nil {
+		return *x.Height
+	}
+	return 0
+}
+
+func (x *Camera_Detection) GetConfidence() float32 {
+	if x != nil && x.Confidence != nil {
+		return *x.Confidence
+	}
+	return 0
+}
+
+func (x *Camera_Detection) GetSelected() bool {
+	if x != nil && x.Selected != nil {
+		return *x.Selected
+	}
+	return false
+}
+
+func (x *Camera_Detection) GetGroundX() float32 {
+	if x != nil && x.GroundX != nil {
+		return *x.GroundX
+	}
+	return 0
+}
+
+func (x *Camera_Detection) GetGroundY() float32 {
+	if x != nil && x.GroundY != nil {
+		return *x.GroundY
+	}
+	return 0
+}
+
 type Robot_Status struct {
 	state                  protoimpl.MessageState `protogen:"open.v1"`
 	RobotId                *uint32                `protobuf:"varint,1,req,name=robot_id,json=robotId" json:"robot_id,omitempty"`
@@ -118,7 +513,7 @@ type Robot_Status struct {
 
 func (x *Robot_Status) Reset() {
 	*x = Robot_Status{}
-	mi := &file_pi_to_mw_proto_msgTypes[1]
+	mi := &file_pi_to_mw_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -130,7 +525,7 @@ func (x *Robot_Status) String() string {
 func (*Robot_Status) ProtoMessage() {}
 
 func (x *Robot_Status) ProtoReflect() protoreflect.Message {
-	mi := &file_pi_to_mw_proto_msgTypes[1]
+	mi := &file_pi_to_mw_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -143,7 +538,7 @@ func (x *Robot_Status) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Robot_Status.ProtoReflect.Descriptor instead.
 func (*Robot_Status) Descriptor() ([]byte, []int) {
-	return file_pi_to_mw_proto_rawDescGZIP(), []int{1}
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *Robot_Status) GetRobotId() uint32 {
@@ -217,17 +612,30 @@ func (x *Robot_Status) GetFrWheelSpeed() float32 {
 }
 
 type Ball_Status struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	IsBallExit    *bool                  `protobuf:"varint,1,req,name=is_ball_exit,json=isBallExit" json:"is_ball_exit,omitempty"`
-	BallCameraX   *float32               `protobuf:"fixed32,2,req,name=ball_camera_x,json=ballCameraX" json:"ball_camera_x,omitempty"`
-	BallCameraY   *float32               `protobuf:"fixed32,3,req,name=ball_camera_y,json=ballCameraY" json:"ball_camera_y,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	IsBallExit  *bool                  `protobuf:"varint,1,req,name=is_ball_exit,json=isBallExit" json:"is_ball_exit,omitempty"`
+	BallCameraX *float32               `protobuf:"fixed32,2,req,name=ball_camera_x,json=ballCameraX" json:"ball_camera_x,omitempty"`
+	BallCameraY *float32               `protobuf:"fixed32,3,req,name=ball_camera_y,json=ballCameraY" json:"ball_camera_y,omitempty"`
+	// 最新のカメラ検出結果を受信してからの経過時間。一度も受信していなければ未設定。
+	// カメラの鮮度タイムアウトを超えると is_ball_exit は false になる。
+	CameraAgeMs *uint32 `protobuf:"varint,4,opt,name=camera_age_ms,json=cameraAgeMs" json:"camera_age_ms,omitempty"`
+	// 追跡フィルタ (alpha-beta) の推定値。追跡中でなければ未設定。
+	Track *Ball_Track `protobuf:"bytes,5,opt,name=track" json:"track,omitempty"`
+	// 検出したボールのロボット中心原点の床面座標 [mm] (x 前方、y 左)。
+	// カメラキャリブレーション (または外部パラメータ設定) があり、床上に投影できたときのみ。
+	BallGroundX *float32 `protobuf:"fixed32,6,opt,name=ball_ground_x,json=ballGroundX" json:"ball_ground_x,omitempty"`
+	BallGroundY *float32 `protobuf:"fixed32,7,opt,name=ball_ground_y,json=ballGroundY" json:"ball_ground_y,omitempty"`
+	// フォトセンサー・ドリブラーセンサー・カメラを統合したボール保持状態 (internal/possession)。
+	Possession *Ball_Possession `protobuf:"varint,8,opt,name=possession,enum=Ball_Possession" json:"possession,omitempty"`
+	// possession が現在の状態になってからの経過時間。
+	PossessionMs  *uint32 `protobuf:"varint,9,opt,name=possession_ms,json=possessionMs" json:"possession_ms,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Ball_Status) Reset() {
 	*x = Ball_Status{}
-	mi := &file_pi_to_mw_proto_msgTypes[2]
+	mi := &file_pi_to_mw_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -239,7 +647,7 @@ func (x *Ball_Status) String() string {
 func (*Ball_Status) ProtoMessage() {}
 
 func (x *Ball_Status) ProtoReflect() protoreflect.Message {
-	mi := &file_pi_to_mw_proto_msgTypes[2]
+	mi := &file_pi_to_mw_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -252,7 +660,7 @@ func (x *Ball_Status) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ball_Status.ProtoReflect.Descriptor instead.
 func (*Ball_Status) Descriptor() ([]byte, []int) {
-	return file_pi_to_mw_proto_rawDescGZIP(), []int{2}
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Ball_Status) GetIsBallExit() bool {
@@ -276,6 +684,159 @@ func (x *Ball_Status) GetBallCameraY() float32 {
 	return 0
 }
 
+func (x *Ball_Status) GetCameraAgeMs() uint32 {
+	if x != nil && x.CameraAgeMs != nil {
+		return *x.CameraAgeMs
+	}
+	return 0
+}
+
+func (x *Ball_Status) GetTrack() *Ball_Track {
+	if x != nil {
+		return x.Track
+	}
+	return nil
+}
+
+func (x *Ball_Status) GetBallGroundX() float32 {
+	if x != nil && x.BallGroundX != nil {
+		return *x.BallGroundX
+	}
+	return 0
+}
+
+func (x *Ball_Status) GetBallGroundY() float32 {
+	if x != nil && x.BallGroundY != nil {
+		return *x.BallGroundY
+	}
+	return 0
+}
+
+func (x *Ball_Status) GetPossession() Ball_Possession {
+	if x != nil && x.Possession != nil {
+		return *x.Possession
+	}
+	return Ball_Possession_POSSESSION_NONE
+}
+
+func (x *Ball_Status) GetPossessionMs() uint32 {
+	if x != nil && x.PossessionMs != nil {
+		return *x.PossessionMs
+	}
+	return 0
+}
+
+type Ball_Track struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 検出が途切れ、推定速度で外挿している間は true。
+	Coasting *bool `protobuf:"varint,1,req,name=coasting" json:"coasting,omitempty"`
+	// カメラ座標 [px] (画像中心原点、y 上向き) と速度 [px/s]。
+	X  *float32 `protobuf:"fixed32,2,req,name=x" json:"x,omitempty"`
+	Y  *float32 `protobuf:"fixed32,3,req,name=y" json:"y,omitempty"`
+	Vx *float32 `protobuf:"fixed32,4,req,name=vx" json:"vx,omitempty"`
+	Vy *float32 `protobuf:"fixed32,5,req,name=vy" json:"vy,omitempty"`
+	// カメラキャリブレーション (または外部パラメータ設定) 時のみ: ロボット中心原点の床面座標 [mm] (x 前方、y 左) と速度 [mm/s]。
+	GroundX       *float32 `protobuf:"fixed32,6,opt,name=ground_x,json=groundX" json:"ground_x,omitempty"`
+	GroundY       *float32 `protobuf:"fixed32,7,opt,name=ground_y,json=groundY" json:"ground_y,omitempty"`
+	GroundVx      *float32 `protobuf:"fixed32,8,opt,name=ground_vx,json=groundVx" json:"ground_vx,omitempty"`
+	GroundVy      *float32 `protobuf:"fixed32,9,opt,name=ground_vy,json=groundVy" json:"ground_vy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ball_Track) Reset() {
+	*x = Ball_Track{}
+	mi := &file_pi_to_mw_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ball_Track) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ball_Track) ProtoMessage() {}
+
+func (x *Ball_Track) ProtoReflect() protoreflect.Message {
+	mi := &file_pi_to_mw_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ball_Track.ProtoReflect.Descriptor instead.
+func (*Ball_Track) Descriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Ball_Track) GetCoasting() bool {
+	if x != nil && x.Coasting != nil {
+		return *x.Coasting
+	}
+	return false
+}
+
+func (x *Ball_Track) GetX() float32 {
+	if x != nil && x.X != nil {
+		return *x.X
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetY() float32 {
+	if x != nil && x.Y != nil {
+		return *x.Y
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetVx() float32 {
+	if x != nil && x.Vx != nil {
+		return *x.Vx
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetVy() float32 {
+	if x != nil && x.Vy != nil {
+		return *x.Vy
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetGroundX() float32 {
+	if x != nil && x.GroundX != nil {
+		return *x.GroundX
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetGroundY() float32 {
+	if x != nil && x.GroundY != nil {
+		return *x.GroundY
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetGroundVx() float32 {
+	if x != nil && x.GroundVx != nil {
+		return *x.GroundVx
+	}
+	return 0
+}
+
+func (x *Ball_Track) GetGroundVy() float32 {
+	if x != nil && x.GroundVy != nil {
+		return *x.GroundVy
+	}
+	return 0
+}
+
 type Ball struct {
 	state                protoimpl.MessageState `protogen:"open.v1"`
 	MinThreshold         *string                `protobuf:"bytes,1,req,name=min_threshold,json=minThreshold" json:"min_threshold,omitempty"`
@@ -288,7 +849,7 @@ type Ball struct {
 
 func (x *Ball) Reset() {
 	*x = Ball{}
-	mi := &file_pi_to_mw_proto_msgTypes[3]
+	mi := &file_pi_to_mw_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -300,7 +861,7 @@ func (x *Ball) String() string {
 func (*Ball) ProtoMessage() {}
 
 func (x *Ball) ProtoReflect() protoreflect.Message {
-	mi := &file_pi_to_mw_proto_msgTypes[3]
+	mi := &file_pi_to_mw_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -313,7 +874,7 @@ func (x *Ball) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ball.ProtoReflect.Descriptor instead.
 func (*Ball) Descriptor() ([]byte, []int) {
-	return file_pi_to_mw_proto_rawDescGZIP(), []int{3}
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Ball) GetMinThreshold() string {
@@ -344,11 +905,297 @@ func (x *Ball) GetCircularityThreshold() float32 {
 	return 0
 }
 
+type Robot_Fault struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          *uint32                `protobuf:"varint,1,req,name=code" json:"code,omitempty"`
+	Message       *string                `protobuf:"bytes,2,req,name=message" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Robot_Fault) Reset() {
+	*x = Robot_Fault{}
+	mi := &file_pi_to_mw_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Robot_Fault) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Robot_Fault) ProtoMessage() {}
+
+func (x *Robot_Fault) ProtoReflect() protoreflect.Message {
+	mi := &file_pi_to_mw_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Robot_Fault.ProtoReflect.Descriptor instead.
+func (*Robot_Fault) Descriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Robot_Fault) GetCode() uint32 {
+	if x != nil && x.Code != nil {
+		return *x.Code
+	}
+	return 0
+}
+
+func (x *Robot_Fault) GetMessage() string {
+	if x != nil && x.Message != nil {
+		return *x.Message
+	}
+	return ""
+}
+
+type Robot_Diagnostics struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ビルド時に埋め込まれたバージョン (例: "1.2.3")。開発ビルドでは "(devel)" 等。
+	// MCU のファームウェアバージョンは含まない。MCU からの受信フレーム (電圧・センサー・
+	// ホイール速度・フッター) にバージョンの欄がなく、Pi 側からは取得できないため。
+	SoftwareVersion *string `protobuf:"bytes,1,opt,name=software_version,json=softwareVersion" json:"software_version,omitempty"`
+	// "pi4" または "rock5a"。
+	Board    *string `protobuf:"bytes,2,opt,name=board" json:"board,omitempty"`
+	UptimeMs *uint64 `protobuf:"varint,3,opt,name=uptime_ms,json=uptimeMs" json:"uptime_ms,omitempty"`
+	// OK_ROBOT 送信から OK_PC 受信までの時間 (接続確立時のハンドシェイクで計測)。
+	ConnectionRttMs *float32 `protobuf:"fixed32,4,opt,name=connection_rtt_ms,json=connectionRttMs" json:"connection_rtt_ms,omitempty"`
+	// MCU とのリンク (UART/SPI) で検出した受信フレーム異常・送信失敗の累計。
+	LinkRxErrors   *uint32               `protobuf:"varint,5,opt,name=link_rx_errors,json=linkRxErrors" json:"link_rx_errors,omitempty"`
+	LinkTxErrors   *uint32               `protobuf:"varint,6,opt,name=link_tx_errors,json=linkTxErrors" json:"link_tx_errors,omitempty"`
+	CameraFps      *float32              `protobuf:"fixed32,7,opt,name=camera_fps,json=cameraFps" json:"camera_fps,omitempty"`
+	CameraState    *Camera_Process_State `protobuf:"varint,8,opt,name=camera_state,json=cameraState,enum=Camera_Process_State" json:"camera_state,omitempty"`
+	Faults         []*Robot_Fault        `protobuf:"bytes,9,rep,name=faults" json:"faults,omitempty"`
+	DryRun         *bool                 `protobuf:"varint,10,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	ControlByRobot *bool                 `protobuf:"varint,11,opt,name=control_by_robot,json=controlByRobot" json:"control_by_robot,omitempty"`
+	// CPU 温度 [°C]。取得できない場合は未設定。
+	CpuTemperature *float32 `protobuf:"fixed32,12,opt,name=cpu_temperature,json=cpuTemperature" json:"cpu_temperature,omitempty"`
+	// 現在追従しているコントローラの IP アドレス。探索中は未設定。
+	ControllerAddress *string `protobuf:"bytes,13,opt,name=controller_address,json=controllerAddress" json:"controller_address,omitempty"`
+	// API でコントローラが固定 (pin) されているか。
+	ControllerPinned *bool `protobuf:"varint,14,opt,name=controller_pinned,json=controllerPinned" json:"controller_pinned,omitempty"`
+	// カメラプロセスの自動再起動回数と最後の終了コード (シグナル終了は -1)。
+	CameraRestarts *uint32 `protobuf:"varint,15,opt,name=camera_restarts,json=cameraRestarts" json:"camera_restarts,omitempty"`
+	CameraExitCode *int32  `protobuf:"zigzag32,16,opt,name=camera_exit_code,json=cameraExitCode" json:"camera_exit_code,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Robot_Diagnostics) Reset() {
+	*x = Robot_Diagnostics{}
+	mi := &file_pi_to_mw_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Robot_Diagnostics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Robot_Diagnostics) ProtoMessage() {}
+
+func (x *Robot_Diagnostics) ProtoReflect() protoreflect.Message {
+	mi := &file_pi_to_mw_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Robot_Diagnostics.ProtoReflect.Descriptor instead.
+func (*Robot_Diagnostics) Descriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Robot_Diagnostics) GetSoftwareVersion() string {
+	if x != nil && x.SoftwareVersion != nil {
+		return *x.SoftwareVersion
+	}
+	return ""
+}
+
+func (x *Robot_Diagnostics) GetBoard() string {
+	if x != nil && x.Board != nil {
+		return *x.Board
+	}
+	return ""
+}
+
+func (x *Robot_Diagnostics) GetUptimeMs() uint64 {
+	if x != nil && x.UptimeMs != nil {
+		return *x.UptimeMs
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetConnectionRttMs() float32 {
+	if x != nil && x.ConnectionRttMs != nil {
+		return *x.ConnectionRttMs
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetLinkRxErrors() uint32 {
+	if x != nil && x.LinkRxErrors != nil {
+		return *x.LinkRxErrors
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetLinkTxErrors() uint32 {
+	if x != nil && x.LinkTxErrors != nil {
+		return *x.LinkTxErrors
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetCameraFps() float32 {
+	if x != nil && x.CameraFps != nil {
+		return *x.CameraFps
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetCameraState() Camera_Process_State {
+	if x != nil && x.CameraState != nil {
+		return *x.CameraState
+	}
+	return Camera_Process_State_CAMERA_STOPPED
+}
+
+func (x *Robot_Diagnostics) GetFaults() []*Robot_Fault {
+	if x != nil {
+		return x.Faults
+	}
+	return nil
+}
+
+func (x *Robot_Diagnostics) GetDryRun() bool {
+	if x != nil && x.DryRun != nil {
+		return *x.DryRun
+	}
+	return false
+}
+
+func (x *Robot_Diagnostics) GetControlByRobot() bool {
+	if x != nil && x.ControlByRobot != nil {
+		return *x.ControlByRobot
+	}
+	return false
+}
+
+func (x *Robot_Diagnostics) GetCpuTemperature() float32 {
+	if x != nil && x.CpuTemperature != nil {
+		return *x.CpuTemperature
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetControllerAddress() string {
+	if x != nil && x.ControllerAddress != nil {
+		return *x.ControllerAddress
+	}
+	return ""
+}
+
+func (x *Robot_Diagnostics) GetControllerPinned() bool {
+	if x != nil && x.ControllerPinned != nil {
+		return *x.ControllerPinned
+	}
+	return false
+}
+
+func (x *Robot_Diagnostics) GetCameraRestarts() uint32 {
+	if x != nil && x.CameraRestarts != nil {
+		return *x.CameraRestarts
+	}
+	return 0
+}
+
+func (x *Robot_Diagnostics) GetCameraExitCode() int32 {
+	if x != nil && x.CameraExitCode != nil {
+		return *x.CameraExitCode
+	}
+	return 0
+}
+
+type Command_Ack struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommandId     *uint32                `protobuf:"varint,1,req,name=command_id,json=commandId" json:"command_id,omitempty"`
+	Status        *Command_Ack_Status    `protobuf:"varint,2,req,name=status,enum=Command_Ack_Status" json:"status,omitempty"`
+	Message       *string                `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command_Ack) Reset() {
+	*x = Command_Ack{}
+	mi := &file_pi_to_mw_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command_Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command_Ack) ProtoMessage() {}
+
+func (x *Command_Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_pi_to_mw_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command_Ack.ProtoReflect.Descriptor instead.
+func (*Command_Ack) Descriptor() ([]byte, []int) {
+	return file_pi_to_mw_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Command_Ack) GetCommandId() uint32 {
+	if x != nil && x.CommandId != nil {
+		return *x.CommandId
+	}
+	return 0
+}
+
+func (x *Command_Ack) GetStatus() Command_Ack_Status {
+	if x != nil && x.Status != nil {
+		return *x.Status
+	}
+	return Command_Ack_Status_ACK_ACCEPTED
+}
+
+func (x *Command_Ack) GetMessage() string {
+	if x != nil && x.Message != nil {
+		return *x.Message
+	}
+	return ""
+}
+
 var File_pi_to_mw_proto protoreflect.FileDescriptor
 
 const file_pi_to_mw_proto_rawDesc = "" +
 	"\n" +
-	"\x0epi_to_mw.proto\"\xc9\x01\n" +
+	"\x0epi_to_mw.proto\"\xe3\x02\n" +
 	"\x06PiToMw\x122\n" +
 	"\rrobots_status\x18\x01 \x02(\v2\r.Robot_StatusR\frobotsStatus\x12-\n" +
 	"\vball_status\x18\x02 \x02(\v2\f.Ball_StatusR\n" +
@@ -357,7 +1204,24 @@ const file_pi_to_mw_proto_rawDesc = "" +
 	"\fis_new_robot\x18\x04 \x02(\bR\n" +
 	"isNewRobot\x12\x1f\n" +
 	"\vmac_address\x18\x05 \x01(\tR\n" +
-	"macAddress\"\x9f\x03\n" +
+	"macAddress\x124\n" +
+	"\vdiagnostics\x18\x06 \x01(\v2\x12.Robot_DiagnosticsR\vdiagnostics\x12/\n" +
+	"\fcommand_acks\x18\a \x03(\v2\f.Command_AckR\vcommandAcks\x121\n" +
+	"\n" +
+	"detections\x18\b \x03(\v2\x11.Camera_DetectionR\n" +
+	"detections\"\x90\x02\n" +
+	"\x10Camera_Detection\x12&\n" +
+	"\x05class\x18\x01 \x02(\x0e2\x10.Detection_ClassR\x05class\x12\x19\n" +
+	"\bcenter_x\x18\x02 \x02(\x02R\acenterX\x12\x19\n" +
+	"\bcenter_y\x18\x03 \x02(\x02R\acenterY\x12\x14\n" +
+	"\x05width\x18\x04 \x02(\x02R\x05width\x12\x16\n" +
+	"\x06height\x18\x05 \x02(\x02R\x06height\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x06 \x02(\x02R\n" +
+	"confidence\x12\x1a\n" +
+	"\bselected\x18\a \x01(\bR\bselected\x12\x19\n" +
+	"\bground_x\x18\b \x01(\x02R\agroundX\x12\x19\n" +
+	"\bground_y\x18\t \x01(\x02R\agroundY\"\x9f\x03\n" +
 	"\fRobot_Status\x12\x19\n" +
 	"\brobot_id\x18\x01 \x02(\rR\arobotId\x123\n" +
 	"\x16is_detect_photo_sensor\x18\x02 \x02(\bR\x13isDetectPhotoSensor\x129\n" +
@@ -369,17 +1233,83 @@ const file_pi_to_mw_proto_rawDesc = "" +
 	"\x0ebl_wheel_speed\x18\b \x01(\x02R\fblWheelSpeed\x12$\n" +
 	"\x0ebr_wheel_speed\x18\t \x01(\x02R\fbrWheelSpeed\x12$\n" +
 	"\x0efr_wheel_speed\x18\n" +
-	" \x01(\x02R\ffrWheelSpeed\"w\n" +
+	" \x01(\x02R\ffrWheelSpeed\"\xdd\x02\n" +
 	"\vBall_Status\x12 \n" +
 	"\fis_ball_exit\x18\x01 \x02(\bR\n" +
 	"isBallExit\x12\"\n" +
 	"\rball_camera_x\x18\x02 \x02(\x02R\vballCameraX\x12\"\n" +
-	"\rball_camera_y\x18\x03 \x02(\x02R\vballCameraY\"\xb3\x01\n" +
+	"\rball_camera_y\x18\x03 \x02(\x02R\vballCameraY\x12\"\n" +
+	"\rcamera_age_ms\x18\x04 \x01(\rR\vcameraAgeMs\x12!\n" +
+	"\x05track\x18\x05 \x01(\v2\v.Ball_TrackR\x05track\x12\"\n" +
+	"\rball_ground_x\x18\x06 \x01(\x02R\vballGroundX\x12\"\n" +
+	"\rball_ground_y\x18\a \x01(\x02R\vballGroundY\x120\n" +
+	"\n" +
+	"possession\x18\b \x01(\x0e2\x10.Ball_PossessionR\n" +
+	"possession\x12#\n" +
+	"\rpossession_ms\x18\t \x01(\rR\fpossessionMs\"\xd4\x01\n" +
+	"\n" +
+	"Ball_Track\x12\x1a\n" +
+	"\bcoasting\x18\x01 \x02(\bR\bcoasting\x12\f\n" +
+	"\x01x\x18\x02 \x02(\x02R\x01x\x12\f\n" +
+	"\x01y\x18\x03 \x02(\x02R\x01y\x12\x0e\n" +
+	"\x02vx\x18\x04 \x02(\x02R\x02vx\x12\x0e\n" +
+	"\x02vy\x18\x05 \x02(\x02R\x02vy\x12\x19\n" +
+	"\bground_x\x18\x06 \x01(\x02R\agroundX\x12\x19\n" +
+	"\bground_y\x18\a \x01(\x02R\agroundY\x12\x1b\n" +
+	"\tground_vx\x18\b \x01(\x02R\bgroundVx\x12\x1b\n" +
+	"\tground_vy\x18\t \x01(\x02R\bgroundVy\"\xb3\x01\n" +
 	"\x04Ball\x12#\n" +
 	"\rmin_threshold\x18\x01 \x02(\tR\fminThreshold\x12#\n" +
 	"\rmax_threshold\x18\x02 \x02(\tR\fmaxThreshold\x12,\n" +
 	"\x12ball_detect_radius\x18\x03 \x02(\x05R\x10ballDetectRadius\x123\n" +
-	"\x15circularity_threshold\x18\x04 \x02(\x02R\x14circularityThresholdB.Z,github.com/Rione/ssl-RACOON-Pi2/proto/pb_gen"
+	"\x15circularity_threshold\x18\x04 \x02(\x02R\x14circularityThreshold\";\n" +
+	"\vRobot_Fault\x12\x12\n" +
+	"\x04code\x18\x01 \x02(\rR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x02(\tR\amessage\"\x83\x05\n" +
+	"\x11Robot_Diagnostics\x12)\n" +
+	"\x10software_version\x18\x01 \x01(\tR\x0fsoftwareVersion\x12\x14\n" +
+	"\x05board\x18\x02 \x01(\tR\x05board\x12\x1b\n" +
+	"\tuptime_ms\x18\x03 \x01(\x04R\buptimeMs\x12*\n" +
+	"\x11connection_rtt_ms\x18\x04 \x01(\x02R\x0fconnectionRttMs\x12$\n" +
+	"\x0elink_rx_errors\x18\x05 \x01(\rR\flinkRxErrors\x12$\n" +
+	"\x0elink_tx_errors\x18\x06 \x01(\rR\flinkTxErrors\x12\x1d\n" +
+	"\n" +
+	"camera_fps\x18\a \x01(\x02R\tcameraFps\x128\n" +
+	"\fcamera_state\x18\b \x01(\x0e2\x15.Camera_Process_StateR\vcameraState\x12$\n" +
+	"\x06faults\x18\t \x03(\v2\f.Robot_FaultR\x06faults\x12\x17\n" +
+	"\adry_run\x18\n" +
+	" \x01(\bR\x06dryRun\x12(\n" +
+	"\x10control_by_robot\x18\v \x01(\bR\x0econtrolByRobot\x12'\n" +
+	"\x0fcpu_temperature\x18\f \x01(\x02R\x0ecpuTemperature\x12-\n" +
+	"\x12controller_address\x18\r \x01(\tR\x11controllerAddress\x12+\n" +
+	"\x11controller_pinned\x18\x0e \x01(\bR\x10controllerPinned\x12'\n" +
+	"\x0fcamera_restarts\x18\x0f \x01(\rR\x0ecameraRestarts\x12(\n" +
+	"\x10camera_exit_code\x18\x10 \x01(\x11R\x0ecameraExitCode\"s\n" +
+	"\vCommand_Ack\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x02(\rR\tcommandId\x12+\n" +
+	"\x06status\x18\x02 \x02(\x0e2\x13.Command_Ack_StatusR\x06status\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage*N\n" +
+	"\x0fDetection_Class\x12\x12\n" +
+	"\x0eDETECTION_BALL\x10\x00\x12\x13\n" +
+	"\x0fDETECTION_ROBOT\x10\x01\x12\x12\n" +
+	"\x0eDETECTION_GOAL\x10\x02*l\n" +
+	"\x0fBall_Possession\x12\x13\n" +
+	"\x0fPOSSESSION_NONE\x10\x00\x12\x13\n" +
+	"\x0fPOSSESSION_SEEN\x10\x01\x12\x1a\n" +
+	"\x16POSSESSION_UNCONFIRMED\x10\x02\x12\x13\n" +
+	"\x0fPOSSESSION_HELD\x10\x03*h\n" +
+	"\x14Camera_Process_State\x12\x12\n" +
+	"\x0eCAMERA_STOPPED\x10\x00\x12\x12\n" +
+	"\x0eCAMERA_RUNNING\x10\x01\x12\x11\n" +
+	"\rCAMERA_EXITED\x10\x02\x12\x15\n" +
+	"\x11CAMERA_RESTARTING\x10\x03*V\n" +
+	"\x12Command_Ack_Status\x12\x10\n" +
+	"\fACK_ACCEPTED\x10\x00\x12\f\n" +
+	"\bACK_DONE\x10\x01\x12\x0e\n" +
+	"\n" +
+	"ACK_FAILED\x10\x02\x12\x10\n" +
+	"\fACK_REJECTED\x10\x03B.Z,github.com/Rione/ssl-RACOON-Pi2/proto/pb_gen"
 
 var (
 	file_pi_to_mw_proto_rawDescOnce sync.Once
@@ -393,22 +1323,41 @@ func file_pi_to_mw_proto_rawDescGZIP() []byte {
 	return file_pi_to_mw_proto_rawDescData
 }
 
-var file_pi_to_mw_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_pi_to_mw_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_pi_to_mw_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_pi_to_mw_proto_goTypes = []any{
-	(*PiToMw)(nil),       // 0: PiToMw
-	(*Robot_Status)(nil), // 1: Robot_Status
-	(*Ball_Status)(nil),  // 2: Ball_Status
-	(*Ball)(nil),         // 3: Ball
+	(Detection_Class)(0),      // 0: Detection_Class
+	(Ball_Possession)(0),      // 1: Ball_Possession
+	(Camera_Process_State)(0), // 2: Camera_Process_State
+	(Command_Ack_Status)(0),   // 3: Command_Ack_Status
+	(*PiToMw)(nil),            // 4: PiToMw
+	(*Camera_Detection)(nil),  // 5: Camera_Detection
+	(*Robot_Status)(nil),      // 6: Robot_Status
+	(*Ball_Status)(nil),       // 7: Ball_Status
+	(*Ball_Track)(nil),        // 8: Ball_Track
+	(*Ball)(nil),              // 9: Ball
+	(*Robot_Fault)(nil),       // 10: Robot_Fault
+	(*Robot_Diagnostics)(nil), // 11: Robot_Diagnostics
+	(*Command_Ack)(nil),       // 12: Command_Ack
 }
 var file_pi_to_mw_proto_depIdxs = []int32{
-	1, // 0: PiToMw.robots_status:type_name -> Robot_Status
-	2, // 1: PiToMw.ball_status:type_name -> Ball_Status
-	3, // 2: PiToMw.ball:type_name -> Ball
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	6,  // 0: PiToMw.robots_status:type_name -> Robot_Status
+	7,  // 1: PiToMw.ball_status:type_name -> Ball_Status
+	9,  // 2: PiToMw.ball:type_name -> Ball
+	11, // 3: PiToMw.diagnostics:type_name -> Robot_Diagnostics
+	12, // 4: PiToMw.command_acks:type_name -> Command_Ack
+	5,  // 5: PiToMw.detections:type_name -> Camera_Detection
+	0,  // 6: Camera_Detection.class:type_name -> Detection_Class
+	8,  // 7: Ball_Status.track:type_name -> Ball_Track
+	1,  // 8: Ball_Status.possession:type_name -> Ball_Possession
+	2,  // 9: Robot_Diagnostics.camera_state:type_name -> Camera_Process_State
+	10, // 10: Robot_Diagnostics.faults:type_name -> Robot_Fault
+	3,  // 11: Command_Ack.status:type_name -> Command_Ack_Status
+	12, // [12:12] is the sub-list for method output_type
+	12, // [12:12] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_pi_to_mw_proto_init() }
@@ -421,13 +1370,14 @@ func file_pi_to_mw_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pi_to_mw_proto_rawDesc), len(file_pi_to_mw_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   4,
+			NumEnums:      4,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_pi_to_mw_proto_goTypes,
 		DependencyIndexes: file_pi_to_mw_proto_depIdxs,
+		EnumInfos:         file_pi_to_mw_proto_enumTypes,
 		MessageInfos:      file_pi_to_mw_proto_msgTypes,
 	}.Build()
 	File_pi_to_mw_proto = out.File
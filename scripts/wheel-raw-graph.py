@@ -1,17 +1,26 @@
 #!/usr/bin/env python3
-"""Plot Wheel(raw) from racoon-pi2 -ds log lines or WHEEL_RAW CSV.
+"""Plot Wheel(raw) from the robot's telemetry stream, racoon-pi2 -ds log lines
+or WHEEL_RAW CSV.
 
 Usage:
+  python3 scripts/wheel-raw-graph.py --robot 192.168.100.11 [--rate 50]
   ./racoon-pi2 -ds 2>&1 | python3 scripts/wheel-raw-graph.py
   python3 scripts/wheel-raw-graph.py /path/to/log.txt
 
+--robot subscribes to the wheelRaw channel of GET /telemetry (server-sent
+events on the API port 9191); the robot decimates the link rate to --rate Hz.
+
 Parses lines like:
   [SPI RX] Wheel(raw) FL: 13, BL: -1271, BR: 22, FR: 190
   [Serial RX] Wheel(raw) FL: 13, BL: -1271, BR: 22, FR: 190
 """
 
+import argparse
+import json
 import re
 import sys
+import threading
+import urllib.request
 from collections import deque
 
 try:
@@ -27,6 +36,7 @@ WHEEL_LINE = re.compile(
 CSV_LINE = re.compile(r"^WHEEL_RAW,(-?\d+),(-?\d+),(-?\d+),(-?\d+)")
 
 MAX_POINTS = 600
+API_PORT = 9191
 
 
 def parse_line(line):
@@ -49,9 +59,32 @@ def read_all(path):
     return samples
 
 
+def read_telemetry(robot, rate, push):
+    """Feed wheelRaw samples of the robot's /telemetry stream to push."""
+    host = robot if ":" in robot else "%s:%d" % (robot, API_PORT)
+    url = "http://%s/telemetry/wheelRaw:%g" % (host, rate)
+    event = None
+    with urllib.request.urlopen(url) as res:
+        for raw in res:
+            line = raw.decode("utf-8", errors="replace").rstrip("\r\n")
+            if line.startswith("event: "):
+                event = line[len("event: "):]
+            elif line.startswith("data: ") and event == "wheelRaw":
+                v = json.loads(line[len("data: "):])["v"]
+                push((v["fl"], v["bl"], v["br"], v["fr"]))
+            elif line == "":
+                event = None
+
+
 def main():
-    if len(sys.argv) > 1:
-        samples = read_all(sys.argv[1])
+    parser = argparse.ArgumentParser(description="Plot Wheel(raw)")
+    parser.add_argument("log", nargs="?", help="log or CSV file (default: live from stdin)")
+    parser.add_argument("--robot", help="robot address: subscribe to its telemetry stream")
+    parser.add_argument("--rate", type=float, default=50, help="telemetry rate in Hz (default 50)")
+    args = parser.parse_args()
+
+    if args.log:
+        samples = read_all(args.log)
         if not samples:
             print("No Wheel(raw) lines found.", file=sys.stderr)
             raise SystemExit(1)
@@ -83,29 +116,41 @@ def main():
     ax.set_ylabel("raw")
     ax.set_title("Wheel(raw) live")
 
-    def update(_frame):
-        while True:
-            line = sys.stdin.readline()
-            if not line:
-                return l_fl, l_bl, l_br, l_fr
+    lock = threading.Lock()
+
+    def push(row):
+        with lock:
+            fl.append(row[0])
+            bl.append(row[1])
+            br.append(row[2])
+            fr.append(row[3])
+
+    def read_stdin():
+        for line in sys.stdin:
             row = parse_line(line)
             if row:
-                fl.append(row[0])
-                bl.append(row[1])
-                br.append(row[2])
-                fr.append(row[3])
-                break
-        xs = list(range(len(fl)))
-        l_fl.set_data(xs, list(fl))
-        l_bl.set_data(xs, list(bl))
-        l_br.set_data(xs, list(br))
-        l_fr.set_data(xs, list(fr))
+                push(row)
+
+    def update(_frame):
+        with lock:
+            xs = list(range(len(fl)))
+            l_fl.set_data(xs, list(fl))
+            l_bl.set_data(xs, list(bl))
+            l_br.set_data(xs, list(br))
+            l_fr.set_data(xs, list(fr))
         ax.relim()
         ax.autoscale_view()
         return l_fl, l_bl, l_br, l_fr
 
-    print("Reading Wheel(raw) from stdin… (pipe ./racoon-pi2 -ds output here)", file=sys.stderr)
-    FuncAnimation(fig, update, interval=100, cache_frame_data=False)
+    if args.robot:
+        print("Subscribing to Wheel(raw) telemetry of %s…" % args.robot, file=sys.stderr)
+        reader = threading.Thread(target=read_telemetry, args=(args.robot, args.rate, push), daemon=True)
+    else:
+        print("Reading Wheel(raw) from stdin… (pipe ./racoon-pi2 -ds output here)", file=sys.stderr)
+        reader = threading.Thread(target=read_stdin, daemon=True)
+    reader.start()
+    # Keep a reference: an unreferenced animation is garbage collected.
+    anim = FuncAnimation(fig, update, interval=100, cache_frame_data=False)
     plt.show()
 
 